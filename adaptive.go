@@ -0,0 +1,142 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"log/slog"
+	"math"
+)
+
+// The default settings used to adjust the rate limit in response to reported successes and failures.
+const (
+	DefaultDecreaseFactor = 0.5
+	DefaultIncreaseStep   = 1.0
+	DefaultRateFloor      = 1.0
+)
+
+// rateControl holds the configured rate limit and the effective rate limit adjusted at runtime.
+type rateControl struct {
+	ceiling   float64
+	effective float64
+	slack     int
+	successes int
+	adaptive  adaptiveConfig
+	// The functions registered by OnRateLimitChange, and the changes not yet provided to them
+	fns     []func(srv Service, old, new int)
+	changes [][2]int
+}
+
+type adaptiveConfig struct {
+	decrease float64
+	increase float64
+	floor    float64
+}
+
+func defaultAdaptiveConfig() adaptiveConfig {
+	return adaptiveConfig{
+		decrease: DefaultDecreaseFactor,
+		increase: DefaultIncreaseStep,
+		floor:    DefaultRateFloor,
+	}
+}
+
+// AdaptiveOption configures how the rate limit is adjusted by ReportSuccess and ReportFailure.
+type AdaptiveOption func(*adaptiveConfig)
+
+// WithDecreaseFactor sets the factor that the effective rate limit is multiplied by for each reported failure.
+func WithDecreaseFactor(factor float64) AdaptiveOption {
+	return func(cfg *adaptiveConfig) {
+		cfg.decrease = factor
+	}
+}
+
+// WithIncreaseStep sets the number of calls per second added to the effective rate limit
+// after a sustained period of reported successes.
+func WithIncreaseStep(step float64) AdaptiveOption {
+	return func(cfg *adaptiveConfig) {
+		cfg.increase = step
+	}
+}
+
+// WithRateFloor sets the minimum number of calls per second that failures can reduce the effective rate limit to.
+func WithRateFloor(floor float64) AdaptiveOption {
+	return func(cfg *adaptiveConfig) {
+		cfg.floor = floor
+	}
+}
+
+// SetAdaptiveRateLimit configures how the effective rate limit is adjusted by ReportSuccess and ReportFailure.
+func (bas *BaseService) SetAdaptiveRateLimit(opts ...AdaptiveOption) {
+	cfg := defaultAdaptiveConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	bas.rlock.Lock()
+	defer bas.rlock.Unlock()
+
+	bas.rctl.adaptive = cfg
+}
+
+// ReportSuccess informs the service that a call made under the rate limit succeeded. Once a second's
+// worth of calls has succeeded, the effective rate limit is increased toward the configured rate limit.
+func (bas *BaseService) ReportSuccess() {
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	rc := &bas.rctl
+	if rc.ceiling == 0 || rc.effective >= rc.ceiling {
+		return
+	}
+
+	rc.successes++
+	if float64(rc.successes) < rc.effective {
+		return
+	}
+
+	rc.successes = 0
+	rc.effective = math.Min(rc.ceiling, rc.effective+rc.adaptive.increase)
+	bas.adjustLimiter()
+}
+
+// ReportFailure informs the service that a call made under the rate limit failed, for example due to
+// the upstream responding with HTTP 429, and multiplicatively decreases the effective rate limit.
+func (bas *BaseService) ReportFailure() {
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	rc := &bas.rctl
+	if rc.ceiling == 0 {
+		return
+	}
+
+	floor := math.Min(rc.adaptive.floor, rc.ceiling)
+	rc.successes = 0
+	rc.effective = math.Max(floor, rc.effective*rc.adaptive.decrease)
+	bas.adjustLimiter()
+}
+
+// EffectiveRateLimit returns the number of calls per second currently permitted by the service,
+// which includes the adjustments made by ReportSuccess and ReportFailure. Zero means no rate limit
+// or a Limiter provided by SetRateLimiter.
+func (bas *BaseService) EffectiveRateLimit() float64 {
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	bas.checkSchedule()
+	bas.checkRamp()
+	return bas.rctl.effective
+}
+
+// adjustLimiter applies the effective rate limit, keeping the state of the default limiter.
+func (bas *BaseService) adjustLimiter() {
+	bas.log(slog.LevelDebug, "effective rate limit adjusted", nil, slog.Float64("rate", bas.rctl.effective))
+
+	if p, ok := bas.rlimit.(*pacer); ok {
+		p.setRate(bas.rctl.effective)
+		return
+	}
+	bas.rlimit = bas.newLimiter(bas.rctl.effective, bas.rctl.slack)
+}
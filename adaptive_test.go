@@ -0,0 +1,82 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveRateLimit(t *testing.T) {
+	srv := newTestService()
+	srv.SetRateLimit(100)
+	srv.SetAdaptiveRateLimit(WithDecreaseFactor(0.5), WithIncreaseStep(10), WithRateFloor(5))
+
+	if r := srv.EffectiveRateLimit(); r != 100 {
+		t.Errorf("Expected the effective rate limit to start at 100, received %f", r)
+	}
+
+	// Simulate a burst of failures
+	for i := 0; i < 10; i++ {
+		srv.ReportFailure()
+	}
+	if r := srv.EffectiveRateLimit(); r != 5 {
+		t.Errorf("Expected the effective rate limit to stop at the floor of 5, received %f", r)
+	}
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		srv.CheckRateLimit()
+	}
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("The reduced rate limit was not enforced, three calls took %v", elapsed)
+	}
+
+	prev := srv.EffectiveRateLimit()
+	for i := 0; i < 1000 && srv.EffectiveRateLimit() < 100; i++ {
+		srv.ReportSuccess()
+		if r := srv.EffectiveRateLimit(); r < prev {
+			t.Fatalf("The effective rate limit decreased from %f to %f after a success", prev, r)
+		}
+		prev = srv.EffectiveRateLimit()
+	}
+	if r := srv.EffectiveRateLimit(); r != 100 {
+		t.Errorf("Expected the effective rate limit to recover to 100, received %f", r)
+	}
+
+	srv.ReportSuccess()
+	if r := srv.EffectiveRateLimit(); r != 100 {
+		t.Errorf("The effective rate limit exceeded the configured rate limit: %f", r)
+	}
+}
+
+func TestAdaptiveRateLimitDefaults(t *testing.T) {
+	srv := newTestService()
+
+	srv.ReportFailure()
+	if r := srv.EffectiveRateLimit(); r != 0 {
+		t.Errorf("A failure reduced the rate limit of a service without one: %f", r)
+	}
+
+	srv.SetRateLimit(8)
+	srv.ReportFailure()
+	if r := srv.EffectiveRateLimit(); r != 4 {
+		t.Errorf("Expected the default decrease factor to halve the rate limit, received %f", r)
+	}
+	for i := 0; i < 4; i++ {
+		srv.ReportSuccess()
+	}
+	if r := srv.EffectiveRateLimit(); r != 5 {
+		t.Errorf("Expected the default increase step to add one call per second, received %f", r)
+	}
+
+	srv.SetRateLimit(8)
+	if r := srv.EffectiveRateLimit(); r != 8 {
+		t.Errorf("Setting the rate limit did not reset the effective rate limit: %f", r)
+	}
+}
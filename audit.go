@@ -0,0 +1,135 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditEntry describes a request processed by the Run method, as kept by the buffer set with
+// SetAuditBuffer. The payloads are the strings returned by the redaction function.
+type AuditEntry struct {
+	// The ID of the message, when the request was a *Message with an ID
+	ID       string    `json:"id,omitempty"`
+	Input    string    `json:"input"`
+	Output   string    `json:"output,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Received time.Time `json:"received"`
+	Finished time.Time `json:"finished"`
+}
+
+// auditBuffer is a ring of the most recent requests processed by the service.
+type auditBuffer struct {
+	sync.Mutex
+	// The size is read without the lock, so the requests are not slowed when the buffer is disabled
+	size    atomic.Int64
+	entries []AuditEntry
+	// The position of the oldest entry once the ring is full
+	next   int
+	redact func(payload interface{}) string
+}
+
+// SetAuditBuffer sets the number of recent requests kept by the service for debugging, with their
+// results or errors and the times they were received and finished. The entries are returned by
+// DumpAudit, and kept across restarts. The payloads are stored as the strings returned by the
+// function set with SetAuditRedactor, or formatted with fmt.Sprint by default. Changing the size
+// discards the entries kept, and a size that is not positive disables the buffer.
+func (bas *BaseService) SetAuditBuffer(n int) {
+	a := &bas.audit
+	a.Lock()
+	defer a.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	a.size.Store(int64(n))
+	a.entries = nil
+	a.next = 0
+}
+
+// SetAuditRedactor sets the function converting the payloads kept by the audit buffer to strings,
+// so secrets can be removed before they are kept in memory. A nil function restores the default.
+func (bas *BaseService) SetAuditRedactor(fn func(payload interface{}) string) {
+	a := &bas.audit
+	a.Lock()
+	defer a.Unlock()
+
+	a.redact = fn
+}
+
+// DumpAudit returns the entries kept by the buffer set with SetAuditBuffer, oldest first.
+func (bas *BaseService) DumpAudit() []AuditEntry {
+	a := &bas.audit
+	a.Lock()
+	defer a.Unlock()
+
+	entries := make([]AuditEntry, 0, len(a.entries))
+	entries = append(entries, a.entries[a.next:]...)
+	return append(entries, a.entries[:a.next]...)
+}
+
+// auditRecord is the entry of a request being processed, which is nil when the buffer is disabled.
+type auditRecord struct {
+	bas   *BaseService
+	entry AuditEntry
+}
+
+// startAudit starts the entry of the request when the audit buffer is enabled.
+func (bas *BaseService) startAudit(req interface{}) *auditRecord {
+	if bas.audit.size.Load() == 0 {
+		return nil
+	}
+
+	r := &auditRecord{bas: bas}
+	r.entry.Received = bas.clock.Now()
+	if msg, ok := req.(*Message); ok {
+		r.entry.ID = msg.ID
+	}
+	r.entry.Input = bas.redact(Unwrap(req))
+	return r
+}
+
+// finish completes the entry with the result or the error, and keeps it in the ring.
+func (r *auditRecord) finish(result interface{}, err error) {
+	if r == nil {
+		return
+	}
+
+	bas := r.bas
+	r.entry.Finished = bas.clock.Now()
+	if err != nil {
+		r.entry.Error = err.Error()
+	} else if result != nil {
+		r.entry.Output = bas.redact(Unwrap(result))
+	}
+
+	a := &bas.audit
+	a.Lock()
+	defer a.Unlock()
+
+	size := int(a.size.Load())
+	switch {
+	case size == 0:
+	case len(a.entries) < size:
+		a.entries = append(a.entries, r.entry)
+	default:
+		a.entries[a.next] = r.entry
+		a.next = (a.next + 1) % size
+	}
+}
+
+func (bas *BaseService) redact(payload interface{}) string {
+	bas.audit.Lock()
+	fn := bas.audit.redact
+	bas.audit.Unlock()
+
+	if fn == nil {
+		return fmt.Sprint(payload)
+	}
+	return fn(payload)
+}
@@ -0,0 +1,71 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAuditBuffer(t *testing.T) {
+	srv := NewSimpleService("Audit", func(req interface{}) (interface{}, error) {
+		if req == "bad" {
+			return nil, errors.New("rejected")
+		}
+		return strings.ToUpper(req.(string)), nil
+	})
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	// The buffer is disabled by default
+	srv.Input() <- "a"
+	<-srv.Output()
+	if entries := srv.DumpAudit(); len(entries) != 0 {
+		t.Errorf("Expected no entries while the buffer is disabled, received %d", len(entries))
+	}
+
+	srv.SetAuditBuffer(2)
+	for _, req := range []string{"b", "c", "bad"} {
+		srv.Input() <- req
+	}
+	<-srv.Output()
+	<-srv.Output()
+	<-srv.Errors()
+
+	entries := srv.DumpAudit()
+	if len(entries) != 2 {
+		t.Fatalf("Expected the 2 most recent entries, received %d", len(entries))
+	}
+	if e := entries[0]; e.Input != "c" || e.Output != "C" || e.Error != "" || e.Finished.Before(e.Received) {
+		t.Errorf("Expected the entry of c, received %+v", e)
+	}
+	if e := entries[1]; e.Input != "bad" || e.Output != "" || e.Error != "rejected" {
+		t.Errorf("Expected the entry of the failed request, received %+v", e)
+	}
+}
+
+func TestAuditRedactor(t *testing.T) {
+	srv := newEchoService("Redacted")
+	srv.SetAuditBuffer(5)
+	srv.SetAuditRedactor(func(payload interface{}) string {
+		return "<redacted>"
+	})
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	msg := NewMessage("secret")
+	msg.ID = "42"
+	srv.Input() <- msg
+	<-srv.Output()
+
+	entries := srv.DumpAudit()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, received %d", len(entries))
+	}
+	if e := entries[0]; e.ID != "42" || e.Input != "<redacted>" || e.Output != "<redacted>" {
+		t.Errorf("Expected the payloads to be redacted, received %+v", e)
+	}
+}
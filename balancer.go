@@ -0,0 +1,224 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// Strategy selects the member of a Balancer that receives a message.
+type Strategy interface {
+	// Pick returns the index of the member receiving the message. The members are never empty,
+	// and only contain the services that have not stopped.
+	Pick(msg interface{}, members []Service) int
+}
+
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+// RoundRobin returns a Strategy that sends the messages to each member in turn.
+func RoundRobin() Strategy {
+	return new(roundRobin)
+}
+
+func (rr *roundRobin) Pick(_ interface{}, members []Service) int {
+	return int((rr.next.Add(1) - 1) % uint64(len(members)))
+}
+
+type leastBacklog struct{}
+
+// The services that report the number of requests queued, such as those embedding BaseService
+type backlogger interface {
+	InputLen() int
+}
+
+// LeastBacklog returns a Strategy that sends each message to the member with the fewest requests
+// queued on its Input channel. Members that do not provide InputLen are considered empty.
+func LeastBacklog() Strategy {
+	return leastBacklog{}
+}
+
+func (leastBacklog) Pick(_ interface{}, members []Service) int {
+	best, fewest := 0, -1
+	for i, srv := range members {
+		var n int
+		if b, ok := srv.(backlogger); ok {
+			n = b.InputLen()
+		}
+		if fewest < 0 || n < fewest {
+			best, fewest = i, n
+		}
+	}
+	return best
+}
+
+type hashByKey struct {
+	key func(msg interface{}) string
+}
+
+// HashByKey returns a Strategy that sends the messages with the same key to the same member,
+// as long as the members do not change.
+func HashByKey(key func(msg interface{}) string) Strategy {
+	return hashByKey{key: key}
+}
+
+func (h hashByKey) Pick(msg interface{}, members []Service) int {
+	f := fnv.New32a()
+	_, _ = f.Write([]byte(h.key(msg)))
+	return int(f.Sum32() % uint32(len(members)))
+}
+
+// MemberPolicy determines what a Balancer does with a member that has stopped.
+type MemberPolicy int
+
+// The policies for the members that have stopped.
+const (
+	// MemberSkip leaves the member in the Balancer, so it receives messages again once restarted.
+	MemberSkip MemberPolicy = iota
+	// MemberRemove removes the member from the Balancer.
+	MemberRemove
+	// MemberRestart restarts the member, and removes it when the restart fails.
+	MemberRestart
+)
+
+// The services that can be restarted, such as those embedding BaseService
+type restarter interface {
+	Restart() error
+}
+
+// Balancer is a service that spreads the requests on its Input channel across its members, which
+// are typically identical instances of a service. The results of the members are merged on the
+// Output channel of the Balancer. The members are started and stopped by their owners.
+type Balancer struct {
+	BaseService
+	mu       sync.Mutex
+	strategy Strategy
+	members  []Service
+	policy   MemberPolicy
+	merge    *FanIn
+}
+
+// NewBalancer returns a Balancer that selects the members using the strategy.
+func NewBalancer(name string, strategy Strategy, members ...Service) *Balancer {
+	b := &Balancer{
+		strategy: strategy,
+		members:  members,
+		merge:    NewFanIn(name+" results", members...),
+	}
+	// The members can be restarted or added after they have all stopped
+	b.merge.persistent = true
+
+	b.Init(b, name)
+	return b
+}
+
+// SetMemberPolicy sets what the Balancer does with the members found to have stopped.
+// The default policy is MemberSkip.
+func (b *Balancer) SetMemberPolicy(policy MemberPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.policy = policy
+}
+
+// Members returns the services the requests are spread across.
+func (b *Balancer) Members() []Service {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]Service(nil), b.members...)
+}
+
+// AddMember adds the service to the members, and merges its results on the Output channel.
+func (b *Balancer) AddMember(srv Service) {
+	b.mu.Lock()
+	b.members = append(b.members, srv)
+	b.mu.Unlock()
+
+	b.merge.AddSource(srv)
+}
+
+// RemoveMember stops sending requests to the service.
+func (b *Balancer) RemoveMember(srv Service) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, m := range b.members {
+		if m == srv {
+			b.members = append(b.members[:i], b.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// OnStart implements the Service interface.
+func (b *Balancer) OnStart() error {
+	start := b.merge.Start
+	if b.merge.State() != StateNew {
+		start = b.merge.Restart
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	return b.RunContext(b.dispatch)
+}
+
+// OnStop implements the Service interface.
+func (b *Balancer) OnStop() error {
+	if err := b.merge.Stop(); err != nil && !errors.Is(err, ErrAlreadyStopped) {
+		return err
+	}
+	return nil
+}
+
+// Output implements the Service interface.
+func (b *Balancer) Output() chan interface{} {
+	return b.merge.Output()
+}
+
+func (b *Balancer) dispatch(ctx context.Context, req interface{}) (interface{}, error) {
+	alive := b.alive()
+	if len(alive) == 0 {
+		return nil, fmt.Errorf("%s: %w", b.name, ErrNoMembers)
+	}
+	return nil, sendTo(ctx, alive[b.strategy.Pick(req, alive)], req)
+}
+
+// alive returns the members that have not stopped, after applying the member policy to the others.
+func (b *Balancer) alive() []Service {
+	b.mu.Lock()
+	members := append([]Service(nil), b.members...)
+	policy := b.policy
+	b.mu.Unlock()
+
+	var alive []Service
+	for _, srv := range members {
+		select {
+		case <-srv.Done():
+		default:
+			alive = append(alive, srv)
+			continue
+		}
+
+		switch policy {
+		case MemberRemove:
+			b.RemoveMember(srv)
+		case MemberRestart:
+			if r, ok := srv.(restarter); ok && r.Restart() == nil {
+				b.merge.follow(srv)
+				alive = append(alive, srv)
+			} else {
+				b.RemoveMember(srv)
+			}
+		}
+	}
+	return alive
+}
@@ -0,0 +1,151 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newMembers(t *testing.T, n int) ([]Service, []*SimpleService) {
+	var members []Service
+	var srvs []*SimpleService
+
+	for i := 0; i < n; i++ {
+		srv := newEchoService(fmt.Sprintf("member%d", i))
+		_ = srv.Start()
+		t.Cleanup(func() { _ = srv.Stop() })
+
+		members = append(members, srv)
+		srvs = append(srvs, srv)
+	}
+	return members, srvs
+}
+
+func sendAndCollect(t *testing.T, b *Balancer, msgs ...interface{}) {
+	for _, msg := range msgs {
+		if err := b.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for range msgs {
+		if _, err := b.Receive(ctx); err != nil {
+			t.Fatalf("The results were not merged on the Output channel: %v", err)
+		}
+	}
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	members, srvs := newMembers(t, 3)
+
+	b := NewBalancer("Balancer", RoundRobin(), members...)
+	_ = b.Start()
+	defer func() { _ = b.Stop() }()
+
+	var msgs []interface{}
+	for i := 0; i < 30; i++ {
+		msgs = append(msgs, i)
+	}
+	sendAndCollect(t, b, msgs...)
+
+	for _, srv := range srvs {
+		if n := srv.Stats().Received; n != 10 {
+			t.Errorf("Expected %s to receive 10 requests and counted %d", srv, n)
+		}
+	}
+}
+
+func TestBalancerLeastBacklog(t *testing.T) {
+	busy := newEchoService("busy", WithInputBuffer(5))
+	// The busy member is not started, so its backlog grows
+	idle := newEchoService("idle")
+	_ = idle.Start()
+	defer func() { _ = idle.Stop() }()
+	_ = busy.Send(context.Background(), "queued")
+
+	b := NewBalancer("Balancer", LeastBacklog(), busy, idle)
+	_ = b.Start()
+	defer func() { _ = b.Stop() }()
+
+	sendAndCollect(t, b, 1, 2, 3)
+	if n := idle.Stats().Received; n != 3 {
+		t.Errorf("Expected the member without a backlog to receive 3 requests and counted %d", n)
+	}
+}
+
+func TestBalancerHashByKey(t *testing.T) {
+	members, srvs := newMembers(t, 4)
+
+	b := NewBalancer("Balancer", HashByKey(func(msg interface{}) string {
+		return fmt.Sprint(msg.(int) % 2)
+	}), members...)
+	_ = b.Start()
+	defer func() { _ = b.Stop() }()
+
+	sendAndCollect(t, b, 0, 2, 4, 6, 8)
+
+	var receiving int
+	for _, srv := range srvs {
+		if srv.Stats().Received > 0 {
+			receiving++
+		}
+	}
+	if receiving != 1 {
+		t.Errorf("Expected the messages with the same key to reach a single member, %d received them", receiving)
+	}
+}
+
+func TestBalancerFailover(t *testing.T) {
+	members, srvs := newMembers(t, 2)
+
+	b := NewBalancer("Balancer", RoundRobin(), members...)
+	_ = b.Start()
+	defer func() { _ = b.Stop() }()
+
+	_ = srvs[0].Stop()
+	sendAndCollect(t, b, 1, 2, 3, 4)
+	if n := srvs[1].Stats().Received; n != 4 {
+		t.Errorf("Expected the remaining member to receive 4 requests and counted %d", n)
+	}
+
+	_ = srvs[1].Stop()
+	_ = b.Send(context.Background(), 5)
+	select {
+	case err := <-b.Errors():
+		if !errors.Is(err, ErrNoMembers) {
+			t.Errorf("Expected ErrNoMembers and received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The request without members was not reported")
+	}
+}
+
+func TestBalancerMemberPolicy(t *testing.T) {
+	members, srvs := newMembers(t, 2)
+
+	b := NewBalancer("Balancer", RoundRobin(), members...)
+	b.SetMemberPolicy(MemberRemove)
+	_ = b.Start()
+	defer func() { _ = b.Stop() }()
+
+	_ = srvs[0].Stop()
+	sendAndCollect(t, b, 1)
+	if n := len(b.Members()); n != 1 {
+		t.Errorf("Expected the stopped member to be removed, %d members remain", n)
+	}
+
+	b.SetMemberPolicy(MemberRestart)
+	_ = srvs[1].Stop()
+	sendAndCollect(t, b, 2)
+	if s := srvs[1].State(); s != StateRunning {
+		t.Errorf("Expected the stopped member to be restarted, the state is %v", s)
+	}
+}
@@ -5,34 +5,133 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"log/slog"
 	"sync"
-
-	"go.uber.org/ratelimit"
+	"sync/atomic"
+	"time"
 )
 
 // BaseService provides common mechanisms to all services implementing the Service interface.
+// It is embedded by the specific service and initialized in place using the Init method:
+//
+//	type MyService struct {
+//		service.BaseService
+//	}
+//
+//	srv := new(MyService)
+//	srv.Init(srv, "MyService")
 type BaseService struct {
 	sync.Mutex
-	name   string
-	runs   bool
-	done   chan struct{}
-	input  chan interface{}
-	output chan interface{}
-	rlock  sync.Mutex
-	rlimit ratelimit.Limiter
+	name     string
+	state    atomic.Int32
+	ctx      atomic.Pointer[context.Context]
+	cancel   context.CancelFunc
+	input    chan interface{}
+	output   chan interface{}
+	rlock    sync.Mutex
+	rlimit   Limiter
+	rview    atomic.Pointer[rateView]
+	blimit   Limiter
+	rctl     rateControl
+	sched    rateSchedule
+	ramp     rateRamp
+	keyed    keyLimiters
+	slots    slots
+	workers  int
+	bcast    broadcaster
+	drain    drainState
+	late     lateDrain
+	ready    readiness
+	reports  errorReports
+	stats    statCounters
+	tracer   Tracer
+	logger   *slog.Logger
+	beats    heartbeat
+	pause    pauseState
+	idle     idleState
+	retry    *retryConfig
+	breaker  *breaker
+	dead     deadLetters
+	batch    batchState
+	prio     priorityQueue
+	requeues requeueList
+	cancels  cancelIndex
+	overflow OverflowPolicy
+	ttl      atomic.Int64
+	// Loaded for each request without taking the lock
+	dedup    atomic.Pointer[dedupWindow]
+	dedupMax int
+	codec    Codec
+	replay   replayBuffer
+	// The middleware applied around the handler for each request
+	middleware middlewareChain
+	// The time permitted for the handler to process each request
+	reqTimeout time.Duration
+	// The ratio of errors to received requests above which the service is unhealthy
+	errThreshold float64
+	// The share of time spent waiting on the rate limit watched by SetRateLimitAlert
+	waitAlert waitWindow
+	// The water marks of the Input backlog set by SetHighWaterMark
+	marks waterMarks
+	// The recent requests kept by the buffer set with SetAuditBuffer
+	audit auditBuffer
+	// The detection of slow requests set by SetSlowThreshold
+	slow atomic.Pointer[slowConfig]
+	// Receives the errors returned by handlers executed by the Run method
+	errHandler func(req interface{}, err error)
+	// Functions executed by each start with the context of the new run
+	hooks []func(ctx context.Context)
+	// Functions called after each change of the service state
+	stateFns []func(srv Service, old, new State)
+	// The reason logged by the next stop, when it was not requested by Stop
+	stopReason string
+	// The cause of the last stop, returned by Err
+	exitErr error
+	// Serializes the Start, Stop and Restart transitions
+	lifecycle sync.Mutex
+	// Provides the time to the rate limiter, timers and TTL checks
+	clock Clock
 	// The specific service embedding BaseService
 	service Service
 }
 
-// NewBaseService returns an initialized BaseService object.
-func NewBaseService(srv Service, name string) *BaseService {
-	return &BaseService{
-		name:    name,
-		done:    make(chan struct{}),
-		input:   make(chan interface{}),
-		output:  make(chan interface{}, 10),
-		service: srv,
+// NewBaseService returns an initialized BaseService object. It is intended for services that embed
+// a *BaseService, since copying the returned value also copies the mutexes it contains. Services
+// embedding BaseService by value should call Init on the embedded field instead.
+func NewBaseService(srv Service, name string, opts ...Option) *BaseService {
+	bas := new(BaseService)
+
+	bas.Init(srv, name, opts...)
+	return bas
+}
+
+// Init initializes the BaseService in place for the provided service embedding it.
+// It must be called before the service is used.
+func (bas *BaseService) Init(srv Service, name string, opts ...Option) {
+	bas.name = name
+	bas.newContext()
+	bas.input = make(chan interface{})
+	bas.output = make(chan interface{}, 10)
+	bas.service = srv
+	bas.clock = realClock{}
+	bas.openReports()
+	bas.rctl.adaptive = defaultAdaptiveConfig()
+	bas.errThreshold = DefaultErrorRateThreshold
+	bas.pause.paused = make(chan struct{})
+	bas.idle.changed = make(chan struct{}, 1)
+	bas.prio.queued = make(chan struct{}, 1)
+	bas.prio.takes = make(chan chan []interface{})
+	bas.requeues.changed = make(chan struct{}, 1)
+	bas.requeues.limit = DefaultMaxAttempts
+	bas.ready.ch = make(chan struct{})
+
+	for _, opt := range opts {
+		opt(bas)
+	}
+	if bas.dead.ch == nil {
+		bas.dead.ch = make(chan DeadLetter, DefaultDeadLetterBuffer)
 	}
 }
 
@@ -43,58 +142,204 @@ func (bas *BaseService) Description() string {
 
 // Start implements the Service interface.
 func (bas *BaseService) Start() error {
-	if bas.running() {
-		return errors.New(bas.name + " has already been started")
-	}
+	bas.lifecycle.Lock()
+	defer bas.lifecycle.Unlock()
 
-	bas.setRunning(true)
-	return bas.service.OnStart()
+	switch bas.State() {
+	case StateNew:
+	case StateFailed:
+		// The run that failed to start was rolled back, so the service is started with a new context
+		bas.Lock()
+		bas.newContext()
+		bas.Unlock()
+	case StateStopped:
+		// A stopped service is started again using Restart
+		return fmt.Errorf("%s: %w", bas.name, ErrAlreadyStopped)
+	default:
+		return fmt.Errorf("%s: %w", bas.name, ErrAlreadyStarted)
+	}
+	return bas.start()
 }
 
-// OnStart implements the Service interface.
-func (bas *BaseService) OnStart() error {
+func (bas *BaseService) start() error {
+	bas.stopLateDrain()
+	bas.resetReady(nil)
+	bas.setState(StateStarting)
+
+	bas.Lock()
+	ctx := *bas.ctx.Load()
+	hooks := bas.hooks
+	bas.exitErr = nil
+	bas.Unlock()
+
+	for _, hook := range hooks {
+		hook(ctx)
+	}
+	bas.resetDrain()
+	bas.setPaused(false)
+	bas.idle.lastInput.Store(bas.clock.Now().UnixNano())
+	// The run is compared with the context of the service, so the context without the labels is provided
+	bas.RunLabeled(ctx, "idle", func(context.Context) { bas.watchIdle(ctx) })
+	bas.RunLabeled(ctx, "priority", bas.feedPriority)
+	bas.RunLabeled(ctx, "requeue", bas.feedRequeues)
+	bas.openReports()
+	bas.stats.startedAt.Store(bas.clock.Now().UnixNano())
+	bas.restartRamp()
+	bas.startBroadcast(ctx)
+	if err := bas.service.OnStart(); err != nil {
+		bas.resetReady(err)
+		bas.rollback(err)
+		bas.setState(StateFailed)
+		bas.log(slog.LevelError, "service failed to start", err)
+		return err
+	}
+
+	bas.setState(StateRunning)
+	bas.log(slog.LevelInfo, "service started", nil)
 	return nil
 }
 
-func (bas *BaseService) running() bool {
+// rollback releases the run of the service when OnStart fails, so the Done channel is closed and
+// the service can be started again.
+func (bas *BaseService) rollback(err error) {
 	bas.Lock()
-	defer bas.Unlock()
+	bas.exitErr = err
+	bas.cancel()
+	bas.Unlock()
 
-	return bas.runs
+	bas.closeReports()
+	bas.clearQueued()
+	bas.stats.startedAt.Store(0)
 }
 
-func (bas *BaseService) setRunning(val bool) {
+// addStartHook registers a function that is executed before OnStart each time the service starts.
+// The context provided to the hook is canceled when that run of the service is stopped.
+func (bas *BaseService) addStartHook(hook func(ctx context.Context)) {
 	bas.Lock()
 	defer bas.Unlock()
 
-	bas.runs = val
+	bas.hooks = append(bas.hooks, hook)
+}
+
+// OnStart implements the Service interface.
+func (bas *BaseService) OnStart() error {
+	return nil
 }
 
 // Stop implements the Service interface.
 func (bas *BaseService) Stop() error {
-	if !bas.running() {
-		return errors.New(bas.name + " is already stopped")
+	return bas.StopWithError(nil)
+}
+
+// StopWithError stops the service like Stop, and records the error as the cause of the stop, which
+// is returned by Err once the Done channel is closed. Services call it when they cannot continue
+// because of a fatal error. The error is not recorded when the service is not running. Like Stop,
+// it waits for OnStop, so it must not be called by a goroutine that OnStop waits for.
+func (bas *BaseService) StopWithError(cause error) error {
+	if bas.State() == StateStarting {
+		// The start in progress observes the stop through the context of the service, and OnStop
+		// is called once OnStart has returned
+		bas.Lock()
+		bas.cancel()
+		bas.Unlock()
 	}
 
-	close(bas.done)
+	bas.lifecycle.Lock()
+	defer bas.lifecycle.Unlock()
+
+	if cause != nil && bas.running() {
+		bas.Lock()
+		bas.exitErr = cause
+		bas.Unlock()
+	}
+	return bas.stop()
+}
+
+// Err returns nil while the service is running, and the cause of the last stop once the Done
+// channel is closed, mirroring the Err method of a context. The cause is the error provided to
+// StopWithError, or the error returned by OnStart when the service failed to start. When neither
+// is present, the error returned by OnStop is recorded once Stop returns. It is nil for a clean stop.
+func (bas *BaseService) Err() error {
+	bas.Lock()
+	defer bas.Unlock()
+
+	return bas.exitErr
+}
+
+func (bas *BaseService) stop() error {
+	switch bas.State() {
+	case StateNew:
+		return fmt.Errorf("%s: %w", bas.name, ErrNotStarted)
+	case StateStopped:
+		return fmt.Errorf("%s: %w", bas.name, ErrAlreadyStopped)
+	case StateFailed:
+		// The run that failed to start was already rolled back
+		bas.setState(StateStopped)
+		bas.log(slog.LevelInfo, "service stopped", nil)
+		return nil
+	}
+	bas.setState(StateStopping)
+	bas.resetReady(nil)
+
+	bas.Lock()
+	bas.cancel()
+	bas.Unlock()
+
+	var wg sync.WaitGroup
 	finished := make(chan struct{})
-	defer close(finished)
 
+	wg.Add(2)
 	drain := func(ch chan interface{}, finished chan struct{}) {
+		defer wg.Done()
+
 		for {
 			select {
-			case <-ch:
+			case msg := <-ch:
+				bas.ReportDeadLetter(msg, DeadLetterCanceled, ErrServiceStopped)
 			case <-finished:
 				return
 			}
 		}
 	}
 
-	go drain(bas.Input(), finished)
-	go drain(bas.Output(), finished)
+	for _, ch := range []chan interface{}{bas.Input(), bas.Output()} {
+		ch := ch
+		bas.RunLabeled(context.Background(), "drain", func(context.Context) { drain(ch, finished) })
+	}
+
+	err := bas.service.OnStop()
+	if err != nil {
+		bas.Lock()
+		if bas.exitErr == nil {
+			bas.exitErr = err
+		}
+		bas.Unlock()
+	}
+	// The drain goroutines must be gone before a restart can use the channels again
+	close(finished)
+	wg.Wait()
+	bas.closeReports()
+	bas.replay.clear()
+	bas.clearQueued()
+	bas.stats.startedAt.Store(0)
+	bas.startLateDrain()
+
+	bas.setState(StateStopped)
+
+	bas.Lock()
+	var attrs []slog.Attr
+	if bas.stopReason != "" {
+		attrs = append(attrs, slog.String("reason", bas.stopReason))
+		bas.stopReason = ""
+	}
+	bas.Unlock()
 
-	defer bas.setRunning(false)
-	return bas.service.OnStop()
+	if err != nil {
+		bas.log(slog.LevelError, "service stopped with an error", err, attrs...)
+	} else {
+		bas.log(slog.LevelInfo, "service stopped", nil, attrs...)
+	}
+	return err
 }
 
 // OnStop implements the Service interface.
@@ -102,9 +347,80 @@ func (bas *BaseService) OnStop() error {
 	return nil
 }
 
+// Restart stops the service when it is running, provides a new Done channel and starts the service again.
+func (bas *BaseService) Restart() error {
+	bas.lifecycle.Lock()
+	defer bas.lifecycle.Unlock()
+
+	if bas.State() == StateNew {
+		return fmt.Errorf("%s: %w", bas.name, ErrNotStarted)
+	}
+
+	if bas.running() {
+		if err := bas.stop(); err != nil {
+			return err
+		}
+	}
+
+	bas.Lock()
+	bas.newContext()
+	bas.Unlock()
+	return bas.start()
+}
+
+// newContext provides the context of the next run of the service. The context is loaded without
+// locking the service, since it is read for each request.
+func (bas *BaseService) newContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	bas.ctx.Store(&ctx)
+	bas.cancel = cancel
+}
+
+// StartContext starts the service and stops it automatically when the provided context is canceled.
+func (bas *BaseService) StartContext(ctx context.Context) error {
+	if err := bas.Start(); err != nil {
+		return err
+	}
+
+	done := bas.Done()
+	go func() {
+		select {
+		case <-ctx.Done():
+			bas.lifecycle.Lock()
+			defer bas.lifecycle.Unlock()
+			// Only stop the service that was started by this call
+			if bas.Done() == done {
+				_ = bas.stop()
+			}
+		case <-done:
+		}
+	}()
+	return nil
+}
+
+// StopContext stops the service, but returns the context error when OnStop does not return before
+// the provided context is done. The OnStop call continues to run in the background in that case.
+func (bas *BaseService) StopContext(ctx context.Context) error {
+	errc := make(chan error, 1)
+	go func() { errc <- bas.Stop() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", bas.name, ctx.Err())
+	}
+}
+
+// Context returns a context that is canceled when the service is stopped.
+func (bas *BaseService) Context() context.Context {
+	return *bas.ctx.Load()
+}
+
 // Done implements the Service interface.
 func (bas *BaseService) Done() <-chan struct{} {
-	return bas.done
+	return bas.Context().Done()
 }
 
 // Input implements the Service interface.
@@ -112,6 +428,11 @@ func (bas *BaseService) Input() chan interface{} {
 	return bas.input
 }
 
+// InputLen returns the number of requests waiting in the Input channel buffer.
+func (bas *BaseService) InputLen() int {
+	return len(bas.input)
+}
+
 // HandlesReq implements the Service interface.
 func (bas *BaseService) HandlesReq(req interface{}) bool {
 	return true
@@ -122,30 +443,12 @@ func (bas *BaseService) Output() chan interface{} {
 	return bas.output
 }
 
+// OutputLen returns the number of results waiting in the Output channel buffer.
+func (bas *BaseService) OutputLen() int {
+	return len(bas.output)
+}
+
 // String implements the Stringer interface.
 func (bas *BaseService) String() string {
 	return bas.name
 }
-
-// SetRateLimit implements the Service interface.
-func (bas *BaseService) SetRateLimit(persec int) {
-	bas.rlock.Lock()
-	defer bas.rlock.Unlock()
-
-	if persec == 0 {
-		bas.rlimit = nil
-		return
-	}
-	bas.rlimit = ratelimit.New(persec, ratelimit.WithoutSlack)
-}
-
-// CheckRateLimit implements the Service interface.
-func (bas *BaseService) CheckRateLimit() {
-	bas.rlock.Lock()
-	rlimit := bas.rlimit
-	bas.rlock.Unlock()
-
-	if rlimit != nil {
-		rlimit.Take()
-	}
-}
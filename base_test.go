@@ -5,6 +5,10 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -21,11 +25,13 @@ func TestStart(t *testing.T) {
 
 	_ = srv.Start()
 	defer func() { _ = srv.Stop() }()
-	time.Sleep(500 * time.Millisecond)
+	if err := srv.WaitStarted(context.Background()); err != nil {
+		t.Fatalf("Expected the service to be ready, received %v", err)
+	}
 
 	select {
 	case srv.Input() <- data:
-	default:
+	case <-time.After(time.Second):
 		t.Errorf("The service did not start when the Start method was executed")
 	}
 }
@@ -49,6 +55,95 @@ func TestStop(t *testing.T) {
 	}
 }
 
+func TestLifecycleErrors(t *testing.T) {
+	srv := newTestService()
+
+	if err := srv.Stop(); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Expected ErrNotStarted when stopping a service that was never started, received %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start the service: %v", err)
+	}
+	if err := srv.Start(); !errors.Is(err, ErrAlreadyStarted) {
+		t.Errorf("Expected ErrAlreadyStarted when starting a running service, received %v", err)
+	} else if !strings.HasPrefix(err.Error(), srv.String()) {
+		t.Errorf("The error was not wrapped with the service name: %v", err)
+	}
+	if err := srv.Stop(); err != nil {
+		t.Errorf("Failed to stop the service: %v", err)
+	}
+	if err := srv.Stop(); !errors.Is(err, ErrAlreadyStopped) {
+		t.Errorf("Expected ErrAlreadyStopped when stopping a stopped service, received %v", err)
+	}
+
+	failing := new(failingService)
+	failing.Init(failing, "Failing")
+	if err := failing.Start(); !errors.Is(err, errStartFailed) {
+		t.Errorf("Expected the OnStart error to be returned unchanged, received %v", err)
+	}
+}
+
+var errStartFailed = errors.New("start failed")
+
+type failingService struct {
+	BaseService
+}
+
+func (srv *failingService) OnStart() error {
+	return errStartFailed
+}
+
+func TestConcurrentStop(t *testing.T) {
+	srv := newTestService()
+	_ = srv.Start()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- srv.Stop()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var success int
+	for err := range errs {
+		if err == nil {
+			success++
+		} else if !errors.Is(err, ErrAlreadyStopped) {
+			t.Errorf("Expected ErrAlreadyStopped from the concurrent Stop calls, received %v", err)
+		}
+	}
+	if success != 1 {
+		t.Errorf("Expected exactly one Stop call to succeed, but %d succeeded", success)
+	}
+}
+
+func TestConcurrentStartStop(t *testing.T) {
+	srv := newTestService()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = srv.Start()
+		}()
+		go func() {
+			defer wg.Done()
+			if err := srv.Stop(); err != nil &&
+				!errors.Is(err, ErrAlreadyStopped) && !errors.Is(err, ErrNotStarted) {
+				t.Errorf("Stop returned an unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	_ = srv.Stop()
+}
+
 func TestRequest(t *testing.T) {
 	srv := newTestService()
 
@@ -63,55 +158,289 @@ func TestRequest(t *testing.T) {
 	}
 }
 
-func TestRateLimit(t *testing.T) {
+func TestRestart(t *testing.T) {
 	srv := newTestService()
-	srv.SetRateLimit(2)
+
+	if err := srv.Restart(); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Expected ErrNotStarted when restarting a service that was never started, received %v", err)
+	}
 
 	_ = srv.Start()
+	first := srv.Done()
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("Failed to restart the running service: %v", err)
+	}
 	defer func() { _ = srv.Stop() }()
 
-	start := time.Now()
-	for _, str := range []string{"1", "2", "3", "4"} {
-		srv.Input() <- str
-		<-srv.Output()
+	select {
+	case <-first:
+	default:
+		t.Errorf("The Done channel from before the restart was not closed")
+	}
+	select {
+	case <-srv.Done():
+		t.Errorf("The Done channel after the restart is not open")
+	default:
 	}
-	finish := time.Now()
 
-	if finish.Sub(start) < time.Second {
-		t.Errorf("The rate limit was not enforced between requests")
+	srv.Input() <- "restarted"
+	if result := <-srv.Output(); result != "restarted" {
+		t.Errorf("Expected restarted to be returned and received %v", result)
 	}
 }
 
-type testService struct {
-	BaseService
-	done chan struct{}
+func TestRestartAfterStop(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	_ = srv.Stop()
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("Failed to restart the stopped service: %v", err)
+	}
+	defer func() { _ = srv.Stop() }()
+
+	select {
+	case <-srv.Done():
+		t.Errorf("The Done channel after the restart is not open")
+	default:
+	}
+
+	srv.Input() <- "restarted"
+	if result := <-srv.Output(); result != "restarted" {
+		t.Errorf("Expected restarted to be returned and received %v", result)
+	}
 }
 
-func newTestService() *testService {
-	srv := &testService{
-		done: make(chan struct{}),
+func TestRestartConcurrentStop(t *testing.T) {
+	srv := newTestService()
+	_ = srv.Start()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = srv.Restart()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = srv.Stop()
+		}()
 	}
+	wg.Wait()
+	_ = srv.Stop()
 
-	srv.BaseService = *NewBaseService(srv, "Test")
-	return srv
+	select {
+	case <-srv.Done():
+	default:
+		t.Errorf("The service was not stopped after the final Stop call")
+	}
 }
 
-func (srv *testService) OnStart() error {
-	go srv.handleRequests()
+func TestStartContext(t *testing.T) {
+	srv := newTestService()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if err := srv.StartContext(ctx); err != nil {
+		t.Fatalf("Failed to start the service: %v", err)
+	}
+	svcctx := srv.Context()
+
+	cancel()
+	select {
+	case <-srv.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("The service was not stopped when the context was canceled")
+	}
+	if svcctx.Err() == nil {
+		t.Errorf("The service context was not canceled when the service stopped")
+	}
+}
+
+func TestStartContextRaceStop(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		srv := newTestService()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		if err := srv.StartContext(ctx); err != nil {
+			t.Fatalf("Failed to start the service: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cancel()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = srv.Stop()
+		}()
+		wg.Wait()
+
+		select {
+		case <-srv.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("The service was not stopped after the cancellation raced with Stop")
+		}
+	}
+}
+
+func TestStartContextAfterRestart(t *testing.T) {
+	srv := newTestService()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	_ = srv.StartContext(ctx)
+	_ = srv.Stop()
+	_ = srv.Restart()
+	defer func() { _ = srv.Stop() }()
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-srv.Done():
+		t.Errorf("The canceled context stopped the service after it was restarted")
+	default:
+	}
+}
+
+func TestStopContext(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+
+	srv := &hungService{hang: hang}
+	srv.Init(srv, "Hung")
+	_ = srv.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := srv.StopContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to be exceeded while OnStop was hung, received %v", err)
+	}
+
+	srv2 := newTestService()
+	_ = srv2.Start()
+	if err := srv2.StopContext(context.Background()); err != nil {
+		t.Errorf("Failed to stop the service: %v", err)
+	}
+}
+
+func TestStopWithError(t *testing.T) {
+	srv := newTestService()
+	_ = srv.Start()
+	if err := srv.Err(); err != nil {
+		t.Errorf("Expected no error while the service is running, received %v", err)
+	}
+	if err := srv.Stop(); err != nil {
+		t.Fatalf("Failed to stop the service: %v", err)
+	}
+	if err := srv.Err(); err != nil {
+		t.Errorf("Expected no error after a clean stop, received %v", err)
+	}
+
+	errFatal := errors.New("fatal")
+	_ = srv.Restart()
+	if err := srv.Err(); err != nil {
+		t.Errorf("Expected the restart to clear the error, received %v", err)
+	}
+	if err := srv.StopWithError(errFatal); err != nil {
+		t.Fatalf("Failed to stop the service: %v", err)
+	}
+	if err := srv.Err(); !errors.Is(err, errFatal) {
+		t.Errorf("Expected the cause of the stop, received %v", err)
+	}
+	if err := srv.StopWithError(errors.New("late")); !errors.Is(err, ErrAlreadyStopped) {
+		t.Errorf("Expected ErrAlreadyStopped, received %v", err)
+	}
+	if err := srv.Err(); !errors.Is(err, errFatal) {
+		t.Errorf("Expected the stopped service to keep the first cause, received %v", err)
+	}
+
+	failing := new(failingService)
+	failing.Init(failing, "Failing")
+	_ = failing.Start()
+	if err := failing.Err(); !errors.Is(err, errStartFailed) {
+		t.Errorf("Expected the OnStart error after the failed start, received %v", err)
+	}
+	_ = failing.Stop()
+}
+
+func TestStopWithErrorConcurrent(t *testing.T) {
+	errFatal := errors.New("fatal")
+
+	for i := 0; i < 20; i++ {
+		srv := newTestService()
+		_ = srv.Start()
+
+		done := make(chan error)
+		go func() {
+			<-srv.Done()
+			done <- srv.Err()
+		}()
+		go func() {
+			for srv.State() != StateStopped {
+				_ = srv.Err()
+			}
+		}()
+
+		_ = srv.StopWithError(errFatal)
+		if err := <-done; !errors.Is(err, errFatal) {
+			t.Fatalf("Expected the cause once the Done channel was closed, received %v", err)
+		}
+	}
+}
+
+func TestEmbeddedPointer(t *testing.T) {
+	srv := new(pointerService)
+	srv.BaseService = NewBaseService(srv, "Pointer")
+
+	_ = srv.Start()
+	if !srv.started {
+		t.Errorf("OnStart was not called on the service embedding a *BaseService")
+	}
+	_ = srv.Stop()
+}
+
+type pointerService struct {
+	*BaseService
+	started bool
+}
+
+func (srv *pointerService) OnStart() error {
+	srv.started = true
 	return nil
 }
 
-func (srv *testService) OnStop() error {
-	close(srv.done)
+type hungService struct {
+	BaseService
+	hang chan struct{}
+}
+
+func (srv *hungService) OnStop() error {
+	<-srv.hang
+	return nil
+}
+
+func newTestService(opts ...Option) *testService {
+	srv := new(testService)
+
+	srv.Init(srv, "Test", opts...)
+	return srv
+}
+
+func (srv *testService) OnStart() error {
+	go srv.handleRequests(srv.Done())
 	return nil
 }
 
-func (srv *testService) handleRequests() {
+func (srv *testService) handleRequests(done <-chan struct{}) {
+	srv.Ready()
 	for {
 		srv.CheckRateLimit()
 
 		select {
-		case <-srv.done:
+		case <-done:
 			return
 		case req := <-srv.Input():
 			srv.Output() <- req
@@ -0,0 +1,258 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultBatchSize is the maximum number of requests in a batch when SetBatching has not been called.
+const DefaultBatchSize = 100
+
+// DefaultBatchDelay is the longest a request waits for its batch when SetBatching has not been called.
+const DefaultBatchDelay = time.Second
+
+// BatchHandler processes a batch of requests received by the service.
+type BatchHandler func(reqs []interface{}) ([]interface{}, error)
+
+type batchState struct {
+	sync.Mutex
+	size  int
+	delay time.Duration
+	// Closed by Flush to make the batches pending be processed
+	flush chan struct{}
+}
+
+// SetBatching sets the thresholds used by the RunBatch method. A batch is processed once it
+// contains maxSize requests, or once the first request in the batch has waited for maxDelay.
+func (bas *BaseService) SetBatching(maxSize int, maxDelay time.Duration) {
+	b := &bas.batch
+	b.Lock()
+	defer b.Unlock()
+
+	b.size = maxSize
+	b.delay = maxDelay
+}
+
+// Flush makes the batches pending in the goroutines started by RunBatch be processed now,
+// without waiting for the size or time thresholds.
+func (bas *BaseService) Flush() {
+	b := &bas.batch
+	b.Lock()
+	defer b.Unlock()
+
+	if b.flush != nil {
+		close(b.flush)
+	}
+	b.flush = make(chan struct{})
+}
+
+func (bas *BaseService) batchConfig() (int, time.Duration, <-chan struct{}) {
+	b := &bas.batch
+	b.Lock()
+	defer b.Unlock()
+
+	if b.flush == nil {
+		b.flush = make(chan struct{})
+	}
+
+	size, delay := b.size, b.delay
+	if size < 1 {
+		size = DefaultBatchSize
+	}
+	if delay <= 0 {
+		delay = DefaultBatchDelay
+	}
+	return size, delay, b.flush
+}
+
+// RunBatch is like Run, but accumulates the requests and executes the handler with a batch once
+// either threshold set by SetBatching is reached, or when Flush is called. The batch pending when
+// the service is stopped or drained is processed before the goroutines exit. The rate limit is
+// checked once for each batch, except the batch processed as the service stops. Results other
+// than nil are sent on the Output channel, unless each request in the batch was sent by the
+// Request method and the handler returned a result for each of them, in the same order. Those
+// requests receive their result as the reply.
+func (bas *BaseService) RunBatch(handler BatchHandler) error {
+	ctx := bas.Context()
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	}
+
+	workers := bas.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	drain := bas.addLoops(workers)
+	for i := 0; i < workers; i++ {
+		bas.RunLabeled(ctx, "batcher", func(ctx context.Context) { bas.batchLoop(ctx, drain, handler) })
+	}
+	bas.Ready()
+	return nil
+}
+
+func (bas *BaseService) batchLoop(ctx context.Context, drain <-chan struct{}, handler BatchHandler) {
+	defer bas.loopExited()
+
+	beats, stop := bas.beatTicker()
+	defer stop()
+
+	var timer Timer
+	defer func() { stopTimer(timer) }()
+
+	var pending []interface{}
+	var expired <-chan time.Time
+	process := func(run context.Context) {
+		if len(pending) > 0 {
+			bas.processBatch(run, handler, pending)
+		}
+		pending = nil
+		stopTimer(timer)
+		expired = nil
+	}
+
+	bas.Beat()
+	for {
+		size, delay, flush := bas.batchConfig()
+		paused, resumed := bas.pauseChans()
+
+		input := bas.input
+		if resumed != nil {
+			input = nil
+			paused = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			// The service is stopping, so the handler is not bound to the run
+			process(context.Background())
+			return
+		case <-drain:
+			for {
+				select {
+				case req := <-bas.input:
+					if bas.skip(req) {
+						continue
+					}
+					bas.MarkBusy()
+					bas.IncReceived()
+					if pending = append(pending, req); len(pending) >= size {
+						process(ctx)
+					}
+				default:
+					if !bas.waitPriority(ctx) {
+						process(ctx)
+						return
+					}
+				}
+			}
+		case <-beats:
+			bas.Beat()
+		case <-paused:
+		case <-resumed:
+		case <-flush:
+			process(ctx)
+		case <-expired:
+			expired = nil
+			process(ctx)
+		case req := <-input:
+			bas.checkBacklog()
+			if bas.skip(req) {
+				continue
+			}
+			bas.MarkBusy()
+			bas.IncReceived()
+			if pending = append(pending, req); len(pending) >= size {
+				process(ctx)
+			} else if len(pending) == 1 {
+				timer = bas.resetTimer(timer, delay)
+				expired = timer.C()
+			}
+		}
+		bas.Beat()
+	}
+}
+
+// processBatch executes the handler for the batch during the run of the context.
+func (bas *BaseService) processBatch(run context.Context, handler BatchHandler, reqs []interface{}) {
+	// The requests were marked busy when they were dequeued
+	defer bas.markIdle(len(reqs))
+
+	// The batch processed as the service stops is not delayed by the rate limit
+	if bas.Context().Err() == nil {
+		if err := bas.CheckRateLimitErr(); err != nil {
+			bas.handleError(reqs, nil, err)
+			return
+		}
+	}
+
+	msgs := make([]*Message, len(reqs))
+	payloads := make([]interface{}, len(reqs))
+	for i, req := range reqs {
+		payloads[i] = req
+		if msg, ok := req.(*Message); ok {
+			msgs[i] = msg
+			payloads[i] = msg.Payload
+		}
+	}
+
+	hctx, cancel := context.WithCancel(run)
+	defer cancel()
+
+	env := &Message{Payload: payloads}
+	res, err := bas.call(hctx, env, func(_ context.Context, req interface{}) (interface{}, error) {
+		return handler(req.([]interface{}))
+	})
+	results, _ := res.([]interface{})
+	if err != nil {
+		bas.handleError(reqs, env, err)
+	}
+
+	aligned := err == nil && len(results) == len(reqs)
+	replied := aligned
+	for i, msg := range msgs {
+		if msg == nil {
+			replied = false
+			continue
+		}
+
+		var result interface{}
+		if aligned {
+			result = results[i]
+		}
+		if !msg.Reply(result, err) {
+			replied = false
+		}
+	}
+	if err != nil || replied {
+		return
+	}
+
+	for _, result := range results {
+		if result != nil {
+			bas.emitFlushed(run, result)
+		}
+	}
+}
+
+// emitFlushed sends the result on the Output channel. Once the service is stopping, the result is
+// only sent when the channel has capacity, and is routed to the dead letters otherwise.
+func (bas *BaseService) emitFlushed(run context.Context, result interface{}) {
+	if bas.Context().Err() == nil {
+		bas.emit(run, result)
+		return
+	}
+
+	select {
+	case bas.output <- result:
+		bas.emitted(result)
+	default:
+		bas.ReportDeadLetter(result, DeadLetterCanceled, ErrServiceStopped)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type batchService struct {
+	BaseService
+	batches chan []interface{}
+}
+
+func newBatchService(maxSize int, maxDelay time.Duration, opts ...Option) *batchService {
+	srv := &batchService{batches: make(chan []interface{}, 10)}
+
+	srv.Init(srv, "Batch", opts...)
+	srv.SetBatching(maxSize, maxDelay)
+	return srv
+}
+
+func (srv *batchService) OnStart() error {
+	return srv.RunBatch(func(reqs []interface{}) ([]interface{}, error) {
+		srv.batches <- reqs
+		return reqs, nil
+	})
+}
+
+func (srv *batchService) nextBatch(t *testing.T) []interface{} {
+	select {
+	case batch := <-srv.batches:
+		return batch
+	case <-time.After(time.Second):
+		t.Fatalf("The handler was not executed with a batch")
+	}
+	return nil
+}
+
+func TestBatchSize(t *testing.T) {
+	srv := newBatchService(3, time.Hour)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 0; i < 3; i++ {
+		srv.Input() <- i
+	}
+	if batch := srv.nextBatch(t); len(batch) != 3 {
+		t.Errorf("Expected a batch of 3 requests and received %v", batch)
+	}
+	for i := 0; i < 3; i++ {
+		if result := <-srv.Output(); result != i {
+			t.Errorf("Expected %d to be emitted and received %v", i, result)
+		}
+	}
+}
+
+func TestBatchDelay(t *testing.T) {
+	clock := newFakeClock()
+	srv := newBatchService(100, 50*time.Millisecond, WithClock(clock))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "a"
+	srv.Input() <- "b"
+	clock.waitTimers(t, 1)
+	clock.Advance(50*time.Millisecond - time.Nanosecond)
+	select {
+	case batch := <-srv.batches:
+		t.Fatalf("The batch %v was processed before the delay expired", batch)
+	default:
+	}
+
+	clock.Advance(time.Nanosecond)
+	if batch := srv.nextBatch(t); len(batch) != 2 {
+		t.Errorf("Expected a batch of 2 requests and received %v", batch)
+	}
+}
+
+func TestBatchFlush(t *testing.T) {
+	srv := newBatchService(100, time.Hour)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "a"
+	// The request must be pending before the flush
+	for srv.Stats().Received == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	srv.Flush()
+	if batch := srv.nextBatch(t); len(batch) != 1 || batch[0] != "a" {
+		t.Errorf("Expected the pending request to be flushed and received %v", batch)
+	}
+}
+
+func TestBatchFlushOnStop(t *testing.T) {
+	srv := newBatchService(100, time.Hour)
+
+	_ = srv.Start()
+	srv.Input() <- "a"
+	srv.Input() <- "b"
+	_ = srv.Stop()
+
+	if batch := srv.nextBatch(t); len(batch) != 2 {
+		t.Errorf("Expected the pending batch to be processed on stop and received %v", batch)
+	}
+}
+
+func TestBatchFlushOnDrain(t *testing.T) {
+	srv := newBatchService(100, time.Hour)
+
+	_ = srv.Start()
+	srv.Input() <- "a"
+	if err := srv.StopDrain(context.Background()); err != nil {
+		t.Errorf("StopDrain failed: %v", err)
+	}
+
+	if batch := srv.nextBatch(t); len(batch) != 1 {
+		t.Errorf("Expected the pending batch to be processed on drain and received %v", batch)
+	}
+}
+
+func TestBatchRequestReply(t *testing.T) {
+	srv := newBatchService(2, time.Hour)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	replies := make(chan interface{}, 2)
+	for _, str := range []string{"a", "b"} {
+		go func(in string) {
+			result, _ := srv.Request(context.Background(), in)
+			replies <- result
+		}(str)
+	}
+
+	received := make(map[interface{}]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case result := <-replies:
+			received[result] = true
+		case <-time.After(time.Second):
+			t.Fatalf("The request did not receive a reply")
+		}
+	}
+	if !received["a"] || !received["b"] {
+		t.Errorf("Expected each request to receive its result, received %v", received)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// The default settings used by WithCircuitBreaker.
+const (
+	DefaultFailureThreshold = 5
+	DefaultCooldown         = 30 * time.Second
+)
+
+// BreakerState is the state of the circuit breaker of a service.
+type BreakerState int
+
+// The states of a circuit breaker. The breaker opens after consecutive failures, and is half-open
+// once the cool-down period has passed, until a probe request decides whether it is closed again.
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+var breakerNames = [...]string{
+	BreakerClosed:   "closed",
+	BreakerOpen:     "open",
+	BreakerHalfOpen: "half-open",
+}
+
+// String implements the Stringer interface.
+func (s BreakerState) String() string {
+	if s < 0 || int(s) >= len(breakerNames) {
+		return "unknown"
+	}
+	return breakerNames[s]
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *BreakerState) UnmarshalText(text []byte) error {
+	for i, name := range breakerNames {
+		if name == string(text) {
+			*s = BreakerState(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown breaker state %q", text)
+}
+
+type breaker struct {
+	sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	fns       []func(srv Service, old, new BreakerState)
+}
+
+// BreakerOption configures the circuit breaker of a service.
+type BreakerOption func(*breaker)
+
+// WithFailureThreshold sets the number of consecutive failures that opens the breaker.
+func WithFailureThreshold(n int) BreakerOption {
+	return func(b *breaker) {
+		b.threshold = n
+	}
+}
+
+// WithCooldown sets how long the breaker stays open before a probe request is permitted.
+func WithCooldown(d time.Duration) BreakerOption {
+	return func(b *breaker) {
+		b.cooldown = d
+	}
+}
+
+// WithCircuitBreaker makes the Run method fail the requests fast with an error wrapping
+// ErrCircuitOpen while the breaker is open, so a service does not spend its rate limit on an
+// upstream that is down. The failures include the errors returned by the handler and panics.
+func WithCircuitBreaker(opts ...BreakerOption) Option {
+	b := &breaker{
+		threshold: DefaultFailureThreshold,
+		cooldown:  DefaultCooldown,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return func(bas *BaseService) {
+		bas.breaker = b
+	}
+}
+
+// BreakerState returns the state of the circuit breaker, which is always closed for services
+// without a breaker.
+func (bas *BaseService) BreakerState() BreakerState {
+	b := bas.breaker
+	if b == nil {
+		return BreakerClosed
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	return b.state
+}
+
+// OnBreakerChange registers a function that is called each time the circuit breaker changes state.
+// The functions are called synchronously in the order they were registered, without holding a lock.
+func (bas *BaseService) OnBreakerChange(fn func(srv Service, old, new BreakerState)) {
+	b := bas.breaker
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.fns = append(b.fns, fn)
+}
+
+// guard executes the handler when the breaker permits it, and records the outcome.
+func (bas *BaseService) guard(ctx context.Context, handler Handler, req interface{}) (interface{}, error) {
+	b := bas.breaker
+	if b == nil {
+		return bas.execute(ctx, handler, req)
+	}
+
+	allowed, from, to := b.allow(bas.clock.Now())
+	bas.breakerChanged(from, to)
+	if !allowed {
+		return nil, fmt.Errorf("%s: %w", bas.name, ErrCircuitOpen)
+	}
+
+	result, err := bas.execute(ctx, handler, req)
+	bas.breakerChanged(b.record(err, bas.clock.Now()))
+	return result, err
+}
+
+func (bas *BaseService) breakerChanged(from, to BreakerState) {
+	if from == to {
+		return
+	}
+
+	b := bas.breaker
+	b.Lock()
+	fns := b.fns
+	b.Unlock()
+
+	level := slog.LevelInfo
+	if to == BreakerOpen {
+		level = slog.LevelWarn
+	}
+	bas.log(level, "circuit breaker "+to.String(), nil, slog.String("breaker", to.String()))
+
+	for _, fn := range fns {
+		fn(bas.service, from, to)
+	}
+}
+
+// allow returns true when a request is permitted at the time, and the states before and after the
+// check. Once the cool-down period has passed, the breaker becomes half-open and permits a single probe.
+func (b *breaker) allow(now time.Time) (bool, BreakerState, BreakerState) {
+	b.Lock()
+	defer b.Unlock()
+
+	from := b.state
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false, from, from
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false, from, from
+		}
+		b.probing = true
+	}
+	return true, from, b.state
+}
+
+// record updates the breaker with the outcome of a request finished at the time, and returns the
+// old and new states.
+func (b *breaker) record(err error, now time.Time) (BreakerState, BreakerState) {
+	b.Lock()
+	defer b.Unlock()
+
+	old := b.state
+	switch {
+	case err == nil:
+		b.failures = 0
+		b.state = BreakerClosed
+	case b.state == BreakerHalfOpen:
+		b.open(now)
+	default:
+		if b.failures++; b.failures >= b.threshold {
+			b.open(now)
+		}
+	}
+
+	b.probing = false
+	return old, b.state
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.failures = 0
+}
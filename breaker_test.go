@@ -0,0 +1,140 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	errDown := errors.New("down")
+
+	var mu sync.Mutex
+	var calls int
+	healthy := false
+	srv := NewSimpleService("Breaker", func(req interface{}) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		if !healthy {
+			return nil, errDown
+		}
+		return req, nil
+	}, WithCircuitBreaker(WithFailureThreshold(3), WithCooldown(time.Minute)), WithClock(clock))
+
+	type change struct{ from, to BreakerState }
+	var changes []change
+	srv.OnBreakerChange(func(s Service, old, new BreakerState) {
+		changes = append(changes, change{old, new})
+	})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	expectErr := func(target error) {
+		t.Helper()
+
+		select {
+		case err := <-srv.Errors():
+			if !errors.Is(err, target) {
+				t.Errorf("Expected %v and received %v", target, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("The error was not reported")
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		srv.Input() <- i
+		expectErr(errDown)
+	}
+	if s := srv.BreakerState(); s != BreakerOpen {
+		t.Fatalf("Expected the breaker to be open after 3 failures, not %v", s)
+	}
+
+	// The requests fail fast while the breaker is open
+	srv.Input() <- "fast"
+	expectErr(ErrCircuitOpen)
+	mu.Lock()
+	if calls != 3 {
+		t.Errorf("The handler was called while the breaker was open")
+	}
+	mu.Unlock()
+
+	// The failed probe opens the breaker again
+	clock.Advance(time.Minute)
+	srv.Input() <- "probe"
+	expectErr(errDown)
+	if s := srv.BreakerState(); s != BreakerOpen {
+		t.Errorf("Expected the failed probe to open the breaker, not %v", s)
+	}
+
+	// The successful probe closes the breaker
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+	clock.Advance(time.Minute)
+	srv.Input() <- "probe"
+	if result := <-srv.Output(); result != "probe" {
+		t.Errorf("Expected probe to be returned and received %v", result)
+	}
+	if s := srv.BreakerState(); s != BreakerClosed {
+		t.Errorf("Expected the successful probe to close the breaker, not %v", s)
+	}
+
+	expected := []change{
+		{BreakerClosed, BreakerOpen},
+		{BreakerOpen, BreakerHalfOpen},
+		{BreakerHalfOpen, BreakerOpen},
+		{BreakerOpen, BreakerHalfOpen},
+		{BreakerHalfOpen, BreakerClosed},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected the changes %v and received %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected the changes %v and received %v", expected, changes)
+			break
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenSingleProbe(t *testing.T) {
+	now := time.Now()
+	b := &breaker{threshold: 1, cooldown: time.Second}
+
+	b.record(errors.New("failed"), now)
+	now = now.Add(time.Second)
+
+	if ok, from, to := b.allow(now); !ok || from != BreakerOpen || to != BreakerHalfOpen {
+		t.Errorf("The probe was not permitted after the cool-down: %v %v %v", ok, from, to)
+	}
+	if ok, _, _ := b.allow(now); ok {
+		t.Errorf("A second request was permitted while the probe is in flight")
+	}
+}
+
+func TestBreakerStateStats(t *testing.T) {
+	srv := newEchoService("Stats", WithCircuitBreaker())
+
+	data, err := json.Marshal(srv.Stats())
+	if err != nil {
+		t.Fatalf("Failed to marshal the stats: %v", err)
+	}
+	if !strings.Contains(string(data), `"breaker":"closed"`) {
+		t.Errorf("The breaker state is missing from %s", data)
+	}
+	if s := BreakerState(42).String(); s != "unknown" {
+		t.Errorf("Expected unknown and received %s", s)
+	}
+}
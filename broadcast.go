@@ -0,0 +1,195 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// OverflowPolicy determines what happens to a message sent to a full buffer.
+type OverflowPolicy int
+
+// The policies available for full buffers.
+const (
+	// PolicyBlock waits until the buffer has room for the message.
+	PolicyBlock OverflowPolicy = iota
+	// PolicyDropNew discards the message that did not fit in the buffer.
+	PolicyDropNew
+	// PolicyDropOld discards the oldest message in the buffer to make room for the new message.
+	PolicyDropOld
+)
+
+// DefaultSubscriberBuffer is the default capacity of the channels returned by Subscribe.
+const DefaultSubscriberBuffer = 16
+
+type subscriber struct {
+	ch     chan interface{}
+	quit   chan struct{}
+	once   sync.Once
+	policy OverflowPolicy
+	replay bool
+}
+
+// SubscribeOption configures a subscription to the results of a service.
+type SubscribeOption func(*subscriber)
+
+// WithSubscriberBuffer sets the capacity of the subscription channel.
+func WithSubscriberBuffer(size int) SubscribeOption {
+	return func(s *subscriber) {
+		s.ch = make(chan interface{}, size)
+	}
+}
+
+// WithDropPolicy sets the policy applied when the subscription channel is full. The default
+// policy is PolicyDropNew, so a stuck subscriber cannot block the service.
+func WithDropPolicy(policy OverflowPolicy) SubscribeOption {
+	return func(s *subscriber) {
+		s.policy = policy
+	}
+}
+
+type broadcaster struct {
+	sync.Mutex
+	subs map[*subscriber]struct{}
+	// The context of the run that the broadcasting goroutine was started for
+	ctx context.Context
+}
+
+// Subscribe returns a channel that receives a copy of every result sent on the Output channel,
+// and a function that ends the subscription. While subscriptions exist, the Output channel is
+// consumed by the service, so results should only be read from the subscriptions. The channels
+// are closed when the service is stopped.
+func (bas *BaseService) Subscribe(opts ...SubscribeOption) (<-chan interface{}, func()) {
+	sub := &subscriber{
+		quit:   make(chan struct{}),
+		policy: PolicyDropNew,
+	}
+	for _, opt := range opts {
+		opt(sub)
+	}
+	if sub.ch == nil {
+		sub.ch = make(chan interface{}, DefaultSubscriberBuffer)
+	}
+
+	ctx := bas.Context()
+	if ctx.Err() != nil {
+		close(sub.ch)
+		return sub.ch, func() {}
+	}
+
+	b := &bas.bcast
+	b.Lock()
+	if sub.replay {
+		// The results are replayed before the subscriber is visible to the broadcasting goroutine
+		history := bas.replay.history()
+		if extra := len(history) - cap(sub.ch); extra > 0 {
+			history = history[extra:]
+		}
+		for _, msg := range history {
+			sub.ch <- msg
+		}
+	}
+	if b.subs == nil {
+		b.subs = make(map[*subscriber]struct{})
+	}
+	b.subs[sub] = struct{}{}
+	b.Unlock()
+
+	if bas.running() {
+		bas.startBroadcast(ctx)
+	}
+	return sub.ch, func() { bas.unsubscribe(sub) }
+}
+
+func (bas *BaseService) unsubscribe(sub *subscriber) {
+	sub.once.Do(func() {
+		close(sub.quit)
+
+		b := &bas.bcast
+		b.Lock()
+		defer b.Unlock()
+
+		if _, found := b.subs[sub]; found {
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	})
+}
+
+// startBroadcast starts the goroutine delivering the results to the subscribers, unless it is
+// already running for the provided context or there are no subscribers.
+func (bas *BaseService) startBroadcast(ctx context.Context) {
+	b := &bas.bcast
+	b.Lock()
+	defer b.Unlock()
+
+	if b.ctx == ctx || len(b.subs) == 0 {
+		return
+	}
+
+	b.ctx = ctx
+	bas.RunLabeled(ctx, "broadcast", bas.broadcast)
+}
+
+func (bas *BaseService) broadcast(ctx context.Context) {
+	b := &bas.bcast
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.Lock()
+			for sub := range b.subs {
+				delete(b.subs, sub)
+				close(sub.ch)
+			}
+			b.Unlock()
+			return
+		case msg := <-bas.output:
+			b.Lock()
+			for sub := range b.subs {
+				if dropped, ok := sub.deliver(ctx, msg); ok {
+					bas.ReportDeadLetter(dropped, DeadLetterBufferFull, nil)
+				}
+			}
+			b.Unlock()
+		}
+	}
+}
+
+// deliver sends the message to the subscriber according to its policy, and returns the message
+// that was dropped because the buffer was full.
+func (s *subscriber) deliver(ctx context.Context, msg interface{}) (interface{}, bool) {
+	switch s.policy {
+	case PolicyBlock:
+		select {
+		case s.ch <- msg:
+		case <-s.quit:
+		case <-ctx.Done():
+		}
+	case PolicyDropOld:
+		var dropped interface{}
+		var ok bool
+		for {
+			select {
+			case s.ch <- msg:
+				return dropped, ok
+			default:
+			}
+			select {
+			case dropped = <-s.ch:
+				ok = true
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- msg:
+		default:
+			return msg, true
+		}
+	}
+	return nil, false
+}
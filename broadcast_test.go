@@ -0,0 +1,100 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	srv := newTestService()
+	first, unsubFirst := srv.Subscribe()
+	defer unsubFirst()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	second, unsubSecond := srv.Subscribe(WithSubscriberBuffer(4))
+	for _, str := range []string{"a", "b", "c"} {
+		srv.Input() <- str
+	}
+
+	for _, ch := range []<-chan interface{}{first, second} {
+		for _, str := range []string{"a", "b", "c"} {
+			select {
+			case result := <-ch:
+				if result != str {
+					t.Errorf("Expected %s to be delivered and received %v", str, result)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("The subscriber did not receive %s", str)
+			}
+		}
+	}
+
+	unsubSecond()
+	if _, ok := <-second; ok {
+		t.Errorf("The channel was not closed by the unsubscribe function")
+	}
+
+	srv.Input() <- "d"
+	if result := <-first; result != "d" {
+		t.Errorf("Expected d to be delivered to the remaining subscriber and received %v", result)
+	}
+}
+
+func TestSubscribeSlowSubscriber(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	stuck, unsubStuck := srv.Subscribe(WithSubscriberBuffer(2))
+	defer unsubStuck()
+	old, unsubOld := srv.Subscribe(WithSubscriberBuffer(2), WithDropPolicy(PolicyDropOld))
+	defer unsubOld()
+	live, unsubLive := srv.Subscribe(WithSubscriberBuffer(10))
+	defer unsubLive()
+
+	for i := 0; i < 5; i++ {
+		srv.Input() <- i
+		if result := <-live; result != i {
+			t.Errorf("Expected %d to be delivered and received %v", i, result)
+		}
+	}
+
+	if a, b := <-stuck, <-stuck; a != 0 || b != 1 {
+		t.Errorf("Expected the oldest results to be kept by PolicyDropNew, received %v and %v", a, b)
+	}
+	if a, b := <-old, <-old; a != 3 || b != 4 {
+		t.Errorf("Expected the newest results to be kept by PolicyDropOld, received %v and %v", a, b)
+	}
+}
+
+func TestSubscribeClosedOnStop(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	ch, unsub := srv.Subscribe()
+	_ = srv.Stop()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Errorf("Received a value instead of the channel being closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The subscription channel was not closed when the service stopped")
+	}
+	// Unsubscribing after the service stopped must not panic
+	unsub()
+
+	if late, _ := srv.Subscribe(); late != nil {
+		if _, ok := <-late; ok {
+			t.Errorf("The subscription to a stopped service was not closed")
+		}
+	}
+}
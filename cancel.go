@@ -0,0 +1,176 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// cancelIndex tracks the messages with an ID that are queued or being processed, so they can be
+// canceled by Cancel.
+type cancelIndex struct {
+	sync.Mutex
+	// The messages sent with Send, TrySend, SendPriority or Requeue and not yet received, with
+	// whether they were canceled
+	queued map[string]map[*Message]bool
+	// The functions canceling the contexts of the messages being processed
+	inflight map[string]map[*Message]context.CancelFunc
+}
+
+// Cancel cancels the messages with the ID, and reports whether any message was found. The messages
+// still queued are routed to the dead letters with an error wrapping ErrRequestCanceled, once they
+// are received or, for those requeued, right away. The contexts provided to the handler for the
+// messages being processed are canceled. Only the messages sent with Send, TrySend, SendPriority
+// or Requeue can be found in the queue, and only those received by the Run method are canceled.
+func (bas *BaseService) Cancel(id string) bool {
+	if id == "" {
+		return false
+	}
+
+	var found bool
+	c := &bas.cancels
+	c.Lock()
+	for _, cancel := range c.inflight[id] {
+		cancel()
+		found = true
+	}
+	for msg := range c.queued[id] {
+		c.queued[id][msg] = true
+		found = true
+	}
+	c.Unlock()
+
+	// The requeued messages waiting for their delay are discarded by the goroutine feeding them
+	select {
+	case bas.requeues.changed <- struct{}{}:
+	default:
+	}
+	return found
+}
+
+func (bas *BaseService) cancelMessage(msg *Message) {
+	err := fmt.Errorf("%s: %w", bas.name, ErrRequestCanceled)
+
+	bas.deadLetter(msg.original(), msg, DeadLetterCanceled, err)
+	msg.Reply(nil, err)
+}
+
+// trackQueued records the message sent to the Input channel, when it is a *Message with an ID.
+func (bas *BaseService) trackQueued(v interface{}) {
+	msg, ok := v.(*Message)
+	if !ok || msg.ID == "" {
+		return
+	}
+
+	c := &bas.cancels
+	c.Lock()
+	defer c.Unlock()
+
+	if c.queued == nil {
+		c.queued = make(map[string]map[*Message]bool)
+	}
+	if c.queued[msg.ID] == nil {
+		c.queued[msg.ID] = make(map[*Message]bool)
+	}
+	c.queued[msg.ID][msg] = false
+}
+
+// untrackQueued removes the message from the queued messages, and returns true when it was canceled.
+func (bas *BaseService) untrackQueued(v interface{}) bool {
+	msg, ok := v.(*Message)
+	if !ok || msg.ID == "" {
+		return false
+	}
+
+	c := &bas.cancels
+	c.Lock()
+	defer c.Unlock()
+
+	canceled := c.queued[msg.ID][msg]
+	delete(c.queued[msg.ID], msg)
+	if len(c.queued[msg.ID]) == 0 {
+		delete(c.queued, msg.ID)
+	}
+	return canceled
+}
+
+// dequeued removes the received message from the queued messages, and discards it when it was
+// canceled, in which case it returns true.
+func (bas *BaseService) dequeued(v interface{}) bool {
+	if !bas.untrackQueued(v) {
+		return false
+	}
+
+	bas.cancelMessage(v.(*Message))
+	return true
+}
+
+// canceled reports whether the queued message was canceled.
+func (bas *BaseService) canceled(msg *Message) bool {
+	c := &bas.cancels
+	c.Lock()
+	defer c.Unlock()
+
+	return c.queued[msg.ID][msg]
+}
+
+// clearQueued forgets the queued messages, which are discarded when the service stops.
+func (bas *BaseService) clearQueued() {
+	c := &bas.cancels
+	c.Lock()
+	defer c.Unlock()
+
+	c.queued = nil
+}
+
+// trackInFlight records the function canceling the context of the message being processed, and
+// returns the function to call once the message has been processed.
+func (bas *BaseService) trackInFlight(msg *Message, cancel context.CancelFunc) func() {
+	if msg.ID == "" {
+		return func() {}
+	}
+
+	c := &bas.cancels
+	c.Lock()
+	defer c.Unlock()
+
+	if c.inflight == nil {
+		c.inflight = make(map[string]map[*Message]context.CancelFunc)
+	}
+	if c.inflight[msg.ID] == nil {
+		c.inflight[msg.ID] = make(map[*Message]context.CancelFunc)
+	}
+	c.inflight[msg.ID][msg] = cancel
+
+	return func() {
+		c.Lock()
+		defer c.Unlock()
+
+		delete(c.inflight[msg.ID], msg)
+		if len(c.inflight[msg.ID]) == 0 {
+			delete(c.inflight, msg.ID)
+		}
+	}
+}
+
+// The services that cancel their messages by ID, such as those embedding BaseService
+type canceler interface {
+	Cancel(id string) bool
+}
+
+// Cancel cancels the messages with the ID in each service of the group that supports it, and
+// reports whether any message was found.
+func (g *Group) Cancel(id string) bool {
+	var found bool
+
+	for _, srv := range g.Members() {
+		if c, ok := srv.(canceler); ok && c.Cancel(id) {
+			found = true
+		}
+	}
+	return found
+}
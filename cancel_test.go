@@ -0,0 +1,128 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func idMessage(id string, payload interface{}) *Message {
+	msg := NewMessage(payload)
+
+	msg.ID = id
+	return msg
+}
+
+func TestCancelQueued(t *testing.T) {
+	srv := newEchoService("Queued", WithInputBuffer(4))
+	for _, msg := range []*Message{idMessage("a", 1), idMessage("b", 2)} {
+		if !srv.TrySend(msg) {
+			t.Fatal("Failed to queue the message")
+		}
+	}
+
+	if !srv.Cancel("a") {
+		t.Error("Expected the queued message to be found")
+	}
+	if srv.Cancel("missing") {
+		t.Error("Expected no message to be found for an unknown ID")
+	}
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if result := (<-srv.Output()).(*Message); result.ID != "b" {
+		t.Errorf("Expected only the message b to be processed, received %s", result.ID)
+	}
+	dl := <-srv.DeadLetters()
+	if dl.Reason != DeadLetterCanceled || !errors.Is(dl.Err, ErrRequestCanceled) {
+		t.Errorf("Expected the message a to be canceled, received %+v", dl)
+	}
+	if n := srv.Stats().Received; n != 1 {
+		t.Errorf("Expected the canceled message not to be processed, received %d", n)
+	}
+}
+
+// cancelWaitService waits in its handler until the context of the request is canceled.
+type cancelWaitService struct {
+	BaseService
+	started chan struct{}
+}
+
+func (s *cancelWaitService) OnStart() error {
+	return s.RunContext(func(ctx context.Context, req interface{}) (interface{}, error) {
+		close(s.started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+}
+
+func TestCancelInFlight(t *testing.T) {
+	started := make(chan struct{})
+	srv := &cancelWaitService{started: started}
+	srv.Init(srv, "InFlight")
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- idMessage("slow", 1)
+	<-started
+	if !srv.Cancel("slow") {
+		t.Error("Expected the message in flight to be found")
+	}
+
+	select {
+	case dl := <-srv.DeadLetters():
+		if !errors.Is(dl.Err, context.Canceled) {
+			t.Errorf("Expected the handler to return the cancellation, received %v", dl.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The context of the handler was not canceled")
+	}
+}
+
+func TestCancelRequeued(t *testing.T) {
+	srv := newEchoService("Requeued")
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if err := srv.Requeue(idMessage("later", 1), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Cancel("later") {
+		t.Error("Expected the requeued message to be found")
+	}
+
+	select {
+	case dl := <-srv.DeadLetters():
+		if !errors.Is(dl.Err, ErrRequestCanceled) {
+			t.Errorf("Expected the requeued message to be canceled, received %v", dl.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The requeued message was not discarded")
+	}
+}
+
+func TestGroupCancel(t *testing.T) {
+	a := newEchoService("A", WithInputBuffer(2))
+	b := newEchoService("B", WithInputBuffer(2))
+	g := NewGroup(a, b)
+
+	a.TrySend(idMessage("enum", 1))
+	b.TrySend(idMessage("enum", 2))
+	if !g.Cancel("enum") {
+		t.Fatal("Expected the messages to be found")
+	}
+
+	_ = g.StartAll()
+	defer func() { _ = g.StopAll() }()
+	for _, srv := range []*SimpleService{a, b} {
+		if dl := <-srv.DeadLetters(); !errors.Is(dl.Err, ErrRequestCanceled) {
+			t.Errorf("Expected the message of %s to be canceled, received %v", srv, dl.Err)
+		}
+	}
+}
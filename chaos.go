@@ -0,0 +1,247 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ChaosOption configures a Chaos during construction. Each Option is also a ChaosOption, so the
+// latency and the blackouts can be timed by the clock set with WithClock.
+type ChaosOption interface {
+	applyChaos(*Chaos)
+}
+
+func (o Option) applyChaos(c *Chaos) {
+	o(&c.BaseService)
+}
+
+type chaosOption func(*Chaos)
+
+func (o chaosOption) applyChaos(c *Chaos) {
+	o(c)
+}
+
+// WithChaosSeed sets the seed of the random faults, so a test injects the same faults in each run.
+func WithChaosSeed(seed int64) ChaosOption {
+	return chaosOption(func(c *Chaos) {
+		c.rng = rand.New(rand.NewSource(seed))
+	})
+}
+
+// WithLatency delays each message by a random duration between the shortest and the longest
+// duration. The messages are forwarded in order, so the delays add up when messages are queued.
+func WithLatency(shortest, longest time.Duration) ChaosOption {
+	return chaosOption(func(c *Chaos) {
+		c.minDelay = shortest
+		c.maxDelay = longest
+	})
+}
+
+// WithDropRate discards each message with the probability, so it never reaches the inner service.
+func WithDropRate(p float64) ChaosOption {
+	return chaosOption(func(c *Chaos) {
+		c.dropRate = p
+	})
+}
+
+// WithErrorRate fails each message with the probability, using an error wrapping ErrInjectedFault.
+func WithErrorRate(p float64) ChaosOption {
+	return chaosOption(func(c *Chaos) {
+		c.errRate = p
+	})
+}
+
+// WithBlackout stops the delivery of messages to the inner service for the duration, beginning
+// after the delay since the Chaos started. The option can be provided for several windows.
+func WithBlackout(after, length time.Duration) ChaosOption {
+	return chaosOption(func(c *Chaos) {
+		c.blackouts = append(c.blackouts, blackout{after: after, length: length})
+	})
+}
+
+type blackout struct {
+	after  time.Duration
+	length time.Duration
+}
+
+// ChaosStats is a snapshot of the faults injected by a Chaos.
+type ChaosStats struct {
+	Delayed    uint64
+	Dropped    uint64
+	Failed     uint64
+	BlackedOut uint64
+}
+
+// Chaos is a service that forwards the messages on its Input channel to the inner service while
+// injecting faults, so tests can observe how consumers behave when a service misbehaves. The
+// results of the inner service are sent on the Output channel of the Chaos, and the replies to
+// Request are provided by the inner service. The inner service is started and stopped with the
+// Chaos. The faults are random, unless the seed is set by WithChaosSeed.
+type Chaos struct {
+	BaseService
+	inner     Service
+	minDelay  time.Duration
+	maxDelay  time.Duration
+	dropRate  float64
+	errRate   float64
+	blackouts []blackout
+	rng       *rand.Rand
+	delayed   atomic.Uint64
+	dropped   atomic.Uint64
+	failed    atomic.Uint64
+	blacked   atomic.Uint64
+	wg        sync.WaitGroup
+}
+
+// NewChaos returns a Chaos injecting the faults configured by the options in front of the inner service.
+func NewChaos(inner Service, opts ...ChaosOption) *Chaos {
+	c := &Chaos{inner: inner}
+	c.Init(c, "Chaos("+inner.String()+")")
+
+	for _, opt := range opts {
+		opt.applyChaos(c)
+	}
+	if c.rng == nil {
+		c.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return c
+}
+
+// Inner returns the service receiving the messages forwarded by the Chaos.
+func (c *Chaos) Inner() Service {
+	return c.inner
+}
+
+// ChaosStats returns the number of messages affected by each kind of fault.
+func (c *Chaos) ChaosStats() ChaosStats {
+	return ChaosStats{
+		Delayed:    c.delayed.Load(),
+		Dropped:    c.dropped.Load(),
+		Failed:     c.failed.Load(),
+		BlackedOut: c.blacked.Load(),
+	}
+}
+
+// OnStart implements the Service interface.
+func (c *Chaos) OnStart() error {
+	if err := c.inner.Start(); err != nil && !errors.Is(err, ErrAlreadyStarted) {
+		return err
+	}
+
+	ctx := c.Context()
+	c.wg.Add(2)
+	start := c.clock.Now()
+	c.RunLabeled(ctx, "forward", func(ctx context.Context) { c.forward(ctx, start) })
+	c.RunLabeled(ctx, "results", c.results)
+	c.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (c *Chaos) OnStop() error {
+	c.wg.Wait()
+
+	if err := c.inner.Stop(); err != nil && !errors.Is(err, ErrAlreadyStopped) {
+		return err
+	}
+	return nil
+}
+
+func (c *Chaos) forward(ctx context.Context, started time.Time) {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-c.Input():
+			c.MarkBusy()
+			c.IncReceived()
+			c.inject(ctx, started, req)
+			c.MarkIdle()
+		}
+	}
+}
+
+// inject applies the faults to the request, and forwards it to the inner service unless it was
+// dropped or failed. The random values are drawn for every request, so the faults injected with
+// a seed do not depend on the options.
+func (c *Chaos) inject(ctx context.Context, started time.Time, req interface{}) {
+	drop, fail := c.rng.Float64(), c.rng.Float64()
+	delay := c.minDelay
+	if span := c.maxDelay - c.minDelay; span > 0 {
+		delay += time.Duration(c.rng.Int63n(int64(span)))
+	}
+
+	if end, found := c.blackoutEnd(started, c.clock.Now()); found {
+		c.blacked.Add(1)
+		if !c.sleep(ctx, end.Sub(c.clock.Now())) {
+			c.ReportDeadLetter(req, DeadLetterCanceled, ctx.Err())
+			return
+		}
+	}
+
+	switch {
+	case drop < c.dropRate:
+		c.dropped.Add(1)
+		return
+	case fail < c.errRate:
+		c.failed.Add(1)
+
+		err := fmt.Errorf("%s: %w", c, ErrInjectedFault)
+		c.ReportDeadLetter(req, DeadLetterHandlerError, err)
+		if msg, ok := req.(*Message); ok {
+			msg.Reply(nil, err)
+		}
+		c.ReportError(err)
+		return
+	}
+
+	if delay > 0 {
+		c.delayed.Add(1)
+		if !c.sleep(ctx, delay) {
+			c.ReportDeadLetter(req, DeadLetterCanceled, ctx.Err())
+			return
+		}
+	}
+
+	if err := sendTo(ctx, c.inner, req); err != nil {
+		c.ReportDeadLetter(req, DeadLetterCanceled, err)
+	}
+}
+
+// blackoutEnd returns the end of the blackout window containing the time.
+func (c *Chaos) blackoutEnd(started, now time.Time) (time.Time, bool) {
+	for _, b := range c.blackouts {
+		begin := started.Add(b.after)
+
+		if end := begin.Add(b.length); !now.Before(begin) && now.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (c *Chaos) results(ctx context.Context) {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.inner.Done():
+			return
+		case msg := <-c.inner.Output():
+			c.emit(ctx, msg)
+		}
+	}
+}
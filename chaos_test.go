@@ -0,0 +1,130 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func runChaos(t *testing.T, opts ...ChaosOption) (ChaosStats, int) {
+	c := NewChaos(newEchoService("Echo"), opts...)
+
+	_ = c.Start()
+	defer func() { _ = c.Stop() }()
+
+	received := make(chan struct{}, 100)
+	go func() {
+		for {
+			if _, err := c.Receive(context.Background()); err != nil {
+				return
+			}
+			received <- struct{}{}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = c.Send(context.Background(), i)
+	}
+
+	var s ChaosStats
+	deadline := time.After(time.Second)
+	for {
+		s = c.ChaosStats()
+		if int(s.Dropped+s.Failed)+len(received) == 100 {
+			break
+		}
+
+		select {
+		case <-deadline:
+			t.Fatalf("Only %d of the 100 messages were handled, %+v", len(received), s)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return s, len(received)
+}
+
+func TestChaosSeed(t *testing.T) {
+	first, received := runChaos(t, WithChaosSeed(42), WithDropRate(0.3), WithErrorRate(0.3))
+	second, _ := runChaos(t, WithChaosSeed(42), WithDropRate(0.3), WithErrorRate(0.3))
+
+	if first != second {
+		t.Errorf("Expected the same faults with the same seed and received %+v and %+v", first, second)
+	}
+	if first.Dropped == 0 || first.Failed == 0 || received == 0 {
+		t.Errorf("Expected messages to be dropped, failed and received, counted %+v", first)
+	}
+}
+
+func TestChaosErrors(t *testing.T) {
+	c := NewChaos(newEchoService("Echo"), WithErrorRate(1))
+
+	_ = c.Start()
+	defer func() { _ = c.Stop() }()
+
+	if _, err := c.Request(context.Background(), "req"); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("Expected the injected fault and received %v", err)
+	}
+	if err := <-c.Errors(); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("Expected the injected fault to be reported and received %v", err)
+	}
+	if n := c.ChaosStats().Failed; n != 1 {
+		t.Errorf("Expected 1 failed message and counted %d", n)
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	c := NewChaos(newEchoService("Echo"), WithLatency(50*time.Millisecond, 50*time.Millisecond))
+
+	_ = c.Start()
+	defer func() { _ = c.Stop() }()
+
+	start := time.Now()
+	if result, err := c.Request(context.Background(), "req"); err != nil || result != "req" {
+		t.Errorf("Expected the inner service to reply, received %v: %v", result, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("Expected the request to be delayed by 50ms and it took %v", d)
+	}
+	if n := c.ChaosStats().Delayed; n != 1 {
+		t.Errorf("Expected 1 delayed message and counted %d", n)
+	}
+}
+
+func TestChaosBlackout(t *testing.T) {
+	clock := newFakeClock()
+	c := NewChaos(newEchoService("Echo"), WithBlackout(0, time.Hour), WithClock(clock))
+
+	_ = c.Start()
+	defer func() { _ = c.Stop() }()
+
+	replied := make(chan struct{})
+	go func() {
+		_, _ = c.Request(context.Background(), "first")
+		close(replied)
+	}()
+
+	clock.waitTimers(t, 1)
+	select {
+	case <-replied:
+		t.Fatalf("The request was delivered during the blackout")
+	default:
+	}
+	clock.Advance(time.Hour)
+	select {
+	case <-replied:
+	case <-time.After(time.Second):
+		t.Fatalf("The request was not delivered at the end of the blackout")
+	}
+
+	// The requests after the blackout do not wait on the clock
+	if result, err := c.Request(context.Background(), "second"); err != nil || result != "second" {
+		t.Errorf("Expected the inner service to reply after the blackout, received %v: %v", result, err)
+	}
+	if n := c.ChaosStats().BlackedOut; n != 1 {
+		t.Errorf("Expected 1 message held by the blackout and counted %d", n)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// CheckpointVersion is the version of the format written by Checkpoint.
+const CheckpointVersion = 1
+
+const checkpointMagic = "svcckpt"
+
+// The kinds of the records written for the checkpointed requests
+const (
+	recordRaw byte = iota
+	recordMessage
+)
+
+// Codec converts the payloads of the queued requests to bytes and back for Checkpoint and Restore.
+type Codec interface {
+	Marshal(payload interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+type jsonCodec[T any] struct{}
+
+// JSONCodec returns a Codec that encodes the payloads as JSON, and decodes them as values of type T.
+func JSONCodec[T any]() Codec {
+	return jsonCodec[T]{}
+}
+
+// Marshal implements the Codec interface.
+func (jsonCodec[T]) Marshal(payload interface{}) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+// ContentType returns the media type of the encoded payloads.
+func (jsonCodec[T]) ContentType() string {
+	return "application/json"
+}
+
+// Unmarshal implements the Codec interface.
+func (jsonCodec[T]) Unmarshal(data []byte) (interface{}, error) {
+	var v T
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// The envelope of a *Message request, without the payload
+type checkpointMessage struct {
+	ID         string            `json:"id"`
+	EnqueuedAt time.Time         `json:"enqueued_at"`
+	Deadline   time.Time         `json:"deadline"`
+	Attempts   int               `json:"attempts"`
+	Meta       map[string]string `json:"meta,omitempty"`
+}
+
+// SetCodec sets the Codec used by Checkpoint and Restore for the payloads of the requests.
+func (bas *BaseService) SetCodec(c Codec) {
+	bas.Lock()
+	defer bas.Unlock()
+
+	bas.codec = c
+}
+
+// Checkpoint writes the requests waiting on the Input channel and in the priority queue, so a later
+// run of the program can process them after calling Restore. The requests are removed from the
+// service, so they are not also processed by it. Checkpoint can be called before the service is
+// started, after it is stopped, or while it is paused, which lets the requests in flight complete
+// first, as reported by InFlight. The replies expected by callers of Request are not saved. When the write
+// fails, the requests are queued again.
+func (bas *BaseService) Checkpoint(w io.Writer) error {
+	bas.lifecycle.Lock()
+	defer bas.lifecycle.Unlock()
+
+	codec := bas.getCodec()
+	if codec == nil {
+		return fmt.Errorf("%s: %w", bas.name, ErrNoCodec)
+	}
+
+	var msgs []interface{}
+	switch bas.State() {
+	case StateNew, StateStopped:
+		msgs = bas.takeQueued()
+	case StatePaused:
+		// The goroutine feeding the Input channel takes the requests, so none is delivered meanwhile
+		reply := make(chan []interface{}, 1)
+		bas.prio.takes <- reply
+		msgs = <-reply
+	default:
+		return fmt.Errorf("%s: %w", bas.name, ErrNotPaused)
+	}
+
+	if err := writeCheckpoint(w, codec, msgs); err != nil {
+		bas.pushPriority(0, msgs...)
+		return fmt.Errorf("%s: %w", bas.name, err)
+	}
+	return nil
+}
+
+// Restore queues the requests written by Checkpoint like SendPriority does with priority zero, and
+// must be called before the service is started. The requests are delivered to the Input channel in
+// the order they were saved, and the messages keep the time they were sent and their deadline. An
+// error wrapping ErrInvalidCheckpoint is returned when the data does not start with a checkpoint
+// header of a supported version, and nothing is queued when an error is returned.
+func (bas *BaseService) Restore(r io.Reader) error {
+	bas.lifecycle.Lock()
+	defer bas.lifecycle.Unlock()
+
+	if bas.State() != StateNew {
+		return fmt.Errorf("%s: %w", bas.name, ErrAlreadyStarted)
+	}
+
+	codec := bas.getCodec()
+	if codec == nil {
+		return fmt.Errorf("%s: %w", bas.name, ErrNoCodec)
+	}
+
+	msgs, err := readCheckpoint(bufio.NewReader(r), codec)
+	if err != nil {
+		return fmt.Errorf("%s: %w", bas.name, err)
+	}
+	bas.pushPriority(0, msgs...)
+	return nil
+}
+
+func (bas *BaseService) getCodec() Codec {
+	bas.Lock()
+	defer bas.Unlock()
+
+	return bas.codec
+}
+
+func writeCheckpoint(w io.Writer, codec Codec, msgs []interface{}) error {
+	var buf bytes.Buffer
+
+	buf.WriteString(checkpointMagic)
+	buf.WriteByte(CheckpointVersion)
+	writeUvarint(&buf, uint64(len(msgs)))
+
+	for _, req := range msgs {
+		msg, isMsg := req.(*Message)
+		if !isMsg {
+			buf.WriteByte(recordRaw)
+		} else {
+			env, err := json.Marshal(&checkpointMessage{
+				ID:         msg.ID,
+				EnqueuedAt: msg.EnqueuedAt,
+				Deadline:   msg.Deadline,
+				Attempts:   msg.Attempts,
+				Meta:       msg.Meta,
+			})
+			if err != nil {
+				return err
+			}
+
+			buf.WriteByte(recordMessage)
+			writeBytes(&buf, env)
+		}
+
+		data, err := codec.Marshal(Unwrap(req))
+		if err != nil {
+			return err
+		}
+		writeBytes(&buf, data)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readCheckpoint(r *bufio.Reader, codec Codec) ([]interface{}, error) {
+	header := make([]byte, len(checkpointMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(checkpointMagic)]) != checkpointMagic {
+		return nil, fmt.Errorf("%w: the header is missing", ErrInvalidCheckpoint)
+	}
+	if v := header[len(checkpointMagic)]; v != CheckpointVersion {
+		return nil, fmt.Errorf("%w: version %d is not supported", ErrInvalidCheckpoint, v)
+	}
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, invalidCheckpoint(err)
+	}
+
+	var msgs []interface{}
+	for i := uint64(0); i < n; i++ {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, invalidCheckpoint(err)
+		}
+
+		var env *checkpointMessage
+		switch kind {
+		case recordRaw:
+		case recordMessage:
+			data, err := readBytes(r)
+			if err != nil {
+				return nil, err
+			}
+
+			env = new(checkpointMessage)
+			if err := json.Unmarshal(data, env); err != nil {
+				return nil, invalidCheckpoint(err)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown record kind %d", ErrInvalidCheckpoint, kind)
+		}
+
+		data, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := codec.Unmarshal(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if env == nil {
+			msgs = append(msgs, payload)
+			continue
+		}
+		msgs = append(msgs, &Message{
+			ID:         env.ID,
+			Payload:    payload,
+			EnqueuedAt: env.EnqueuedAt,
+			Deadline:   env.Deadline,
+			Attempts:   env.Attempts,
+			Meta:       env.Meta,
+		})
+	}
+	return msgs, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func writeBytes(buf *bytes.Buffer, data []byte) {
+	writeUvarint(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, invalidCheckpoint(err)
+	}
+
+	// The buffer grows with the data read, so a corrupted length does not allocate memory
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, invalidCheckpoint(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func invalidCheckpoint(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidCheckpoint, err)
+}
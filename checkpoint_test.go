@@ -0,0 +1,184 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func newCheckpointService(name string, opts ...Option) *SimpleService {
+	srv := newEchoService(name, opts...)
+
+	srv.SetCodec(JSONCodec[int]())
+	return srv
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	const total = 3000
+	src := newCheckpointService("Source", WithInputBuffer(1000))
+
+	ids := make(map[int]string)
+	for i := 0; i < total; i++ {
+		var req interface{} = i
+		if i%2 == 1 {
+			msg := NewMessage(i)
+			msg.Meta = map[string]string{"n": strconv.Itoa(i)}
+			ids[i] = msg.ID
+			req = msg
+		}
+
+		// The requests that do not fit in the Input channel are queued by priority
+		if i < 1000 {
+			_ = src.Send(context.Background(), req)
+		} else {
+			_ = src.SendPriority(context.Background(), req, 0)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := src.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if n := len(src.Input()) + src.PriorityLen(); n != 0 {
+		t.Errorf("Expected the checkpoint to take the requests, %d remain", n)
+	}
+
+	dst := newCheckpointService("Destination")
+	if err := dst.Restore(&buf); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	_ = dst.Start()
+	defer func() { _ = dst.Stop() }()
+
+	for i := 0; i < total; i++ {
+		var result interface{}
+		select {
+		case result = <-dst.Output():
+		case <-time.After(time.Second):
+			t.Fatalf("Only %d of the %d restored requests were processed", i, total)
+		}
+
+		if p := Unwrap(result); p != i {
+			t.Fatalf("Expected the restored request %d and received %v", i, p)
+		}
+		if i%2 == 0 {
+			continue
+		}
+		if msg, ok := result.(*Message); !ok || msg.ID != ids[i] || msg.Meta["n"] != strconv.Itoa(i) {
+			t.Fatalf("The envelope of message %d was not restored: %v", i, result)
+		}
+	}
+}
+
+func TestCheckpointPaused(t *testing.T) {
+	gate := make(chan struct{})
+	srv := NewSimpleService("Paused", func(req interface{}) (interface{}, error) {
+		<-gate
+		return req, nil
+	}, WithInputBuffer(100))
+	srv.SetCodec(JSONCodec[int]())
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 0; i < 51; i++ {
+		_ = srv.Send(context.Background(), i)
+	}
+	for srv.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	_ = srv.Pause()
+	close(gate)
+	<-srv.Output()
+
+	for srv.InFlight() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var buf bytes.Buffer
+	if err := srv.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+
+	restored := newCheckpointService("Restored")
+	_ = restored.Restore(&buf)
+	if n := restored.PriorityLen(); n != 50 {
+		t.Errorf("Expected the 50 queued requests to be saved and restored %d", n)
+	}
+}
+
+func TestCheckpointRunning(t *testing.T) {
+	srv := newCheckpointService("Running")
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if err := srv.Checkpoint(new(bytes.Buffer)); !errors.Is(err, ErrNotPaused) {
+		t.Errorf("Expected ErrNotPaused for a running service and received %v", err)
+	}
+}
+
+func TestCheckpointWriteError(t *testing.T) {
+	srv := newCheckpointService("Failing", WithInputBuffer(10))
+	for i := 0; i < 5; i++ {
+		_ = srv.Send(context.Background(), i)
+	}
+
+	if err := srv.Checkpoint(failingWriter{}); err == nil {
+		t.Fatalf("Expected the write error to be returned")
+	}
+	if n := len(srv.Input()) + srv.PriorityLen(); n != 5 {
+		t.Errorf("Expected the 5 requests to be queued again and counted %d", n)
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	src := newCheckpointService("Source", WithInputBuffer(10))
+	for i := 0; i < 5; i++ {
+		_ = src.Send(context.Background(), NewMessage(i))
+	}
+	var buf bytes.Buffer
+	_ = src.Checkpoint(&buf)
+	valid := buf.Bytes()
+
+	version := append([]byte(checkpointMagic), CheckpointVersion+1)
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"header":    []byte("not a checkpoint"),
+		"version":   version,
+		"truncated": valid[:len(valid)-3],
+	} {
+		srv := newCheckpointService("Restore")
+		if err := srv.Restore(bytes.NewReader(data)); !errors.Is(err, ErrInvalidCheckpoint) {
+			t.Errorf("Expected ErrInvalidCheckpoint for the %s checkpoint and received %v", name, err)
+		}
+		if n := srv.PriorityLen(); n != 0 {
+			t.Errorf("Expected nothing to be restored from the %s checkpoint, %d requests are queued", name, n)
+		}
+	}
+
+	srv := newEchoService("Codec")
+	if err := srv.Restore(bytes.NewReader(valid)); !errors.Is(err, ErrNoCodec) {
+		t.Errorf("Expected ErrNoCodec and received %v", err)
+	}
+
+	srv = newCheckpointService("Started")
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+	if err := srv.Restore(bytes.NewReader(valid)); !errors.Is(err, ErrAlreadyStarted) {
+		t.Errorf("Expected ErrAlreadyStarted for a started service and received %v", err)
+	}
+}
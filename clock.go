@@ -0,0 +1,83 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import "time"
+
+// Clock provides the time to a service. The rate limiter, the idle timeout, the batching timer,
+// the message TTL, the request timeout, the retry backoff, the deduplication window, the priority
+// aging, the heartbeats, the statistics and the circuit breaker use the clock, as do the ticks of
+// a Scheduler, the windows of a Debounce and the faults of a Chaos, so tests can control the
+// passing of time with a fake clock, such as the FakeClock of the servicetest package.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock, and behaves like a *time.Timer.
+type Timer interface {
+	// C returns the channel receiving the time when the timer fires
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// WithClock sets the clock used by the service. The real clock is used by default.
+func WithClock(c Clock) Option {
+	return func(bas *BaseService) {
+		bas.clock = c
+	}
+}
+
+type realClock struct{}
+
+// Now implements the Clock interface.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer implements the Clock interface.
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+// C implements the Timer interface.
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// since returns the time elapsed on the clock of the service since t.
+func (bas *BaseService) since(t time.Time) time.Duration {
+	return bas.clock.Now().Sub(t)
+}
+
+// resetTimer starts the timer for the duration, and returns it. The timer is created on the
+// clock of the service when it is nil, so a timer is only waiting on the clock once it is used.
+func (bas *BaseService) resetTimer(t Timer, d time.Duration) Timer {
+	if t == nil {
+		return bas.clock.NewTimer(d)
+	}
+
+	// Discard the time the timer may have sent, so it is not received after the reset
+	if !t.Stop() {
+		select {
+		case <-t.C():
+		default:
+		}
+	}
+	t.Reset(d)
+	return t
+}
+
+// stopTimer stops the timer when it was created.
+func stopTimer(t Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
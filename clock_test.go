@@ -0,0 +1,173 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only passes when Advance is called.
+type fakeClock struct {
+	sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+	// Signaled each time a timer is added
+	added chan struct{}
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the time forward and fires the timers expiring by the new time.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = c.now.Add(d)
+
+	var pending []*fakeTimer
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.fire(c.now)
+	}
+	c.timers = pending
+}
+
+// waitTimers blocks until at least n timers are waiting to fire.
+func (c *fakeClock) waitTimers(t *testing.T, n int) {
+	t.Helper()
+
+	deadline := time.After(time.Second)
+	for {
+		c.Lock()
+		if c.added == nil {
+			c.added = make(chan struct{}, 1)
+		}
+		waiting, added := len(c.timers), c.added
+		c.Unlock()
+
+		if waiting >= n {
+			return
+		}
+		select {
+		case <-added:
+		case <-deadline:
+			t.Fatalf("Expected %d timers to be waiting, but %d were", n, waiting)
+		}
+	}
+}
+
+// nextTimer waits for a timer to wait on the clock, and returns the duration left before it fires.
+func (c *fakeClock) nextTimer(t *testing.T) time.Duration {
+	t.Helper()
+
+	c.waitTimers(t, 1)
+	c.Lock()
+	defer c.Unlock()
+
+	return c.timers[0].when.Sub(c.now)
+}
+
+func (c *fakeClock) remove(t *fakeTimer) bool {
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	ch    chan time.Time
+	when  time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.Lock()
+	defer c.Unlock()
+
+	active := c.remove(t)
+	t.when = c.now.Add(d)
+	if d <= 0 {
+		t.fire(c.now)
+		return active
+	}
+
+	c.timers = append(c.timers, t)
+	if c.added != nil {
+		select {
+		case c.added <- struct{}{}:
+		default:
+		}
+	}
+	return active
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	clock := newFakeClock()
+	srv := newTestService(WithClock(clock))
+	srv.SetMessageTTL(time.Minute)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	msg := NewMessage("late")
+	if err := srv.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Failed to send the message: %v", err)
+	}
+	if !msg.EnqueuedAt.Equal(clock.Now()) {
+		t.Errorf("Expected the message to be stamped by the clock of the service")
+	}
+	<-srv.Output()
+
+	expired := NewMessage("expired")
+	expired.EnqueuedAt = clock.Now()
+	clock.Advance(time.Hour)
+	if !srv.expire(expired) {
+		t.Errorf("Expected the message to expire once the clock passed its TTL")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// slots is a semaphore that grants the slots to waiters in the order that they arrived.
+type slots struct {
+	sync.Mutex
+	max     int
+	inuse   int
+	waiters list.List
+}
+
+// SetMaxConcurrent sets the maximum number of slots that can be held at once.
+// A value of zero or less removes the limit.
+func (bas *BaseService) SetMaxConcurrent(n int) {
+	s := &bas.slots
+	s.Lock()
+	defer s.Unlock()
+
+	s.max = n
+	for s.waiters.Len() > 0 && (s.max <= 0 || s.inuse < s.max) {
+		s.inuse++
+		close(s.waiters.Remove(s.waiters.Front()).(chan struct{}))
+	}
+}
+
+// AcquireSlot blocks until a slot is available, the context is done, or the service is stopped.
+// Each successful call must be followed by a call to ReleaseSlot.
+func (bas *BaseService) AcquireSlot(ctx context.Context) error {
+	done := bas.Done()
+	select {
+	case <-done:
+		return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	default:
+	}
+
+	s := &bas.slots
+	s.Lock()
+	if s.max <= 0 || s.inuse < s.max {
+		s.inuse++
+		s.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	e := s.waiters.PushBack(ready)
+	s.Unlock()
+
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-done:
+		err = fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	}
+
+	s.Lock()
+	select {
+	case <-ready:
+		// The slot was granted while giving up, so pass it along
+		s.Unlock()
+		bas.ReleaseSlot()
+		return err
+	default:
+	}
+	s.waiters.Remove(e)
+	s.Unlock()
+	return err
+}
+
+// ReleaseSlot returns a slot obtained by AcquireSlot.
+func (bas *BaseService) ReleaseSlot() {
+	s := &bas.slots
+	s.Lock()
+	defer s.Unlock()
+
+	if s.waiters.Len() > 0 && (s.max <= 0 || s.inuse <= s.max) {
+		// Hand the slot directly to the next waiter
+		close(s.waiters.Remove(s.waiters.Front()).(chan struct{}))
+		return
+	}
+	if s.inuse > 0 {
+		s.inuse--
+	}
+}
+
+// Do executes the function while holding a slot, and returns the error from AcquireSlot without
+// executing the function when a slot could not be obtained.
+func (bas *BaseService) Do(ctx context.Context, fn func()) error {
+	if err := bas.AcquireSlot(ctx); err != nil {
+		return err
+	}
+	defer bas.ReleaseSlot()
+
+	fn()
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrent(t *testing.T) {
+	srv := newTestService()
+	srv.SetMaxConcurrent(5)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	var inflight, highest int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := srv.Do(context.Background(), func() {
+				cur := atomic.AddInt32(&inflight, 1)
+				for {
+					high := atomic.LoadInt32(&highest)
+					if cur <= high || atomic.CompareAndSwapInt32(&highest, high, cur) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&inflight, -1)
+			})
+			if err != nil {
+				t.Errorf("Do returned an error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if highest > 5 {
+		t.Errorf("Expected no more than 5 functions in flight, but %d were in flight", highest)
+	} else if highest < 2 {
+		t.Errorf("The functions did not execute concurrently")
+	}
+}
+
+func TestAcquireSlotCanceled(t *testing.T) {
+	srv := newTestService()
+	srv.SetMaxConcurrent(1)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if err := srv.AcquireSlot(context.Background()); err != nil {
+		t.Fatalf("Failed to acquire the only slot: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.AcquireSlot(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context deadline to be exceeded, received %v", err)
+	}
+
+	srv.ReleaseSlot()
+	if err := srv.AcquireSlot(context.Background()); err != nil {
+		t.Errorf("The slot was not available after being released: %v", err)
+	}
+	srv.ReleaseSlot()
+}
+
+func TestAcquireSlotStopped(t *testing.T) {
+	srv := newTestService()
+	srv.SetMaxConcurrent(1)
+
+	_ = srv.Start()
+	_ = srv.AcquireSlot(context.Background())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- srv.AcquireSlot(context.Background())
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	_ = srv.Stop()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if !errors.Is(err, ErrServiceStopped) {
+			t.Errorf("Expected ErrServiceStopped for the waiters, received %v", err)
+		}
+	}
+}
+
+func TestSetMaxConcurrentGrantsWaiters(t *testing.T) {
+	srv := newTestService()
+	srv.SetMaxConcurrent(1)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+	_ = srv.AcquireSlot(context.Background())
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- srv.AcquireSlot(context.Background()) }()
+
+	time.Sleep(20 * time.Millisecond)
+	srv.SetMaxConcurrent(2)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("Failed to acquire the slot: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The waiter was not granted a slot after the maximum was raised")
+	}
+}
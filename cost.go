@@ -0,0 +1,76 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import "context"
+
+// Coster is implemented by the requests that use more than one unit of the rate limit, such as a
+// zone transfer costing more upstream quota than a single lookup. The Run method charges the cost
+// of the requests, or of their payloads, to the rate limit. Costs below one are charged as one.
+type Coster interface {
+	Cost() int
+}
+
+// WeightedLimiter is a Limiter that can wait for several units at once. The *rate.Limiter type
+// from the golang.org/x/time/rate package satisfies this interface, but fails to wait for more
+// units than its burst.
+type WeightedLimiter interface {
+	Limiter
+	WaitN(ctx context.Context, n int) error
+}
+
+// CheckRateLimitN is like CheckRateLimitErr, but waits until the rate limit permits n units, so a
+// call can use more than one unit of the rate set by SetRateLimit. Limiters that do not implement
+// WeightedLimiter are waited on n times.
+func (bas *BaseService) CheckRateLimitN(n int) error {
+	rlimit := bas.limiter()
+
+	return bas.takeN(rlimit, n)
+}
+
+func waitN(ctx context.Context, l Limiter, n int) error {
+	if n == 1 {
+		return l.Wait(ctx)
+	}
+	if wl, ok := l.(WeightedLimiter); ok {
+		return wl.WaitN(ctx, n)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := l.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestCost returns the number of units of the rate limit used by the request.
+func requestCost(req interface{}) int {
+	c, ok := req.(Coster)
+	if !ok {
+		c, ok = Unwrap(req).(Coster)
+	}
+	if !ok {
+		return 1
+	}
+	return max(c.Cost(), 1)
+}
+
+// chargeCost charges the units of the request beyond the unit checked before it was received.
+// The default limiter delays the requests that follow, while other limiters are waited on.
+func (bas *BaseService) chargeCost(req interface{}) error {
+	n := requestCost(req) - 1
+	if n <= 0 {
+		return nil
+	}
+
+	rlimit := bas.limiter()
+
+	if p, ok := rlimit.(*pacer); ok {
+		p.charge(n)
+		return nil
+	}
+	return bas.takeN(rlimit, n)
+}
@@ -0,0 +1,91 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type costedRequest int
+
+func (c costedRequest) Cost() int { return int(c) }
+
+func TestRequestCost(t *testing.T) {
+	clock := newFakeClock()
+	srv := newEchoService("Cost", WithClock(clock))
+	srv.SetRateLimit(10)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	// The request uses five units, so the next one waits for five intervals
+	srv.Input() <- &Message{Payload: costedRequest(5)}
+	<-srv.Output()
+
+	clock.waitTimers(t, 1)
+	clock.Advance(500*time.Millisecond - time.Nanosecond)
+	select {
+	case srv.Input() <- "next":
+		t.Fatalf("Expected the cost of the request to delay the next request")
+	default:
+	}
+
+	clock.Advance(time.Nanosecond)
+	srv.Input() <- "next"
+	<-srv.Output()
+
+	// A request without a cost uses a single unit
+	clock.waitTimers(t, 1)
+	clock.Advance(100 * time.Millisecond)
+	srv.Input() <- "last"
+	<-srv.Output()
+}
+
+type weightedLimiter struct {
+	units chan int
+}
+
+func (l *weightedLimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+func (l *weightedLimiter) WaitN(ctx context.Context, n int) error {
+	l.units <- n
+	return nil
+}
+
+func TestCheckRateLimitN(t *testing.T) {
+	srv := newTestService()
+	wl := &weightedLimiter{units: make(chan int, 1)}
+	srv.SetRateLimiter(wl)
+
+	if err := srv.CheckRateLimitN(3); err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	if n := <-wl.units; n != 3 {
+		t.Errorf("Expected the limiter to wait for 3 units, received %d", n)
+	}
+
+	// Limiters without WaitN are waited on once for each unit
+	counter := &countingLimiter{}
+	srv.SetRateLimiter(counter)
+	if err := srv.CheckRateLimitN(4); err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	if n := counter.calls; n != 4 {
+		t.Errorf("Expected the limiter to be waited on 4 times, received %d", n)
+	}
+}
+
+type countingLimiter struct {
+	calls int
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.calls++
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultDeadLetterBuffer is the default number of dead letters kept until they are read.
+const DefaultDeadLetterBuffer = 64
+
+// DeadLetterReason describes why a message could not be processed.
+type DeadLetterReason int
+
+// The reasons for dead letters.
+const (
+	// DeadLetterHandlerError is used for requests the handler failed to process.
+	DeadLetterHandlerError DeadLetterReason = iota
+	// DeadLetterExpired is used for requests that were not processed in time.
+	DeadLetterExpired
+	// DeadLetterBufferFull is used for messages dropped because a buffer was full.
+	DeadLetterBufferFull
+	// DeadLetterCanceled is used for messages discarded because the service stopped or the request was canceled.
+	DeadLetterCanceled
+	// DeadLetterDuplicate is used for requests skipped because the same request was recently received.
+	DeadLetterDuplicate
+	// DeadLetterRequeueLimit is used for messages requeued after they reached the requeue limit.
+	DeadLetterRequeueLimit
+)
+
+var deadLetterNames = [...]string{
+	DeadLetterHandlerError: "handler error",
+	DeadLetterExpired:      "expired",
+	DeadLetterBufferFull:   "buffer full",
+	DeadLetterCanceled:     "canceled",
+	DeadLetterDuplicate:    "duplicate",
+	DeadLetterRequeueLimit: "requeue limit",
+}
+
+// String implements the Stringer interface.
+func (r DeadLetterReason) String() string {
+	if r < 0 || int(r) >= len(deadLetterNames) {
+		return "unknown"
+	}
+	return deadLetterNames[r]
+}
+
+// DeadLetter is a message that the service failed to process or deliver.
+type DeadLetter struct {
+	Payload interface{}
+	Reason  DeadLetterReason
+	Err     error
+	Time    time.Time
+	// The number of times the handler was executed for the message
+	Attempts int
+	// The time the message was sent to the service, when known
+	EnqueuedAt time.Time
+}
+
+type deadLetters struct {
+	sync.Mutex
+	ch      chan DeadLetter
+	dropped uint64
+}
+
+// WithDeadLetterBuffer sets the number of dead letters kept until they are read.
+func WithDeadLetterBuffer(size int) Option {
+	return func(bas *BaseService) {
+		bas.dead.ch = make(chan DeadLetter, size)
+	}
+}
+
+// DeadLetters returns the channel receiving the messages that the service failed to process or
+// deliver. The channel is never closed, so the dead letters can be read after the service stops.
+// Once the buffer is full, the oldest dead letter is discarded for each new one.
+func (bas *BaseService) DeadLetters() <-chan DeadLetter {
+	return bas.dead.ch
+}
+
+// DroppedDeadLetters returns the number of dead letters discarded because nobody read them.
+func (bas *BaseService) DroppedDeadLetters() uint64 {
+	d := &bas.dead
+	d.Lock()
+	defer d.Unlock()
+
+	return d.dropped
+}
+
+// ReportDeadLetter adds the payload to the dead letters, without blocking. The metadata of a
+// *Message payload is copied to the dead letter.
+func (bas *BaseService) ReportDeadLetter(payload interface{}, reason DeadLetterReason, err error) {
+	msg, _ := payload.(*Message)
+
+	bas.deadLetter(payload, msg, reason, err)
+}
+
+func (bas *BaseService) deadLetter(payload interface{}, env *Message, reason DeadLetterReason, err error) {
+	dl := DeadLetter{
+		Payload: payload,
+		Reason:  reason,
+		Err:     err,
+		Time:    time.Now(),
+	}
+	if env != nil {
+		dl.Attempts = env.Attempts
+		dl.EnqueuedAt = env.EnqueuedAt
+	}
+
+	d := &bas.dead
+	d.Lock()
+	defer d.Unlock()
+
+	for {
+		select {
+		case d.ch <- dl:
+			return
+		default:
+		}
+
+		select {
+		case <-d.ch:
+			d.dropped++
+		default:
+			// The buffer has no capacity
+			if cap(d.ch) == 0 {
+				d.dropped++
+				return
+			}
+		}
+	}
+}
+
+// deadLetterReason returns the reason for a request that failed with the error.
+func deadLetterReason(err error) DeadLetterReason {
+	switch {
+	case errors.Is(err, ErrRequestTimeout), errors.Is(err, ErrMessageExpired), errors.Is(err, context.DeadlineExceeded):
+		return DeadLetterExpired
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrServiceStopped):
+		return DeadLetterCanceled
+	case errors.Is(err, ErrDuplicateMessage):
+		return DeadLetterDuplicate
+	}
+	return DeadLetterHandlerError
+}
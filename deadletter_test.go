@@ -0,0 +1,139 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterHandlerError(t *testing.T) {
+	errFailed := errors.New("failed")
+	srv := NewSimpleService("DeadLetter", func(req interface{}) (interface{}, error) {
+		return nil, errFailed
+	})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "request"
+	select {
+	case dl := <-srv.DeadLetters():
+		if dl.Payload != "request" {
+			t.Errorf("Expected the request as the payload and received %v", dl.Payload)
+		}
+		if dl.Reason != DeadLetterHandlerError {
+			t.Errorf("Expected the reason %v and received %v", DeadLetterHandlerError, dl.Reason)
+		}
+		if !errors.Is(dl.Err, errFailed) {
+			t.Errorf("Expected the handler error and received %v", dl.Err)
+		}
+		if dl.Time.IsZero() {
+			t.Errorf("The dead letter does not have a timestamp")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The failed request was not routed to the dead letters")
+	}
+}
+
+func TestDeadLetterExpired(t *testing.T) {
+	clock := newFakeClock()
+	release := make(chan struct{})
+	defer close(release)
+
+	srv := NewSimpleService("Expired", func(req interface{}) (interface{}, error) {
+		<-release
+		return req, nil
+	}, WithRequestTimeout(time.Hour), WithClock(clock))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "slow"
+	// The timer of the request timeout is waiting once the handler runs
+	clock.waitTimers(t, 1)
+	clock.Advance(time.Hour)
+	select {
+	case dl := <-srv.DeadLetters():
+		if dl.Reason != DeadLetterExpired {
+			t.Errorf("Expected the reason %v and received %v", DeadLetterExpired, dl.Reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The expired request was not routed to the dead letters")
+	}
+}
+
+func TestDeadLetterBufferFull(t *testing.T) {
+	srv := newEchoService("BufferFull")
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	sub, unsub := srv.Subscribe(WithSubscriberBuffer(1))
+	defer unsub()
+
+	srv.Input() <- 1
+	srv.Input() <- 2
+	select {
+	case dl := <-srv.DeadLetters():
+		if dl.Payload != 2 || dl.Reason != DeadLetterBufferFull {
+			t.Errorf("Expected 2 dropped with a full buffer and received %v: %v", dl.Payload, dl.Reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The dropped result was not routed to the dead letters")
+	}
+	if result := <-sub; result != 1 {
+		t.Errorf("Expected 1 to be delivered and received %v", result)
+	}
+}
+
+func TestDeadLetterCanceled(t *testing.T) {
+	srv := newBlockingService()
+
+	go func() { <-srv.entered; srv.release <- struct{}{} }()
+	_ = srv.Start()
+
+	stopped := make(chan error)
+	go func() { stopped <- srv.Stop() }()
+	// The request is discarded while OnStop is executed
+	<-srv.entered
+	srv.Input() <- "discarded"
+	srv.release <- struct{}{}
+	<-stopped
+
+	select {
+	case dl := <-srv.DeadLetters():
+		if dl.Payload != "discarded" || dl.Reason != DeadLetterCanceled {
+			t.Errorf("Expected the discarded request to be canceled and received %v: %v", dl.Payload, dl.Reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The discarded request was not routed to the dead letters")
+	}
+}
+
+func TestDeadLetterDropped(t *testing.T) {
+	srv := new(BaseService)
+	srv.Init(srv, "Dropped", WithDeadLetterBuffer(2))
+
+	for i := 0; i < 5; i++ {
+		srv.ReportDeadLetter(i, DeadLetterHandlerError, nil)
+	}
+	if n := srv.DroppedDeadLetters(); n != 3 {
+		t.Errorf("Expected 3 dropped dead letters and counted %d", n)
+	}
+	if a, b := <-srv.DeadLetters(), <-srv.DeadLetters(); a.Payload != 3 || b.Payload != 4 {
+		t.Errorf("Expected the newest dead letters to be kept, received %v and %v", a.Payload, b.Payload)
+	}
+}
+
+func TestDeadLetterReasonString(t *testing.T) {
+	if s := DeadLetterBufferFull.String(); s != "buffer full" {
+		t.Errorf("Expected buffer full and received %s", s)
+	}
+	if s := DeadLetterReason(-1).String(); s != "unknown" {
+		t.Errorf("Expected unknown and received %s", s)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DebounceOption configures a Debounce during construction. Each Option is also a
+// DebounceOption, so the windows can be timed by the clock set with WithClock.
+type DebounceOption interface {
+	applyDebounce(*Debounce)
+}
+
+func (o Option) applyDebounce(d *Debounce) {
+	o(&d.BaseService)
+}
+
+// DebounceStats is a snapshot of the activity of a Debounce.
+type DebounceStats struct {
+	// The number of keys with an event waiting for the window to close
+	Pending int
+	// The number of events replaced by a later event with the same key
+	Suppressed map[string]uint64
+}
+
+type pendingEvent struct {
+	msg      interface{}
+	deadline time.Time
+	seq      uint64
+}
+
+// Debounce is a service that collapses the events received with the same key during a window into
+// the last of them. The window opens with the first event for the key, and the last event is sent
+// on the Output channel once the window closes. The pending events are sent when the Debounce stops.
+type Debounce struct {
+	BaseService
+	window     time.Duration
+	key        func(msg interface{}) string
+	mu         sync.Mutex
+	pending    map[string]*pendingEvent
+	suppressed map[string]uint64
+	seq        uint64
+	flush      chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewDebounce returns a Debounce that obtains the key of each event from the provided function.
+func NewDebounce(name string, window time.Duration, key func(msg interface{}) string, opts ...DebounceOption) *Debounce {
+	d := &Debounce{
+		window:     window,
+		key:        key,
+		pending:    make(map[string]*pendingEvent),
+		suppressed: make(map[string]uint64),
+		flush:      make(chan struct{}, 1),
+	}
+	d.Init(d, name)
+
+	for _, opt := range opts {
+		opt.applyDebounce(d)
+	}
+	return d
+}
+
+// DebounceStats returns a snapshot of the pending and suppressed events.
+func (d *Debounce) DebounceStats() DebounceStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s := DebounceStats{
+		Pending:    len(d.pending),
+		Suppressed: make(map[string]uint64, len(d.suppressed)),
+	}
+	for k, n := range d.suppressed {
+		s.Suppressed[k] = n
+	}
+	return s
+}
+
+// Flush sends the pending events without waiting for their windows to close.
+func (d *Debounce) Flush() {
+	select {
+	case d.flush <- struct{}{}:
+	default:
+	}
+}
+
+// OnStart implements the Service interface.
+func (d *Debounce) OnStart() error {
+	d.wg.Add(1)
+	d.RunLabeled(d.Context(), "debounce", d.debounce)
+	d.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (d *Debounce) OnStop() error {
+	d.wg.Wait()
+	return nil
+}
+
+func (d *Debounce) debounce(ctx context.Context) {
+	defer d.wg.Done()
+
+	var timer Timer
+	defer func() { stopTimer(timer) }()
+
+	// The window the timer is waiting for, so the timer is only reset when the next window changed
+	var armed time.Time
+	for {
+		var closed <-chan time.Time
+		if next, ok := d.nextDeadline(); ok {
+			if !next.Equal(armed) {
+				timer = d.resetTimer(timer, next.Sub(d.clock.Now()))
+				armed = next
+			}
+			closed = timer.C()
+		} else if !armed.IsZero() {
+			stopTimer(timer)
+			armed = time.Time{}
+		}
+
+		select {
+		case <-ctx.Done():
+			for _, msg := range d.take(time.Time{}) {
+				d.emitFlushed(ctx, msg)
+			}
+			return
+		case req := <-d.Input():
+			d.IncReceived()
+			d.add(req)
+		case <-closed:
+			armed = time.Time{}
+			for _, msg := range d.take(d.clock.Now()) {
+				d.emit(ctx, msg)
+			}
+		case <-d.flush:
+			for _, msg := range d.take(time.Time{}) {
+				d.emit(ctx, msg)
+			}
+		}
+	}
+}
+
+func (d *Debounce) add(msg interface{}) {
+	k := d.key(Unwrap(msg))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if p, found := d.pending[k]; found {
+		p.msg = msg
+		d.suppressed[k]++
+		return
+	}
+	d.seq++
+	d.pending[k] = &pendingEvent{msg: msg, deadline: d.clock.Now().Add(d.window), seq: d.seq}
+}
+
+func (d *Debounce) nextDeadline() (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var next time.Time
+	for _, p := range d.pending {
+		if next.IsZero() || p.deadline.Before(next) {
+			next = p.deadline
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// take removes the events with a window closed at the time, or every event for the zero time,
+// and returns them in the order their windows opened.
+func (d *Debounce) take(now time.Time) []interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var events []*pendingEvent
+	for k, p := range d.pending {
+		if now.IsZero() || !p.deadline.After(now) {
+			events = append(events, p)
+			delete(d.pending, k)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].deadline.Equal(events[j].deadline) {
+			return events[i].deadline.Before(events[j].deadline)
+		}
+		return events[i].seq < events[j].seq
+	})
+
+	msgs := make([]interface{}, len(events))
+	for i, p := range events {
+		msgs[i] = p.msg
+	}
+	return msgs
+}
@@ -0,0 +1,122 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func firstLetter(msg interface{}) string {
+	return msg.(string)[:1]
+}
+
+func newTestDebounce() (*Debounce, *fakeClock) {
+	clock := newFakeClock()
+
+	d := NewDebounce("Debounce", time.Second, firstLetter, WithClock(clock))
+	return d, clock
+}
+
+func TestDebounce(t *testing.T) {
+	d, clock := newTestDebounce()
+
+	_ = d.Start()
+	defer func() { _ = d.Stop() }()
+
+	for _, msg := range []string{"a1", "b1", "a2", "a3"} {
+		d.Input() <- msg
+	}
+	select {
+	case msg := <-d.Output():
+		t.Fatalf("The event %v was sent before the window closed", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	clock.waitTimers(t, 1)
+	clock.Advance(time.Second)
+	for _, expected := range []string{"a3", "b1"} {
+		select {
+		case msg := <-d.Output():
+			if msg != expected {
+				t.Errorf("Expected %s once the window closed and received %v", expected, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("The event %s was not sent when the window closed", expected)
+		}
+	}
+
+	s := d.DebounceStats()
+	if s.Suppressed["a"] != 2 || s.Suppressed["b"] != 0 {
+		t.Errorf("Expected 2 suppressed events for a and none for b, received %v", s.Suppressed)
+	}
+	if s.Pending != 0 {
+		t.Errorf("Expected no pending events and counted %d", s.Pending)
+	}
+}
+
+func TestDebounceWindows(t *testing.T) {
+	d, clock := newTestDebounce()
+
+	_ = d.Start()
+	defer func() { _ = d.Stop() }()
+
+	d.Input() <- "a1"
+	clock.waitTimers(t, 1)
+	clock.Advance(600 * time.Millisecond)
+	d.Input() <- "b1"
+	clock.Advance(600 * time.Millisecond)
+
+	if msg := <-d.Output(); msg != "a1" {
+		t.Errorf("Expected the window of a to close first and received %v", msg)
+	}
+	// The window of b is still open
+	for d.DebounceStats().Pending != 1 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDebounceFlush(t *testing.T) {
+	d, _ := newTestDebounce()
+
+	_ = d.Start()
+	defer func() { _ = d.Stop() }()
+
+	d.Input() <- "a1"
+	d.Flush()
+	select {
+	case msg := <-d.Output():
+		if msg != "a1" {
+			t.Errorf("Expected the pending event to be flushed and received %v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The pending event was not flushed")
+	}
+}
+
+func TestDebounceFlushOnStop(t *testing.T) {
+	d, _ := newTestDebounce()
+
+	_ = d.Start()
+	d.Input() <- "a1"
+	d.Input() <- "b1"
+	_ = d.Stop()
+
+	// The events are sent on the Output channel, or discarded to the dead letters by the stop
+	flushed := make(map[interface{}]bool)
+	for len(flushed) < 2 {
+		select {
+		case msg := <-d.Output():
+			flushed[msg] = true
+		case dl := <-d.DeadLetters():
+			flushed[dl.Payload] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Only %d of the 2 pending events were flushed on stop", len(flushed))
+		}
+	}
+	if !flushed["a1"] || !flushed["b1"] {
+		t.Errorf("The pending events were not flushed on stop: %v", flushed)
+	}
+}
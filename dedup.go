@@ -0,0 +1,126 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultDedupEntries is the default number of keys remembered by the deduplication window.
+const DefaultDedupEntries = 10000
+
+// dedupWindow remembers the keys of the requests seen during the window. The entries are kept in
+// the order they were last used, so the least recently used key is evicted once the cache is full.
+type dedupWindow struct {
+	sync.Mutex
+	window  time.Duration
+	key     func(msg interface{}) string
+	max     int
+	now     func() time.Time
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type dedupEntry struct {
+	key  string
+	seen time.Time
+}
+
+// SetDedupWindow makes the Run method skip the requests with the same key as a request received
+// during the last window. The key of each request is obtained from the provided function, and the
+// skipped duplicates are counted in Stats and routed to the dead letters with DeadLetterDuplicate.
+// The number of keys remembered is bounded by SetDedupEntries. Setting the window discards the keys
+// already seen, and a zero window disables the deduplication.
+func (bas *BaseService) SetDedupWindow(d time.Duration, key func(msg interface{}) string) {
+	bas.Lock()
+	defer bas.Unlock()
+
+	if d <= 0 || key == nil {
+		bas.dedup.Store(nil)
+		return
+	}
+
+	limit := bas.dedupMax
+	if limit <= 0 {
+		limit = DefaultDedupEntries
+	}
+	bas.dedup.Store(&dedupWindow{
+		window:  d,
+		key:     key,
+		max:     limit,
+		now:     bas.clock.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	})
+}
+
+// SetDedupEntries sets the maximum number of keys remembered by the deduplication window. Once the
+// limit is reached, the least recently used key is forgotten for each new key.
+func (bas *BaseService) SetDedupEntries(n int) {
+	bas.Lock()
+	defer bas.Unlock()
+
+	bas.dedupMax = n
+	if dw := bas.dedup.Load(); dw != nil {
+		dw.Lock()
+		defer dw.Unlock()
+
+		if dw.max = n; n <= 0 {
+			dw.max = DefaultDedupEntries
+		}
+		dw.evict()
+	}
+}
+
+// duplicate reports whether the request has the key of a request received during the window. The
+// duplicate is routed to the dead letters, and the caller waiting in Request receives the error.
+func (bas *BaseService) duplicate(req interface{}) bool {
+	dw := bas.dedup.Load()
+	if dw == nil || !dw.seen(dw.key(Unwrap(req))) {
+		return false
+	}
+
+	err := fmt.Errorf("%s: %w", bas.name, ErrDuplicateMessage)
+	bas.stats.duplicates.Add(1)
+	bas.ReportDeadLetter(req, DeadLetterDuplicate, err)
+	if msg, ok := req.(*Message); ok {
+		msg.Reply(nil, err)
+	}
+	return true
+}
+
+// seen records the key, and reports whether it was already recorded during the window.
+func (dw *dedupWindow) seen(key string) bool {
+	dw.Lock()
+	defer dw.Unlock()
+
+	now := dw.now()
+	if e, found := dw.entries[key]; found {
+		dw.order.MoveToFront(e)
+
+		entry := e.Value.(*dedupEntry)
+		if now.Sub(entry.seen) < dw.window {
+			return true
+		}
+		entry.seen = now
+		return false
+	}
+
+	dw.entries[key] = dw.order.PushFront(&dedupEntry{key: key, seen: now})
+	dw.evict()
+	return false
+}
+
+func (dw *dedupWindow) evict() {
+	for dw.order.Len() > dw.max {
+		e := dw.order.Back()
+
+		dw.order.Remove(e)
+		delete(dw.entries, e.Value.(*dedupEntry).key)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func valueKey(msg interface{}) string {
+	return fmt.Sprint(msg)
+}
+
+func TestDedupWindow(t *testing.T) {
+	srv := newEchoService("Dedup", WithInputBuffer(10))
+	srv.SetDedupWindow(time.Minute, valueKey)
+
+	for _, req := range []string{"a", "b", "a", "a", "c"} {
+		_ = srv.Send(context.Background(), req)
+	}
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for _, expected := range []string{"a", "b", "c"} {
+		select {
+		case result := <-srv.Output():
+			if result != expected {
+				t.Errorf("Expected %s to be processed and received %v", expected, result)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("The request %s was not processed", expected)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		dl := <-srv.DeadLetters()
+		if dl.Reason != DeadLetterDuplicate || !errors.Is(dl.Err, ErrDuplicateMessage) {
+			t.Errorf("Expected a duplicate and received %v: %v", dl.Reason, dl.Err)
+		}
+		if dl.Payload != "a" {
+			t.Errorf("Expected the request a to be a duplicate and received %v", dl.Payload)
+		}
+	}
+	if s := srv.Stats(); s.Duplicates != 2 || s.Received != 3 {
+		t.Errorf("Expected 2 duplicates and 3 requests received, counted %d and %d", s.Duplicates, s.Received)
+	}
+}
+
+func TestDedupRequest(t *testing.T) {
+	srv := newEchoService("Dedup")
+	srv.SetDedupWindow(time.Minute, valueKey)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if _, err := srv.Request(context.Background(), "a"); err != nil {
+		t.Fatalf("The first request failed: %v", err)
+	}
+	if _, err := srv.Request(context.Background(), "a"); !errors.Is(err, ErrDuplicateMessage) {
+		t.Errorf("Expected the second request to return ErrDuplicateMessage and received %v", err)
+	}
+}
+
+func TestDedupExpiry(t *testing.T) {
+	clock := newFakeClock()
+	srv := newEchoService("Dedup", WithClock(clock))
+	srv.SetDedupWindow(time.Minute, valueKey)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	_, _ = srv.Request(context.Background(), "a")
+	clock.Advance(59 * time.Second)
+	if _, err := srv.Request(context.Background(), "a"); !errors.Is(err, ErrDuplicateMessage) {
+		t.Errorf("Expected the request within the window to be a duplicate, received %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	if result, err := srv.Request(context.Background(), "a"); err != nil || result != "a" {
+		t.Errorf("Expected the request after the window to be processed, received %v: %v", result, err)
+	}
+}
+
+func TestDedupEntries(t *testing.T) {
+	srv := newTestService()
+	srv.SetDedupWindow(time.Minute, valueKey)
+	srv.SetDedupEntries(2)
+	dw := srv.dedup.Load()
+
+	dw.seen("a")
+	dw.seen("b")
+	// The use of a makes b the least recently used key
+	if !dw.seen("a") {
+		t.Errorf("Expected the key a to be remembered")
+	}
+	dw.seen("c")
+
+	if n := dw.order.Len(); n != 2 {
+		t.Errorf("Expected 2 keys to be remembered and counted %d", n)
+	}
+	if !dw.seen("a") || !dw.seen("c") {
+		t.Errorf("Expected the recently used keys to be remembered")
+	}
+	if dw.seen("b") {
+		t.Errorf("Expected the least recently used key to be evicted")
+	}
+}
+
+func TestDedupDisabled(t *testing.T) {
+	srv := newEchoService("Dedup")
+	srv.SetDedupWindow(time.Minute, valueKey)
+	srv.SetDedupWindow(0, nil)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 0; i < 2; i++ {
+		if _, err := srv.Request(context.Background(), "a"); err != nil {
+			t.Errorf("Expected the deduplication to be disabled and received %v", err)
+		}
+	}
+}
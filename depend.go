@@ -0,0 +1,194 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReadyTimeout is the time permitted by StartAll for the services marked by AwaitReady to be
+// ready.
+const DefaultReadyTimeout = 30 * time.Second
+
+// DependsOn declares that the service depends on the members of the group with the provided names,
+// as returned by their String method. StartAll starts the service after its dependencies, and
+// StopAll stops it before them. WithDependencies declares the same for a Registry.
+func DependsOn(names ...string) MemberOption {
+	return func(c *memberConfig) {
+		c.deps = append(c.deps, names...)
+	}
+}
+
+// AwaitReady makes StartAll wait until the service is marked ready by its Ready method, as reported
+// by WaitStarted, rather than until its Start method returns, so the services started after it or
+// depending on it are started once it is ready. It has no effect on the services that do not
+// provide WaitStarted. The wait is bounded by the context of StartAllContext, or by
+// DefaultReadyTimeout for StartAll.
+func AwaitReady() MemberOption {
+	return func(c *memberConfig) {
+		c.awaitReady = true
+	}
+}
+
+// The services that report when they are ready, such as those embedding BaseService
+type startWaiter interface {
+	WaitStarted(ctx context.Context) error
+}
+
+// dependencyOrder returns the services sorted so each service follows its dependencies, keeping the
+// order of the services otherwise. The dependencies that are not among the services are ignored,
+// unless strict is set, and an error wrapping ErrUnknownDependency is returned for them.
+func dependencyOrder(services []Service, deps map[Service][]string, strict bool) ([]Service, error) {
+	byName := make(map[string]Service, len(services))
+	for _, srv := range services {
+		byName[srv.String()] = srv
+	}
+
+	pending := make(map[Service]int, len(services))
+	dependents := make(map[Service][]Service)
+	for _, srv := range services {
+		for _, name := range deps[srv] {
+			dep, found := byName[name]
+			if !found {
+				if strict {
+					return nil, fmt.Errorf("%s: %w: %s", srv, ErrUnknownDependency, name)
+				}
+				continue
+			}
+			pending[srv]++
+			dependents[dep] = append(dependents[dep], srv)
+		}
+	}
+
+	order := make([]Service, 0, len(services))
+	placed := make(map[Service]bool, len(services))
+	for len(order) < len(services) {
+		var progress bool
+
+		for _, srv := range services {
+			if placed[srv] || pending[srv] > 0 {
+				continue
+			}
+
+			placed[srv] = true
+			order = append(order, srv)
+			for _, d := range dependents[srv] {
+				pending[d]--
+			}
+			progress = true
+		}
+		if !progress {
+			var names []string
+			for _, srv := range services {
+				if !placed[srv] {
+					names = append(names, srv.String())
+				}
+			}
+			return nil, fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(names, ", "))
+		}
+	}
+	return order, nil
+}
+
+// stopOrder returns the members in the order their dependencies are started, or in the order they
+// were added when the dependencies are not valid. The group must be locked.
+func (g *Group) stopOrder() []Service {
+	if len(g.deps) > 0 {
+		if order, err := dependencyOrder(g.members, g.deps, true); err == nil {
+			return order
+		}
+	}
+	return append([]Service(nil), g.members...)
+}
+
+// awaitStarted waits until the service is ready when it is among the services awaited.
+func awaitStarted(ctx context.Context, srv Service, await map[Service]struct{}) error {
+	if _, found := await[srv]; !found {
+		return nil
+	}
+	if sw, ok := srv.(startWaiter); ok {
+		return sw.WaitStarted(ctx)
+	}
+	return nil
+}
+
+// The progress of a member started by startGraph
+type startNode struct {
+	// Closed once the dependents of the member can proceed
+	done    chan struct{}
+	started bool
+	// The dependents of the member can be started
+	ready bool
+	err   error
+}
+
+// startGraph starts each service once its dependencies have started, so the services that do not
+// depend on each other are started concurrently. The services marked by AwaitReady are waited for
+// until the context is done. When a service fails to start, the services depending on it are not
+// started, and the services already started are stopped in the reverse order. The group must not
+// be locked, so the dependencies and the services awaited are provided.
+func startGraph(ctx context.Context, order []Service, deps map[Service][]string, await map[Service]struct{}) error {
+	byName := make(map[string]Service, len(order))
+	nodes := make(map[Service]*startNode, len(order))
+	for _, srv := range order {
+		byName[srv.String()] = srv
+		nodes[srv] = &startNode{done: make(chan struct{})}
+	}
+
+	var wg sync.WaitGroup
+	for _, srv := range order {
+		wg.Add(1)
+		go func(srv Service, n *startNode) {
+			defer wg.Done()
+			defer close(n.done)
+
+			for _, name := range deps[srv] {
+				dep := nodes[byName[name]]
+				if <-dep.done; !dep.ready {
+					return
+				}
+			}
+
+			if err := srv.Start(); err != nil {
+				n.err = fmt.Errorf("%s: failed to start: %w", srv, err)
+				return
+			}
+			n.started = true
+
+			if err := awaitStarted(ctx, srv, await); err != nil {
+				n.err = fmt.Errorf("%s: failed to start: %w", srv, err)
+				return
+			}
+			n.ready = true
+		}(srv, nodes[srv])
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, srv := range order {
+		if err := nodes[srv].err; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	var started []Service
+	for _, srv := range order {
+		if nodes[srv].started {
+			started = append(started, srv)
+		}
+	}
+	if err := stopReverse(started); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,218 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGroupDependencies(t *testing.T) {
+	var order []string
+	rec := &recorder{events: &order}
+
+	// A diamond: the sink depends on both producers, which depend on the cache
+	g := NewGroup()
+	g.Add(newRecordedService("sink", rec), DependsOn("producer1", "producer2"))
+	g.Add(newRecordedService("producer1", rec), DependsOn("cache"))
+	g.Add(newRecordedService("producer2", rec), DependsOn("cache"))
+	g.Add(newRecordedService("cache", rec))
+
+	if err := g.StartAll(); err != nil {
+		t.Fatalf("Failed to start the group: %v", err)
+	}
+	if err := g.StopAll(); err != nil {
+		t.Fatalf("Failed to stop the group: %v", err)
+	}
+
+	index := make(map[string]int)
+	for i, e := range order {
+		index[e] = i
+	}
+	if len(index) != 8 {
+		t.Fatalf("Expected every service to start and stop once, received %v", order)
+	}
+
+	edges := [][2]string{
+		{"sink", "producer1"},
+		{"sink", "producer2"},
+		{"producer1", "cache"},
+		{"producer2", "cache"},
+	}
+	for _, e := range edges {
+		if index["start "+e[1]] > index["start "+e[0]] {
+			t.Errorf("Expected %s to start before %s, received %v", e[1], e[0], order)
+		}
+		if index["stop "+e[0]] > index["stop "+e[1]] {
+			t.Errorf("Expected %s to stop before %s, received %v", e[0], e[1], order)
+		}
+	}
+}
+
+func TestGroupDependencyErrors(t *testing.T) {
+	var order []string
+	rec := &recorder{events: &order}
+
+	g := NewGroup()
+	g.Add(newRecordedService("A", rec), DependsOn("C"))
+	g.Add(newRecordedService("B", rec), DependsOn("A"))
+	g.Add(newRecordedService("C", rec), DependsOn("B"))
+	g.Add(newRecordedService("D", rec))
+	if err := g.StartAll(); !errors.Is(err, ErrDependencyCycle) {
+		t.Errorf("Expected ErrDependencyCycle, received %v", err)
+	}
+
+	g2 := NewGroup()
+	g2.Add(newRecordedService("A", rec), DependsOn("missing"))
+	if err := g2.StartAll(); !errors.Is(err, ErrUnknownDependency) {
+		t.Errorf("Expected ErrUnknownDependency, received %v", err)
+	}
+
+	if len(order) != 0 {
+		t.Errorf("Expected no service to start when the dependencies are not valid, received %v", order)
+	}
+}
+
+func TestGroupDependencyFailure(t *testing.T) {
+	var order []string
+	rec := &recorder{events: &order}
+	failing := new(failingService)
+	failing.Init(failing, "Failing")
+
+	g := NewGroup()
+	g.Add(newRecordedService("A", rec))
+	g.Add(failing, DependsOn("A"))
+	g.Add(newRecordedService("B", rec), DependsOn("Failing"))
+	if err := g.StartAll(); !errors.Is(err, errStartFailed) {
+		t.Fatalf("Expected the start error, received %v", err)
+	}
+
+	expected := []string{"start A", "stop A"}
+	if len(order) != len(expected) || order[0] != expected[0] || order[1] != expected[1] {
+		t.Errorf("Expected the events %v, received %v", expected, order)
+	}
+}
+
+// Becomes ready a while after it was started
+type slowReadyService struct {
+	recordedService
+}
+
+func (srv *slowReadyService) OnStart() error {
+	_ = srv.recordedService.OnStart()
+	time.AfterFunc(50*time.Millisecond, func() {
+		srv.rec.record("ready " + srv.String())
+		srv.Ready()
+	})
+	return nil
+}
+
+func TestGroupAwaitReady(t *testing.T) {
+	// The service added after the awaited service waits for it, whether it depends on it or not
+	for _, opts := range [][]MemberOption{nil, {DependsOn("Slow")}} {
+		var order []string
+		rec := &recorder{events: &order}
+		slow := &slowReadyService{recordedService: recordedService{rec: rec}}
+		slow.Init(slow, "Slow")
+
+		g := NewGroup()
+		g.Add(slow, AwaitReady())
+		g.Add(newRecordedService("A", rec), opts...)
+		if err := g.StartAll(); err != nil {
+			t.Fatalf("Failed to start the group: %v", err)
+		}
+
+		expected := []string{"start Slow", "ready Slow", "start A"}
+		if len(order) != len(expected) {
+			t.Errorf("Expected the events %v, received %v", expected, order)
+		} else {
+			for i, e := range expected {
+				if order[i] != e {
+					t.Errorf("Expected the events %v, received %v", expected, order)
+					break
+				}
+			}
+		}
+		_ = g.StopAll()
+	}
+}
+
+func TestGroupAwaitReadyLast(t *testing.T) {
+	// The service never calls Ready, and no service is started after it
+	for _, opts := range [][]MemberOption{{AwaitReady()}, {AwaitReady(), DependsOn("A")}} {
+		var order []string
+		rec := &recorder{events: &order}
+
+		g := NewGroup()
+		g.Add(newRecordedService("A", rec))
+		g.Add(newRecordedService("Never", rec), opts...)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if err := g.StartAllContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected StartAllContext to wait for the service, received %v", err)
+		}
+		cancel()
+
+		expected := []string{"start A", "start Never", "stop Never", "stop A"}
+		if len(order) != len(expected) {
+			t.Errorf("Expected the events %v, received %v", expected, order)
+			continue
+		}
+		for i, e := range expected {
+			if order[i] != e {
+				t.Errorf("Expected the events %v, received %v", expected, order)
+				break
+			}
+		}
+	}
+}
+
+func TestGroupAwaitReadyTimeout(t *testing.T) {
+	var order []string
+	rec := &recorder{events: &order}
+	started := func() bool {
+		rec.Lock()
+		defer rec.Unlock()
+
+		return len(order) > 0
+	}
+
+	// The service never calls Ready
+	g := NewGroup()
+	g.Add(newRecordedService("Never", rec), AwaitReady())
+	g.Add(newRecordedService("A", rec), DependsOn("Never"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() { errs <- g.StartAllContext(ctx) }()
+
+	for !started() {
+		time.Sleep(time.Millisecond)
+	}
+	// The group is not locked while the service is awaited
+	members := make(chan int, 1)
+	go func() { members <- len(g.Members()) }()
+	select {
+	case n := <-members:
+		if n != 2 {
+			t.Errorf("Expected 2 members, received %d", n)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("The group was locked while the service was awaited")
+	}
+
+	if err := <-errs; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context error, received %v", err)
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	expected := []string{"start Never", "stop Never"}
+	if len(order) != len(expected) || order[0] != expected[0] || order[1] != expected[1] {
+		t.Errorf("Expected the events %v, received %v", expected, order)
+	}
+}
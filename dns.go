@@ -0,0 +1,442 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDNSTimeout is the time permitted for a resolver to answer a query.
+const DefaultDNSTimeout = 2 * time.Second
+
+// The DNS record types decoded by a DNSService. Answers of other types carry the record data
+// encoded in hexadecimal.
+const (
+	DNSTypeA     uint16 = 1
+	DNSTypeNS    uint16 = 2
+	DNSTypeCNAME uint16 = 5
+	DNSTypeSOA   uint16 = 6
+	DNSTypePTR   uint16 = 12
+	DNSTypeMX    uint16 = 15
+	DNSTypeTXT   uint16 = 16
+	DNSTypeAAAA  uint16 = 28
+)
+
+// The DNS response codes handled by a DNSService.
+const (
+	DNSRcodeSuccess  = 0
+	DNSRcodeServFail = 2
+	DNSRcodeNXDomain = 3
+	DNSRcodeRefused  = 5
+)
+
+// DNSQuery is a request for the records of the type for the name.
+type DNSQuery struct {
+	Name string
+	Type uint16
+}
+
+// DNSAnswer is a record of the answer section of a DNS response.
+type DNSAnswer struct {
+	Name string
+	Type uint16
+	TTL  uint32
+	// The record data in presentation format, such as an IP address or a domain name
+	Data string
+}
+
+// DNSResponse is the result of a DNSQuery.
+type DNSResponse struct {
+	Query DNSQuery
+	// The address of the resolver that answered the query
+	Resolver string
+	Rcode    int
+	Answers  []DNSAnswer
+	Duration time.Duration
+}
+
+// ResolverStats is a snapshot of the queries sent to a resolver of a DNSService.
+type ResolverStats struct {
+	Resolver  string
+	Queries   uint64
+	Successes uint64
+	Failures  uint64
+	Timeouts  uint64
+}
+
+type dnsResolver struct {
+	addr      string
+	queries   atomic.Uint64
+	successes atomic.Uint64
+	failures  atomic.Uint64
+	timeouts  atomic.Uint64
+}
+
+// DNSService resolves the DNSQuery values received on its Input channel, and sends a
+// *DNSResponse for each on its Output channel. The queries are distributed across the resolvers,
+// and a query is sent to the next resolver when a resolver fails with SERVFAIL or REFUSED, or does
+// not answer in time. Responses truncated over UDP are queried again over TCP. Each resolver is
+// rate limited using SetRateLimitForKey with the address of the resolver as the key, or
+// SetResolverRateLimit. The timeouts are reported on the Errors channel, and the queries that no
+// resolver answered are reported as errors and routed to the dead letters.
+type DNSService struct {
+	BaseService
+	resolvers []*dnsResolver
+	next      atomic.Uint64
+	timeout   atomic.Int64
+}
+
+// NewDNSService returns a DNSService sending the queries to the resolvers. A resolver address
+// without a port uses port 53.
+func NewDNSService(name string, resolvers []string, opts ...Option) *DNSService {
+	ds := new(DNSService)
+	ds.timeout.Store(int64(DefaultDNSTimeout))
+
+	for _, addr := range resolvers {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		ds.resolvers = append(ds.resolvers, &dnsResolver{addr: addr})
+	}
+
+	ds.Init(ds, name, opts...)
+	return ds
+}
+
+// SetResolverRateLimit sets the number of queries permitted each second for each resolver.
+// A value of zero removes the rate limits of the resolvers.
+func (ds *DNSService) SetResolverRateLimit(persec int) {
+	for _, r := range ds.resolvers {
+		ds.SetRateLimitForKey(r.addr, persec)
+	}
+}
+
+// SetQueryTimeout sets the time permitted for a resolver to answer a query.
+func (ds *DNSService) SetQueryTimeout(d time.Duration) {
+	ds.timeout.Store(int64(d))
+}
+
+// ResolverStats returns the number of queries sent to each resolver, and their outcome.
+func (ds *DNSService) ResolverStats() []ResolverStats {
+	stats := make([]ResolverStats, 0, len(ds.resolvers))
+
+	for _, r := range ds.resolvers {
+		stats = append(stats, ResolverStats{
+			Resolver:  r.addr,
+			Queries:   r.queries.Load(),
+			Successes: r.successes.Load(),
+			Failures:  r.failures.Load(),
+			Timeouts:  r.timeouts.Load(),
+		})
+	}
+	return stats
+}
+
+// OnStart implements the Service interface.
+func (ds *DNSService) OnStart() error {
+	return ds.RunContext(ds.resolve)
+}
+
+func (ds *DNSService) resolve(ctx context.Context, in interface{}) (interface{}, error) {
+	q, ok := in.(DNSQuery)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported query type %T", ds, in)
+	}
+	if len(ds.resolvers) == 0 {
+		return nil, fmt.Errorf("%s: no resolvers", ds)
+	}
+
+	var failure error
+	start := int(ds.next.Add(1) - 1)
+	for i := range ds.resolvers {
+		r := ds.resolvers[(start+i)%len(ds.resolvers)]
+
+		if rlimit := ds.keyLimiter(r.addr); rlimit != nil {
+			if err := ds.take(rlimit); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := ds.query(ctx, r, q)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		failure = err
+	}
+	return nil, failure
+}
+
+// query sends the query to the resolver over UDP, and over TCP when the response is truncated.
+func (ds *DNSService) query(ctx context.Context, r *dnsResolver, q DNSQuery) (*DNSResponse, error) {
+	r.queries.Add(1)
+	start := time.Now()
+
+	msg, err := packDNSQuery(q)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ds, err)
+	}
+
+	resp, truncated, err := ds.exchange(ctx, "udp", r.addr, msg)
+	if err == nil && truncated {
+		resp, _, err = ds.exchange(ctx, "tcp", r.addr, msg)
+	}
+
+	var nerr net.Error
+	switch {
+	case errors.As(err, &nerr) && nerr.Timeout():
+		r.timeouts.Add(1)
+		err = fmt.Errorf("%s: resolver %s: %w", ds, r.addr, err)
+		ds.ReportError(err)
+		return nil, err
+	case err != nil:
+		r.failures.Add(1)
+		return nil, fmt.Errorf("%s: resolver %s: %w", ds, r.addr, err)
+	case resp.Rcode == DNSRcodeServFail || resp.Rcode == DNSRcodeRefused:
+		r.failures.Add(1)
+		return nil, fmt.Errorf("%s: resolver %s: rcode %d for %s", ds, r.addr, resp.Rcode, q.Name)
+	}
+
+	r.successes.Add(1)
+	resp.Query = q
+	resp.Resolver = r.addr
+	resp.Duration = time.Since(start)
+	return resp, nil
+}
+
+// exchange sends the message to the resolver and returns the response, and whether it was truncated.
+func (ds *DNSService) exchange(ctx context.Context, network, addr string, msg []byte) (*DNSResponse, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(ds.timeout.Load()))
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	// The pending read is interrupted when the context is canceled before the deadline
+	defer context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })()
+
+	var reply []byte
+	if network == "tcp" {
+		buf := make([]byte, 2+len(msg))
+		binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+		copy(buf[2:], msg)
+		if _, err := conn.Write(buf); err != nil {
+			return nil, false, err
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return nil, false, err
+		}
+		reply = make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return nil, false, err
+		}
+	} else {
+		if _, err := conn.Write(msg); err != nil {
+			return nil, false, err
+		}
+
+		// The responses with another ID, such as a late response to an earlier query, are skipped
+		// until the deadline
+		buf := make([]byte, 65535)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return nil, false, err
+			}
+
+			reply = buf[:n]
+			if len(reply) < 12 || sameDNSID(reply, msg) {
+				break
+			}
+		}
+	}
+
+	if len(reply) < 12 {
+		return nil, false, errDNSFormat
+	}
+	if !sameDNSID(reply, msg) {
+		return nil, false, errors.New("response ID does not match the query")
+	}
+	return unpackDNSResponse(reply)
+}
+
+// sameDNSID reports whether the messages, which hold at least the two bytes of the ID, have the same ID.
+func sameDNSID(a, b []byte) bool {
+	return binary.BigEndian.Uint16(a) == binary.BigEndian.Uint16(b)
+}
+
+// packDNSQuery returns the wire format of the query, with a random ID and recursion desired.
+func packDNSQuery(q DNSQuery) ([]byte, error) {
+	msg := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:], uint16(rand.Uint32()))
+	// Recursion desired
+	binary.BigEndian.PutUint16(msg[2:], 0x0100)
+	// One question
+	binary.BigEndian.PutUint16(msg[4:], 1)
+
+	for _, label := range strings.Split(strings.TrimSuffix(q.Name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid name %q", q.Name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, q.Type)
+	// The Internet class
+	return binary.BigEndian.AppendUint16(msg, 1), nil
+}
+
+var errDNSFormat = errors.New("malformed DNS response")
+
+// unpackDNSResponse parses the response, and reports whether it was truncated.
+func unpackDNSResponse(msg []byte) (*DNSResponse, bool, error) {
+	if len(msg) < 12 {
+		return nil, false, errDNSFormat
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	resp := &DNSResponse{Rcode: int(flags & 0xf)}
+	truncated := flags&0x0200 != 0
+
+	off := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:])); i++ {
+		_, next, err := unpackDNSName(msg, off)
+		if err != nil || next+4 > len(msg) {
+			return nil, false, errDNSFormat
+		}
+		off = next + 4
+	}
+
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[6:])); i++ {
+		name, next, err := unpackDNSName(msg, off)
+		if err != nil || next+10 > len(msg) {
+			return nil, false, errDNSFormat
+		}
+
+		rtype := binary.BigEndian.Uint16(msg[next:])
+		ttl := binary.BigEndian.Uint32(msg[next+4:])
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		start := next + 10
+		if start+length > len(msg) {
+			return nil, false, errDNSFormat
+		}
+
+		data, err := unpackDNSData(msg, rtype, start, length)
+		if err != nil {
+			return nil, false, err
+		}
+		resp.Answers = append(resp.Answers, DNSAnswer{Name: name, Type: rtype, TTL: ttl, Data: data})
+		off = start + length
+	}
+	return resp, truncated, nil
+}
+
+// unpackDNSData returns the record data in presentation format.
+func unpackDNSData(msg []byte, rtype uint16, off, length int) (string, error) {
+	rdata := msg[off : off+length]
+
+	switch rtype {
+	case DNSTypeA, DNSTypeAAAA:
+		if len(rdata) != net.IPv4len && len(rdata) != net.IPv6len {
+			return "", errDNSFormat
+		}
+		return net.IP(rdata).String(), nil
+	case DNSTypeNS, DNSTypeCNAME, DNSTypePTR:
+		name, _, err := unpackDNSName(msg, off)
+		return name, err
+	case DNSTypeMX:
+		if len(rdata) < 3 {
+			return "", errDNSFormat
+		}
+		name, _, err := unpackDNSName(msg, off+2)
+		return strconv.Itoa(int(binary.BigEndian.Uint16(rdata))) + " " + name, err
+	case DNSTypeTXT:
+		var b strings.Builder
+		for i := 0; i < len(rdata); {
+			n := int(rdata[i])
+			if i+1+n > len(rdata) {
+				return "", errDNSFormat
+			}
+			b.Write(rdata[i+1 : i+1+n])
+			i += 1 + n
+		}
+		return b.String(), nil
+	case DNSTypeSOA:
+		mname, next, err := unpackDNSName(msg, off)
+		if err != nil {
+			return "", err
+		}
+		rname, next, err := unpackDNSName(msg, next)
+		if err != nil || next+20 > off+length {
+			return "", errDNSFormat
+		}
+
+		fields := []string{mname, rname}
+		for i := 0; i < 5; i++ {
+			fields = append(fields, strconv.FormatUint(uint64(binary.BigEndian.Uint32(msg[next+4*i:])), 10))
+		}
+		return strings.Join(fields, " "), nil
+	}
+	return hex.EncodeToString(rdata), nil
+}
+
+// unpackDNSName returns the name at the offset, following compression pointers, and the
+// offset following the name.
+func unpackDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errDNSFormat
+		}
+
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, "."), end, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 10 {
+				return "", 0, errDNSFormat
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errDNSFormat
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
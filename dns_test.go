@@ -0,0 +1,283 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dnsServer answers the A queries over UDP and TCP using the answer function, which returns
+// the response code and the addresses, and whether the UDP response is truncated.
+type dnsServer struct {
+	addr   string
+	answer func(name string) (rcode int, addrs []string, truncate bool)
+}
+
+func newDNSServer(t *testing.T, answer func(name string) (int, []string, bool)) *dnsServer {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to listen on TCP: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = pc.Close()
+		_ = ln.Close()
+	})
+
+	s := &dnsServer{addr: pc.LocalAddr().String(), answer: answer}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo(s.reply(buf[:n], true), from)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			var size [2]byte
+			if _, err := io.ReadFull(conn, size[:]); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(size[:]))
+				if _, err := io.ReadFull(conn, query); err == nil {
+					reply := s.reply(query, false)
+					_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(reply))), reply...))
+				}
+			}
+			_ = conn.Close()
+		}
+	}()
+	return s
+}
+
+func (s *dnsServer) reply(query []byte, udp bool) []byte {
+	name, end, _ := unpackDNSName(query, 12)
+	rcode, addrs, truncate := s.answer(name)
+
+	flags := uint16(0x8180) | uint16(rcode)
+	if udp && truncate {
+		flags |= 0x0200
+		addrs = nil
+	}
+
+	msg := append([]byte(nil), query[:12]...)
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(addrs)))
+	msg = append(msg, query[12:end+4]...)
+	for _, addr := range addrs {
+		// The name is a pointer to the question
+		msg = append(msg, 0xc0, 12)
+		msg = binary.BigEndian.AppendUint16(msg, DNSTypeA)
+		msg = binary.BigEndian.AppendUint16(msg, 1)
+		msg = binary.BigEndian.AppendUint32(msg, 300)
+		msg = binary.BigEndian.AppendUint16(msg, 4)
+		msg = append(msg, net.ParseIP(addr).To4()...)
+	}
+	return msg
+}
+
+func resolve(ds *DNSService, name string) (*DNSResponse, error) {
+	result, err := ds.Request(context.Background(), DNSQuery{Name: name, Type: DNSTypeA})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*DNSResponse), nil
+}
+
+func TestDNSService(t *testing.T) {
+	server := newDNSServer(t, func(name string) (int, []string, bool) {
+		switch name {
+		case "www.example.com":
+			return DNSRcodeSuccess, []string{"192.0.2.1", "192.0.2.2"}, false
+		case "big.example.com":
+			return DNSRcodeSuccess, []string{"192.0.2.3"}, true
+		}
+		return DNSRcodeNXDomain, nil, false
+	})
+
+	ds := NewDNSService("DNS", []string{server.addr})
+	_ = ds.Start()
+	defer func() { _ = ds.Stop() }()
+
+	resp, err := resolve(ds, "www.example.com")
+	if err != nil || len(resp.Answers) != 2 || resp.Answers[1].Data != "192.0.2.2" ||
+		resp.Answers[0].Name != "www.example.com" || resp.Answers[0].TTL != 300 {
+		t.Errorf("Expected the parsed answers and received %+v, %v", resp, err)
+	}
+
+	resp, err = resolve(ds, "big.example.com")
+	if err != nil || len(resp.Answers) != 1 || resp.Answers[0].Data != "192.0.2.3" {
+		t.Errorf("Expected the truncated response to be queried over TCP and received %+v, %v", resp, err)
+	}
+
+	resp, err = resolve(ds, "missing.example.com")
+	if err != nil || resp.Rcode != DNSRcodeNXDomain || len(resp.Answers) != 0 {
+		t.Errorf("Expected the NXDOMAIN response to be returned and received %+v, %v", resp, err)
+	}
+
+	if stats := ds.ResolverStats(); stats[0].Queries != 3 || stats[0].Successes != 3 {
+		t.Errorf("Expected three successful queries and received %+v", stats)
+	}
+}
+
+func TestDNSServiceFailover(t *testing.T) {
+	failing := newDNSServer(t, func(name string) (int, []string, bool) {
+		return DNSRcodeServFail, nil, false
+	})
+	working := newDNSServer(t, func(name string) (int, []string, bool) {
+		return DNSRcodeSuccess, []string{"192.0.2.1"}, false
+	})
+	// Nothing answers on the silent resolver
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+	defer silent.Close()
+
+	ds := NewDNSService("DNS", []string{failing.addr, silent.LocalAddr().String(), working.addr})
+	ds.SetQueryTimeout(50 * time.Millisecond)
+	_ = ds.Start()
+	defer func() { _ = ds.Stop() }()
+
+	resp, err := resolve(ds, "www.example.com")
+	if err != nil || resp.Resolver != working.addr {
+		t.Errorf("Expected the query to fail over to the working resolver and received %+v, %v", resp, err)
+	}
+
+	stats := ds.ResolverStats()
+	if stats[0].Failures != 1 || stats[1].Timeouts != 1 || stats[2].Successes != 1 {
+		t.Errorf("Expected the failure, timeout and success to be counted and received %+v", stats)
+	}
+	if err := <-ds.Errors(); !strings.Contains(err.Error(), silent.LocalAddr().String()) {
+		t.Errorf("Expected the timeout to be reported and received %v", err)
+	}
+}
+
+func TestDNSServiceRateLimit(t *testing.T) {
+	server := newDNSServer(t, func(name string) (int, []string, bool) {
+		return DNSRcodeSuccess, nil, false
+	})
+
+	clock := newFakeClock()
+	ds := NewDNSService("DNS", []string{server.addr}, WithClock(clock))
+	ds.SetResolverRateLimit(1)
+	_ = ds.Start()
+	defer func() { _ = ds.Stop() }()
+
+	if _, err := resolve(ds, "a.example.com"); err != nil {
+		t.Fatalf("The first query failed: %v", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := resolve(ds, "b.example.com")
+		errs <- err
+	}()
+	// The second query waits for the rate limit of the resolver
+	clock.waitTimers(t, 1)
+	select {
+	case err := <-errs:
+		t.Fatalf("The query was sent before the rate limit permitted it: %v", err)
+	default:
+	}
+
+	clock.Advance(time.Second)
+	if err := <-errs; err != nil {
+		t.Errorf("The second query failed: %v", err)
+	}
+}
+
+// newRawDNSServer answers each UDP query with the datagrams returned by the respond function.
+func newRawDNSServer(t *testing.T, respond func(query []byte) [][]byte) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, data := range respond(buf[:n]) {
+				_, _ = pc.WriteTo(data, from)
+			}
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestDNSServiceShortReply(t *testing.T) {
+	short := newRawDNSServer(t, func(query []byte) [][]byte {
+		return [][]byte{{0x01}}
+	})
+	working := newDNSServer(t, func(name string) (int, []string, bool) {
+		return DNSRcodeSuccess, []string{"192.0.2.1"}, false
+	})
+
+	ds := NewDNSService("DNS", []string{short, working.addr})
+	_ = ds.Start()
+	defer func() { _ = ds.Stop() }()
+
+	resp, err := resolve(ds, "www.example.com")
+	if err != nil || resp.Resolver != working.addr {
+		t.Errorf("Expected the query to move on from the short reply and received %+v, %v", resp, err)
+	}
+	if stats := ds.ResolverStats(); stats[0].Failures != 1 {
+		t.Errorf("Expected the short reply to be counted as a failure and received %+v", stats)
+	}
+}
+
+func TestDNSServiceMismatchedID(t *testing.T) {
+	server := newDNSServer(t, func(name string) (int, []string, bool) {
+		return DNSRcodeSuccess, []string{"192.0.2.1"}, false
+	})
+	// The response to another query arrives first
+	addr := newRawDNSServer(t, func(query []byte) [][]byte {
+		reply := server.reply(query, true)
+
+		other := append([]byte(nil), reply...)
+		binary.BigEndian.PutUint16(other, binary.BigEndian.Uint16(reply)+1)
+		return [][]byte{other, reply}
+	})
+
+	ds := NewDNSService("DNS", []string{addr})
+	_ = ds.Start()
+	defer func() { _ = ds.Stop() }()
+
+	resp, err := resolve(ds, "www.example.com")
+	if err != nil || len(resp.Answers) != 1 || resp.Answers[0].Data != "192.0.2.1" {
+		t.Errorf("Expected the response with the ID of the query and received %+v, %v", resp, err)
+	}
+}
+
+func TestUnpackDNSResponseMalformed(t *testing.T) {
+	msg, _ := packDNSQuery(DNSQuery{Name: "www.example.com", Type: DNSTypeA})
+	// Claim an answer that is not present
+	binary.BigEndian.PutUint16(msg[6:], 1)
+
+	if _, _, err := unpackDNSResponse(msg); !errors.Is(err, errDNSFormat) {
+		t.Errorf("Expected the malformed response to be rejected and received %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The interval between the checks performed by StopDrain while waiting for the queued requests
+const drainPollInterval = 5 * time.Millisecond
+
+// The time StopDrain waits for a result buffered on the Output channel to be read, before the
+// results left are considered to have no consumer
+const outputReadTimeout = 100 * time.Millisecond
+
+type drainState struct {
+	sync.Mutex
+	// Closed when StopDrain begins for the current run
+	ch       chan struct{}
+	draining bool
+	// The number of requests dequeued that have not been finished
+	busy atomic.Int64
+	// Closed when busy returns to zero, once a waiter obtained it
+	idle chan struct{}
+	// The number of request loops started by Run that have not exited
+	loops int
+}
+
+// MarkBusy records that the service has started processing a request. Services that do not use
+// the Run method should call it after receiving each request, so StopDrain and WaitIdle wait for
+// the request.
+func (bas *BaseService) MarkBusy() {
+	bas.drain.busy.Add(1)
+}
+
+// MarkIdle records that the service has finished processing a request marked by MarkBusy.
+func (bas *BaseService) MarkIdle() {
+	bas.markIdle(1)
+}
+
+func (bas *BaseService) markIdle(n int) {
+	d := &bas.drain
+
+	for {
+		busy := d.busy.Load()
+
+		left := busy - int64(n)
+		if left < 0 {
+			left = 0
+		}
+		if !d.busy.CompareAndSwap(busy, left) {
+			continue
+		}
+		if left == 0 {
+			bas.wakeIdle()
+		}
+		return
+	}
+}
+
+// idleSignal returns the channel closed the next time no request is in flight.
+func (bas *BaseService) idleSignal() <-chan struct{} {
+	d := &bas.drain
+	d.Lock()
+	defer d.Unlock()
+
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	return d.idle
+}
+
+// wakeIdle wakes the callers waiting on the channel returned by idleSignal.
+func (bas *BaseService) wakeIdle() {
+	d := &bas.drain
+	d.Lock()
+	defer d.Unlock()
+
+	if d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// InFlight returns the number of requests that have been dequeued and not yet finished, including
+// the requests waiting in a pending batch.
+func (bas *BaseService) InFlight() int {
+	return int(bas.drain.busy.Load())
+}
+
+// WaitIdle blocks until the service has caught up, with nothing queued on the Input channel or by
+// SendPriority, and nothing in flight. It returns the context error when the context is done
+// first, and an error wrapping ErrServiceStopped when the service stops first. Since a request is
+// counted as in flight just after it is received from the Input channel, the service must be
+// found idle on two consecutive checks.
+func (bas *BaseService) WaitIdle(ctx context.Context) error {
+	done := bas.Done()
+
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+
+	for checks := 0; checks < 2; {
+		// Obtained before the check, so the last request finishing after the check is not missed
+		finished := bas.idleSignal()
+
+		// The requests in flight are waited for until the last of them finishes, and the
+		// queues are checked again at each tick
+		var tick <-chan time.Time
+		switch {
+		case bas.idleNow():
+			checks++
+			tick = t.C
+		case bas.InFlight() > 0:
+			checks = 0
+		default:
+			checks = 0
+			tick = t.C
+		}
+		if checks == 2 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+			return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+		case <-finished:
+		case <-tick:
+		}
+	}
+	return nil
+}
+
+// StopDrain stops accepting new requests through Send and Request, waits for the requests
+// already queued on the Input channel and those being processed to be finished, and for the
+// results buffered on the Output channel to be read, as long as the consumers keep reading them,
+// and then stops the service. When the context
+// is done first, the service is stopped without finishing the remaining requests, the results
+// left on the Output channel are routed to the dead letters, and the context error is returned.
+func (bas *BaseService) StopDrain(ctx context.Context) error {
+	bas.lifecycle.Lock()
+	defer bas.lifecycle.Unlock()
+
+	if !bas.running() {
+		// Provides the same errors as Stop
+		return bas.stop()
+	}
+	return bas.stopDrain(ctx)
+}
+
+func (bas *BaseService) stopDrain(ctx context.Context) error {
+	bas.beginDrain()
+	werr := bas.waitDrained(ctx)
+	if werr == nil {
+		werr = bas.waitOutput(ctx)
+	}
+	if err := bas.stop(); err != nil {
+		return err
+	}
+	return werr
+}
+
+func (bas *BaseService) resetDrain() {
+	d := &bas.drain
+	d.Lock()
+	defer d.Unlock()
+
+	d.ch = make(chan struct{})
+	d.draining = false
+}
+
+func (bas *BaseService) beginDrain() {
+	d := &bas.drain
+	d.Lock()
+	defer d.Unlock()
+
+	if !d.draining {
+		d.draining = true
+		close(d.ch)
+	}
+}
+
+func (bas *BaseService) draining() bool {
+	d := &bas.drain
+	d.Lock()
+	defer d.Unlock()
+
+	return d.draining
+}
+
+// idleNow reports whether nothing is queued or in flight.
+func (bas *BaseService) idleNow() bool {
+	return bas.InFlight() == 0 && bas.InputLen() == 0 && bas.PriorityLen() == 0
+}
+
+// drained reports whether the service is idle and the request loops started by Run have exited.
+func (bas *BaseService) drained() bool {
+	d := &bas.drain
+	d.Lock()
+	loops := d.loops
+	d.Unlock()
+
+	return loops == 0 && bas.idleNow()
+}
+
+func (bas *BaseService) waitDrained(ctx context.Context) error {
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+
+	for !bas.drained() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", bas.name, ctx.Err())
+		case <-bas.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+	return nil
+}
+
+// waitOutput waits for the consumers to read the results buffered on the Output channel, and
+// returns once no result was read for outputReadTimeout.
+func (bas *BaseService) waitOutput(ctx context.Context) error {
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+
+	last, read := len(bas.Output()), time.Now()
+	for n := last; n > 0; n = len(bas.Output()) {
+		if n < last {
+			last, read = n, time.Now()
+		} else if time.Since(read) >= outputReadTimeout {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", bas.name, ctx.Err())
+		case <-bas.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+	return nil
+}
+
+// addLoops records the request loops started by Run and returns the channel closed by StopDrain.
+func (bas *BaseService) addLoops(n int) <-chan struct{} {
+	d := &bas.drain
+	d.Lock()
+	defer d.Unlock()
+
+	d.loops += n
+	return d.ch
+}
+
+func (bas *BaseService) loopExited() {
+	d := &bas.drain
+	d.Lock()
+	defer d.Unlock()
+
+	d.loops--
+}
+
+// drainInput processes the requests remaining on the Input channel and returns once it is empty.
+func (bas *BaseService) drainInput(ctx context.Context, handler Handler) {
+	for {
+		if err := bas.CheckRateLimitErr(); err != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-bas.input:
+			bas.MarkBusy()
+			if bas.skip(req) {
+				bas.MarkIdle()
+				continue
+			}
+			bas.process(ctx, handler, req, 0)
+		default:
+			if !bas.waitPriority(ctx) {
+				return
+			}
+		}
+	}
+}
+
+// waitPriority waits briefly for the messages queued by SendPriority to be delivered to the Input
+// channel, and returns false when none remain.
+func (bas *BaseService) waitPriority(ctx context.Context) bool {
+	if bas.PriorityLen() == 0 {
+		return false
+	}
+
+	t := time.NewTimer(drainPollInterval)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+	}
+	return true
+}
+
+// errDraining reports whether new requests are refused because the service is draining.
+func (bas *BaseService) errDraining() error {
+	if bas.draining() {
+		return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	}
+	return nil
+}
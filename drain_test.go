@@ -0,0 +1,248 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStopDrain(t *testing.T) {
+	const num = 100
+
+	srv := NewSimpleService("Drain", func(req interface{}) (interface{}, error) {
+		time.Sleep(time.Millisecond)
+		return req, nil
+	}, WithInputBuffer(num), WithWorkers(4))
+
+	for i := 0; i < num; i++ {
+		srv.Input() <- i
+	}
+
+	var count int
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-srv.Output():
+				count++
+			case <-time.After(500 * time.Millisecond):
+				return
+			}
+		}
+	}()
+
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start the service: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.StopDrain(ctx); err != nil {
+		t.Fatalf("StopDrain returned an error: %v", err)
+	}
+	wg.Wait()
+	if count != num {
+		t.Errorf("Expected %d outputs after the drain and received %d", num, count)
+	}
+	if err := srv.Stop(); !errors.Is(err, ErrAlreadyStopped) {
+		t.Errorf("Expected the service to be stopped after StopDrain, received %v", err)
+	}
+}
+
+func TestStopDrainRefusesInput(t *testing.T) {
+	release := make(chan struct{})
+	srv := NewSimpleService("Refuse", func(req interface{}) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+
+	_ = srv.Start()
+	if err := srv.Send(context.Background(), "first"); err != nil {
+		t.Fatalf("Failed to send the message: %v", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.StopDrain(context.Background()) }()
+
+	deadline := time.Now().Add(time.Second)
+	for !srv.draining() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := srv.Send(context.Background(), "second"); !errors.Is(err, ErrServiceStopped) {
+		t.Errorf("Expected ErrServiceStopped when sending during the drain, received %v", err)
+	}
+	if srv.TrySend("third") {
+		t.Errorf("TrySend delivered a message during the drain")
+	}
+
+	close(release)
+	if err := <-errs; err != nil {
+		t.Errorf("StopDrain returned an error: %v", err)
+	}
+}
+
+func TestStopDrainTimeout(t *testing.T) {
+	srv := NewSimpleService("Timeout", func(req interface{}) (interface{}, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	}, WithInputBuffer(10))
+
+	for i := 0; i < 10; i++ {
+		srv.Input() <- i
+	}
+	_ = srv.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := srv.StopDrain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded from StopDrain, received %v", err)
+	}
+	if err := srv.Stop(); !errors.Is(err, ErrAlreadyStopped) {
+		t.Errorf("Expected the service to be stopped after the drain timeout, received %v", err)
+	}
+}
+
+func TestStopDrainMarkBusy(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	srv.MarkBusy()
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.StopDrain(context.Background()) }()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("StopDrain returned while a request was busy: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	srv.MarkIdle()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("StopDrain returned an error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("StopDrain did not return after the request became idle")
+	}
+}
+
+func TestStopDrainNotStarted(t *testing.T) {
+	srv := newTestService()
+
+	if err := srv.StopDrain(context.Background()); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Expected ErrNotStarted from StopDrain on a new service, received %v", err)
+	}
+}
+
+func TestWaitIdle(t *testing.T) {
+	const num = 20
+
+	srv := NewSimpleService("Idle", func(req interface{}) (interface{}, error) {
+		time.Sleep(5 * time.Millisecond)
+		return nil, nil
+	}, WithInputBuffer(num), WithWorkers(3))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	first := make(chan struct{})
+	go func() {
+		for i := 0; i < num; i++ {
+			_ = srv.Send(context.Background(), i)
+			if i == 0 {
+				close(first)
+			}
+		}
+	}()
+
+	<-first
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.WaitIdle(ctx); err != nil {
+		t.Fatalf("WaitIdle returned an error: %v", err)
+	}
+	if n := srv.Stats().Received; n != num {
+		t.Errorf("WaitIdle returned after %d of %d requests were received", n, num)
+	}
+	if n := srv.InFlight(); n != 0 {
+		t.Errorf("Expected no requests in flight and counted %d", n)
+	}
+}
+
+func TestWaitIdleCanceled(t *testing.T) {
+	srv := NewSimpleService("Busy", func(req interface{}) (interface{}, error) {
+		time.Sleep(200 * time.Millisecond)
+		return nil, nil
+	})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "slow"
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := srv.WaitIdle(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context error and received %v", err)
+	}
+	if n := srv.InFlight(); n != 1 {
+		t.Errorf("Expected 1 request in flight and counted %d", n)
+	}
+}
+
+func TestWaitIdleMarkBusy(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.MarkBusy()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				srv.MarkBusy()
+				srv.MarkIdle()
+			}
+		}()
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.WaitIdle(context.Background()) }()
+	wg.Wait()
+	select {
+	case err := <-errs:
+		t.Fatalf("WaitIdle returned while a request was busy: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	srv.MarkIdle()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("WaitIdle returned an error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("WaitIdle did not return after the last request became idle")
+	}
+
+	// The count does not go below zero
+	srv.MarkIdle()
+	if n := srv.InFlight(); n != 0 {
+		t.Errorf("Expected no requests in flight and counted %d", n)
+	}
+}
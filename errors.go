@@ -0,0 +1,96 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import "errors"
+
+// The errors returned by the package are wrapped with the name of the service,
+// and can be identified using errors.Is.
+var (
+	// ErrAlreadyStarted is returned when Start is called on a service that is already running.
+	ErrAlreadyStarted = errors.New("service has already been started")
+
+	// ErrAlreadyStopped is returned when Stop is called on a service that has already been stopped.
+	ErrAlreadyStopped = errors.New("service is already stopped")
+
+	// ErrCircuitOpen is returned for the requests failed fast while the circuit breaker is open.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+
+	// ErrDependencyCycle is returned when the dependencies declared in a Group form a cycle.
+	ErrDependencyCycle = errors.New("dependencies form a cycle")
+
+	// ErrDuplicateMessage is reported for the messages skipped by the deduplication window.
+	ErrDuplicateMessage = errors.New("message is a duplicate")
+
+	// ErrDuplicateName is returned when a service is registered using a name that is already registered.
+	ErrDuplicateName = errors.New("service name is already registered")
+
+	// ErrInjectedFault is returned for the messages failed by a Chaos.
+	ErrInjectedFault = errors.New("injected fault")
+
+	// ErrInputFull is returned when a message cannot be delivered without blocking because the
+	// Input channel of the service is full.
+	ErrInputFull = errors.New("input buffer is full")
+
+	// ErrInvalidCheckpoint is returned when Restore reads data that is not a supported checkpoint.
+	ErrInvalidCheckpoint = errors.New("checkpoint is not valid")
+
+	// ErrInvalidRateLimit is returned when a rate limit is set using a negative value.
+	ErrInvalidRateLimit = errors.New("rate limit is not valid")
+
+	// ErrInvalidRecording is reported when a Replayer reads a record that is truncated or not valid.
+	ErrInvalidRecording = errors.New("recording is not valid")
+
+	// ErrMessageExpired is reported for the messages dequeued after their deadline.
+	ErrMessageExpired = errors.New("message has expired")
+
+	// ErrNoCodec is returned when Checkpoint or Restore is called before a codec is set.
+	ErrNoCodec = errors.New("no codec is set")
+
+	// ErrNoMembers is returned when a Balancer has no member available to receive a message.
+	ErrNoMembers = errors.New("no member is available")
+
+	// ErrNoRoute is returned when a Router has no route for the key of a message and no default route.
+	ErrNoRoute = errors.New("no route for the message")
+
+	// ErrNotPaused is returned when Resume is called on a service that is not paused, or when
+	// Checkpoint is called on a running service that is not paused.
+	ErrNotPaused = errors.New("service is not paused")
+
+	// ErrNotRunning is returned when an operation requires a service that is running.
+	ErrNotRunning = errors.New("service is not running")
+
+	// ErrNotStarted is returned when an operation requires a service that has been started at least once.
+	ErrNotStarted = errors.New("service has not been started")
+
+	// ErrUnknownDependency is returned when a service in a Group depends on a name that is not
+	// a member of the group.
+	ErrUnknownDependency = errors.New("dependency is not a member of the group")
+
+	// ErrUnhealthy is returned when a health check finds that the service is not healthy.
+	ErrUnhealthy = errors.New("service is unhealthy")
+
+	// ErrPaused is returned when an operation cannot complete because the service is paused.
+	ErrPaused = errors.New("service is paused")
+
+	// ErrProcessExited is reported when the command run by an ExecService exits while the service is running.
+	ErrProcessExited = errors.New("command has exited")
+
+	// ErrRequestCanceled is reported for the messages canceled by their ID while they were queued.
+	ErrRequestCanceled = errors.New("request was canceled")
+
+	// ErrRequestTimeout is returned when the handler did not process a request before the request timeout.
+	ErrRequestTimeout = errors.New("request timed out")
+
+	// ErrRequeueLimit is returned when a message is requeued after it has reached the requeue limit.
+	ErrRequeueLimit = errors.New("requeue limit reached")
+
+	// ErrRestartIntensity is reported when a child of a Supervisor is restarted more times than
+	// permitted within the restart window.
+	ErrRestartIntensity = errors.New("restart intensity exceeded")
+
+	// ErrServiceStopped is returned when an operation cannot complete because the service was stopped.
+	ErrServiceStopped = errors.New("service has been stopped")
+)
@@ -0,0 +1,78 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/caffix/service"
+)
+
+func ExampleNewSimpleService() {
+	srv := service.NewSimpleService("Upper", func(req interface{}) (interface{}, error) {
+		return strings.ToUpper(req.(string)), nil
+	})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "hello"
+	fmt.Println(<-srv.Output())
+	// Output: HELLO
+}
+
+func ExampleNewSimpleService_workers() {
+	srv := service.NewSimpleService("Square", func(req interface{}) (interface{}, error) {
+		return req.(int) * req.(int), nil
+	}, service.WithWorkers(4), service.WithOutputBuffer(100))
+	srv.SetRateLimit(1000)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 1; i <= 10; i++ {
+		srv.Input() <- i
+	}
+
+	var sum int
+	for i := 1; i <= 10; i++ {
+		sum += (<-srv.Output()).(int)
+	}
+	fmt.Println(sum)
+	// Output: 385
+}
+
+func ExampleBaseService_Request() {
+	srv := service.NewSimpleService("Length", func(req interface{}) (interface{}, error) {
+		return len(req.(string)), nil
+	})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	result, err := srv.Request(context.Background(), "service")
+	fmt.Println(result, err)
+	// Output: 7 <nil>
+}
+
+func ExampleBaseService_SetErrorHandler() {
+	srv := service.NewSimpleService("Failing", func(req interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("cannot handle %v", req)
+	})
+
+	errs := make(chan error, 1)
+	srv.SetErrorHandler(func(req interface{}, err error) {
+		errs <- err
+	})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "request"
+	fmt.Println(<-errs)
+	// Output: cannot handle request
+}
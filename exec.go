@@ -0,0 +1,385 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// The default settings of an ExecService.
+const (
+	DefaultGracePeriod  = 5 * time.Second
+	DefaultRestartDelay = time.Second
+	DefaultMaxLineSize  = 1 << 20
+)
+
+// RestartPolicy determines whether a child that exited while its parent is running is started again.
+type RestartPolicy int
+
+// The restart policies of the children.
+const (
+	// RestartAlways starts the child again whenever it exits.
+	RestartAlways RestartPolicy = iota
+	// RestartOnFailure starts the child again when it exits with an error.
+	RestartOnFailure
+	// RestartNever leaves the child stopped once it exits.
+	RestartNever
+)
+
+var restartPolicyNames = map[RestartPolicy]string{
+	RestartAlways:    "always",
+	RestartOnFailure: "on failure",
+	RestartNever:     "never",
+}
+
+// String implements the fmt.Stringer interface.
+func (p RestartPolicy) String() string {
+	if name, ok := restartPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("RestartPolicy(%d)", int(p))
+}
+
+// restart reports whether the policy starts again a child that exited with the error.
+func (p RestartPolicy) restart(err error) bool {
+	switch p {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	}
+	return false
+}
+
+// LineCodec is a Codec whose encoded payloads are single lines of text, without the newline. The
+// codecs returned by JSONCodec and TextCodec are line codecs.
+type LineCodec interface {
+	Codec
+}
+
+type textCodec struct{}
+
+// TextCodec returns a LineCodec that encodes strings, byte slices and fmt.Stringer values as
+// text, and decodes each line as a string.
+func TextCodec() LineCodec {
+	return textCodec{}
+}
+
+// Marshal implements the Codec interface.
+func (textCodec) Marshal(payload interface{}) ([]byte, error) {
+	var data []byte
+
+	switch v := payload.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case fmt.Stringer:
+		data = []byte(v.String())
+	default:
+		return nil, fmt.Errorf("unsupported payload type %T", payload)
+	}
+	if bytes.IndexByte(data, '\n') >= 0 {
+		return nil, errors.New("payload contains a newline")
+	}
+	return data, nil
+}
+
+// Unmarshal implements the Codec interface.
+func (textCodec) Unmarshal(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+// ContentType returns the media type of the encoded payloads.
+func (textCodec) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+// ExecService runs an external command for as long as the service is running. The payloads
+// received on the Input channel are encoded by the codec and written to the standard input of
+// the command, one per line, and each line written by the command to its standard output is
+// decoded and sent on the Output channel. The lines written to the standard error are reported
+// on the Errors channel. The results are not correlated with the inputs, so the service does not
+// reply to Request. When the command exits while the service is running, the exit is reported
+// as ErrProcessExited and the command is started again as set by SetRestartPolicy. When the
+// policy does not start it again, the service stops itself, and Err returns the exit. Stop sends
+// SIGTERM to the command, and SIGKILL when it has not exited after the grace period.
+type ExecService struct {
+	BaseService
+	cmd      *exec.Cmd
+	codec    LineCodec
+	grace    atomic.Int64
+	delay    atomic.Int64
+	policy   atomic.Int64
+	restarts atomic.Uint64
+	wg       sync.WaitGroup
+}
+
+// NewExecService returns an ExecService running copies of the command, which is used as a
+// template and is never started itself. The Stdin, Stdout and Stderr of the command must be nil.
+func NewExecService(name string, cmd *exec.Cmd, codec LineCodec, opts ...Option) *ExecService {
+	es := &ExecService{
+		cmd:   cmd,
+		codec: codec,
+	}
+	es.grace.Store(int64(DefaultGracePeriod))
+	es.delay.Store(int64(DefaultRestartDelay))
+
+	es.Init(es, name, opts...)
+	return es
+}
+
+// SetGracePeriod sets the time permitted for the command to exit after SIGTERM is sent by Stop.
+func (es *ExecService) SetGracePeriod(d time.Duration) {
+	es.grace.Store(int64(d))
+}
+
+// SetRestartPolicy sets whether the command is started again when it exits while the service
+// is running. The command is always started again by default.
+func (es *ExecService) SetRestartPolicy(p RestartPolicy) {
+	es.policy.Store(int64(p))
+}
+
+// SetRestartDelay sets the time waited before the command is started again.
+func (es *ExecService) SetRestartDelay(d time.Duration) {
+	es.delay.Store(int64(d))
+}
+
+// Restarts returns the number of times the command was started again after it exited.
+func (es *ExecService) Restarts() uint64 {
+	return es.restarts.Load()
+}
+
+// OnStart implements the Service interface.
+func (es *ExecService) OnStart() error {
+	ctx := es.Context()
+
+	c, err := es.spawn(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", es, err)
+	}
+
+	es.wg.Add(1)
+	es.RunLabeled(ctx, "supervisor", func(ctx context.Context) { es.supervise(ctx, c) })
+	es.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (es *ExecService) OnStop() error {
+	es.wg.Wait()
+	return nil
+}
+
+type execChild struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	// Closed once the command exited and its output was read
+	done chan struct{}
+	err  error
+}
+
+// command returns a copy of the template that can be started.
+func (es *ExecService) command() *exec.Cmd {
+	t := es.cmd
+
+	return &exec.Cmd{
+		Path:        t.Path,
+		Args:        t.Args,
+		Env:         t.Env,
+		Dir:         t.Dir,
+		ExtraFiles:  t.ExtraFiles,
+		SysProcAttr: t.SysProcAttr,
+		WaitDelay:   t.WaitDelay,
+	}
+}
+
+// spawn starts a copy of the command, and the goroutines writing the inputs and reading the output.
+func (es *ExecService) spawn(ctx context.Context) (*execChild, error) {
+	if es.cmd.Err != nil {
+		return nil, es.cmd.Err
+	}
+
+	cmd := es.command()
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &execChild{
+		cmd:   cmd,
+		stdin: stdin,
+		done:  make(chan struct{}),
+	}
+
+	// Wait must not be called before the pipes have been read to the end
+	var pipes sync.WaitGroup
+	pipes.Add(2)
+	es.wg.Add(4)
+	es.RunLabeled(ctx, "reader", func(ctx context.Context) {
+		defer es.wg.Done()
+		defer pipes.Done()
+		es.readOutput(ctx, stdout)
+	})
+	es.RunLabeled(ctx, "stderr", func(context.Context) {
+		defer es.wg.Done()
+		defer pipes.Done()
+		es.readErrors(stderr)
+	})
+	es.RunLabeled(ctx, "wait", func(context.Context) {
+		defer es.wg.Done()
+		pipes.Wait()
+		c.err = cmd.Wait()
+		close(c.done)
+	})
+	es.RunLabeled(ctx, "writer", func(ctx context.Context) { es.write(ctx, c) })
+	return c, nil
+}
+
+// supervise terminates the command when the service is stopped, and starts it again when it exits.
+func (es *ExecService) supervise(ctx context.Context, c *execChild) {
+	defer es.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			es.terminate(c)
+			return
+		case <-c.done:
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		err := fmt.Errorf("%s: %w", es, ErrProcessExited)
+		if c.err != nil {
+			err = fmt.Errorf("%w: %v", err, c.err)
+		}
+		es.ReportError(err)
+		if !RestartPolicy(es.policy.Load()).restart(c.err) {
+			// Stop waits for this goroutine to exit
+			go func() { _ = es.StopWithError(err) }()
+			return
+		}
+
+		for {
+			if !es.sleep(ctx, time.Duration(es.delay.Load())) {
+				return
+			}
+
+			var err error
+			if c, err = es.spawn(ctx); err == nil {
+				es.restarts.Add(1)
+				break
+			}
+			es.ReportError(fmt.Errorf("%s: %w", es, err))
+		}
+	}
+}
+
+// terminate sends SIGTERM to the command, and kills it when it has not exited after the grace period.
+func (es *ExecService) terminate(c *execChild) {
+	_ = c.stdin.Close()
+	if err := c.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		_ = c.cmd.Process.Kill()
+	}
+
+	t := es.clock.NewTimer(time.Duration(es.grace.Load()))
+	defer t.Stop()
+
+	select {
+	case <-c.done:
+		return
+	case <-t.C():
+	}
+
+	_ = c.cmd.Process.Kill()
+	<-c.done
+}
+
+// write sends the inputs to the command until the command exits. The writes block while the
+// command does not read its input, which leaves the inputs queued on the Input channel.
+func (es *ExecService) write(ctx context.Context, c *execChild) {
+	defer es.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.done:
+			return
+		case req := <-es.Input():
+			es.MarkBusy()
+			es.IncReceived()
+
+			data, err := es.codec.Marshal(Unwrap(req))
+			if err != nil {
+				err = fmt.Errorf("%s: %w", es, err)
+				es.ReportError(err)
+				es.ReportDeadLetter(req, DeadLetterHandlerError, err)
+				es.MarkIdle()
+				continue
+			}
+
+			_, err = c.stdin.Write(append(data, '\n'))
+			es.MarkIdle()
+			if err != nil {
+				es.ReportDeadLetter(req, DeadLetterCanceled, fmt.Errorf("%s: %w", es, err))
+				return
+			}
+		}
+	}
+}
+
+// readOutput sends the decoded lines of the standard output on the Output channel.
+func (es *ExecService) readOutput(ctx context.Context, r io.Reader) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, DefaultMaxLineSize)
+
+	for sc.Scan() {
+		result, err := es.codec.Unmarshal(sc.Bytes())
+		if err != nil {
+			es.ReportError(fmt.Errorf("%s: %w", es, err))
+			continue
+		}
+		es.emit(ctx, result)
+	}
+	if err := sc.Err(); err != nil {
+		es.ReportError(fmt.Errorf("%s: %w", es, err))
+		// The command would block writing the rest of its output
+		_, _ = io.Copy(io.Discard, r)
+	}
+}
+
+// readErrors reports each line of the standard error.
+func (es *ExecService) readErrors(r io.Reader) {
+	sc := bufio.NewScanner(r)
+
+	for sc.Scan() {
+		es.ReportError(fmt.Errorf("%s: %s", es, sc.Text()))
+	}
+	_, _ = io.Copy(io.Discard, r)
+}
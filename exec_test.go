@@ -0,0 +1,216 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestExecHelper is the command run by the tests, selected by the mode in the environment.
+func TestExecHelper(t *testing.T) {
+	mode := os.Getenv("SERVICE_EXEC_HELPER")
+	if mode == "" {
+		t.Skip("only runs as the command of an ExecService")
+	}
+
+	in := bufio.NewScanner(os.Stdin)
+	switch mode {
+	case "upper":
+		for in.Scan() {
+			fmt.Println(strings.ToUpper(in.Text()))
+		}
+	case "stderr":
+		for in.Scan() {
+			fmt.Fprintln(os.Stderr, "bad input:", in.Text())
+		}
+	case "exit":
+		// Exits with an error after the first input
+		if in.Scan() {
+			fmt.Println(in.Text())
+		}
+		os.Exit(3)
+	case "stubborn":
+		// Ignores SIGTERM and never reads its input
+		signal.Ignore(syscall.SIGTERM)
+		fmt.Println("ready")
+		select {}
+	}
+	os.Exit(0)
+}
+
+func helperCommand(mode string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExecHelper$")
+	cmd.Env = append(os.Environ(), "SERVICE_EXEC_HELPER="+mode)
+	return cmd
+}
+
+func receive(t *testing.T, es *ExecService) interface{} {
+	select {
+	case result := <-es.Output():
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No result was received from the command")
+	}
+	return nil
+}
+
+func TestExecService(t *testing.T) {
+	es := NewExecService("Upper", helperCommand("upper"), TextCodec())
+	if err := es.Start(); err != nil {
+		t.Fatalf("The service failed to start: %v", err)
+	}
+
+	for _, in := range []string{"a", "bc"} {
+		es.Input() <- in
+		if result := receive(t, es); result != strings.ToUpper(in) {
+			t.Errorf("Expected %q, received %v", strings.ToUpper(in), result)
+		}
+	}
+
+	if err := es.Stop(); err != nil {
+		t.Errorf("The service failed to stop: %v", err)
+	}
+	if n := es.Restarts(); n != 0 {
+		t.Errorf("Expected no restart when the command is stopped, received %d", n)
+	}
+}
+
+func TestExecServiceJSON(t *testing.T) {
+	es := NewExecService("JSON", helperCommand("upper"), JSONCodec[[]string]())
+	_ = es.Start()
+	defer func() { _ = es.Stop() }()
+
+	es.Input() <- []string{"x", "y"}
+	if result, ok := receive(t, es).([]string); !ok || len(result) != 2 || result[1] != "Y" {
+		t.Errorf("Expected the decoded JSON line, received %v", result)
+	}
+}
+
+func TestExecServiceStderr(t *testing.T) {
+	es := NewExecService("Stderr", helperCommand("stderr"), TextCodec())
+	_ = es.Start()
+	defer func() { _ = es.Stop() }()
+
+	es.Input() <- "x"
+	select {
+	case err := <-es.Errors():
+		if !strings.Contains(err.Error(), "bad input: x") {
+			t.Errorf("Expected the line of the standard error, received %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The standard error was not reported")
+	}
+}
+
+func TestExecServiceRestart(t *testing.T) {
+	es := NewExecService("Exit", helperCommand("exit"), TextCodec())
+	es.SetRestartDelay(0)
+	_ = es.Start()
+	defer func() { _ = es.Stop() }()
+
+	for _, in := range []string{"a", "b"} {
+		es.Input() <- in
+		if result := receive(t, es); result != in {
+			t.Errorf("Expected %q, received %v", in, result)
+		}
+		if err := <-es.Errors(); !errors.Is(err, ErrProcessExited) {
+			t.Errorf("Expected the exit to be reported, received %v", err)
+		}
+	}
+
+	// The second exit may still be handled by the service
+	deadline := time.Now().Add(5 * time.Second)
+	for es.Restarts() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := es.Restarts(); n != 2 {
+		t.Errorf("Expected the command to be started again after each exit, received %d restarts", n)
+	}
+}
+
+func TestExecServiceRestartNever(t *testing.T) {
+	es := NewExecService("Exit", helperCommand("exit"), TextCodec())
+	es.SetRestartPolicy(RestartNever)
+	_ = es.Start()
+	defer func() { _ = es.Stop() }()
+
+	es.Input() <- "a"
+	_ = receive(t, es)
+	if err := <-es.Errors(); !errors.Is(err, ErrProcessExited) {
+		t.Errorf("Expected the exit to be reported, received %v", err)
+	}
+
+	select {
+	case <-es.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("The service did not stop once the command exited")
+	}
+	// Stop returns once the service has stopped itself
+	_ = es.Stop()
+	if s := es.State(); s != StateStopped {
+		t.Errorf("Expected the service to be stopped, received %v", s)
+	}
+	if err := es.Err(); !errors.Is(err, ErrProcessExited) {
+		t.Errorf("Expected the exit to be the cause of the stop, received %v", err)
+	}
+	if n := es.Restarts(); n != 0 {
+		t.Errorf("Expected the command to remain stopped, received %d restarts", n)
+	}
+}
+
+func TestExecServiceKill(t *testing.T) {
+	es := NewExecService("Stubborn", helperCommand("stubborn"), TextCodec(), WithInputBuffer(1))
+	es.SetGracePeriod(100 * time.Millisecond)
+	_ = es.Start()
+
+	if result := receive(t, es); result != "ready" {
+		t.Fatalf("Expected the command to be ready, received %v", result)
+	}
+	// The command does not read its input, so the writes fill the pipe and the Input channel
+	payload := strings.Repeat("x", 1<<16)
+	for i := 0; i < 4; i++ {
+		select {
+		case es.Input() <- payload:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- es.Stop() }()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("The service failed to stop: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not kill the command ignoring SIGTERM")
+	}
+}
+
+func TestTextCodec(t *testing.T) {
+	c := TextCodec()
+
+	if data, err := c.Marshal("abc"); err != nil || string(data) != "abc" {
+		t.Errorf("Expected the text of the string, received %q, %v", data, err)
+	}
+	if _, err := c.Marshal("a\nb"); err == nil {
+		t.Error("Expected a payload containing a newline to be rejected")
+	}
+	if _, err := c.Marshal(42); err == nil {
+		t.Error("Expected an unsupported payload type to be rejected")
+	}
+	if v, _ := c.Unmarshal([]byte("abc")); v != "abc" {
+		t.Errorf("Expected the line as a string, received %v", v)
+	}
+}
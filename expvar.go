@@ -0,0 +1,114 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// The values published for a service, read from the accessors of BaseService when the service provides them
+var expvarMetrics = []struct {
+	name  string
+	value func(srv Service) (interface{}, bool)
+}{
+	{"state", func(srv Service) (interface{}, bool) {
+		s, ok := srv.(stater)
+		if !ok {
+			return nil, false
+		}
+		return s.State().String(), true
+	}},
+	{"processed", statsValue(func(s Stats) interface{} { return s.Received })},
+	{"emitted", statsValue(func(s Stats) interface{} { return s.Emitted })},
+	{"dropped", statsValue(func(s Stats) interface{} { return s.Dropped })},
+	{"errors", statsValue(func(s Stats) interface{} { return s.Errors })},
+	{"ratelimit_wait_seconds", statsValue(func(s Stats) interface{} { return s.RateLimitWait.Seconds() })},
+	{"ratelimit", func(srv Service) (interface{}, bool) {
+		r, ok := srv.(interface{ EffectiveRateLimit() float64 })
+		if !ok {
+			return nil, false
+		}
+		return r.EffectiveRateLimit(), true
+	}},
+	{"backlog", func(srv Service) (interface{}, bool) {
+		b, ok := srv.(interface{ InputLen() int })
+		if !ok {
+			return nil, false
+		}
+		return b.InputLen(), true
+	}},
+}
+
+func statsValue(field func(Stats) interface{}) func(Service) (interface{}, bool) {
+	return func(srv Service) (interface{}, bool) {
+		s, ok := srv.(statser)
+		if !ok {
+			return nil, false
+		}
+		return field(s.Stats()), true
+	}
+}
+
+// The expvar variables published by the package, which read the service currently bound to the name
+var expvars = struct {
+	sync.Mutex
+	bound map[string]*atomic.Pointer[expvarTarget]
+}{bound: make(map[string]*atomic.Pointer[expvarTarget])}
+
+type expvarTarget struct {
+	srv Service
+}
+
+// PublishExpvar publishes the state, the statistics, the effective rate limit and the backlog of
+// the service as expvar variables named prefix.name.metric, such as service.dns.processed, where
+// name is the name of the service. The variables read the service each time they are requested,
+// and only the values that the service provides are published. Publishing a service under names
+// that are already published by this function binds the variables to the new service, so a
+// service can be published again after it is restarted or replaced. The names already published
+// by other packages are left unchanged.
+func PublishExpvar(prefix string, srv Service) {
+	base := srv.String()
+	if prefix != "" {
+		base = prefix + "." + base
+	}
+
+	expvars.Lock()
+	defer expvars.Unlock()
+
+	for _, m := range expvarMetrics {
+		if _, ok := m.value(srv); !ok {
+			continue
+		}
+
+		name := base + "." + m.name
+		if target, found := expvars.bound[name]; found {
+			target.Store(&expvarTarget{srv: srv})
+			continue
+		}
+		if expvar.Get(name) != nil {
+			continue
+		}
+
+		target := new(atomic.Pointer[expvarTarget])
+		target.Store(&expvarTarget{srv: srv})
+		expvars.bound[name] = target
+
+		value := m.value
+		expvar.Publish(name, expvar.Func(func() interface{} {
+			v, _ := value(target.Load().srv)
+			return v
+		}))
+	}
+}
+
+// PublishRegistryExpvar publishes each service of the registry using PublishExpvar, including the
+// services registered later.
+func PublishRegistryExpvar(prefix string, reg *Registry) {
+	reg.addRegisterHook(func(srv Service) {
+		PublishExpvar(prefix, srv)
+	})
+}
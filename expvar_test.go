@@ -0,0 +1,77 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"expvar"
+	"testing"
+)
+
+func expvarValue(t *testing.T, name string) string {
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatalf("The variable %s was not published", name)
+	}
+	return v.String()
+}
+
+func TestPublishExpvar(t *testing.T) {
+	srv := newEchoService("dns", WithInputBuffer(4))
+	srv.SetRateLimit(5)
+	PublishExpvar("test", srv)
+
+	if v := expvarValue(t, "test.dns.state"); v != `"new"` {
+		t.Errorf("Expected the state of the service, received %s", v)
+	}
+	srv.Input() <- "a"
+	if v := expvarValue(t, "test.dns.backlog"); v != "1" {
+		t.Errorf("Expected the backlog of the service, received %s", v)
+	}
+	if v := expvarValue(t, "test.dns.ratelimit"); v != "5" {
+		t.Errorf("Expected the rate limit of the service, received %s", v)
+	}
+
+	_ = srv.Start()
+	_ = srv.Output()
+	<-srv.Output()
+	_ = srv.Stop()
+	if v := expvarValue(t, "test.dns.processed"); v != "1" {
+		t.Errorf("Expected the processed requests, received %s", v)
+	}
+
+	// A replacement is published under the same names without panicking
+	replacement := newEchoService("dns")
+	PublishExpvar("test", replacement)
+	if v := expvarValue(t, "test.dns.processed"); v != "0" {
+		t.Errorf("Expected the variables to read the replacement, received %s", v)
+	}
+}
+
+func TestPublishExpvarForeignName(t *testing.T) {
+	// The variable of another package remains from a previous run of the test
+	foreign, ok := expvar.Get("test.foreign.state").(*expvar.String)
+	if !ok {
+		foreign = expvar.NewString("test.foreign.state")
+	}
+	foreign.Set("mine")
+
+	PublishExpvar("test", newEchoService("foreign"))
+	if v := expvarValue(t, "test.foreign.state"); v != `"mine"` {
+		t.Errorf("Expected the variable of another package to be unchanged, received %s", v)
+	}
+}
+
+func TestPublishRegistryExpvar(t *testing.T) {
+	reg := NewRegistry()
+	_ = reg.Register(newEchoService("first"))
+	PublishRegistryExpvar("registry", reg)
+	_ = reg.Register(newEchoService("second"))
+
+	for _, name := range []string{"registry.first.state", "registry.second.state"} {
+		if v := expvarValue(t, name); v != `"new"` {
+			t.Errorf("Expected %s to be published, received %s", name, v)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// FanIn is a service that merges the results of the source services on its Output channel. The
+// sources are started and stopped by their owners, and the FanIn stops itself once every source
+// has finished. Consumers can use Receive to learn that the FanIn has stopped.
+type FanIn struct {
+	BaseService
+	mu      sync.Mutex
+	sources []Service
+	// The context of the current run, or nil while the FanIn is not running
+	run    context.Context
+	active int
+	wg     sync.WaitGroup
+	// Keeps the FanIn running after every source has finished
+	persistent bool
+}
+
+// NewFanIn returns a FanIn merging the results of the provided sources.
+func NewFanIn(name string, sources ...Service) *FanIn {
+	fi := &FanIn{sources: sources}
+
+	fi.Init(fi, name)
+	return fi
+}
+
+// Sources returns the services merged by the FanIn.
+func (fi *FanIn) Sources() []Service {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	return append([]Service(nil), fi.sources...)
+}
+
+// AddSource merges the results of the service, starting immediately when the FanIn is running.
+func (fi *FanIn) AddSource(src Service) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	fi.sources = append(fi.sources, src)
+	if fi.run != nil {
+		fi.forward(fi.run, src)
+	}
+}
+
+// follow resumes merging the results of a source that was restarted.
+func (fi *FanIn) follow(src Service) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	if fi.run != nil {
+		fi.forward(fi.run, src)
+	}
+}
+
+// OnStart implements the Service interface.
+func (fi *FanIn) OnStart() error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	fi.run = fi.Context()
+	fi.active = 0
+	for _, src := range fi.sources {
+		fi.forward(fi.run, src)
+	}
+	fi.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (fi *FanIn) OnStop() error {
+	fi.mu.Lock()
+	fi.run = nil
+	fi.mu.Unlock()
+
+	fi.wg.Wait()
+	return nil
+}
+
+// forward starts the goroutine copying the results of the source. The lock must be held.
+func (fi *FanIn) forward(ctx context.Context, src Service) {
+	fi.active++
+	fi.wg.Add(1)
+	// The run is compared with the context of the FanIn, so the context without the labels is provided
+	fi.RunLabeled(ctx, "forward", func(context.Context) { fi.copyResults(ctx, src) })
+}
+
+func (fi *FanIn) copyResults(ctx context.Context, src Service) {
+	defer fi.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-src.Output():
+			if !fi.deliver(ctx, msg) {
+				return
+			}
+		case <-src.Done():
+			// The results already emitted by the source are not lost
+			for {
+				select {
+				case msg := <-src.Output():
+					if !fi.deliver(ctx, msg) {
+						return
+					}
+				default:
+					fi.sourceDone(ctx)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (fi *FanIn) deliver(ctx context.Context, msg interface{}) bool {
+	fi.IncReceived()
+
+	select {
+	case fi.Output() <- msg:
+		fi.emitted(msg)
+		return true
+	case <-ctx.Done():
+		fi.ReportDeadLetter(msg, DeadLetterCanceled, ctx.Err())
+	}
+	return false
+}
+
+// sourceDone stops the FanIn once the last source of the run has finished.
+func (fi *FanIn) sourceDone(ctx context.Context) {
+	fi.mu.Lock()
+	fi.active--
+	last := fi.active == 0 && fi.run == ctx && !fi.persistent
+	fi.mu.Unlock()
+
+	if last {
+		// Stop waits for this goroutine to exit
+		go func() { _ = fi.Stop() }()
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFanIn(t *testing.T) {
+	const num = 50
+
+	var sources []Service
+	for _, name := range []string{"first", "second", "third"} {
+		src := newEchoService(name)
+		_ = src.Start()
+		sources = append(sources, src)
+	}
+
+	fi := NewFanIn("FanIn", sources...)
+	_ = fi.Start()
+	defer func() { _ = fi.Stop() }()
+
+	received := make(map[interface{}]bool)
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for {
+			msg, err := fi.Receive(ctx)
+			if err != nil {
+				return
+			}
+			received[msg] = true
+		}
+	}()
+
+	for i := 0; i < num; i++ {
+		for j, src := range sources {
+			_ = src.(*SimpleService).Send(context.Background(), j*num+i)
+		}
+		// The second source stops in the middle of the stream
+		if i == num/2 {
+			_ = sources[1].(*SimpleService).StopDrain(context.Background())
+			sources = append(sources[:1], sources[2:]...)
+		}
+	}
+	for _, src := range sources {
+		_ = src.(*SimpleService).StopDrain(context.Background())
+	}
+
+	select {
+	case <-fi.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("The FanIn did not stop after every source finished")
+	}
+	<-collected
+
+	if expected := 2*num + num/2 + 1; len(received) != expected {
+		t.Errorf("Expected %d results to be merged and received %d", expected, len(received))
+	}
+}
+
+func TestFanInAddSource(t *testing.T) {
+	fi := NewFanIn("Dynamic", newEchoService("static"))
+	_ = fi.Start()
+	defer func() { _ = fi.Stop() }()
+
+	src := newEchoService("dynamic")
+	_ = src.Start()
+	defer func() { _ = src.Stop() }()
+
+	fi.AddSource(src)
+	if n := len(fi.Sources()); n != 2 {
+		t.Errorf("Expected 2 sources and counted %d", n)
+	}
+
+	src.Input() <- "added"
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if msg, err := fi.Receive(ctx); err != nil || msg != "added" {
+		t.Errorf("Expected the result of the added source and received %v, %v", msg, err)
+	}
+}
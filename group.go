@@ -0,0 +1,436 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// Group starts and stops a collection of services together.
+type Group struct {
+	sync.Mutex
+	// Serializes StartAll, StopAll and StopDrain, which do not hold the lock while the services
+	// start and stop
+	lifecycle  sync.Mutex
+	members    []Service
+	bestEffort map[Service]struct{}
+	done       chan struct{}
+	logger     *slog.Logger
+	middleware []Middleware
+	congestion []*groupCongestion
+	shared     *SharedLimiter
+	deps       map[Service][]string
+	awaitReady map[Service]struct{}
+}
+
+type memberConfig struct {
+	bestEffort bool
+	deps       []string
+	awaitReady bool
+}
+
+// MemberOption configures a service added to a Group.
+type MemberOption func(*memberConfig)
+
+// BestEffort marks the service as not critical, so its health does not affect the health of the group.
+func BestEffort() MemberOption {
+	return func(c *memberConfig) {
+		c.bestEffort = true
+	}
+}
+
+// The services that accept a logger, such as those embedding BaseService
+type loggerSetter interface {
+	Logger() *slog.Logger
+	SetLogger(l *slog.Logger)
+}
+
+// NewGroup returns a Group containing the provided services.
+func NewGroup(members ...Service) *Group {
+	return &Group{
+		members:    members,
+		bestEffort: make(map[Service]struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Add appends the service to the group. Services are started in the order they were added,
+// and are critical to the health of the group unless the BestEffort option is provided.
+func (g *Group) Add(srv Service, opts ...MemberOption) {
+	var cfg memberConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	g.members = append(g.members, srv)
+	if cfg.bestEffort {
+		if g.bestEffort == nil {
+			g.bestEffort = make(map[Service]struct{})
+		}
+		g.bestEffort[srv] = struct{}{}
+	}
+	if len(cfg.deps) > 0 {
+		if g.deps == nil {
+			g.deps = make(map[Service][]string)
+		}
+		g.deps[srv] = cfg.deps
+	}
+	if cfg.awaitReady {
+		if g.awaitReady == nil {
+			g.awaitReady = make(map[Service]struct{})
+		}
+		g.awaitReady[srv] = struct{}{}
+	}
+	inheritLogger(srv, g.logger)
+	if len(g.middleware) > 0 {
+		inheritMiddleware(srv, g, g.middleware)
+	}
+	for _, c := range g.congestion {
+		c.watch(srv)
+	}
+	if g.shared != nil {
+		inheritSharedLimit(srv, g.shared)
+	}
+}
+
+// SetLogger sets the logger provided to the services in the group that do not have a logger,
+// including the services added later.
+func (g *Group) SetLogger(l *slog.Logger) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.logger = l
+	for _, srv := range g.members {
+		inheritLogger(srv, l)
+	}
+}
+
+// Use adds middleware applied around the handlers of the services in the group that support them,
+// such as those embedding BaseService, including the services added later. The middleware of the
+// group are applied outside of the middleware set on each service.
+func (g *Group) Use(mw ...Middleware) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.middleware = append(g.middleware[:len(g.middleware):len(g.middleware)], mw...)
+	for _, srv := range g.members {
+		inheritMiddleware(srv, g, g.middleware)
+	}
+}
+
+// The services that accept a Limiter, such as those embedding BaseService
+type rateLimiterSetter interface {
+	SetRateLimiter(l Limiter)
+}
+
+// SetSharedRateLimit sets a rate limit of persec calls each second shared by the services in the
+// group that accept a Limiter, such as those embedding BaseService, including the services added
+// later. The services take turns drawing from the shared rate, as described by SharedLimiter. A
+// value of zero removes the rate limit from the services.
+func (g *Group) SetSharedRateLimit(persec int) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.shared = nil
+	if persec > 0 {
+		g.shared = NewSharedLimiter(persec)
+	}
+	for _, srv := range g.members {
+		inheritSharedLimit(srv, g.shared)
+	}
+}
+
+func inheritSharedLimit(srv Service, shared *SharedLimiter) {
+	rs, ok := srv.(rateLimiterSetter)
+	if !ok {
+		return
+	}
+
+	if shared == nil {
+		rs.SetRateLimiter(nil)
+		return
+	}
+	rs.SetRateLimiter(shared.Member())
+}
+
+func inheritLogger(srv Service, l *slog.Logger) {
+	if ls, ok := srv.(loggerSetter); ok && l != nil && ls.Logger() == nil {
+		ls.SetLogger(l)
+	}
+}
+
+// Members returns the services in the group, in the order they were added.
+func (g *Group) Members() []Service {
+	g.Lock()
+	defer g.Unlock()
+
+	return append([]Service(nil), g.members...)
+}
+
+// StartAll starts the services in the order they were added. When a service fails to start,
+// the services already started are stopped in reverse order and the errors are returned. When
+// dependencies were declared using DependsOn, each service is started once its dependencies have
+// started, the services that do not depend on each other are started concurrently, and an error
+// wrapping ErrDependencyCycle or ErrUnknownDependency is returned before any service is started
+// when the dependencies are not valid. The services marked by AwaitReady are waited for up to
+// DefaultReadyTimeout before StartAll returns, and before the following services are started.
+func (g *Group) StartAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultReadyTimeout)
+	defer cancel()
+
+	return g.StartAllContext(ctx)
+}
+
+// StartAllContext is like StartAll, but the services marked by AwaitReady are waited for until the
+// context is done. The services already started are then stopped, and the context error is returned.
+func (g *Group) StartAllContext(ctx context.Context) error {
+	g.lifecycle.Lock()
+	defer g.lifecycle.Unlock()
+
+	g.Lock()
+	members := append([]Service(nil), g.members...)
+	deps := make(map[Service][]string, len(g.deps))
+	for srv, names := range g.deps {
+		deps[srv] = names
+	}
+	await := make(map[Service]struct{}, len(g.awaitReady))
+	for srv := range g.awaitReady {
+		await[srv] = struct{}{}
+	}
+	g.Unlock()
+
+	if len(deps) > 0 {
+		order, err := dependencyOrder(members, deps, true)
+		if err != nil {
+			return err
+		}
+		if err := startGraph(ctx, order, deps, await); err != nil {
+			return err
+		}
+
+		g.watch(members)
+		return nil
+	}
+
+	for i, srv := range members {
+		started := members[:i]
+		err := srv.Start()
+		if err == nil {
+			started = members[:i+1]
+			err = awaitStarted(ctx, srv, await)
+		}
+		if err == nil {
+			continue
+		}
+
+		errs := []error{fmt.Errorf("%s: failed to start: %w", srv, err)}
+		if err := stopReverse(started); err != nil {
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+
+	g.watch(members)
+	return nil
+}
+
+// watch replaces the Done channel of the group with one closed once the members have stopped.
+func (g *Group) watch(members []Service) {
+	g.Lock()
+	defer g.Unlock()
+
+	done := make(chan struct{})
+	g.done = done
+	go watchMembers(members, done)
+}
+
+// StopAll stops the services in the reverse order they were added, or in the reverse order of
+// their dependencies, so each service is stopped before the services it depends on. The joined
+// errors are returned. Services that were never started or were already stopped are skipped.
+func (g *Group) StopAll() error {
+	g.lifecycle.Lock()
+	defer g.lifecycle.Unlock()
+
+	g.Lock()
+	members := g.stopOrder()
+	g.Unlock()
+
+	return stopReverse(members)
+}
+
+// The services that finish their queued requests before stopping, such as those embedding BaseService
+type drainer interface {
+	StopDrain(ctx context.Context) error
+}
+
+// StopDrain stops the services in the reverse order they were added, using StopDrain for the
+// services that provide it, so their queued requests are finished first. When the context is
+// done, the remaining services are stopped without finishing their requests, and the context
+// error is returned with the other errors. Dependencies are honored as they are by StopAll.
+func (g *Group) StopDrain(ctx context.Context) error {
+	g.lifecycle.Lock()
+	defer g.lifecycle.Unlock()
+
+	g.Lock()
+	members := g.stopOrder()
+	g.Unlock()
+
+	var errs []error
+	for i := len(members) - 1; i >= 0; i-- {
+		srv := members[i]
+
+		var err error
+		if d, ok := srv.(drainer); ok {
+			err = d.StopDrain(ctx)
+		} else {
+			err = srv.Stop()
+		}
+		if err != nil && !errors.Is(err, ErrAlreadyStopped) && !errors.Is(err, ErrNotStarted) &&
+			!errors.Is(err, ctx.Err()) {
+			errs = append(errs, err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Done returns a channel that is closed after every service started by StartAll has stopped.
+func (g *Group) Done() <-chan struct{} {
+	g.Lock()
+	defer g.Unlock()
+
+	return g.done
+}
+
+func watchMembers(members []Service, done chan struct{}) {
+	for _, srv := range members {
+		<-srv.Done()
+	}
+	close(done)
+}
+
+// WaitOption configures the Wait method of a Group.
+type WaitOption func(*waitConfig)
+
+type waitConfig struct {
+	failFast bool
+}
+
+// WithFailFast stops the remaining services in the group, in the order used by StopAll, as soon
+// as a service stops with an error.
+func WithFailFast() WaitOption {
+	return func(c *waitConfig) {
+		c.failFast = true
+	}
+}
+
+// The services that record the cause of their stop, such as those embedding BaseService
+type errReporter interface {
+	Err() error
+}
+
+// Wait blocks until every service in the group has stopped, and returns the first error reported
+// by the Err method of the services that provide it. When the context is done first, the first
+// error is returned when one was reported, and the context error otherwise.
+func (g *Group) Wait(ctx context.Context, opts ...WaitOption) error {
+	var cfg waitConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	g.Lock()
+	members := g.stopOrder()
+	g.Unlock()
+
+	results := make(chan error, len(members))
+	finished := make(chan struct{})
+	defer close(finished)
+
+	for _, srv := range members {
+		go func(srv Service) {
+			select {
+			case <-srv.Done():
+				results <- memberErr(srv)
+			case <-finished:
+			}
+		}(srv)
+	}
+
+	var first error
+	for range members {
+		select {
+		case err := <-results:
+			if err == nil || first != nil {
+				continue
+			}
+
+			first = err
+			if cfg.failFast {
+				_ = stopReverse(members)
+			}
+		case <-ctx.Done():
+			if first != nil {
+				return first
+			}
+			return ctx.Err()
+		}
+	}
+	return first
+}
+
+func memberErr(srv Service) error {
+	if er, ok := srv.(errReporter); ok {
+		if err := er.Err(); err != nil {
+			return fmt.Errorf("%s: %w", srv, err)
+		}
+	}
+	return nil
+}
+
+// Health checks the services in the group implementing the HealthChecker interface, and returns
+// the result for each of them by name. A nil error means the service is healthy.
+func (g *Group) Health(ctx context.Context) map[string]error {
+	results := make(map[string]error)
+
+	for _, srv := range g.Members() {
+		if hc, ok := srv.(HealthChecker); ok {
+			results[srv.String()] = hc.CheckHealth(ctx)
+		}
+	}
+	return results
+}
+
+// CheckHealth implements the HealthChecker interface. The group is unhealthy when any of the
+// critical services is unhealthy, and the errors from those services are returned joined.
+func (g *Group) CheckHealth(ctx context.Context) error {
+	g.Lock()
+	var critical []HealthChecker
+	for _, srv := range g.members {
+		if _, skip := g.bestEffort[srv]; skip {
+			continue
+		}
+		if hc, ok := srv.(HealthChecker); ok {
+			critical = append(critical, hc)
+		}
+	}
+	g.Unlock()
+
+	var errs []error
+	for _, hc := range critical {
+		if err := hc.CheckHealth(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,251 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	var order []string
+	rec := &recorder{events: &order}
+	g := NewGroup(newRecordedService("A", rec), newRecordedService("B", rec))
+	g.Add(newRecordedService("C", rec))
+
+	if err := g.StartAll(); err != nil {
+		t.Fatalf("Failed to start the group: %v", err)
+	}
+	select {
+	case <-g.Done():
+		t.Errorf("The group Done channel was closed while the services were running")
+	default:
+	}
+
+	if err := g.StopAll(); err != nil {
+		t.Errorf("Failed to stop the group: %v", err)
+	}
+	select {
+	case <-g.Done():
+	case <-time.After(time.Second):
+		t.Errorf("The group Done channel was not closed after the services stopped")
+	}
+
+	expected := []string{"start A", "start B", "start C", "stop C", "stop B", "stop A"}
+	if len(order) != len(expected) {
+		t.Fatalf("Expected the events %v, received %v", expected, order)
+	}
+	for i, e := range expected {
+		if order[i] != e {
+			t.Errorf("Expected the events %v, received %v", expected, order)
+			break
+		}
+	}
+}
+
+func TestGroupStartRollback(t *testing.T) {
+	var order []string
+	rec := &recorder{events: &order}
+	failing := new(failingService)
+	failing.Init(failing, "Failing")
+
+	a, b := newRecordedService("A", rec), newRecordedService("B", rec)
+	g := NewGroup(a, b, failing, newRecordedService("D", rec))
+	if err := g.StartAll(); !errors.Is(err, errStartFailed) {
+		t.Errorf("Expected the start failure to be returned, received %v", err)
+	}
+
+	expected := []string{"start A", "start B", "stop B", "stop A"}
+	if len(order) != len(expected) {
+		t.Fatalf("Expected the events %v, received %v", expected, order)
+	}
+	for i, e := range expected {
+		if order[i] != e {
+			t.Errorf("Expected the events %v, received %v", expected, order)
+			break
+		}
+	}
+}
+
+func TestGroupStopErrors(t *testing.T) {
+	errA, errB := errors.New("stop A failed"), errors.New("stop B failed")
+	a := &stopErrService{err: errA}
+	a.Init(a, "A")
+	b := &stopErrService{err: errB}
+	b.Init(b, "B")
+
+	g := NewGroup(a, b)
+	_ = g.StartAll()
+	err := g.StopAll()
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("Expected both stop errors to be joined, received %v", err)
+	}
+}
+
+type recorder struct {
+	sync.Mutex
+	events *[]string
+}
+
+func (r *recorder) record(event string) {
+	r.Lock()
+	defer r.Unlock()
+
+	*r.events = append(*r.events, event)
+}
+
+type recordedService struct {
+	BaseService
+	rec *recorder
+}
+
+func newRecordedService(name string, rec *recorder) *recordedService {
+	srv := &recordedService{rec: rec}
+
+	srv.Init(srv, name)
+	return srv
+}
+
+func (srv *recordedService) OnStart() error {
+	srv.rec.record("start " + srv.String())
+	return nil
+}
+
+func (srv *recordedService) OnStop() error {
+	srv.rec.record("stop " + srv.String())
+	return nil
+}
+
+type stopErrService struct {
+	BaseService
+	err error
+}
+
+func (srv *stopErrService) OnStop() error {
+	return srv.err
+}
+
+var errMemberFailed = errors.New("member failed")
+
+// Stops with an error shortly after it was started
+type failLaterService struct {
+	BaseService
+	after time.Duration
+}
+
+func (srv *failLaterService) OnStart() error {
+	time.AfterFunc(srv.after, func() { _ = srv.StopWithError(errMemberFailed) })
+	return nil
+}
+
+func TestGroupWaitFailFast(t *testing.T) {
+	failing := &failLaterService{after: 50 * time.Millisecond}
+	failing.Init(failing, "Failing")
+	a, b := newTestService(), newTestService()
+
+	g := NewGroup(a, failing, b)
+	if err := g.StartAll(); err != nil {
+		t.Fatalf("Failed to start the group: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := g.Wait(ctx, WithFailFast()); !errors.Is(err, errMemberFailed) {
+		t.Errorf("Expected the error of the failed member, received %v", err)
+	}
+	for _, srv := range g.Members() {
+		select {
+		case <-srv.Done():
+		default:
+			t.Errorf("Expected %s to be stopped by the failed member", srv)
+		}
+	}
+}
+
+func TestGroupWait(t *testing.T) {
+	a, b := newTestService(), newTestService()
+	g := NewGroup(a, b)
+	_ = g.StartAll()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := g.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context error while the services were running, received %v", err)
+	}
+
+	// Without fail-fast, the other services keep running after a failure
+	_ = b.StopWithError(errMemberFailed)
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel2()
+	if err := g.Wait(ctx2); !errors.Is(err, errMemberFailed) {
+		t.Errorf("Expected the error of the failed member, received %v", err)
+	}
+	if a.State() != StateRunning {
+		t.Errorf("Expected the other service to be running, received %v", a.State())
+	}
+
+	_ = g.StopAll()
+	g2 := NewGroup(newTestService(), newTestService())
+	_ = g2.StartAll()
+	_ = g2.StopAll()
+	if err := g2.Wait(context.Background()); err != nil {
+		t.Errorf("Expected no error after a clean stop, received %v", err)
+	}
+}
+
+func TestGroupLogger(t *testing.T) {
+	own := slog.New(new(recordHandler))
+	shared := slog.New(new(recordHandler))
+
+	first, second, third := newTestService(), newTestService(), newTestService()
+	second.SetLogger(own)
+
+	g := NewGroup(first, second)
+	g.SetLogger(shared)
+	g.Add(third)
+
+	if first.Logger() != shared || third.Logger() != shared {
+		t.Errorf("The group logger was not provided to the services without a logger")
+	}
+	if second.Logger() != own {
+		t.Errorf("The group logger replaced the logger of the service")
+	}
+}
+
+func TestGroupHealth(t *testing.T) {
+	critical, optional, stopped := newTestService(), newTestService(), newTestService()
+	critical.name, optional.name, stopped.name = "critical", "optional", "stopped"
+
+	g := NewGroup()
+	g.Add(critical)
+	g.Add(optional, BestEffort())
+	_ = critical.Start()
+	_ = optional.Start()
+	defer func() { _ = g.StopAll() }()
+
+	ctx := context.Background()
+	if err := g.CheckHealth(ctx); err != nil {
+		t.Errorf("The group is unhealthy while every service is running: %v", err)
+	}
+
+	_ = optional.Stop()
+	health := g.Health(ctx)
+	if len(health) != 2 || health["critical"] != nil || !errors.Is(health["optional"], ErrUnhealthy) {
+		t.Errorf("Unexpected health results: %v", health)
+	}
+	if err := g.CheckHealth(ctx); err != nil {
+		t.Errorf("The unhealthy best effort service made the group unhealthy: %v", err)
+	}
+
+	g.Add(stopped)
+	if err := g.CheckHealth(ctx); !errors.Is(err, ErrUnhealthy) {
+		t.Errorf("Expected ErrUnhealthy when a critical service is unhealthy, received %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultErrorRateThreshold is the ratio of errors to received requests above which the
+// service reports being unhealthy.
+const DefaultErrorRateThreshold = 0.5
+
+// HealthChecker is implemented by services that can report their health.
+type HealthChecker interface {
+	// CheckHealth returns nil when the service is healthy, and the reason otherwise.
+	CheckHealth(ctx context.Context) error
+}
+
+// SetErrorRateThreshold sets the ratio of errors to received requests above which CheckHealth
+// reports the service as unhealthy. A negative value disables the check of the error rate.
+func (bas *BaseService) SetErrorRateThreshold(ratio float64) {
+	bas.Lock()
+	defer bas.Unlock()
+
+	bas.errThreshold = ratio
+}
+
+// CheckHealth implements the HealthChecker interface. The service is unhealthy when it is not
+// running, or when the ratio of errors to received requests exceeds the error rate threshold.
+// Errors returned wrap ErrUnhealthy.
+func (bas *BaseService) CheckHealth(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if state := bas.State(); state != StateRunning {
+		return fmt.Errorf("%s: %w: the service is %s", bas.name, ErrUnhealthy, state)
+	}
+
+	bas.Lock()
+	threshold := bas.errThreshold
+	bas.Unlock()
+
+	stats := bas.Stats()
+	if threshold < 0 || stats.Received == 0 {
+		return nil
+	}
+	if rate := float64(stats.Errors) / float64(stats.Received); rate > threshold {
+		return fmt.Errorf("%s: %w: the error rate %.2f exceeds %.2f", bas.name, ErrUnhealthy, rate, threshold)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckHealth(t *testing.T) {
+	srv := newTestService()
+	ctx := context.Background()
+
+	if err := srv.CheckHealth(ctx); !errors.Is(err, ErrUnhealthy) {
+		t.Errorf("Expected ErrUnhealthy for a service that was not started, received %v", err)
+	}
+
+	_ = srv.Start()
+	if err := srv.CheckHealth(ctx); err != nil {
+		t.Errorf("The running service is unhealthy: %v", err)
+	}
+
+	srv.IncReceived()
+	srv.IncReceived()
+	srv.ReportError(errors.New("failed"))
+	if err := srv.CheckHealth(ctx); err != nil {
+		t.Errorf("The service at the error rate threshold is unhealthy: %v", err)
+	}
+	srv.ReportError(errors.New("failed"))
+	if err := srv.CheckHealth(ctx); !errors.Is(err, ErrUnhealthy) {
+		t.Errorf("Expected ErrUnhealthy when the error rate exceeds the threshold, received %v", err)
+	}
+
+	srv.SetErrorRateThreshold(-1)
+	if err := srv.CheckHealth(ctx); err != nil {
+		t.Errorf("The service is unhealthy after the error rate check was disabled: %v", err)
+	}
+
+	_ = srv.Stop()
+	if err := srv.CheckHealth(ctx); !errors.Is(err, ErrUnhealthy) {
+		t.Errorf("Expected ErrUnhealthy for a stopped service, received %v", err)
+	}
+}
+
+func TestCheckHealthCanceled(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := srv.CheckHealth(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from the health check, received %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type heartbeat struct {
+	last     atomic.Int64
+	interval atomic.Int64
+}
+
+// SetHeartbeatInterval makes the goroutines started by the Run method beat at the interval while
+// they wait for requests, so an idle service is distinguished from one with a stalled handler.
+// The interval applies to the goroutines started after it is set. Zero disables the idle beats.
+func (bas *BaseService) SetHeartbeatInterval(d time.Duration) {
+	bas.beats.interval.Store(int64(d))
+}
+
+// Beat records that the service has made progress. The Run method beats after each request is
+// handled, and services with their own request loop should call Beat on each iteration.
+func (bas *BaseService) Beat() {
+	bas.beats.last.Store(bas.clock.Now().UnixNano())
+}
+
+// LastBeat returns the time of the last heartbeat, or the zero time when the service has not beat.
+func (bas *BaseService) LastBeat() time.Time {
+	if last := bas.beats.last.Load(); last != 0 {
+		return time.Unix(0, last)
+	}
+	return time.Time{}
+}
+
+// Healthy returns true when the service is running and has beat within the maximum age.
+func (bas *BaseService) Healthy(maxAge time.Duration) bool {
+	if bas.State() != StateRunning {
+		return false
+	}
+
+	last := bas.LastBeat()
+	return !last.IsZero() && bas.since(last) <= maxAge
+}
+
+// beatTicker returns the channel delivering the idle beats, and the function stopping them.
+func (bas *BaseService) beatTicker() (<-chan time.Time, func()) {
+	d := time.Duration(bas.beats.interval.Load())
+	if d <= 0 {
+		return nil, func() {}
+	}
+
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
@@ -0,0 +1,89 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatIdle(t *testing.T) {
+	srv := NewSimpleService("Idle", func(req interface{}) (interface{}, error) {
+		return req, nil
+	})
+	srv.SetHeartbeatInterval(10 * time.Millisecond)
+
+	if srv.Healthy(time.Second) {
+		t.Errorf("The service is healthy before it was started")
+	}
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	time.Sleep(100 * time.Millisecond)
+	if !srv.Healthy(50 * time.Millisecond) {
+		t.Errorf("The idle service is not healthy, the last beat was at %v", srv.LastBeat())
+	}
+}
+
+func TestHeartbeatWatchdog(t *testing.T) {
+	stall := make(chan struct{})
+	srv := NewSimpleService("Stalled", func(req interface{}) (interface{}, error) {
+		<-stall
+		return req, nil
+	})
+	srv.SetHeartbeatInterval(10 * time.Millisecond)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+	defer close(stall)
+
+	srv.Input() <- "stall"
+
+	// The watchdog checks the service until it stops making progress
+	detected := make(chan struct{})
+	go func() {
+		t := time.NewTicker(10 * time.Millisecond)
+		defer t.Stop()
+
+		for range t.C {
+			if !srv.Healthy(50 * time.Millisecond) {
+				close(detected)
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-detected:
+	case <-time.After(time.Second):
+		t.Fatalf("The watchdog did not detect the stalled handler")
+	}
+}
+
+func TestBeat(t *testing.T) {
+	clock := newFakeClock()
+	srv := newTestService(WithClock(clock))
+
+	if !srv.LastBeat().IsZero() {
+		t.Errorf("A new service has a heartbeat")
+	}
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Beat()
+	if last := srv.LastBeat(); !last.Equal(clock.Now()) {
+		t.Errorf("Expected the beat to be recorded at %v, received %v", clock.Now(), last)
+	}
+	if !srv.Healthy(time.Second) {
+		t.Errorf("The service is not healthy right after a beat")
+	}
+
+	clock.Advance(2 * time.Second)
+	if srv.Healthy(time.Second) {
+		t.Errorf("The service is healthy after the maximum age has passed on its clock")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// The number of buckets with an upper bound. The bounds are the powers of 2^(1/4) seconds from
+// 2^-20 seconds, about one microsecond, to about 107 seconds, so a percentile is within 19% of the
+// recorded latency. These are the buckets of the native histograms of Prometheus with schema 2.
+const (
+	latencyBuckets  = 108
+	latencyMinPower = -80
+)
+
+var latencyBounds = func() []time.Duration {
+	bounds := make([]time.Duration, latencyBuckets)
+	for i := range bounds {
+		bounds[i] = time.Duration(math.Round(float64(time.Second) * math.Pow(2, float64(latencyMinPower+i)/4)))
+	}
+	return bounds
+}()
+
+// LatencyBounds returns the upper bounds of the buckets of a LatencyHistogram.
+func LatencyBounds() []time.Duration {
+	return append([]time.Duration(nil), latencyBounds...)
+}
+
+// LatencyHistogram is a snapshot of the distribution of a latency measured by a service.
+type LatencyHistogram struct {
+	Count uint64        `json:"count"`
+	Sum   time.Duration `json:"sum"`
+	Max   time.Duration `json:"max"`
+	// The number of latencies in each bucket, where bucket i holds the latencies up to the bound i
+	// returned by LatencyBounds, and the last bucket holds the longer latencies. It is nil when no
+	// latency has been recorded.
+	Counts []uint64 `json:"counts,omitempty"`
+}
+
+// Percentile returns the latency that p percent of the recorded latencies do not exceed, such as
+// Percentile(99) for the 99th percentile. The latency returned is the upper bound of its bucket,
+// and never exceeds the longest latency recorded. It returns zero when no latency was recorded.
+func (h LatencyHistogram) Percentile(p float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(min(max(p, 0), 100) / 100 * float64(h.Count)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen < rank {
+			continue
+		}
+		if i < len(latencyBounds) {
+			return min(latencyBounds[i], h.Max)
+		}
+		break
+	}
+	return h.Max
+}
+
+// latencyHistogram records latencies with atomic counters, so the requests are not serialized.
+type latencyHistogram struct {
+	counts [latencyBuckets + 1]atomic.Uint64
+	sum    atomic.Int64
+	max    atomic.Int64
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	// The first bound that is not smaller than the latency
+	lo, hi := 0, latencyBuckets
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if latencyBounds[mid] < d {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	h.counts[lo].Add(1)
+	h.sum.Add(int64(d))
+	storeMax(&h.max, int64(d))
+}
+
+func (h *latencyHistogram) snapshot() LatencyHistogram {
+	var s LatencyHistogram
+
+	counts := make([]uint64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = h.counts[i].Load()
+		s.Count += counts[i]
+	}
+	if s.Count == 0 {
+		return s
+	}
+
+	s.Counts = counts
+	s.Sum = time.Duration(h.sum.Load())
+	s.Max = time.Duration(h.max.Load())
+	return s
+}
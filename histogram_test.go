@@ -0,0 +1,104 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	if s := h.snapshot(); s.Count != 0 || s.Counts != nil || s.Percentile(50) != 0 {
+		t.Errorf("Expected an empty snapshot, received %+v", s)
+	}
+
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	h.record(10 * time.Minute)
+
+	s := h.snapshot()
+	if s.Count != 101 || s.Max != 10*time.Minute {
+		t.Errorf("Expected 101 latencies up to 10m, received %d up to %v", s.Count, s.Max)
+	}
+	if n := s.Counts[len(s.Counts)-1]; n != 1 {
+		t.Errorf("Expected the longest latency in the last bucket, received %d", n)
+	}
+
+	for _, tc := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{50, 51 * time.Millisecond},
+		{90, 91 * time.Millisecond},
+		{99, 100 * time.Millisecond},
+	} {
+		// The percentile is the upper bound of the bucket, which exceeds the latency by 19% at most
+		got := s.Percentile(tc.p)
+		if got < tc.want || float64(got) > 1.19*float64(tc.want) {
+			t.Errorf("Expected the percentile %v to be close to %v, received %v", tc.p, tc.want, got)
+		}
+	}
+	if got := s.Percentile(100); got != 10*time.Minute {
+		t.Errorf("Expected the maximum for the percentile 100, received %v", got)
+	}
+}
+
+func TestHandlerLatency(t *testing.T) {
+	clock := newFakeClock()
+	srv := NewSimpleService("Latency", func(req interface{}) (interface{}, error) {
+		clock.Advance(req.(time.Duration))
+		return req, nil
+	}, WithClock(clock))
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for _, d := range []time.Duration{time.Millisecond, 2 * time.Millisecond, time.Second} {
+		srv.Input() <- d
+		<-srv.Output()
+	}
+
+	h := srv.Stats().HandlerLatency
+	if h.Count != 3 || h.Sum != time.Second+3*time.Millisecond || h.Max != time.Second {
+		t.Errorf("Expected the latencies of 3 requests, received %+v", h)
+	}
+	if p := h.Percentile(50); p < 2*time.Millisecond || p > 3*time.Millisecond {
+		t.Errorf("Expected the median close to 2ms, received %v", p)
+	}
+}
+
+func BenchmarkLatencyHistogramRecord(b *testing.B) {
+	var h latencyHistogram
+
+	for i := 0; i < b.N; i++ {
+		h.record(time.Duration(i%1000) * time.Microsecond)
+	}
+}
+
+func BenchmarkLatencyHistogramRecordParallel(b *testing.B) {
+	var h latencyHistogram
+
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			h.record(time.Duration(i%1000) * time.Microsecond)
+			i++
+		}
+	})
+}
+
+// BenchmarkRequest measures a request processed by the Run method, including the latencies
+// recorded for it.
+func BenchmarkRequest(b *testing.B) {
+	srv := newEchoService("Benchmark")
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 0; i < b.N; i++ {
+		srv.Input() <- i
+		<-srv.Output()
+	}
+}
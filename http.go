@@ -0,0 +1,275 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// The default settings of the handler returned by NewHTTPHandler.
+const (
+	// The time permitted for the service to respond to an HTTP request
+	DefaultHTTPTimeout = 30 * time.Second
+	// The largest request body in bytes that the handler reads
+	DefaultMaxRequestSize = 1 << 20
+)
+
+// HTTPOption configures the handler returned by NewHTTPHandler.
+type HTTPOption func(*httpHandler)
+
+// WithHTTPTimeout sets the time permitted for the service to respond to each HTTP request. The
+// deadline of the request context applies when it is earlier. A timeout that is not positive
+// removes the limit.
+func WithHTTPTimeout(d time.Duration) HTTPOption {
+	return func(h *httpHandler) {
+		h.timeout = d
+	}
+}
+
+// WithMaxRequestSize sets the largest request body in bytes that the handler reads. The handler
+// responds with 413 to the requests with a larger body. A size that is not positive removes the limit.
+func WithMaxRequestSize(n int64) HTTPOption {
+	return func(h *httpHandler) {
+		h.maxBody = n
+	}
+}
+
+// WithStreaming makes the handler respond with the results of the service that carry the ID of
+// the request message, encoded as JSON lines, for services that send several results for each
+// request. The response ends once no result is received during the idle duration, or when the
+// timeout expires. The handler subscribes to the results of the service, so the service must
+// provide Subscribe like BaseService, and the results should only be read from subscriptions.
+func WithStreaming(idle time.Duration) HTTPOption {
+	return func(h *httpHandler) {
+		h.streamIdle = idle
+	}
+}
+
+// contentTyper is implemented by the codecs that know the media type of the encoded payloads.
+type contentTyper interface {
+	ContentType() string
+}
+
+type stater interface {
+	State() State
+}
+
+type trySender interface {
+	TrySend(msg interface{}) bool
+	OverflowPolicy() OverflowPolicy
+}
+
+type subscribable interface {
+	Subscribe(opts ...SubscribeOption) (<-chan interface{}, func())
+}
+
+type httpHandler struct {
+	srv         Service
+	codec       Codec
+	timeout     time.Duration
+	maxBody     int64
+	streamIdle  time.Duration
+	contentType string
+}
+
+// NewHTTPHandler returns an http.Handler that decodes the body of each POST request with the
+// codec, sends the payload to the service in a *Message, and responds with the reply encoded by
+// the codec. The handler responds with 413 when the body is larger than DefaultMaxRequestSize or
+// the size set by WithMaxRequestSize, 503 when the service is not running, 429 when the service
+// drops messages using WithOverflowPolicy and its Input channel is full, 504 when the service does
+// not respond in time, and 500 when the handler of the service returns an error.
+func NewHTTPHandler(srv Service, codec Codec, opts ...HTTPOption) http.Handler {
+	h := &httpHandler{
+		srv:         srv,
+		codec:       codec,
+		timeout:     DefaultHTTPTimeout,
+		maxBody:     DefaultMaxRequestSize,
+		contentType: "application/octet-stream",
+	}
+	if ct, ok := codec.(contentTyper); ok {
+		h.contentType = ct.ContentType()
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !serviceRunning(h.srv) {
+		http.Error(w, fmt.Sprintf("%s: %v", h.srv, ErrNotRunning), http.StatusServiceUnavailable)
+		return
+	}
+
+	if h.maxBody > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxBody)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		code := http.StatusBadRequest
+
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	payload, err := h.codec.Unmarshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	if h.streamIdle > 0 {
+		h.stream(ctx, w, payload)
+		return
+	}
+
+	msg := NewMessageContext(ctx, payload)
+	msg.reply = make(chan response, 1)
+	if err := h.send(ctx, msg); err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+
+	result, err := awaitReply(ctx, h.srv, msg)
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	data, err := h.codec.Marshal(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", h.contentType)
+	_, _ = w.Write(data)
+}
+
+// stream responds with the results carrying the ID of the request message as they are received.
+func (h *httpHandler) stream(ctx context.Context, w http.ResponseWriter, payload interface{}) {
+	sub, ok := h.srv.(subscribable)
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s: streaming is not supported", h.srv), http.StatusNotImplemented)
+		return
+	}
+
+	// The subscription is created first, so the results sent before the send returns are received
+	results, unsubscribe := sub.Subscribe()
+	defer unsubscribe()
+
+	msg := NewMessageContext(ctx, payload)
+	if err := h.send(ctx, msg); err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	idle := time.NewTimer(h.streamIdle)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-idle.C:
+			return
+		case result, open := <-results:
+			if !open {
+				return
+			}
+
+			m, isMsg := result.(*Message)
+			if !isMsg || m.ID != msg.ID {
+				continue
+			}
+
+			data, err := h.codec.Marshal(m.Payload)
+			if err != nil {
+				continue
+			}
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(h.streamIdle)
+		}
+	}
+}
+
+// send delivers the message to the service, without blocking when the service drops messages
+// that do not fit in its Input channel.
+func (h *httpHandler) send(ctx context.Context, msg *Message) error {
+	if ts, ok := h.srv.(trySender); ok && ts.OverflowPolicy() != PolicyBlock {
+		if !ts.TrySend(msg) {
+			return fmt.Errorf("%s: %w", h.srv, ErrInputFull)
+		}
+		return nil
+	}
+	return sendTo(ctx, h.srv, msg)
+}
+
+// serviceRunning reports whether the service is running, using its State when it is available.
+func serviceRunning(srv Service) bool {
+	if s, ok := srv.(stater); ok {
+		return s.State() == StateRunning
+	}
+
+	select {
+	case <-srv.Done():
+		return false
+	default:
+	}
+	return true
+}
+
+// httpStatus returns the status code of the response for the error.
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInputFull):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrServiceStopped), errors.Is(err, ErrNotRunning),
+		errors.Is(err, ErrPaused), errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrRequestTimeout):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,177 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, h http.Handler, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return rec
+}
+
+func TestHTTPHandler(t *testing.T) {
+	failed := errors.New("failed")
+	srv := NewSimpleService("Upper", func(req interface{}) (interface{}, error) {
+		switch s := req.(string); s {
+		case "fail":
+			return nil, failed
+		case "none":
+			return nil, nil
+		default:
+			return strings.ToUpper(s), nil
+		}
+	})
+	h := NewHTTPHandler(srv, JSONCodec[string]())
+
+	if rec := post(t, h, `"a"`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the service is started and received %d", rec.Code)
+	}
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	rec := post(t, h, `"a"`)
+	if rec.Code != http.StatusOK || rec.Body.String() != `"A"` {
+		t.Errorf("Expected the encoded reply and received %d %q", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected the content type of the codec and received %q", ct)
+	}
+
+	for body, code := range map[string]int{
+		`"fail"`: http.StatusInternalServerError,
+		`"none"`: http.StatusNoContent,
+		`{`:      http.StatusBadRequest,
+	} {
+		if rec := post(t, h, body); rec.Code != code {
+			t.Errorf("Expected %d for %s and received %d", code, body, rec.Code)
+		}
+	}
+
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/", nil))
+	if get.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for a GET request and received %d", get.Code)
+	}
+}
+
+func TestHTTPHandlerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	srv := NewSimpleService("Slow", func(req interface{}) (interface{}, error) {
+		<-release
+		return req, nil
+	})
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	h := NewHTTPHandler(srv, JSONCodec[string](), WithHTTPTimeout(20*time.Millisecond))
+	if rec := post(t, h, `"a"`); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 when the service does not respond in time and received %d", rec.Code)
+	}
+}
+
+func TestHTTPHandlerMaxRequestSize(t *testing.T) {
+	srv := newEchoService("Echo")
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	h := NewHTTPHandler(srv, JSONCodec[string](), WithMaxRequestSize(8))
+	if rec := post(t, h, `"short"`); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a body within the limit and received %d", rec.Code)
+	}
+	if rec := post(t, h, `"too long"`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a body over the limit and received %d", rec.Code)
+	}
+
+	large := `"` + strings.Repeat("a", DefaultMaxRequestSize) + `"`
+	if rec := post(t, NewHTTPHandler(srv, JSONCodec[string]()), large); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a body over the default limit and received %d", rec.Code)
+	}
+	if rec := post(t, NewHTTPHandler(srv, JSONCodec[string](), WithMaxRequestSize(0)), large); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a large body without a limit and received %d", rec.Code)
+	}
+}
+
+func TestHTTPHandlerInputFull(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	srv := NewSimpleService("Busy", func(req interface{}) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return req, nil
+	}, WithInputBuffer(1), WithOverflowPolicy(PolicyDropNew))
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	// The handler is blocked on the first request, and the second fills the buffer
+	srv.Input() <- "first"
+	<-started
+	srv.Input() <- "second"
+
+	h := NewHTTPHandler(srv, JSONCodec[string]())
+	if rec := post(t, h, `"a"`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 when the message cannot be delivered and received %d", rec.Code)
+	}
+}
+
+// splitService sends a result for each character of the requests.
+type splitService struct {
+	BaseService
+}
+
+func (s *splitService) OnStart() error {
+	go func() {
+		for {
+			select {
+			case <-s.Done():
+				return
+			case req := <-s.Input():
+				msg := req.(*Message)
+				for _, c := range msg.Payload.(string) {
+					s.Output() <- &Message{ID: msg.ID, Payload: string(c)}
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func TestHTTPHandlerStreaming(t *testing.T) {
+	srv := new(splitService)
+	srv.Init(srv, "Split")
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	server := httptest.NewServer(NewHTTPHandler(srv, JSONCodec[string](), WithStreaming(50*time.Millisecond)))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`"abc"`))
+	if err != nil {
+		t.Fatalf("The request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if got := string(body); got != "\"a\"\n\"b\"\n\"c\"\n" {
+		t.Errorf("Expected a JSON line for each result and received %q", got)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected the JSON lines content type and received %q", ct)
+	}
+}
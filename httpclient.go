@@ -0,0 +1,213 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// The default limits of an HTTPService.
+const (
+	DefaultMaxBodySize  = 10 << 20
+	DefaultMaxRedirects = 10
+)
+
+// HTTPResponse is the result of a request performed by an HTTPService.
+type HTTPResponse struct {
+	Request    *http.Request
+	StatusCode int
+	Header     http.Header
+	// The body read up to the maximum body size
+	Body []byte
+	// Whether the body was cut at the maximum body size
+	Truncated bool
+	// The time taken by the last attempt to send the request and read the body
+	Duration time.Duration
+}
+
+// HTTPError is returned for the requests that failed, or that received a response with a status
+// code indicating a transient failure, such as 503.
+type HTTPError struct {
+	Method string
+	URL    string
+	// The status code of the response, or zero when no response was received
+	StatusCode int
+	Err        error
+	// Whether the request can be sent again
+	retryable bool
+}
+
+// Error implements the error interface.
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s %s: %v", e.Method, e.URL, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Unwrap returns the error of the HTTP client.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether the failure is transient and the request is idempotent, so the
+// request is retried by the service.
+func (e *HTTPError) Temporary() bool {
+	return e.retryable
+}
+
+// HTTPService performs the *http.Request values received on its Input channel, and sends an
+// *HTTPResponse for each on its Output channel. The service checks its rate limit and the rate
+// limit of the host before each request, which are set using SetRateLimit, SetRateLimitForKey and
+// SetDefaultKeyRateLimit with the host names as keys. Idempotent requests are retried when they
+// fail or receive a status code indicating a transient failure, as configured by WithRetry. The
+// requests that cannot be performed are reported as an *HTTPError on the Errors channel and to
+// the dead letters. A request sent in a *Message is performed with the context of the message.
+type HTTPService struct {
+	BaseService
+	client       *http.Client
+	maxBody      atomic.Int64
+	maxRedirects atomic.Int64
+}
+
+// NewHTTPService returns an HTTPService performing the requests with a copy of the client, or of
+// http.DefaultClient when the client is nil. The requests are retried with the default settings
+// of WithRetry, unless the options provide other settings.
+func NewHTTPService(name string, client *http.Client, opts ...Option) *HTTPService {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := *client
+
+	hs := &HTTPService{client: &c}
+	hs.maxBody.Store(DefaultMaxBodySize)
+	hs.maxRedirects.Store(DefaultMaxRedirects)
+
+	redirect := client.CheckRedirect
+	hs.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if limit := int(hs.maxRedirects.Load()); len(via) >= limit {
+			return fmt.Errorf("stopped after %d redirects", limit)
+		}
+		if redirect != nil {
+			return redirect(req, via)
+		}
+		return nil
+	}
+
+	hs.Init(hs, name, append([]Option{WithRetry()}, opts...)...)
+	return hs
+}
+
+// SetMaxBodySize sets the number of bytes read from the body of each response. The rest of
+// the body is discarded, and the response is marked as truncated. A size that is not positive
+// removes the limit.
+func (hs *HTTPService) SetMaxBodySize(n int64) {
+	hs.maxBody.Store(n)
+}
+
+// SetMaxRedirects sets the number of redirects followed for each request.
+func (hs *HTTPService) SetMaxRedirects(n int) {
+	hs.maxRedirects.Store(int64(n))
+}
+
+// OnStart implements the Service interface.
+func (hs *HTTPService) OnStart() error {
+	return hs.RunContext(hs.do)
+}
+
+func (hs *HTTPService) do(ctx context.Context, in interface{}) (interface{}, error) {
+	req, ok := in.(*http.Request)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported request type %T", hs, in)
+	}
+	if rlimit := hs.keyLimiter(req.URL.Host); rlimit != nil {
+		if err := hs.take(rlimit); err != nil {
+			return nil, err
+		}
+	}
+
+	// The request is abandoned when the context of the request or of the message is done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(req.Context(), cancel)()
+
+	out := req.Clone(ctx)
+	if req.GetBody != nil {
+		// The body may have been consumed by a previous attempt
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, hs.fail(req, 0, err)
+		}
+		out.Body = body
+	}
+
+	start := time.Now()
+	resp, err := hs.client.Do(out)
+	if err != nil {
+		return nil, hs.fail(req, 0, err)
+	}
+	defer resp.Body.Close()
+
+	var src io.Reader = resp.Body
+	limit := hs.maxBody.Load()
+	if limit > 0 {
+		src = io.LimitReader(resp.Body, limit+1)
+	}
+	body, err := io.ReadAll(src)
+	if err != nil {
+		return nil, hs.fail(req, resp.StatusCode, err)
+	}
+	if transientStatus(resp.StatusCode) {
+		return nil, hs.fail(req, resp.StatusCode, nil)
+	}
+
+	truncated := limit > 0 && int64(len(body)) > limit
+	if truncated {
+		body = body[:limit]
+	}
+	return &HTTPResponse{
+		Request:    req,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		Truncated:  truncated,
+		Duration:   time.Since(start),
+	}, nil
+}
+
+// fail returns the error for the request, which is retried when the request is idempotent
+// and can be sent again.
+func (hs *HTTPService) fail(req *http.Request, status int, err error) error {
+	return &HTTPError{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: status,
+		Err:        err,
+		retryable:  idempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil),
+	}
+}
+
+// idempotent reports whether the request can be sent more than once, like the http.Transport does.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+func transientStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
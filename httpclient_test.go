@@ -0,0 +1,114 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestHTTPService(t *testing.T) (*HTTPService, string) {
+	var flaky atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if flaky.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("recovered"))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	hs := NewHTTPService("HTTP", server.Client(), WithRetry(WithBackoff(time.Millisecond, time.Millisecond)))
+	_ = hs.Start()
+	t.Cleanup(func() { _ = hs.Stop() })
+	return hs, server.URL
+}
+
+func doRequest(t *testing.T, hs *HTTPService, method, url string) (*HTTPResponse, error) {
+	req, _ := http.NewRequest(method, url, strings.NewReader("body"))
+
+	result, err := hs.Request(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*HTTPResponse), nil
+}
+
+func TestHTTPService(t *testing.T) {
+	hs, url := newTestHTTPService(t)
+
+	resp, err := doRequest(t, hs, http.MethodGet, url+"/ok")
+	if err != nil || resp.StatusCode != http.StatusOK || string(resp.Body) != "hello" || resp.Duration <= 0 {
+		t.Errorf("Expected the response of the server and received %+v, %v", resp, err)
+	}
+
+	resp, err = doRequest(t, hs, http.MethodGet, url+"/missing")
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the not found response to be returned and received %+v, %v", resp, err)
+	}
+
+	hs.SetMaxBodySize(2)
+	resp, err = doRequest(t, hs, http.MethodGet, url+"/ok")
+	if err != nil || string(resp.Body) != "he" || !resp.Truncated {
+		t.Errorf("Expected the body to be truncated and received %+v, %v", resp, err)
+	}
+
+	hs.SetMaxRedirects(3)
+	if _, err := doRequest(t, hs, http.MethodGet, url+"/loop"); err == nil || !strings.Contains(err.Error(), "3 redirects") {
+		t.Errorf("Expected the redirects to be limited and received %v", err)
+	}
+}
+
+func TestHTTPServiceMaxBodySize(t *testing.T) {
+	hs, url := newTestHTTPService(t)
+
+	for _, tc := range []struct {
+		size      int64
+		body      string
+		truncated bool
+	}{
+		{size: 5, body: "hello"},
+		{size: 4, body: "hell", truncated: true},
+		{size: 0, body: "hello"},
+		{size: -1, body: "hello"},
+	} {
+		hs.SetMaxBodySize(tc.size)
+
+		resp, err := doRequest(t, hs, http.MethodGet, url+"/ok")
+		if err != nil || string(resp.Body) != tc.body || resp.Truncated != tc.truncated {
+			t.Errorf("Expected the body %q with the size %d, received %+v, %v", tc.body, tc.size, resp, err)
+		}
+	}
+}
+
+func TestHTTPServiceRetry(t *testing.T) {
+	hs, url := newTestHTTPService(t)
+
+	var herr *HTTPError
+	if _, err := doRequest(t, hs, http.MethodPost, url+"/flaky"); !errors.As(err, &herr) || herr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the non-idempotent request to fail without a retry and received %v", err)
+	}
+
+	// The second attempt is the second failure, and the third attempt succeeds
+	resp, err := doRequest(t, hs, http.MethodPut, url+"/flaky")
+	if err != nil || string(resp.Body) != "recovered" {
+		t.Errorf("Expected the idempotent request to be retried and received %+v, %v", resp, err)
+	}
+}
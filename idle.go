@@ -0,0 +1,97 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// StopReasonIdle is the reason logged when the service is stopped by the idle timeout.
+const StopReasonIdle = "idle"
+
+type idleState struct {
+	timeout   atomic.Int64
+	lastInput atomic.Int64
+	// Wakes the goroutine watching for the idle timeout when the timeout is changed
+	changed chan struct{}
+}
+
+// SetIdleTimeout makes the service stop itself once no request has been received during the
+// timeout and nothing is in flight. The requests are counted by the Run method or IncReceived.
+// The service is stopped as StopDrain does, so requests arriving as the timeout expires are
+// processed or refused, rather than dropped. A zero timeout disables the idle stop.
+func (bas *BaseService) SetIdleTimeout(d time.Duration) {
+	bas.idle.timeout.Store(int64(d))
+
+	select {
+	case bas.idle.changed <- struct{}{}:
+	default:
+	}
+}
+
+// watchIdle stops the service once it has been idle for the timeout during the run of the context.
+func (bas *BaseService) watchIdle(run context.Context) {
+	var timer Timer
+	defer func() { stopTimer(timer) }()
+
+	for {
+		var expired <-chan time.Time
+		if d := time.Duration(bas.idle.timeout.Load()); d > 0 {
+			wait := d - bas.since(bas.lastInput())
+			if wait <= 0 {
+				// Requests still in flight are checked again after another timeout
+				wait = d
+			}
+			timer = bas.resetTimer(timer, wait)
+			expired = timer.C()
+		}
+
+		select {
+		case <-run.Done():
+			return
+		case <-bas.idle.changed:
+		case <-expired:
+			if bas.idleStop(run) {
+				return
+			}
+		}
+	}
+}
+
+// idleStop stops the service when it is still running the same run and is idle.
+func (bas *BaseService) idleStop(run context.Context) bool {
+	bas.lifecycle.Lock()
+	defer bas.lifecycle.Unlock()
+
+	if bas.Context() != run {
+		return true
+	}
+	if !bas.idleFor(time.Duration(bas.idle.timeout.Load())) {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDrainTimeout)
+	defer cancel()
+
+	bas.Lock()
+	bas.stopReason = StopReasonIdle
+	bas.Unlock()
+	_ = bas.stopDrain(ctx)
+	return true
+}
+
+func (bas *BaseService) idleFor(d time.Duration) bool {
+	if d <= 0 || bas.State() != StateRunning || bas.since(bas.lastInput()) < d {
+		return false
+	}
+
+	return bas.InFlight() == 0 && bas.InputLen() == 0
+}
+
+func (bas *BaseService) lastInput() time.Time {
+	return time.Unix(0, bas.idle.lastInput.Load())
+}
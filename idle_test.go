@@ -0,0 +1,96 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newEchoService(name string, opts ...Option) *SimpleService {
+	return NewSimpleService(name, func(req interface{}) (interface{}, error) {
+		return req, nil
+	}, opts...)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	h := new(recordHandler)
+	srv := newEchoService("Idle")
+	srv.SetLogger(slog.New(h))
+	srv.SetIdleTimeout(50 * time.Millisecond)
+
+	_ = srv.Start()
+	// Requests keep the service from going idle
+	for i := 0; i < 4; i++ {
+		time.Sleep(25 * time.Millisecond)
+		srv.Input() <- i
+		<-srv.Output()
+	}
+	if s := srv.State(); s != StateRunning {
+		t.Fatalf("The service receiving requests was stopped as idle, the state is %v", s)
+	}
+
+	select {
+	case <-srv.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("The idle service was not stopped")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for srv.State() != StateStopped && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if attrs, found := h.find("service stopped"); !found || attrs["reason"].String() != StopReasonIdle {
+		t.Errorf("The idle stop was not logged with the idle reason: %v", attrs)
+	}
+}
+
+func TestIdleTimeoutDisabled(t *testing.T) {
+	srv := newEchoService("Disabled")
+	srv.SetIdleTimeout(20 * time.Millisecond)
+	srv.SetIdleTimeout(0)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	select {
+	case <-srv.Done():
+		t.Errorf("The service was stopped after the idle timeout was disabled")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestIdleTimeoutRace(t *testing.T) {
+	const timeout = 10 * time.Millisecond
+
+	for i := 0; i < 30; i++ {
+		srv := newEchoService("Race", WithOutputBuffer(1))
+		srv.SetIdleTimeout(timeout)
+		_ = srv.Start()
+
+		// Send the request as the timeout expires
+		time.Sleep(timeout - time.Duration(i%5)*time.Millisecond/2)
+		err := srv.Send(context.Background(), i)
+
+		if err != nil {
+			if !errors.Is(err, ErrServiceStopped) {
+				t.Fatalf("Send returned an unexpected error: %v", err)
+			}
+		} else {
+			select {
+			case result := <-srv.Output():
+				if result != i {
+					t.Errorf("Expected %d to be returned and received %v", i, result)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("The request sent as the idle timeout expired was dropped")
+			}
+		}
+		_ = srv.Stop()
+	}
+}
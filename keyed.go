@@ -0,0 +1,145 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultKeyCapacity is the default number of lazily created key rate limiters kept by a service.
+const DefaultKeyCapacity = 1024
+
+type keyEntry struct {
+	key    string
+	rlimit Limiter
+}
+
+// keyLimiters holds the rate limiters set for specific keys and the limiters created lazily for
+// unknown keys, which are evicted in least recently used order once the capacity is reached.
+type keyLimiters struct {
+	sync.Mutex
+	explicit map[string]Limiter
+	lazy     map[string]*list.Element
+	order    *list.List
+	persec   int
+	capacity int
+}
+
+// SetRateLimitForKey sets the number of calls permitted each second for the provided key.
+// A value of zero removes the rate limit for the key.
+func (bas *BaseService) SetRateLimitForKey(key string, persec int) {
+	rlimit := bas.newLimiter(float64(persec), 0)
+
+	kl := &bas.keyed
+	kl.Lock()
+	defer kl.Unlock()
+
+	kl.remove(key)
+	if rlimit == nil {
+		return
+	}
+	if kl.explicit == nil {
+		kl.explicit = make(map[string]Limiter)
+	}
+	kl.explicit[key] = rlimit
+}
+
+// SetDefaultKeyRateLimit sets the number of calls permitted each second for keys without a rate limit
+// of their own. The limiters for these keys are created on first use. A value of zero causes the
+// unknown keys to share the rate limit of the service.
+func (bas *BaseService) SetDefaultKeyRateLimit(persec int) {
+	kl := &bas.keyed
+	kl.Lock()
+	defer kl.Unlock()
+
+	kl.persec = persec
+	kl.lazy = nil
+	kl.order = nil
+}
+
+// SetKeyCapacity sets the maximum number of lazily created key rate limiters kept by the service.
+// The least recently used limiters are evicted once the capacity is reached.
+func (bas *BaseService) SetKeyCapacity(capacity int) {
+	kl := &bas.keyed
+	kl.Lock()
+	defer kl.Unlock()
+
+	kl.capacity = capacity
+	kl.evict()
+}
+
+// DeleteRateLimitKey removes the rate limiter for the provided key.
+func (bas *BaseService) DeleteRateLimitKey(key string) {
+	kl := &bas.keyed
+	kl.Lock()
+	defer kl.Unlock()
+
+	kl.remove(key)
+}
+
+// CheckRateLimitKey blocks until the minimum wait duration since the last call for the provided key,
+// and returns ErrServiceStopped without waiting the full duration when the service is stopped.
+func (bas *BaseService) CheckRateLimitKey(key string) error {
+	if rlimit := bas.keyLimiter(key); rlimit != nil {
+		return bas.take(rlimit)
+	}
+	return bas.CheckRateLimitErr()
+}
+
+func (bas *BaseService) keyLimiter(key string) Limiter {
+	kl := &bas.keyed
+	kl.Lock()
+	defer kl.Unlock()
+
+	if rlimit, found := kl.explicit[key]; found {
+		return rlimit
+	}
+	if kl.persec == 0 {
+		return nil
+	}
+	if kl.lazy == nil {
+		kl.lazy = make(map[string]*list.Element)
+		kl.order = list.New()
+	}
+	if e, found := kl.lazy[key]; found {
+		kl.order.MoveToFront(e)
+		return e.Value.(*keyEntry).rlimit
+	}
+
+	entry := &keyEntry{key: key, rlimit: bas.newLimiter(float64(kl.persec), 0)}
+	kl.lazy[key] = kl.order.PushFront(entry)
+	kl.evict()
+	return entry.rlimit
+}
+
+func (kl *keyLimiters) remove(key string) {
+	delete(kl.explicit, key)
+
+	if e, found := kl.lazy[key]; found {
+		kl.order.Remove(e)
+		delete(kl.lazy, key)
+	}
+}
+
+func (kl *keyLimiters) evict() {
+	capacity := kl.capacity
+	if capacity <= 0 {
+		capacity = DefaultKeyCapacity
+	}
+
+	for kl.order != nil && kl.order.Len() > capacity {
+		e := kl.order.Back()
+		kl.order.Remove(e)
+		delete(kl.lazy, e.Value.(*keyEntry).key)
+	}
+}
+
+func (kl *keyLimiters) len() int {
+	kl.Lock()
+	defer kl.Unlock()
+
+	return len(kl.explicit) + len(kl.lazy)
+}
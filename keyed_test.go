@@ -0,0 +1,96 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitForKey(t *testing.T) {
+	srv := newTestService()
+	srv.SetRateLimitForKey("slow", 5)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_ = srv.CheckRateLimitKey("slow")
+	}
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("The rate limit for the key was not enforced, three calls took %v", elapsed)
+	}
+
+	// Unknown keys share the rate limit of the service, which is not set
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		_ = srv.CheckRateLimitKey("fast")
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("The unknown key was rate limited, three calls took %v", elapsed)
+	}
+
+	srv.DeleteRateLimitKey("slow")
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		_ = srv.CheckRateLimitKey("slow")
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("The deleted key was still rate limited, three calls took %v", elapsed)
+	}
+}
+
+func TestDefaultKeyRateLimit(t *testing.T) {
+	srv := newTestService()
+	srv.SetDefaultKeyRateLimit(5)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	// Each key is paced independently, so the calls run in parallel
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+
+			for i := 0; i < 3; i++ {
+				_ = srv.CheckRateLimitKey(key)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond || elapsed > 700*time.Millisecond {
+		t.Errorf("Expected the keys to be paced independently, but the calls took %v", elapsed)
+	}
+}
+
+func TestKeyCapacity(t *testing.T) {
+	srv := newTestService()
+	srv.SetDefaultKeyRateLimit(1000)
+	srv.SetKeyCapacity(10)
+	srv.SetRateLimitForKey("explicit", 1000)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 0; i < 100; i++ {
+		_ = srv.CheckRateLimitKey(strconv.Itoa(i))
+	}
+	if l := srv.keyed.len(); l != 11 {
+		t.Errorf("Expected 10 lazy limiters and one explicit limiter, but %d limiters were kept", l)
+	}
+	if _, found := srv.keyed.explicit["explicit"]; !found {
+		t.Errorf("The limiter set explicitly for a key was evicted")
+	}
+	if _, found := srv.keyed.lazy["99"]; !found {
+		t.Errorf("The most recently used limiter was evicted")
+	}
+}
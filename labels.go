@@ -0,0 +1,34 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// The pprof labels set on the goroutines started for a service
+const (
+	LabelService = "service"
+	LabelRole    = "role"
+)
+
+// RunLabeled executes fn in a new goroutine carrying the pprof labels of the service, with the
+// role provided, so the goroutine can be told apart in the profiles of the process. The context
+// provided to fn carries the labels, and the goroutines started by fn inherit them. The goroutines
+// started by the package use roles such as "worker", "batcher" and "drain". RunLabeled is intended
+// for the goroutines started by OnStart:
+//
+//	func (srv *MyService) OnStart() error {
+//		srv.RunLabeled(srv.Context(), "poller", srv.poll)
+//		return nil
+//	}
+func (bas *BaseService) RunLabeled(ctx context.Context, role string, fn func(ctx context.Context)) {
+	goLabeled(ctx, bas.name, role, fn)
+}
+
+func goLabeled(ctx context.Context, name, role string, fn func(ctx context.Context)) {
+	go pprof.Do(ctx, pprof.Labels(LabelService, name, LabelRole, role), fn)
+}
@@ -0,0 +1,74 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunLabeled(t *testing.T) {
+	srv := NewBaseService(nil, "Labeled")
+
+	labels := make(chan map[string]string, 1)
+	srv.RunLabeled(context.Background(), "poller", func(ctx context.Context) {
+		set := make(map[string]string)
+		pprof.ForLabels(ctx, func(key, value string) bool {
+			set[key] = value
+			return true
+		})
+		labels <- set
+	})
+
+	select {
+	case set := <-labels:
+		if set[LabelService] != "Labeled" || set[LabelRole] != "poller" {
+			t.Errorf("Expected the labels of the service, received %v", set)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The function was not executed")
+	}
+}
+
+// waitLabeled waits for a goroutine carrying the labels in the goroutine profile.
+func waitLabeled(t *testing.T, name, role string) {
+	label := `"role":"` + role + `", "service":"` + name + `"`
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var buf bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(buf.String(), label) {
+			return
+		}
+	}
+	t.Errorf("Expected a goroutine labeled %s in the profile", label)
+}
+
+func TestRunLabelsWorkers(t *testing.T) {
+	srv := newEchoService("LabeledEcho")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = srv.Stop() }()
+
+	waitLabeled(t, "LabeledEcho", "worker")
+	waitLabeled(t, "LabeledEcho", "idle")
+}
+
+func TestRunBatchLabels(t *testing.T) {
+	srv := newBatchService(4, time.Second)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = srv.Stop() }()
+
+	waitLabeled(t, "Batch", "batcher")
+}
@@ -0,0 +1,77 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// lateDrain receives the messages sent on the Input channel after the service was stopped.
+type lateDrain struct {
+	sync.Mutex
+	grace atomic.Int64
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// SetLateSendGrace sets the time that the Input channel is drained after the service is stopped,
+// so the producers sending on the channel directly are not blocked once nothing processes their
+// messages. The messages received are routed to the dead letters with ErrServiceStopped, and the
+// drain ends early when the service is started again. Send returns ErrServiceStopped without
+// waiting on the channel after the service is stopped. The drain is disabled by default, and a
+// zero duration disables it again.
+func (bas *BaseService) SetLateSendGrace(d time.Duration) {
+	bas.late.grace.Store(int64(d))
+}
+
+// startLateDrain drains the Input channel of the stopped service during the grace period.
+func (bas *BaseService) startLateDrain() {
+	grace := time.Duration(bas.late.grace.Load())
+	if grace <= 0 {
+		return
+	}
+
+	l := &bas.late
+	l.Lock()
+	defer l.Unlock()
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	l.stop, l.done = stop, done
+	bas.RunLabeled(context.Background(), "drain", func(context.Context) {
+		defer close(done)
+
+		t := bas.clock.NewTimer(grace)
+		defer t.Stop()
+
+		input := bas.Input()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C():
+				return
+			case msg := <-input:
+				bas.ReportDeadLetter(msg, DeadLetterCanceled, fmt.Errorf("%s: %w", bas.name, ErrServiceStopped))
+			}
+		}
+	})
+}
+
+// stopLateDrain ends the drain, so the service can receive from the Input channel again.
+func (bas *BaseService) stopLateDrain() {
+	l := &bas.late
+	l.Lock()
+	defer l.Unlock()
+
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop, l.done = nil, nil
+	}
+}
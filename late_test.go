@@ -0,0 +1,83 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestLateSendAfterStop(t *testing.T) {
+	// The drain and the producers must be gone after the grace period
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	srv := newEchoService("Late")
+	srv.SetLateSendGrace(100 * time.Millisecond)
+	_ = srv.Start()
+	_ = srv.Stop()
+
+	if err := srv.Send(context.Background(), "send"); !errors.Is(err, ErrServiceStopped) {
+		t.Errorf("Expected ErrServiceStopped, received %v", err)
+	}
+
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			srv.Input() <- i
+			done <- struct{}{}
+		}(i)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the producers sending after the stop to be released")
+		}
+
+		dl := <-srv.DeadLetters()
+		if dl.Reason != DeadLetterCanceled || !errors.Is(dl.Err, ErrServiceStopped) {
+			t.Errorf("Expected a canceled dead letter with ErrServiceStopped, received %v: %v", dl.Reason, dl.Err)
+		}
+	}
+}
+
+func TestLateSendDisabled(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	srv := newEchoService("Late")
+	_ = srv.Start()
+	_ = srv.Stop()
+
+	// Nothing drains the Input channel by default
+	select {
+	case srv.Input() <- "late":
+		t.Errorf("The Input channel was drained without a grace period")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestLateSendRestart(t *testing.T) {
+	srv := newEchoService("Late")
+	srv.SetLateSendGrace(time.Minute)
+	_ = srv.Start()
+	_ = srv.Stop()
+
+	// The drain ends when the service is started again
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("Failed to start the service again: %v", err)
+	}
+	defer func() { _ = srv.Stop() }()
+
+	for i := 0; i < 5; i++ {
+		srv.Input() <- i
+		if result := <-srv.Output(); result != i {
+			t.Errorf("Expected %d, received %v", i, result)
+		}
+	}
+}
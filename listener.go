@@ -0,0 +1,184 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The delays between the attempts to accept a connection after a temporary failure
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// ListenerService accepts the connections of a net.Listener while the service is running, and
+// executes the handler for each connection in its own goroutine. The handler receives the service,
+// so it can report errors, read the statistics or send messages on behalf of the connection. The
+// connections are closed when the handler returns. SetMaxConcurrent bounds the number of
+// connections handled at once, and the listener stops accepting connections while the limit is
+// reached. The panics of the handler are recovered and reported on the Errors channel as a
+// *PanicError. Stop closes the listener, waits for the handlers during the drain grace period,
+// and then closes the remaining connections.
+type ListenerService struct {
+	BaseService
+	ln      net.Listener
+	handler func(net.Conn, Service)
+	grace   atomic.Int64
+	active  atomic.Int64
+	accepts sync.WaitGroup
+	handles sync.WaitGroup
+	cmu     sync.Mutex
+	conns   map[net.Conn]struct{}
+}
+
+// NewListenerService returns a ListenerService accepting the connections of the listener. The
+// listener is closed when the service is stopped, so the service cannot be restarted.
+func NewListenerService(name string, ln net.Listener, handler func(net.Conn, Service), opts ...Option) *ListenerService {
+	ls := &ListenerService{
+		ln:      ln,
+		handler: handler,
+		conns:   make(map[net.Conn]struct{}),
+	}
+
+	ls.Init(ls, name, opts...)
+	return ls
+}
+
+// Addr returns the network address of the listener.
+func (ls *ListenerService) Addr() net.Addr {
+	return ls.ln.Addr()
+}
+
+// SetDrainGrace sets the time that Stop waits for the handlers to return before the connections
+// are closed. The connections are closed right away by default.
+func (ls *ListenerService) SetDrainGrace(d time.Duration) {
+	ls.grace.Store(int64(d))
+}
+
+// ActiveConnections returns the number of connections being handled.
+func (ls *ListenerService) ActiveConnections() int {
+	return int(ls.active.Load())
+}
+
+// OnStart implements the Service interface.
+func (ls *ListenerService) OnStart() error {
+	ls.accepts.Add(1)
+	ls.RunLabeled(ls.Context(), "accept", func(context.Context) { ls.accept() })
+	ls.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (ls *ListenerService) OnStop() error {
+	err := ls.ln.Close()
+	ls.accepts.Wait()
+
+	finished := make(chan struct{})
+	go func() {
+		ls.handles.Wait()
+		close(finished)
+	}()
+
+	if grace := time.Duration(ls.grace.Load()); grace > 0 {
+		t := ls.clock.NewTimer(grace)
+		defer t.Stop()
+
+		select {
+		case <-finished:
+			return ls.closeErr(err)
+		case <-t.C():
+		}
+	}
+
+	ls.cmu.Lock()
+	for conn := range ls.conns {
+		_ = conn.Close()
+	}
+	ls.cmu.Unlock()
+
+	<-finished
+	return ls.closeErr(err)
+}
+
+func (ls *ListenerService) closeErr(err error) error {
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("%s: %w", ls, err)
+	}
+	return nil
+}
+
+func (ls *ListenerService) accept() {
+	defer ls.accepts.Done()
+
+	ctx := ls.Context()
+	var delay time.Duration
+	for {
+		if err := ls.AcquireSlot(ctx); err != nil {
+			return
+		}
+
+		conn, err := ls.ln.Accept()
+		if err != nil {
+			ls.ReleaseSlot()
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				delay = min(max(2*delay, minAcceptDelay), maxAcceptDelay)
+				ls.ReportError(fmt.Errorf("%s: %w", ls, err))
+				if !ls.sleep(ctx, delay) {
+					return
+				}
+				continue
+			}
+			ls.ReportError(fmt.Errorf("%s: %w", ls, err))
+			return
+		}
+		delay = 0
+
+		ls.track(conn)
+		ls.handles.Add(1)
+		ls.RunLabeled(ctx, "handler", func(context.Context) { ls.handle(conn) })
+	}
+}
+
+// track records the connection, so it can be closed by Stop.
+func (ls *ListenerService) track(conn net.Conn) {
+	ls.cmu.Lock()
+	defer ls.cmu.Unlock()
+
+	ls.conns[conn] = struct{}{}
+	ls.active.Add(1)
+}
+
+func (ls *ListenerService) handle(conn net.Conn) {
+	defer ls.handles.Done()
+	defer ls.ReleaseSlot()
+	defer func() {
+		ls.cmu.Lock()
+		delete(ls.conns, conn)
+		ls.cmu.Unlock()
+
+		ls.active.Add(-1)
+		_ = conn.Close()
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			ls.ReportError(fmt.Errorf("%s: %s: %w", ls, conn.RemoteAddr(), &PanicError{Value: r, Stack: debug.Stack()}))
+		}
+	}()
+
+	ls.handler(conn, ls)
+}
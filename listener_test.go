@@ -0,0 +1,183 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newListenerService(t *testing.T, handler func(net.Conn, Service), opts ...Option) *ListenerService {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ls := NewListenerService("Listener", ln, handler, opts...)
+	if err := ls.Start(); err != nil {
+		t.Fatalf("The service failed to start: %v", err)
+	}
+	return ls
+}
+
+func dialListener(t *testing.T, ls *ListenerService) net.Conn {
+	conn, err := net.Dial("tcp", ls.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// waitGoroutines waits for the number of goroutines to return to the baseline.
+func waitGoroutines(t *testing.T, baseline int) {
+	deadline := time.Now().Add(time.Second)
+
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Errorf("Expected %d goroutines, %d are running", baseline, runtime.NumGoroutine())
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestListenerService(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	ls := newListenerService(t, func(conn net.Conn, srv Service) {
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		_, _ = io.WriteString(conn, srv.String()+": "+strings.ToUpper(line))
+	})
+
+	conn := dialListener(t, ls)
+	_, _ = io.WriteString(conn, "hello\n")
+	if reply, err := io.ReadAll(conn); err != nil || string(reply) != "Listener: HELLO\n" {
+		t.Errorf("Expected the reply of the handler, received %q, %v", reply, err)
+	}
+
+	if err := ls.Stop(); err != nil {
+		t.Errorf("The service failed to stop: %v", err)
+	}
+	if _, err := net.Dial("tcp", ls.Addr().String()); err == nil {
+		t.Error("Expected the listener to be closed by Stop")
+	}
+	waitGoroutines(t, baseline)
+}
+
+func TestListenerServiceForceClose(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	started := make(chan struct{}, 2)
+	ls := newListenerService(t, func(conn net.Conn, srv Service) {
+		started <- struct{}{}
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	a := dialListener(t, ls)
+	b := dialListener(t, ls)
+	<-started
+	<-started
+	if n := ls.ActiveConnections(); n != 2 {
+		t.Errorf("Expected two active connections, received %d", n)
+	}
+
+	if err := ls.Stop(); err != nil {
+		t.Errorf("The service failed to stop: %v", err)
+	}
+	for _, conn := range []net.Conn{a, b} {
+		if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Errorf("Expected the connection to be closed by Stop, received %v", err)
+		}
+	}
+	if n := ls.ActiveConnections(); n != 0 {
+		t.Errorf("Expected no active connections after Stop, received %d", n)
+	}
+	waitGoroutines(t, baseline)
+}
+
+func TestListenerServiceDrainGrace(t *testing.T) {
+	clock := newFakeClock()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ls := newListenerService(t, func(conn net.Conn, srv Service) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(conn, "done\n")
+	}, WithClock(clock))
+	ls.SetDrainGrace(time.Minute)
+
+	conn := dialListener(t, ls)
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- ls.Stop() }()
+	// The handler finishes during the grace period, so its connection is not closed early
+	clock.waitTimers(t, 1)
+	close(release)
+
+	if reply, err := io.ReadAll(conn); err != nil || string(reply) != "done\n" {
+		t.Errorf("Expected the handler to finish during the grace period, received %q, %v", reply, err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("The service failed to stop: %v", err)
+	}
+}
+
+func TestListenerServiceMaxConcurrent(t *testing.T) {
+	handled := make(chan net.Conn, 2)
+	ls := newListenerService(t, func(conn net.Conn, srv Service) {
+		handled <- conn
+		_, _ = io.Copy(io.Discard, conn)
+	})
+	ls.SetMaxConcurrent(1)
+	defer func() { _ = ls.Stop() }()
+
+	a := dialListener(t, ls)
+	<-handled
+	_ = dialListener(t, ls)
+
+	select {
+	case <-handled:
+		t.Fatal("The second connection was handled while the limit was reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The second connection is handled once the first handler returns
+	_ = a.Close()
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The second connection was not handled after the first was closed")
+	}
+}
+
+func TestListenerServicePanic(t *testing.T) {
+	ls := newListenerService(t, func(conn net.Conn, srv Service) {
+		panic("broken handler")
+	})
+	defer func() { _ = ls.Stop() }()
+
+	conn := dialListener(t, ls)
+	var perr *PanicError
+	if err := <-ls.Errors(); !errors.As(err, &perr) || perr.Value != "broken handler" {
+		t.Errorf("Expected the panic to be reported, received %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected the connection to be closed after the panic, received %v", err)
+	}
+
+	// The service keeps accepting connections
+	_ = dialListener(t, ls)
+	if err := <-ls.Errors(); !errors.As(err, &perr) {
+		t.Errorf("Expected the second connection to be handled, received %v", err)
+	}
+}
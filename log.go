@@ -0,0 +1,48 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SetLogger sets the logger used to record the lifecycle events of the service, the changes to the
+// rate limit, and the panics recovered by the Run method. A nil logger disables the logging.
+func (bas *BaseService) SetLogger(l *slog.Logger) {
+	bas.Lock()
+	defer bas.Unlock()
+
+	bas.logger = l
+}
+
+// Logger returns the logger set by SetLogger, or nil when the service is not logging.
+func (bas *BaseService) Logger() *slog.Logger {
+	bas.Lock()
+	defer bas.Unlock()
+
+	return bas.logger
+}
+
+// log records the message with the service name and state, and the error when it is not nil.
+func (bas *BaseService) log(level slog.Level, msg string, err error, attrs ...slog.Attr) {
+	bas.Lock()
+	l := bas.logger
+	bas.Unlock()
+	state := bas.State()
+
+	if l == nil {
+		return
+	}
+
+	attrs = append([]slog.Attr{
+		slog.String("service", bas.name),
+		slog.String("state", state.String()),
+	}, attrs...)
+	if err != nil {
+		attrs = append(attrs, slog.Any("err", err))
+	}
+	l.LogAttrs(context.Background(), level, msg, attrs...)
+}
@@ -0,0 +1,140 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordHandler is a slog.Handler that keeps the records it receives.
+type recordHandler struct {
+	sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recordHandler) WithGroup(string) slog.Handler { return h }
+
+// find returns the attributes of the first record with the message.
+func (h *recordHandler) find(msg string) (map[string]slog.Value, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, r := range h.records {
+		if r.Message != msg {
+			continue
+		}
+
+		attrs := make(map[string]slog.Value)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		return attrs, true
+	}
+	return nil, false
+}
+
+func TestLogger(t *testing.T) {
+	h := new(recordHandler)
+	srv := newTestService()
+	srv.SetLogger(slog.New(h))
+
+	_ = srv.Start()
+	srv.SetRateLimit(5)
+	_ = srv.Stop()
+
+	for msg, state := range map[string]State{
+		"service started":    StateRunning,
+		"service stopped":    StateStopped,
+		"rate limit changed": StateRunning,
+	} {
+		attrs, found := h.find(msg)
+		if !found {
+			t.Errorf("The %q record was not logged", msg)
+			continue
+		}
+		if attrs["service"].String() != srv.String() {
+			t.Errorf("The %q record has the service attribute %v", msg, attrs["service"])
+		}
+		if attrs["state"].String() != state.String() {
+			t.Errorf("The %q record has the state attribute %v", msg, attrs["state"])
+		}
+	}
+	if attrs, _ := h.find("rate limit changed"); attrs["rate"].Float64() != 5 {
+		t.Errorf("The rate limit change was logged with the rate %v", attrs["rate"])
+	}
+}
+
+func TestLoggerStartFailure(t *testing.T) {
+	h := new(recordHandler)
+	srv := new(failingService)
+	srv.Init(srv, "Failing")
+	srv.SetLogger(slog.New(h))
+
+	_ = srv.Start()
+	attrs, found := h.find("service failed to start")
+	if !found {
+		t.Fatalf("The start failure was not logged")
+	}
+	if err, ok := attrs["err"].Any().(error); !ok || !errors.Is(err, errStartFailed) {
+		t.Errorf("The start failure was logged with the err attribute %v", attrs["err"])
+	}
+	if attrs["state"].String() != StateFailed.String() {
+		t.Errorf("The start failure was logged with the state %v", attrs["state"])
+	}
+}
+
+func TestLoggerPanic(t *testing.T) {
+	h := new(recordHandler)
+	srv := NewSimpleService("Panic", func(req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	srv.SetLogger(slog.New(h))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+	srv.Input() <- "request"
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if attrs, found := h.find("handler panic recovered"); found {
+			var perr *PanicError
+			if err, ok := attrs["err"].Any().(error); !ok || !errors.As(err, &perr) {
+				t.Errorf("The panic was logged with the err attribute %v", attrs["err"])
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("The recovered panic was not logged")
+}
+
+func TestLoggerNil(t *testing.T) {
+	srv := newTestService()
+
+	if srv.Logger() != nil {
+		t.Errorf("A new service has a logger")
+	}
+	// Logging without a logger must be silent
+	_ = srv.Start()
+	_ = srv.Stop()
+}
@@ -0,0 +1,320 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The number of events buffered for each client of the events endpoint. The events that do not
+// fit are dropped, so a slow client cannot block the state transitions of the services.
+const managementEventBuffer = 64
+
+// ServiceStatus describes a registered service in the responses of the management handler.
+type ServiceStatus struct {
+	Name  string   `json:"name"`
+	State State    `json:"state"`
+	Tags  []string `json:"tags,omitempty"`
+	// The statistics of the services that provide them, such as those embedding BaseService
+	Stats *Stats `json:"stats,omitempty"`
+}
+
+// StateEvent is a transition of a registered service, sent by the events endpoint of the
+// management handler.
+type StateEvent struct {
+	Time    time.Time `json:"time"`
+	Service string    `json:"service"`
+	From    State     `json:"from"`
+	To      State     `json:"to"`
+}
+
+// The services that provide their statistics, such as those embedding BaseService
+type statser interface {
+	Stats() Stats
+}
+
+type stateWatcher interface {
+	OnStateChange(fn func(srv Service, old, new State))
+}
+
+type auditor interface {
+	DumpAudit() []AuditEntry
+}
+
+type pauseResumer interface {
+	Pause() error
+	Resume() error
+}
+
+type managementHandler struct {
+	reg  *Registry
+	mu   sync.Mutex
+	subs map[chan StateEvent]struct{}
+}
+
+// NewManagementHandler returns an http.Handler for inspecting and controlling the services of the
+// registry, with the following JSON endpoints:
+//
+//	GET  /services                  the ServiceStatus of each service
+//	GET  /services/{name}           the ServiceStatus of the service
+//	GET  /services/{name}/audit     the entries kept by the audit buffer of the service
+//	POST /services/{name}/{action}  start, stop, restart, pause, resume or set-rate-limit
+//	GET  /events                    the StateEvent of each transition, as JSON lines
+//
+// The set-rate-limit action reads the rate from a body such as {"rate": 10}. The actions respond
+// with the ServiceStatus of the service, and with 409 Conflict when the state of the service does
+// not permit the action, using the message of the lifecycle error. The handler does not perform
+// authentication, so it should be wrapped by a handler that does when it is exposed.
+func NewManagementHandler(reg *Registry) http.Handler {
+	m := &managementHandler{
+		reg:  reg,
+		subs: make(map[chan StateEvent]struct{}),
+	}
+
+	reg.addRegisterHook(m.watch)
+	return m
+}
+
+// watch publishes the transitions of the service while it is registered.
+func (m *managementHandler) watch(srv Service) {
+	sw, ok := srv.(stateWatcher)
+	if !ok {
+		return
+	}
+
+	name := srv.String()
+	sw.OnStateChange(func(s Service, old, new State) {
+		if cur, found := m.reg.Lookup(name); !found || cur != srv {
+			return
+		}
+		m.publish(StateEvent{
+			Time:    time.Now(),
+			Service: name,
+			From:    old,
+			To:      new,
+		})
+	})
+}
+
+func (m *managementHandler) publish(e StateEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for ch := range m.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (m *managementHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+
+	switch {
+	case path == "services":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		statuses := []ServiceStatus{}
+		for _, srv := range m.reg.List() {
+			statuses = append(statuses, m.status(srv))
+		}
+		writeJSON(w, http.StatusOK, statuses)
+	case strings.HasPrefix(path, "services/"):
+		m.serveService(w, r, strings.TrimPrefix(path, "services/"))
+	case path == "events":
+		if allowMethod(w, r, http.MethodGet) {
+			m.serveEvents(w, r)
+		}
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (m *managementHandler) serveService(w http.ResponseWriter, r *http.Request, rest string) {
+	if r.Method == http.MethodGet {
+		srv, found := m.reg.Lookup(rest)
+		if name, ok := strings.CutSuffix(rest, "/audit"); !found && ok {
+			m.serveAudit(w, name)
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, fmt.Errorf("%s: service is not registered", rest))
+			return
+		}
+		writeJSON(w, http.StatusOK, m.status(srv))
+		return
+	}
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	i := strings.LastIndexByte(rest, '/')
+	if i < 0 {
+		writeError(w, http.StatusNotFound, errors.New("no action was provided"))
+		return
+	}
+	name, action := rest[:i], rest[i+1:]
+
+	srv, found := m.reg.Lookup(name)
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s: service is not registered", name))
+		return
+	}
+
+	var err error
+	switch action {
+	case "start":
+		err = srv.Start()
+	case "stop":
+		err = srv.Stop()
+	case "restart":
+		rs, ok := srv.(restarter)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, fmt.Errorf("%s: restart is not supported", name))
+			return
+		}
+		err = rs.Restart()
+	case "pause", "resume":
+		pr, ok := srv.(pauseResumer)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, fmt.Errorf("%s: %s is not supported", name, action))
+			return
+		}
+		if action == "pause" {
+			err = pr.Pause()
+		} else {
+			err = pr.Resume()
+		}
+	case "set-rate-limit":
+		var body struct {
+			Rate *int `json:"rate"`
+		}
+		if derr := json.NewDecoder(r.Body).Decode(&body); derr != nil || body.Rate == nil || *body.Rate < 0 {
+			writeError(w, http.StatusBadRequest, errors.New(`the body must provide a rate such as {"rate": 10}`))
+			return
+		}
+		srv.SetRateLimit(*body.Rate)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s: unknown action %q", name, action))
+		return
+	}
+
+	if err != nil {
+		writeError(w, lifecycleStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m.status(srv))
+}
+
+// serveAudit responds with the entries kept by the audit buffer of the service.
+func (m *managementHandler) serveAudit(w http.ResponseWriter, name string) {
+	srv, found := m.reg.Lookup(name)
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s: service is not registered", name))
+		return
+	}
+
+	a, ok := srv.(auditor)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("%s: audit is not supported", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, a.DumpAudit())
+}
+
+// serveEvents streams the transitions of the services until the client goes away.
+func (m *managementHandler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	events := make(chan StateEvent, managementEventBuffer)
+
+	m.mu.Lock()
+	m.subs[events] = struct{}{}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.subs, events)
+		m.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events:
+			if err := enc.Encode(&e); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func (m *managementHandler) status(srv Service) ServiceStatus {
+	s := ServiceStatus{
+		Name:  srv.String(),
+		State: StateRunning,
+		Tags:  m.reg.Tags(srv.String()),
+	}
+
+	if st, ok := srv.(stater); ok {
+		s.State = st.State()
+	} else if !serviceRunning(srv) {
+		s.State = StateStopped
+	}
+	if ss, ok := srv.(statser); ok {
+		stats := ss.Stats()
+		s.Stats = &stats
+	}
+	return s
+}
+
+// lifecycleStatus returns the status code of the response for an error returned by an action.
+func lifecycleStatus(err error) int {
+	for _, target := range []error{ErrAlreadyStarted, ErrAlreadyStopped, ErrNotStarted,
+		ErrNotRunning, ErrNotPaused, ErrPaused} {
+		if errors.Is(err, target) {
+			return http.StatusConflict
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
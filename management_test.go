@@ -0,0 +1,163 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func manage(t *testing.T, h http.Handler, method, path, body string) (*httptest.ResponseRecorder, ServiceStatus) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+	var status ServiceStatus
+	if rec.Code == http.StatusOK {
+		_ = json.Unmarshal(rec.Body.Bytes(), &status)
+	}
+	return rec, status
+}
+
+func TestManagementHandler(t *testing.T) {
+	reg := NewRegistry()
+	a, b := newEchoService("A"), newEchoService("B")
+	_ = reg.Register(a, WithTags("scanner"))
+	_ = reg.Register(b)
+	h := NewManagementHandler(reg)
+
+	rec, _ := manage(t, h, http.MethodGet, "/services", "")
+	var list []ServiceStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 2 {
+		t.Fatalf("Expected the status of both services, received %s", rec.Body.String())
+	}
+	if list[0].Name != "A" || list[0].State != StateNew || list[0].Tags[0] != "scanner" || list[0].Stats == nil {
+		t.Errorf("Expected the status of A, received %+v", list[0])
+	}
+
+	if _, s := manage(t, h, http.MethodPost, "/services/A/start", ""); s.State != StateRunning {
+		t.Errorf("Expected A to be running, received %+v", s)
+	}
+	defer func() { _ = a.Stop() }()
+	if rec, _ := manage(t, h, http.MethodPost, "/services/A/start", ""); rec.Code != http.StatusConflict ||
+		!strings.Contains(rec.Body.String(), ErrAlreadyStarted.Error()) {
+		t.Errorf("Expected 409 with the lifecycle error, received %d %s", rec.Code, rec.Body.String())
+	}
+
+	if _, s := manage(t, h, http.MethodPost, "/services/A/pause", ""); s.State != StatePaused {
+		t.Errorf("Expected A to be paused, received %+v", s)
+	}
+	if _, s := manage(t, h, http.MethodPost, "/services/A/resume", ""); s.State != StateRunning {
+		t.Errorf("Expected A to be resumed, received %+v", s)
+	}
+	if rec, _ := manage(t, h, http.MethodPost, "/services/B/resume", ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when resuming a service that is not paused, received %d", rec.Code)
+	}
+
+	if rec, _ := manage(t, h, http.MethodPost, "/services/A/set-rate-limit", `{"rate": 5}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected the rate limit to be set, received %d %s", rec.Code, rec.Body.String())
+	}
+	if rec, _ := manage(t, h, http.MethodPost, "/services/A/set-rate-limit", `{"rate": -1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative rate, received %d", rec.Code)
+	}
+
+	for _, c := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/services/A", http.StatusOK},
+		{http.MethodGet, "/services/C", http.StatusNotFound},
+		{http.MethodPost, "/services/A/explode", http.StatusNotFound},
+		{http.MethodPost, "/services", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/other", http.StatusNotFound},
+	} {
+		if rec, _ := manage(t, h, c.method, c.path, ""); rec.Code != c.code {
+			t.Errorf("Expected %d for %s %s, received %d", c.code, c.method, c.path, rec.Code)
+		}
+	}
+}
+
+func TestManagementHandlerAudit(t *testing.T) {
+	reg := NewRegistry()
+	srv := newEchoService("Audited")
+	srv.SetAuditBuffer(10)
+	_ = reg.Register(srv)
+	h := NewManagementHandler(reg)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+	srv.Input() <- "request"
+	<-srv.Output()
+
+	rec, _ := manage(t, h, http.MethodGet, "/services/Audited/audit", "")
+	var entries []AuditEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0].Input != "request" {
+		t.Errorf("Expected the audit entry of the request, received %d %s", rec.Code, rec.Body.String())
+	}
+	if rec, _ := manage(t, h, http.MethodGet, "/services/Missing/audit", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a service that is not registered, received %d", rec.Code)
+	}
+}
+
+func TestManagementHandlerEvents(t *testing.T) {
+	reg := NewRegistry()
+	h := NewManagementHandler(reg)
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("The request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The services registered after the handler was created are watched
+	srv := newEchoService("Echo")
+	_ = reg.Register(srv)
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	lines := bufio.NewScanner(resp.Body)
+	for _, want := range []State{StateStarting, StateRunning} {
+		if !lines.Scan() {
+			t.Fatalf("The stream ended: %v", lines.Err())
+		}
+
+		var e StateEvent
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil || e.Service != "Echo" || e.To != want {
+			t.Errorf("Expected the transition to %v, received %s", want, lines.Bytes())
+		}
+	}
+}
+
+func TestManagementHandlerConcurrentRegistry(t *testing.T) {
+	reg := NewRegistry()
+	h := NewManagementHandler(reg)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			name := fmt.Sprintf("S%d", i)
+			_ = reg.Register(newEchoService(name))
+			reg.Deregister(name)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if rec, _ := manage(t, h, http.MethodGet, "/services", ""); rec.Code != http.StatusOK {
+				t.Errorf("Expected the list of services, received %d", rec.Code)
+			}
+		}
+	}()
+	wg.Wait()
+}
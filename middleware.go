@@ -0,0 +1,86 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import "sync"
+
+// Middleware wraps a Handler to add behavior around the processing of each request, such as
+// logging, validation or authorization. The handler is skipped when the middleware returns
+// without calling next.
+type Middleware func(next Handler) Handler
+
+type middlewareChain struct {
+	sync.Mutex
+	own []Middleware
+	// The middleware of the groups and registries containing the service, in the order they were inherited
+	inherited []inheritedMiddleware
+}
+
+type inheritedMiddleware struct {
+	owner interface{}
+	mw    []Middleware
+}
+
+// The services that apply the middleware of the groups containing them, such as those embedding BaseService
+type middlewareInheritor interface {
+	inheritMiddleware(owner interface{}, mw []Middleware)
+}
+
+// Use adds middleware around the handler executed by the Run method for each request. The
+// middleware are applied in the order they were added, so the first is the outermost, and the
+// middleware set on the groups and registries containing the service are applied outside of them.
+func (bas *BaseService) Use(mw ...Middleware) {
+	c := &bas.middleware
+	c.Lock()
+	defer c.Unlock()
+
+	c.own = append(c.own, mw...)
+}
+
+// inheritMiddleware replaces the middleware inherited from the owner, and removes them when none is provided.
+func (bas *BaseService) inheritMiddleware(owner interface{}, mw []Middleware) {
+	c := &bas.middleware
+	c.Lock()
+	defer c.Unlock()
+
+	for i, in := range c.inherited {
+		if in.owner != owner {
+			continue
+		}
+		if len(mw) == 0 {
+			c.inherited = append(c.inherited[:i], c.inherited[i+1:]...)
+		} else {
+			c.inherited[i].mw = mw
+		}
+		return
+	}
+	if len(mw) > 0 {
+		c.inherited = append(c.inherited, inheritedMiddleware{owner: owner, mw: mw})
+	}
+}
+
+// intercept returns the handler wrapped by the middleware, with the outermost applied last.
+func (bas *BaseService) intercept(handler Handler) Handler {
+	c := &bas.middleware
+	c.Lock()
+	defer c.Unlock()
+
+	for i := len(c.own) - 1; i >= 0; i-- {
+		handler = c.own[i](handler)
+	}
+	for i := len(c.inherited) - 1; i >= 0; i-- {
+		mw := c.inherited[i].mw
+		for j := len(mw) - 1; j >= 0; j-- {
+			handler = mw[j](handler)
+		}
+	}
+	return handler
+}
+
+func inheritMiddleware(srv Service, owner interface{}, mw []Middleware) {
+	if mi, ok := srv.(middlewareInheritor); ok {
+		mi.inheritMiddleware(owner, mw)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// callLog records the order the middleware and the handler were executed in.
+type callLog struct {
+	sync.Mutex
+	calls []string
+}
+
+func (l *callLog) add(call string) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.calls = append(l.calls, call)
+}
+
+func (l *callLog) get() []string {
+	l.Lock()
+	defer l.Unlock()
+
+	return append([]string(nil), l.calls...)
+}
+
+func (l *callLog) middleware(name string) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			l.add(name + " before")
+			defer l.add(name + " after")
+
+			return next(ctx, req)
+		}
+	}
+}
+
+func newLoggedService(name string, l *callLog) *SimpleService {
+	return NewSimpleService(name, func(req interface{}) (interface{}, error) {
+		l.add("handler")
+		return req, nil
+	})
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	l := new(callLog)
+	srv := newLoggedService("Middleware", l)
+	srv.Use(l.middleware("first"), l.middleware("second"))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if _, err := srv.Request(context.Background(), "req"); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	expected := []string{"first before", "second before", "handler", "second after", "first after"}
+	if calls := l.get(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the calls %v and received %v", expected, calls)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	l := new(callLog)
+	denied := errors.New("denied")
+	srv := newLoggedService("Middleware", l)
+	srv.Use(func(next Handler) Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if req == "forbidden" {
+				return nil, denied
+			}
+			return next(ctx, req)
+		}
+	})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if _, err := srv.Request(context.Background(), "forbidden"); !errors.Is(err, denied) {
+		t.Errorf("Expected the middleware error and received %v", err)
+	}
+	if calls := l.get(); len(calls) != 0 {
+		t.Errorf("Expected the handler to be skipped and received the calls %v", calls)
+	}
+	if result, err := srv.Request(context.Background(), "allowed"); err != nil || result != "allowed" {
+		t.Errorf("Expected the allowed request to be handled, received %v: %v", result, err)
+	}
+}
+
+func TestGroupMiddleware(t *testing.T) {
+	l := new(callLog)
+	srv := newLoggedService("Member", l)
+	srv.Use(l.middleware("service"))
+
+	g := NewGroup()
+	g.Use(l.middleware("group"))
+	g.Add(srv)
+	r := NewRegistry()
+	_ = r.Register(srv)
+	r.Use(l.middleware("registry"))
+
+	_ = g.StartAll()
+	defer func() { _ = g.StopAll() }()
+
+	_, _ = srv.Request(context.Background(), "req")
+	expected := []string{"group before", "registry before", "service before", "handler",
+		"service after", "registry after", "group after"}
+	if calls := l.get(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the calls %v and received %v", expected, calls)
+	}
+
+	l.calls = nil
+	r.Deregister(srv.String())
+	_, _ = srv.Request(context.Background(), "req")
+	expected = []string{"group before", "service before", "handler", "service after", "group after"}
+	if calls := l.get(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the registry middleware to be removed, received the calls %v", calls)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// The default settings of a Mirror.
+const (
+	// The number of comparisons waiting on the replies of the shadow
+	DefaultMirrorQueue = 64
+	// The number of mismatches buffered for the Mismatches channel
+	DefaultMismatchBuffer = 16
+	// The time permitted for the shadow to reply before the comparison is abandoned
+	DefaultShadowTimeout = 5 * time.Second
+)
+
+// Mismatch is a request for which the shadow of a Mirror did not respond like the primary.
+type Mismatch struct {
+	Input      interface{}
+	Primary    interface{}
+	PrimaryErr error
+	Shadow     interface{}
+	ShadowErr  error
+	Time       time.Time
+}
+
+// A comparison waiting on the reply of the shadow
+type shadowCall struct {
+	in      interface{}
+	msg     *Message
+	primary interface{}
+	err     error
+}
+
+// Mirror is a service that forwards each request on its Input channel to a primary and a shadow
+// service, and sends only the results of the primary on its Output channel. The results of the
+// shadow are compared with those of the primary, and the differences are counted in the Stats and
+// sent on the Mismatches channel. The shadow is best-effort: a request is not mirrored when the
+// shadow cannot accept it without blocking, and the comparisons are abandoned when the shadow is
+// slow, so the primary is never delayed by the shadow. The primary and the shadow must reply to
+// the messages sent by Request, as the services using Run do, and are started and stopped by their
+// owners.
+type Mirror struct {
+	BaseService
+	primary    Service
+	shadow     Service
+	compare    func(a, b interface{}) bool
+	calls      chan *shadowCall
+	mismatches chan Mismatch
+	timeout    time.Duration
+	wg         sync.WaitGroup
+}
+
+// NewMirror returns a Mirror of the primary and the shadow services. The compare function reports
+// whether the results of the primary and the shadow are equivalent, and reflect.DeepEqual is used
+// when it is nil.
+func NewMirror(primary, shadow Service, compare func(a, b interface{}) bool, opts ...Option) *Mirror {
+	if compare == nil {
+		compare = reflect.DeepEqual
+	}
+
+	m := &Mirror{
+		primary:    primary,
+		shadow:     shadow,
+		compare:    compare,
+		calls:      make(chan *shadowCall, DefaultMirrorQueue),
+		mismatches: make(chan Mismatch, DefaultMismatchBuffer),
+		timeout:    DefaultShadowTimeout,
+	}
+
+	m.Init(m, primary.String()+" mirror", opts...)
+	return m
+}
+
+// SetShadowTimeout sets the time permitted for the shadow to reply before the comparison is
+// abandoned. It must be called before the Mirror is started.
+func (m *Mirror) SetShadowTimeout(d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.timeout = d
+}
+
+// Mismatches returns the channel receiving the requests for which the shadow did not respond like
+// the primary. The mismatches are discarded when the channel is full, but are still counted.
+func (m *Mirror) Mismatches() <-chan Mismatch {
+	return m.mismatches
+}
+
+// OnStart implements the Service interface.
+func (m *Mirror) OnStart() error {
+	m.Lock()
+	timeout := m.timeout
+	m.Unlock()
+
+	ctx := m.Context()
+	m.wg.Add(1)
+	go m.compareResults(ctx, timeout)
+	return m.RunContext(m.forward)
+}
+
+// OnStop implements the Service interface.
+func (m *Mirror) OnStop() error {
+	m.wg.Wait()
+	return nil
+}
+
+// forward sends the request to the shadow without blocking, and returns the result of the primary.
+func (m *Mirror) forward(ctx context.Context, req interface{}) (interface{}, error) {
+	in := Unwrap(req)
+	msg := NewMessage(in)
+	msg.reply = make(chan response, 1)
+
+	mirrored := trySendTo(m.shadow, msg)
+	result, err := request(ctx, m.primary, in)
+	if mirrored {
+		select {
+		case m.calls <- &shadowCall{in: in, msg: msg, primary: result, err: err}:
+		default:
+			// The shadow is too slow to be compared with every request
+		}
+	}
+	return result, err
+}
+
+// trySendTo delivers the message only when it can be done without blocking.
+func trySendTo(srv Service, msg interface{}) bool {
+	if s, ok := srv.(interface{ TrySend(msg interface{}) bool }); ok {
+		return s.TrySend(msg)
+	}
+
+	select {
+	case srv.Input() <- msg:
+		return true
+	default:
+	}
+	return false
+}
+
+// compareResults waits on the replies of the shadow and reports those differing from the primary.
+func (m *Mirror) compareResults(ctx context.Context, timeout time.Duration) {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case call := <-m.calls:
+			if !m.compareCall(ctx, call, timeout) {
+				return
+			}
+		}
+	}
+}
+
+// compareCall waits on the reply of the shadow for the call, and returns false when the Mirror stopped.
+func (m *Mirror) compareCall(ctx context.Context, call *shadowCall, timeout time.Duration) bool {
+	t := m.clock.NewTimer(timeout)
+	defer t.Stop()
+
+	var resp response
+	select {
+	case resp = <-call.msg.reply:
+	case <-t.C():
+		return true
+	case <-m.shadow.Done():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+
+	same := (call.err == nil) == (resp.err == nil)
+	if same && call.err == nil {
+		same = m.compare(call.primary, resp.payload)
+	}
+	if same {
+		return true
+	}
+
+	m.stats.mismatches.Add(1)
+	mm := Mismatch{
+		Input:      call.in,
+		Primary:    call.primary,
+		PrimaryErr: call.err,
+		Shadow:     resp.payload,
+		ShadowErr:  resp.err,
+		Time:       m.clock.Now(),
+	}
+	select {
+	case m.mismatches <- mm:
+	default:
+	}
+	return true
+}
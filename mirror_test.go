@@ -0,0 +1,79 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirrorDivergence(t *testing.T) {
+	primary := newEchoService("Primary")
+	// The rewrite is slow, and diverges on the requests containing an x
+	shadow := NewSimpleService("Shadow", func(req interface{}) (interface{}, error) {
+		time.Sleep(100 * time.Millisecond)
+		return strings.ReplaceAll(req.(string), "x", "y"), nil
+	}, WithInputBuffer(10))
+
+	m := NewMirror(primary, shadow, nil)
+	for _, srv := range []Service{primary, shadow, m} {
+		_ = srv.Start()
+		defer func(srv Service) { _ = srv.Stop() }(srv)
+	}
+
+	inputs := []string{"a", "x", "b"}
+	for _, in := range inputs {
+		m.Input() <- in
+
+		select {
+		case out := <-m.Output():
+			if out != in {
+				t.Errorf("Expected the result of the primary %q, received %v", in, out)
+			}
+		case <-time.After(50 * time.Millisecond):
+			t.Fatalf("The result of the primary was delayed by the shadow")
+		}
+	}
+
+	select {
+	case mm := <-m.Mismatches():
+		if mm.Input != "x" || mm.Primary != "x" || mm.Shadow != "y" {
+			t.Errorf("Expected the mismatch of the x request, received %+v", mm)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("The divergence of the shadow was not reported")
+	}
+
+	// The last request is compared once the shadow has replied
+	time.Sleep(250 * time.Millisecond)
+	if n := m.Stats().Mismatches; n != 1 {
+		t.Errorf("Expected 1 mismatch to be counted, received %d", n)
+	}
+}
+
+func TestMirrorShadowStopped(t *testing.T) {
+	primary := newEchoService("Primary")
+	shadow := newEchoService("Shadow")
+
+	m := NewMirror(primary, shadow, nil)
+	_ = primary.Start()
+	defer func() { _ = primary.Stop() }()
+	_ = m.Start()
+	defer func() { _ = m.Stop() }()
+
+	m.Input() <- "data"
+	select {
+	case out := <-m.Output():
+		if out != "data" {
+			t.Errorf("Expected the result of the primary, received %v", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The primary was affected by the stopped shadow")
+	}
+	if n := m.Stats().Mismatches; n != 0 {
+		t.Errorf("Expected no mismatch without the shadow, received %d", n)
+	}
+}
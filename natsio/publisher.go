@@ -0,0 +1,64 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package natsio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/caffix/service"
+	"github.com/nats-io/nats.go"
+)
+
+// PublisherService publishes each request on its Input channel to a NATS subject, encoded using the
+// codec. The requests that cannot be encoded or published are routed to the dead letters by the Run
+// method. While the connection is reconnecting, the messages are buffered by the connection. The
+// connection is flushed when the service stops, and StopDrain publishes the queued requests first.
+type PublisherService struct {
+	service.BaseService
+	conn    *nats.Conn
+	subject string
+	codec   service.Codec
+}
+
+// NewPublisherService returns a PublisherService publishing to the subject.
+func NewPublisherService(name string, conn *nats.Conn, subject string, codec service.Codec, opts ...service.Option) *PublisherService {
+	p := &PublisherService{
+		conn:    conn,
+		subject: subject,
+		codec:   codec,
+	}
+
+	p.Init(p, name, opts...)
+	return p
+}
+
+// OnStart implements the Service interface.
+func (p *PublisherService) OnStart() error {
+	if p.conn.IsClosed() {
+		return fmt.Errorf("%s: %w", p, nats.ErrConnectionClosed)
+	}
+	return p.RunContext(p.publish)
+}
+
+// OnStop implements the Service interface.
+func (p *PublisherService) OnStop() error {
+	if err := p.conn.FlushTimeout(DefaultFlushTimeout); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	return nil
+}
+
+func (p *PublisherService) publish(_ context.Context, req interface{}) (interface{}, error) {
+	data, err := p.codec.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	if err := p.conn.Publish(p.subject, data); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return nil, nil
+}
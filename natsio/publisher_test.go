@@ -0,0 +1,57 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package natsio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/caffix/service"
+)
+
+func TestPublisherService(t *testing.T) {
+	conn := runServer(t)
+
+	sub, err := conn.SubscribeSync("results")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	pub := NewPublisherService("Publisher", conn, "results", service.JSONCodec[int](), service.WithInputBuffer(10))
+	if err := pub.Start(); err != nil {
+		t.Fatalf("Failed to start the publisher: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		_ = pub.Send(context.Background(), i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pub.StopDrain(ctx); err != nil {
+		t.Fatalf("Failed to drain the publisher: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		m, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("Expected the published message %d, received %v", i, err)
+		}
+		if string(m.Data) != string(rune('0'+i)) {
+			t.Errorf("Expected the data %d, received %q", i, m.Data)
+		}
+	}
+}
+
+func TestPublisherConnectionClosed(t *testing.T) {
+	conn := runServer(t)
+	conn.Close()
+
+	pub := NewPublisherService("Publisher", conn, "results", service.JSONCodec[int]())
+	if err := pub.Start(); err == nil {
+		t.Errorf("Expected the publisher to fail to start on a closed connection")
+		_ = pub.Stop()
+	}
+}
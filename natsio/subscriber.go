@@ -0,0 +1,236 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package natsio bridges services across processes using the subjects and JetStream consumers of
+// a NATS server.
+package natsio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/caffix/service"
+	"github.com/nats-io/nats.go"
+)
+
+// The default settings of the services bridging NATS.
+const (
+	// The time permitted for the connection to be flushed when a PublisherService stops
+	DefaultFlushTimeout = 5 * time.Second
+	// The time waited before fetching again after a JetStream fetch failed
+	DefaultFetchRetry = time.Second
+)
+
+// SubscriberService sends the payload of each message received on a NATS subject on its Output
+// channel, decoded using the codec. The messages that cannot be decoded are routed to the dead
+// letters. The subscription is maintained by the connection across reconnects, and the service
+// stops itself when the connection is closed, with the error returned by Err. Core NATS delivers each message at most once, so the
+// messages still pending in the subscription when the service stops are discarded.
+//
+// When created by NewJetStreamSubscriberService, the messages are fetched from a JetStream consumer
+// one at a time, and acknowledged once their payload was sent on the Output channel, which is not
+// buffered unless WithOutputBuffer is provided, so a consumer received the payload. The messages
+// that cannot be decoded are terminated, so the server does not deliver them again, and the message
+// fetched while the service stops is negatively acknowledged, so the server requeues it.
+type SubscriberService struct {
+	service.BaseService
+	conn    *nats.Conn
+	subject string
+	codec   service.Codec
+	// The JetStream consumer, when the service was created by NewJetStreamSubscriberService
+	stream   string
+	consumer string
+	sub      *nats.Subscription
+	wg       sync.WaitGroup
+}
+
+// NewSubscriberService returns a SubscriberService receiving the messages published on the subject.
+func NewSubscriberService(name string, conn *nats.Conn, subject string, codec service.Codec, opts ...service.Option) *SubscriberService {
+	s := &SubscriberService{
+		conn:    conn,
+		subject: subject,
+		codec:   codec,
+	}
+
+	s.Init(s, name, opts...)
+	return s
+}
+
+// NewJetStreamSubscriberService returns a SubscriberService fetching the messages of the durable pull
+// consumer of the stream. The consumer is created and configured by its owner, so its acknowledgment
+// wait and maximum deliveries apply, and it is not deleted when the service stops.
+func NewJetStreamSubscriberService(name string, conn *nats.Conn, stream, consumer string, codec service.Codec, opts ...service.Option) *SubscriberService {
+	s := &SubscriberService{
+		conn:     conn,
+		codec:    codec,
+		stream:   stream,
+		consumer: consumer,
+	}
+
+	// The payloads buffered on the Output channel are discarded when the service stops
+	opts = append([]service.Option{service.WithOutputBuffer(0)}, opts...)
+	s.Init(s, name, opts...)
+	return s
+}
+
+// OnStart implements the Service interface.
+func (s *SubscriberService) OnStart() error {
+	sub, err := s.subscribe()
+	if err != nil {
+		return fmt.Errorf("%s: %w", s, err)
+	}
+	s.sub = sub
+
+	ctx := s.Context()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		if s.consumer != "" {
+			s.fetch(ctx, sub)
+		} else {
+			s.receive(ctx, sub)
+		}
+	}()
+	s.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (s *SubscriberService) OnStop() error {
+	s.wg.Wait()
+	if s.sub == nil {
+		return nil
+	}
+
+	// Unsubscribing does not delete a consumer bound by the subscription
+	if err := s.sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) &&
+		!errors.Is(err, nats.ErrBadSubscription) {
+		return fmt.Errorf("%s: %w", s, err)
+	}
+	return nil
+}
+
+func (s *SubscriberService) subscribe() (*nats.Subscription, error) {
+	if s.consumer == "" {
+		return s.conn.SubscribeSync(s.subject)
+	}
+
+	js, err := s.conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return js.PullSubscribe("", s.consumer, nats.Bind(s.stream, s.consumer))
+}
+
+// receive delivers the messages of a core NATS subscription until the service is stopped.
+func (s *SubscriberService) receive(ctx context.Context, sub *nats.Subscription) {
+	for {
+		m, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			s.failed(ctx, err)
+			return
+		}
+
+		payload, err := s.codec.Unmarshal(m.Data)
+		if err != nil {
+			s.undecodable(m, err)
+			continue
+		}
+		if !s.deliver(ctx, payload) {
+			s.ReportDeadLetter(payload, service.DeadLetterCanceled, ctx.Err())
+			return
+		}
+	}
+}
+
+// fetch delivers the messages of a JetStream consumer until the service is stopped.
+func (s *SubscriberService) fetch(ctx context.Context, sub *nats.Subscription) {
+	for {
+		msgs, err := sub.Fetch(1, nats.Context(ctx))
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, nats.ErrConnectionClosed) {
+				s.failed(ctx, err)
+				return
+			}
+
+			// The connection may be reconnecting
+			s.ReportError(fmt.Errorf("%s: %w", s, err))
+			if !sleep(ctx, DefaultFetchRetry) {
+				return
+			}
+			continue
+		}
+
+		for _, m := range msgs {
+			payload, err := s.codec.Unmarshal(m.Data)
+			if err != nil {
+				s.undecodable(m, err)
+				_ = m.Term()
+				continue
+			}
+			if !s.deliver(ctx, payload) {
+				// The server delivers the message again, as a requeue
+				_ = m.Nak()
+				return
+			}
+			if err := m.Ack(); err != nil {
+				s.ReportError(fmt.Errorf("%s: %w", s, err))
+			}
+		}
+	}
+}
+
+// deliver sends the payload on the Output channel, and returns false when the service stopped first.
+func (s *SubscriberService) deliver(ctx context.Context, payload interface{}) bool {
+	s.IncReceived()
+
+	select {
+	case s.Output() <- payload:
+		s.IncEmitted()
+		return true
+	case <-ctx.Done():
+	}
+	return false
+}
+
+// undecodable routes the data of a message that could not be decoded to the dead letters.
+func (s *SubscriberService) undecodable(m *nats.Msg, err error) {
+	err = fmt.Errorf("%s: %s: %w", s, m.Subject, err)
+
+	s.ReportError(err)
+	s.ReportDeadLetter(m.Data, service.DeadLetterHandlerError, err)
+}
+
+// failed stops the service with the error when the subscription ended while the service was
+// running, such as when the connection was closed.
+func (s *SubscriberService) failed(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	err = fmt.Errorf("%s: %w", s, err)
+	s.ReportError(err)
+	// Stop waits for the goroutine calling failed to exit
+	go func() { _ = s.StopWithError(err) }()
+}
+
+// sleep waits for the duration, and returns false when the context is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package natsio
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/caffix/service"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// runServer starts an embedded NATS server with JetStream enabled, and returns a connection to it.
+func runServer(t *testing.T) *nats.Conn {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create the NATS server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("The NATS server did not start")
+	}
+	t.Cleanup(srv.Shutdown)
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to the NATS server: %v", err)
+	}
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+func receive(t *testing.T, srv service.Service) interface{} {
+	t.Helper()
+
+	select {
+	case out := <-srv.Output():
+		return out
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No output was received from %s", srv)
+	}
+	return nil
+}
+
+func TestSubscriberService(t *testing.T) {
+	conn := runServer(t)
+
+	sub := NewSubscriberService("Subscriber", conn, "events", service.JSONCodec[int]())
+	if err := sub.Start(); err != nil {
+		t.Fatalf("Failed to start the subscriber: %v", err)
+	}
+	defer func() { _ = sub.Stop() }()
+	_ = conn.Flush()
+
+	_ = conn.Publish("events", []byte("not json"))
+	_ = conn.Publish("events", []byte("42"))
+	if out := receive(t, sub); out != 42 {
+		t.Errorf("Expected the decoded payload 42, received %v", out)
+	}
+
+	select {
+	case dl := <-sub.DeadLetters():
+		if string(dl.Payload.([]byte)) != "not json" {
+			t.Errorf("Expected the undecodable data in the dead letters, received %v", dl.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The undecodable message was not routed to the dead letters")
+	}
+}
+
+func TestSubscriberConnectionClosed(t *testing.T) {
+	conn := runServer(t)
+
+	sub := NewSubscriberService("Subscriber", conn, "events", service.JSONCodec[int]())
+	_ = sub.Start()
+
+	conn.Close()
+	select {
+	case <-sub.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("The subscriber did not stop when the connection was closed")
+	}
+	// Stop returns once the subscriber has stopped itself
+	_ = sub.Stop()
+	if err := sub.Err(); !errors.Is(err, nats.ErrConnectionClosed) {
+		t.Errorf("Expected the closed connection to be the cause of the stop, received %v", err)
+	}
+}
+
+func TestJetStreamSubscriberService(t *testing.T) {
+	conn := runServer(t)
+
+	js, _ := conn.JetStream()
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}}); err != nil {
+		t.Fatalf("Failed to add the stream: %v", err)
+	}
+	if _, err := js.AddConsumer("EVENTS", &nats.ConsumerConfig{
+		Durable:   "worker",
+		AckPolicy: nats.AckExplicitPolicy,
+	}); err != nil {
+		t.Fatalf("Failed to add the consumer: %v", err)
+	}
+	for _, data := range []string{"1", "bad", "2", "3"} {
+		if _, err := js.Publish("events.new", []byte(data)); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	sub := NewJetStreamSubscriberService("Worker", conn, "EVENTS", "worker", service.JSONCodec[int]())
+	_ = sub.Start()
+	for _, expected := range []int{1, 2} {
+		if out := receive(t, sub); out != expected {
+			t.Errorf("Expected the payload %d, received %v", expected, out)
+		}
+	}
+	// The third message is fetched while nobody reads the Output channel, and is requeued
+	time.Sleep(100 * time.Millisecond)
+	_ = sub.Stop()
+
+	info, err := js.ConsumerInfo("EVENTS", "worker")
+	if err != nil {
+		t.Fatalf("The consumer was deleted when the service stopped: %v", err)
+	}
+	if info.NumAckPending+int(info.NumPending) != 1 {
+		t.Errorf("Expected the last message to be requeued, received %+v", info)
+	}
+
+	// A new run receives the requeued message
+	sub2 := NewJetStreamSubscriberService("Worker", conn, "EVENTS", "worker", service.JSONCodec[int]())
+	_ = sub2.Start()
+	defer func() { _ = sub2.Stop() }()
+	if out := receive(t, sub2); out != 3 {
+		t.Errorf("Expected the requeued payload 3, received %v", out)
+	}
+
+	// The message is acknowledged after the payload was received
+	deadline := time.Now().Add(time.Second)
+	for {
+		info, _ = js.ConsumerInfo("EVENTS", "worker")
+		if info.NumAckPending == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info.NumAckPending != 0 || info.NumPending != 0 {
+		t.Errorf("Expected every message to be acknowledged or terminated, received %+v", info)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+// Option configures a BaseService during construction.
+type Option func(*BaseService)
+
+// WithInputBuffer sets the capacity of the Input channel. The Input channel is unbuffered by default.
+func WithInputBuffer(size int) Option {
+	return func(bas *BaseService) {
+		bas.input = make(chan interface{}, size)
+	}
+}
+
+// WithOutputBuffer sets the capacity of the Output channel. The Output channel has a capacity of 10 by default.
+func WithOutputBuffer(size int) Option {
+	return func(bas *BaseService) {
+		bas.output = make(chan interface{}, size)
+	}
+}
+
+// WithWorkers sets the number of goroutines started by the Run method to handle requests concurrently.
+// The Run method starts a single goroutine by default.
+func WithWorkers(n int) Option {
+	return func(bas *BaseService) {
+		bas.workers = n
+	}
+}
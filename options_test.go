@@ -0,0 +1,59 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import "testing"
+
+func TestDefaultBuffers(t *testing.T) {
+	srv := newTestService()
+
+	if c := cap(srv.Input()); c != 0 {
+		t.Errorf("Expected the Input channel to be unbuffered by default, but the capacity was %d", c)
+	}
+	if c := cap(srv.Output()); c != 10 {
+		t.Errorf("Expected the Output channel to have a capacity of 10 by default, but the capacity was %d", c)
+	}
+}
+
+func TestInputBuffer(t *testing.T) {
+	bas := NewBaseService(nil, "Buffered", WithInputBuffer(5))
+
+	for i := 0; i < 5; i++ {
+		select {
+		case bas.Input() <- i:
+		default:
+			t.Fatalf("The send %d blocked before the Input buffer was full", i)
+		}
+		if l := bas.InputLen(); l != i+1 {
+			t.Errorf("Expected InputLen to return %d, received %d", i+1, l)
+		}
+	}
+
+	select {
+	case bas.Input() <- 5:
+		t.Errorf("The send did not block after the Input buffer was full")
+	default:
+	}
+}
+
+func TestOutputBuffer(t *testing.T) {
+	bas := NewBaseService(nil, "Buffered", WithOutputBuffer(2))
+
+	bas.Output() <- 1
+	bas.Output() <- 2
+	if l := bas.OutputLen(); l != 2 {
+		t.Errorf("Expected OutputLen to return 2, received %d", l)
+	}
+
+	select {
+	case bas.Output() <- 3:
+		t.Errorf("The send did not block after the Output buffer was full")
+	default:
+	}
+
+	if unbuf := NewBaseService(nil, "Unbuffered", WithOutputBuffer(0)); cap(unbuf.Output()) != 0 {
+		t.Errorf("WithOutputBuffer(0) did not provide an unbuffered Output channel")
+	}
+}
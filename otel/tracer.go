@@ -0,0 +1,62 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package otel creates OpenTelemetry spans for the requests handled by services.
+package otel
+
+import (
+	"context"
+	"time"
+
+	"github.com/caffix/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RateLimitWaitEvent is the name of the span event recording the time spent waiting on the rate limit.
+const RateLimitWaitEvent = "ratelimit.wait"
+
+// WithTracer returns an option that creates a span named after the service for each request it handles.
+func WithTracer(tr trace.Tracer) service.Option {
+	return service.WithTracer(NewTracer(tr))
+}
+
+// NewTracer returns a service.Tracer that creates the spans using the OpenTelemetry tracer.
+func NewTracer(tr trace.Tracer) service.Tracer {
+	return &tracer{tr: tr}
+}
+
+type tracer struct {
+	tr trace.Tracer
+}
+
+// Start implements the service.Tracer interface.
+func (t *tracer) Start(ctx context.Context, srv service.Service, req interface{}) (context.Context, service.Span) {
+	opts := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindConsumer)}
+	if msg, ok := req.(*service.Message); ok {
+		opts = append(opts, trace.WithAttributes(attribute.String("message.id", msg.ID)))
+	}
+
+	ctx, s := t.tr.Start(ctx, srv.String(), opts...)
+	return ctx, &span{span: s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+// RateLimitWait implements the service.Span interface.
+func (s *span) RateLimitWait(d time.Duration) {
+	s.span.AddEvent(RateLimitWaitEvent, trace.WithAttributes(attribute.Float64("wait.seconds", d.Seconds())))
+}
+
+// End implements the service.Span interface.
+func (s *span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
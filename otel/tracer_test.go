@@ -0,0 +1,114 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/caffix/service"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newRecorder() (*tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	sr := tracetest.NewSpanRecorder()
+
+	return sr, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+}
+
+func waitEnded(t *testing.T, sr *tracetest.SpanRecorder, n int) []sdktrace.ReadOnlySpan {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if spans := sr.Ended(); len(spans) >= n {
+			return spans
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d ended spans and received %d", n, len(sr.Ended()))
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	sr, tp := newRecorder()
+	errFailed := errors.New("failed")
+
+	srv := service.NewSimpleService("traced", func(req interface{}) (interface{}, error) {
+		if req == "fail" {
+			return nil, errFailed
+		}
+		return req, nil
+	}, WithTracer(tp.Tracer("test")))
+	srv.SetRateLimit(10)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "first"
+	<-srv.Output()
+	srv.Input() <- "fail"
+
+	spans := waitEnded(t, sr, 2)
+	for _, s := range spans {
+		if s.Name() != "traced" {
+			t.Errorf("Expected the span to be named after the service, received %s", s.Name())
+		}
+	}
+	if spans[0].Status().Code == codes.Error {
+		t.Errorf("The successful request has an error status")
+	}
+	if spans[1].Status().Code != codes.Error || spans[1].Status().Description != errFailed.Error() {
+		t.Errorf("Expected the handler error as the span status, received %+v", spans[1].Status())
+	}
+
+	var found bool
+	for _, e := range spans[1].Events() {
+		if e.Name == RateLimitWaitEvent {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("The rate limit wait was not recorded as an event")
+	}
+}
+
+func TestTracerPipeline(t *testing.T) {
+	sr, tp := newRecorder()
+	tr := tp.Tracer("test")
+
+	echo := func(req interface{}) (interface{}, error) { return req, nil }
+	p := service.NewPipeline("pipeline",
+		service.NewSimpleService("first", echo, WithTracer(tr)),
+		service.NewSimpleService("second", echo, WithTracer(tr)),
+	)
+
+	_ = p.Start()
+	defer func() { _ = p.Stop() }()
+
+	ctx, root := tr.Start(context.Background(), "root")
+	p.Input() <- service.NewMessageContext(ctx, "linked")
+	<-p.Output()
+	root.End()
+
+	spans := waitEnded(t, sr, 3)
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+
+	first, second := byName["first"], byName["second"]
+	if first == nil || second == nil {
+		t.Fatalf("The spans of the stages were not recorded")
+	}
+	if first.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("The span of the first stage is not a child of the span carried by the message")
+	}
+	if second.Parent().SpanID() != first.SpanContext().SpanID() {
+		t.Errorf("The span of the second stage is not a child of the span of the first stage")
+	}
+}
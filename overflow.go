@@ -0,0 +1,49 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+// WithOverflowPolicy sets the policy applied by Send when the Input channel is full. With
+// PolicyDropNew or PolicyDropOld, Send never blocks, including while the service is paused,
+// and the buffer set by WithInputBuffer holds the most recent messages. The dropped messages are
+// counted in Stats and routed to the dead letters. The default policy is PolicyBlock.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(bas *BaseService) {
+		bas.overflow = policy
+	}
+}
+
+// OverflowPolicy returns the policy applied by Send when the Input channel is full.
+func (bas *BaseService) OverflowPolicy() OverflowPolicy {
+	return bas.overflow
+}
+
+// sendOverflow delivers the message to the Input channel without blocking, and applies the
+// overflow policy when the channel is full.
+func (bas *BaseService) sendOverflow(msg interface{}) {
+	for {
+		select {
+		case bas.input <- msg:
+			return
+		default:
+		}
+
+		if bas.overflow != PolicyDropOld || cap(bas.input) == 0 {
+			bas.dropInput(msg)
+			return
+		}
+
+		select {
+		case old := <-bas.input:
+			bas.dropInput(old)
+		default:
+		}
+	}
+}
+
+func (bas *BaseService) dropInput(msg interface{}) {
+	bas.untrackQueued(msg)
+	bas.stats.dropped.Add(1)
+	bas.ReportDeadLetter(msg, DeadLetterBufferFull, nil)
+}
@@ -0,0 +1,109 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newSaturatedService returns a started service whose Input channel is never read.
+func newSaturatedService(t *testing.T, opts ...Option) *BaseService {
+	srv := new(BaseService)
+	srv.Init(srv, "Saturated", append([]Option{WithInputBuffer(3)}, opts...)...)
+
+	_ = srv.Start()
+	t.Cleanup(func() { _ = srv.Stop() })
+	return srv
+}
+
+func sendAll(t *testing.T, srv *BaseService, n int) {
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err := srv.Send(ctx, i)
+		cancel()
+
+		if err != nil && srv.overflow != PolicyBlock {
+			t.Errorf("Send blocked with policy %d: %v", srv.overflow, err)
+		}
+	}
+}
+
+func drainAll(srv *BaseService) []interface{} {
+	var msgs []interface{}
+
+	for {
+		select {
+		case msg := <-srv.Input():
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	srv := newSaturatedService(t)
+
+	for i := 0; i < 3; i++ {
+		if err := srv.Send(context.Background(), i); err != nil {
+			t.Fatalf("Send failed with room in the buffer: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Send(ctx, 3); err != context.DeadlineExceeded {
+		t.Errorf("Expected Send to block until the deadline and received %v", err)
+	}
+	if n := srv.Stats().Dropped; n != 0 {
+		t.Errorf("Expected no dropped messages and counted %d", n)
+	}
+}
+
+func TestOverflowDropNew(t *testing.T) {
+	srv := newSaturatedService(t, WithOverflowPolicy(PolicyDropNew))
+
+	sendAll(t, srv, 5)
+	if n := srv.Stats().Dropped; n != 2 {
+		t.Errorf("Expected 2 dropped messages and counted %d", n)
+	}
+	if msgs := drainAll(srv); len(msgs) != 3 || msgs[0] != 0 || msgs[2] != 2 {
+		t.Errorf("Expected the oldest messages to be kept and received %v", msgs)
+	}
+	for i := 3; i < 5; i++ {
+		if dl := <-srv.DeadLetters(); dl.Payload != i || dl.Reason != DeadLetterBufferFull {
+			t.Errorf("Expected %d to be dropped with a full buffer and received %v: %v", i, dl.Payload, dl.Reason)
+		}
+	}
+}
+
+func TestOverflowDropOld(t *testing.T) {
+	srv := newSaturatedService(t, WithOverflowPolicy(PolicyDropOld))
+
+	sendAll(t, srv, 5)
+	if n := srv.Stats().Dropped; n != 2 {
+		t.Errorf("Expected 2 dropped messages and counted %d", n)
+	}
+	if msgs := drainAll(srv); len(msgs) != 3 || msgs[0] != 2 || msgs[2] != 4 {
+		t.Errorf("Expected the newest messages to be kept and received %v", msgs)
+	}
+	for i := 0; i < 2; i++ {
+		if dl := <-srv.DeadLetters(); dl.Payload != i || dl.Reason != DeadLetterBufferFull {
+			t.Errorf("Expected %d to be dropped with a full buffer and received %v: %v", i, dl.Payload, dl.Reason)
+		}
+	}
+}
+
+func TestOverflowWhilePaused(t *testing.T) {
+	srv := newSaturatedService(t, WithOverflowPolicy(PolicyDropOld))
+
+	_ = srv.Pause()
+	sendAll(t, srv, 4)
+	if n := srv.Stats().Dropped; n != 1 {
+		t.Errorf("Expected 1 dropped message while paused and counted %d", n)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pacer is the default Limiter. It tracks the time that the next call is permitted, which allows
+// calls to be checked without blocking and waits to be abandoned when the context is done.
+type pacer struct {
+	sync.Mutex
+	interval time.Duration
+	slack    int
+	next     time.Time
+	clock    Clock
+}
+
+func newPacer(rate float64, slack int, clock Clock) *pacer {
+	return &pacer{
+		interval: time.Duration(float64(time.Second) / rate),
+		slack:    slack,
+		clock:    clock,
+	}
+}
+
+// reserve returns the time permitted for the next call and the time permitted for the call after
+// it, when the call takes n units.
+func (p *pacer) reserve(now time.Time, n int) (time.Time, time.Time) {
+	start := p.next
+	if start.IsZero() {
+		start = now
+	} else if earliest := now.Add(-time.Duration(p.slack) * p.interval); start.Before(earliest) {
+		// Unused calls accumulate up to the slack while the limiter is idle
+		start = earliest
+	}
+	return start, start.Add(time.Duration(n) * p.interval)
+}
+
+// Wait implements the Limiter interface.
+func (p *pacer) Wait(ctx context.Context) error {
+	return p.WaitN(ctx, 1)
+}
+
+// WaitN implements the WeightedLimiter interface. The call is permitted once the previous calls
+// have used their units, and the n units delay the calls that follow.
+func (p *pacer) WaitN(ctx context.Context, n int) error {
+	p.Lock()
+	now := p.clock.Now()
+	start, next := p.reserve(now, n)
+	p.next = next
+	p.Unlock()
+
+	wait := start.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+
+	t := p.clock.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.Lock()
+	// Return the reservation when no other calls were permitted after it
+	if p.next.Equal(next) {
+		p.next = start
+	}
+	p.Unlock()
+	return ctx.Err()
+}
+
+// Allow reports whether a call is permitted now, and reserves it when permitted.
+func (p *pacer) Allow() bool {
+	p.Lock()
+	defer p.Unlock()
+
+	now := p.clock.Now()
+	start, next := p.reserve(now, 1)
+	if start.After(now) {
+		return false
+	}
+
+	p.next = next
+	return true
+}
+
+// charge uses n units without waiting, so the calls that follow are delayed.
+func (p *pacer) charge(n int) {
+	p.Lock()
+	defer p.Unlock()
+
+	_, p.next = p.reserve(p.clock.Now(), n)
+}
+
+// setRate changes the number of calls permitted each second without losing the reservations already made.
+func (p *pacer) setRate(rate float64) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.interval = time.Duration(float64(time.Second) / rate)
+}
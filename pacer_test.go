@@ -0,0 +1,52 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPacerCanceledWait(t *testing.T) {
+	clock := newFakeClock()
+	p := newPacer(1, 0, clock)
+	_ = p.Wait(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- p.Wait(ctx) }()
+
+	clock.waitTimers(t, 1)
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context to be canceled, received %v", err)
+	}
+
+	// The abandoned reservation must be returned to the pacer
+	p.Lock()
+	next := p.next
+	p.Unlock()
+	if wait := next.Sub(clock.Now()); wait > time.Second {
+		t.Errorf("The canceled wait kept its reservation, the next call is permitted in %v", wait)
+	}
+}
+
+func TestPacerSetRate(t *testing.T) {
+	clock := newFakeClock()
+	p := newPacer(1, 0, clock)
+	p.setRate(10)
+
+	for i := 0; i < 3; i++ {
+		if !p.Allow() {
+			t.Errorf("Expected call %d to be permitted at ten per second", i)
+		}
+		if p.Allow() {
+			t.Errorf("Expected the call after call %d to wait for the interval", i)
+		}
+		clock.Advance(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type pauseState struct {
+	sync.Mutex
+	// Closed when the service is paused
+	paused chan struct{}
+	// Closed when the service is resumed, and nil while the service is not paused
+	resumed chan struct{}
+	// Send returns ErrPaused instead of blocking while the service is paused
+	failSend bool
+}
+
+// The hooks implemented by BaseService and overridden by services that release resources while paused
+type pauser interface {
+	OnPause() error
+	OnResume() error
+}
+
+// WithPauseErrors makes Send return an error wrapping ErrPaused while the service is paused,
+// instead of blocking until the service is resumed.
+func WithPauseErrors() Option {
+	return func(bas *BaseService) {
+		bas.pause.failSend = true
+	}
+}
+
+// Pause stops the intake of requests by Send and the Run method without stopping the service,
+// and then calls OnPause. The service reports StatePaused until Resume is called.
+func (bas *BaseService) Pause() error {
+	bas.lifecycle.Lock()
+	defer bas.lifecycle.Unlock()
+
+	switch bas.State() {
+	case StateRunning:
+	case StatePaused:
+		return fmt.Errorf("%s: %w", bas.name, ErrPaused)
+	case StateNew:
+		return fmt.Errorf("%s: %w", bas.name, ErrNotStarted)
+	default:
+		return fmt.Errorf("%s: %w", bas.name, ErrNotRunning)
+	}
+
+	bas.setPaused(true)
+	if p, ok := bas.service.(pauser); ok {
+		if err := p.OnPause(); err != nil {
+			bas.setPaused(false)
+			return err
+		}
+	}
+
+	bas.setState(StatePaused)
+	return nil
+}
+
+// OnPause is called when the Pause method has stopped the intake of requests.
+func (bas *BaseService) OnPause() error {
+	return nil
+}
+
+// Resume calls OnResume and then restarts the intake of requests stopped by Pause.
+func (bas *BaseService) Resume() error {
+	bas.lifecycle.Lock()
+	defer bas.lifecycle.Unlock()
+
+	if bas.State() != StatePaused {
+		return fmt.Errorf("%s: %w", bas.name, ErrNotPaused)
+	}
+
+	if p, ok := bas.service.(pauser); ok {
+		if err := p.OnResume(); err != nil {
+			return err
+		}
+	}
+
+	bas.setState(StateRunning)
+	bas.setPaused(false)
+	return nil
+}
+
+// OnResume is called by the Resume method before the intake of requests is restarted.
+func (bas *BaseService) OnResume() error {
+	return nil
+}
+
+func (bas *BaseService) setPaused(paused bool) {
+	p := &bas.pause
+	p.Lock()
+	defer p.Unlock()
+
+	if paused && p.resumed == nil {
+		p.resumed = make(chan struct{})
+		close(p.paused)
+	} else if !paused && p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+		p.paused = make(chan struct{})
+	}
+}
+
+// pauseChans returns the channel closed when the service is paused, and the channel closed
+// when the service is resumed, which is nil while the service is not paused.
+func (bas *BaseService) pauseChans() (<-chan struct{}, <-chan struct{}) {
+	p := &bas.pause
+	p.Lock()
+	defer p.Unlock()
+
+	return p.paused, p.resumed
+}
+
+// waitResumed blocks while the service is paused.
+func (bas *BaseService) waitResumed(ctx context.Context, done <-chan struct{}) error {
+	_, resumed := bas.pauseChans()
+	if resumed == nil {
+		return nil
+	}
+	if bas.pause.failSend {
+		return fmt.Errorf("%s: %w", bas.name, ErrPaused)
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	}
+}
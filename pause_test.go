@@ -0,0 +1,163 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type pausingService struct {
+	SimpleService
+	pauses  int32
+	resumes int32
+}
+
+func newPausingService(opts ...Option) *pausingService {
+	srv := new(pausingService)
+	srv.fn = func(req interface{}) (interface{}, error) { return req, nil }
+
+	srv.Init(srv, "Pausing", opts...)
+	return srv
+}
+
+func (srv *pausingService) OnPause() error {
+	atomic.AddInt32(&srv.pauses, 1)
+	return nil
+}
+
+func (srv *pausingService) OnResume() error {
+	atomic.AddInt32(&srv.resumes, 1)
+	return nil
+}
+
+func TestPause(t *testing.T) {
+	srv := newPausingService(WithInputBuffer(10))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if err := srv.Pause(); err != nil {
+		t.Fatalf("Failed to pause the service: %v", err)
+	}
+	if s := srv.State(); s != StatePaused {
+		t.Errorf("Expected the %v state after Pause, not %v", StatePaused, s)
+	}
+	if n := atomic.LoadInt32(&srv.pauses); n != 1 {
+		t.Errorf("Expected OnPause to be called once, it was called %d times", n)
+	}
+
+	for i := 0; i < 5; i++ {
+		srv.Input() <- i
+	}
+	select {
+	case result := <-srv.Output():
+		t.Fatalf("The paused service processed the request %v", result)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := srv.Stats().Received; n != 0 {
+		t.Errorf("The paused service received %d requests", n)
+	}
+
+	if err := srv.Resume(); err != nil {
+		t.Fatalf("Failed to resume the service: %v", err)
+	}
+	if s := srv.State(); s != StateRunning {
+		t.Errorf("Expected the %v state after Resume, not %v", StateRunning, s)
+	}
+	if n := atomic.LoadInt32(&srv.resumes); n != 1 {
+		t.Errorf("Expected OnResume to be called once, it was called %d times", n)
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-srv.Output():
+		case <-time.After(time.Second):
+			t.Fatalf("The service did not process the requests after it was resumed")
+		}
+	}
+}
+
+func TestPauseSend(t *testing.T) {
+	srv := newPausingService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+	_ = srv.Pause()
+
+	if srv.TrySend("paused") {
+		t.Errorf("TrySend delivered a message to the paused service")
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.Send(context.Background(), "blocked") }()
+	select {
+	case err := <-errs:
+		t.Fatalf("Send returned while the service was paused: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_ = srv.Resume()
+	if err := <-errs; err != nil {
+		t.Errorf("Send failed after the service was resumed: %v", err)
+	}
+	if result := <-srv.Output(); result != "blocked" {
+		t.Errorf("Expected blocked to be returned and received %v", result)
+	}
+}
+
+func TestPauseErrors(t *testing.T) {
+	srv := newPausingService(WithPauseErrors())
+
+	if err := srv.Pause(); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Expected ErrNotStarted when pausing a new service, received %v", err)
+	}
+
+	_ = srv.Start()
+	if err := srv.Resume(); !errors.Is(err, ErrNotPaused) {
+		t.Errorf("Expected ErrNotPaused when resuming a running service, received %v", err)
+	}
+
+	_ = srv.Pause()
+	if err := srv.Pause(); !errors.Is(err, ErrPaused) {
+		t.Errorf("Expected ErrPaused when pausing a paused service, received %v", err)
+	}
+	if err := srv.Send(context.Background(), "refused"); !errors.Is(err, ErrPaused) {
+		t.Errorf("Expected ErrPaused from Send with WithPauseErrors, received %v", err)
+	}
+
+	if err := srv.Stop(); err != nil {
+		t.Errorf("Failed to stop the paused service: %v", err)
+	}
+	if s := srv.State(); s != StateStopped {
+		t.Errorf("Expected the %v state after stopping the paused service, not %v", StateStopped, s)
+	}
+	if err := srv.Pause(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning when pausing a stopped service, received %v", err)
+	}
+}
+
+func TestPauseRestart(t *testing.T) {
+	srv := newPausingService()
+
+	_ = srv.Start()
+	_ = srv.Pause()
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("Failed to restart the paused service: %v", err)
+	}
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "restarted"
+	select {
+	case result := <-srv.Output():
+		if result != "restarted" {
+			t.Errorf("Expected restarted to be returned and received %v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The restarted service is still paused")
+	}
+}
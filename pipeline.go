@@ -0,0 +1,182 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Connect copies the messages from the Output channel of one service to the Input channel of
+// another, until the context is done or either service is stopped. Connect blocks until the copying ends.
+func Connect(ctx context.Context, from, to Service) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-from.Done():
+			return
+		case <-to.Done():
+			return
+		case msg := <-from.Output():
+			select {
+			case to.Input() <- msg:
+			case <-ctx.Done():
+				return
+			case <-to.Done():
+				return
+			}
+		}
+	}
+}
+
+// Pipeline is a service that chains the provided stages together, so the results of each stage
+// become the requests of the following stage. The Input channel of the pipeline belongs to the
+// first stage, and the Output channel belongs to the last stage.
+type Pipeline struct {
+	BaseService
+	stages []Service
+	wg     sync.WaitGroup
+}
+
+// NewPipeline returns a Pipeline that connects the stages in the order provided.
+func NewPipeline(name string, stages ...Service) *Pipeline {
+	p := &Pipeline{stages: stages}
+
+	p.Init(p, name)
+	return p
+}
+
+// Chain returns a Pipeline of the stages, such as those returned by NewFilter and NewMap, so
+// short flows can be built in a single expression.
+func Chain(name string, stages ...Service) *Pipeline {
+	return NewPipeline(name, stages...)
+}
+
+// Stages returns the services chained together by the pipeline.
+func (p *Pipeline) Stages() []Service {
+	return p.stages
+}
+
+// OnStart implements the Service interface. The stages are started in order, and the stages
+// already started are stopped when one of them fails to start.
+func (p *Pipeline) OnStart() error {
+	for i, stage := range p.stages {
+		if err := stage.Start(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				_ = p.stages[j].Stop()
+			}
+			return err
+		}
+	}
+
+	// The connections end as the stages are stopped, so messages in flight can reach the next stage
+	for i := 0; i < len(p.stages)-1; i++ {
+		p.wg.Add(1)
+		from, to := p.stages[i], p.stages[i+1]
+		p.RunLabeled(context.Background(), "connect", func(ctx context.Context) {
+			defer p.wg.Done()
+			Connect(ctx, from, to)
+		})
+	}
+	p.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface. The stages are stopped from front to back.
+func (p *Pipeline) OnStop() error {
+	var err error
+
+	for _, stage := range p.stages {
+		if e := stage.Stop(); e != nil && !errors.Is(e, ErrAlreadyStopped) && err == nil {
+			err = e
+		}
+	}
+
+	p.wg.Wait()
+	return err
+}
+
+// StopDrain stops accepting new requests through Send, and waits for each stage, from front to
+// back, to process its queued requests and deliver its results to the following stage, before
+// stopping the pipeline. Stages that do not provide WaitIdle, such as those not embedding
+// BaseService, are not waited for. When the context is done first, the pipeline is stopped
+// without finishing the remaining requests and the context error is returned.
+func (p *Pipeline) StopDrain(ctx context.Context) error {
+	p.lifecycle.Lock()
+	defer p.lifecycle.Unlock()
+
+	if !p.running() {
+		// Provides the same errors as Stop
+		return p.stop()
+	}
+
+	p.beginDrain()
+	var werr error
+	for i, stage := range p.stages {
+		if werr = waitStage(ctx, stage, i == len(p.stages)-1); werr != nil {
+			werr = fmt.Errorf("%s: %w", p.name, werr)
+			break
+		}
+	}
+
+	if err := p.stop(); err != nil {
+		return err
+	}
+	return werr
+}
+
+// The services that report when they have caught up, such as those embedding BaseService
+type idleWaiter interface {
+	WaitIdle(ctx context.Context) error
+}
+
+// waitStage waits for the stage to be idle, and unless it is the last stage, for its results to
+// be taken by the following stage.
+func waitStage(ctx context.Context, stage Service, last bool) error {
+	w, ok := stage.(idleWaiter)
+	if !ok {
+		return nil
+	}
+
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+
+	for {
+		if err := w.WaitIdle(ctx); errors.Is(err, ErrServiceStopped) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if last || len(stage.Output()) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Input implements the Service interface.
+func (p *Pipeline) Input() chan interface{} {
+	if len(p.stages) == 0 {
+		return p.BaseService.Input()
+	}
+	return p.stages[0].Input()
+}
+
+// Output implements the Service interface.
+func (p *Pipeline) Output() chan interface{} {
+	if len(p.stages) == 0 {
+		return p.BaseService.Output()
+	}
+	return p.stages[len(p.stages)-1].Output()
+}
@@ -0,0 +1,140 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestConnect(t *testing.T) {
+	from := NewSimpleService("From", func(req interface{}) (interface{}, error) { return req, nil })
+	to := NewSimpleService("To", func(req interface{}) (interface{}, error) { return req, nil })
+
+	_ = from.Start()
+	_ = to.Start()
+	defer func() { _ = to.Stop() }()
+
+	finished := make(chan struct{})
+	go func() {
+		Connect(context.Background(), from, to)
+		close(finished)
+	}()
+
+	from.Input() <- "message"
+	if result := <-to.Output(); result != "message" {
+		t.Errorf("Expected message to be returned and received %v", result)
+	}
+
+	_ = from.Stop()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Errorf("Connect did not return after the source service was stopped")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p := NewPipeline("Pipeline",
+		NewSimpleService("Add", func(req interface{}) (interface{}, error) { return req.(int) + 1, nil }),
+		NewSimpleService("Double", func(req interface{}) (interface{}, error) { return req.(int) * 2, nil }),
+		NewSimpleService("Format", func(req interface{}) (interface{}, error) { return strconv.Itoa(req.(int)), nil }),
+	)
+	var _ Service = p
+
+	if err := p.Start(); err != nil {
+		t.Fatalf("Failed to start the pipeline: %v", err)
+	}
+
+	go func() {
+		for i := 0; i < 20; i++ {
+			p.Input() <- i
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if result, expected := <-p.Output(), strconv.Itoa((i+1)*2); result != expected {
+			t.Errorf("Expected %s to be returned and received %v", expected, result)
+		}
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Errorf("Failed to stop the pipeline: %v", err)
+	}
+	for _, stage := range p.Stages() {
+		select {
+		case <-stage.Done():
+		default:
+			t.Errorf("The %s stage was not stopped with the pipeline", stage)
+		}
+	}
+}
+
+func TestPipelineStartFailure(t *testing.T) {
+	first := NewSimpleService("First", func(req interface{}) (interface{}, error) { return req, nil })
+	failing := new(failingService)
+	failing.Init(failing, "Failing")
+
+	p := NewPipeline("Pipeline", first, failing)
+	if err := p.Start(); !errors.Is(err, errStartFailed) {
+		t.Errorf("Expected the stage failure to be returned, received %v", err)
+	}
+
+	select {
+	case <-first.Done():
+	default:
+		t.Errorf("The started stage was not stopped after the start failure")
+	}
+}
+
+func TestChainStopDrain(t *testing.T) {
+	last := NewMap("Map", timesTen)
+	c := Chain("Chain", NewFilter("Filter", isEven), last)
+
+	_ = c.Start()
+	results := make(chan interface{}, 100)
+	go func() {
+		for {
+			select {
+			case msg := <-c.Output():
+				results <- msg
+			case <-c.Done():
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if err := c.Send(context.Background(), i); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.StopDrain(ctx); err != nil {
+		t.Fatalf("StopDrain failed: %v", err)
+	}
+
+	// The results left in the Output channel of the last stage are discarded by the stop
+	seen := make(map[interface{}]bool)
+	for len(seen) < 50 {
+		select {
+		case msg := <-results:
+			seen[msg] = true
+		case dl := <-last.DeadLetters():
+			seen[dl.Payload] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Only %d of the 50 results reached the end of the chain", len(seen))
+		}
+	}
+	for i := 0; i < 100; i += 2 {
+		if !seen[i*10] {
+			t.Errorf("The result %d did not reach the end of the chain", i*10)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDrainTimeout is the default time that Stop waits for the in-flight requests of a PoolService.
+const DefaultDrainTimeout = 10 * time.Second
+
+// PoolOption configures a PoolService during construction. Each Option is also a PoolOption.
+type PoolOption interface {
+	applyPool(*PoolService)
+}
+
+func (o Option) applyPool(ps *PoolService) {
+	o(&ps.BaseService)
+}
+
+type poolOption func(*PoolService)
+
+func (o poolOption) applyPool(ps *PoolService) {
+	o(ps)
+}
+
+// WithDrainTimeout sets the maximum time that Stop waits for the in-flight requests to finish.
+func WithDrainTimeout(d time.Duration) PoolOption {
+	return poolOption(func(ps *PoolService) {
+		ps.drain = d
+	})
+}
+
+// WithOrderedOutput causes the results to be sent on the Output channel in the order that
+// the requests were received, instead of the order that the workers finished them.
+func WithOrderedOutput() PoolOption {
+	return poolOption(func(ps *PoolService) {
+		ps.ordered = true
+	})
+}
+
+// PoolStats is a snapshot of the activity of a PoolService.
+type PoolStats struct {
+	Workers   int
+	Busy      int
+	Processed uint64
+}
+
+// PoolService handles the requests received on a single Input channel with a number of concurrent
+// workers that share the rate limit of the service.
+type PoolService struct {
+	BaseService
+	fn        func(req interface{}) (interface{}, error)
+	size      int
+	drain     time.Duration
+	ordered   bool
+	busy      int32
+	processed uint64
+	wg        sync.WaitGroup
+	shardKey  func(req interface{}) string
+	shardBuf  int
+	// The queues of the workers for the current run
+	shards []*shard
+}
+
+type poolJob struct {
+	seq    uint64
+	req    interface{}
+	waited time.Duration
+}
+
+type poolResult struct {
+	seq    uint64
+	result interface{}
+	ok     bool
+}
+
+// NewPoolService returns a service that executes fn for each request using the provided number of workers.
+func NewPoolService(name string, workers int, fn func(req interface{}) (interface{}, error), opts ...PoolOption) *PoolService {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ps := &PoolService{
+		fn:       fn,
+		size:     workers,
+		drain:    DefaultDrainTimeout,
+		shardBuf: DefaultShardBuffer,
+	}
+	ps.Init(ps, name)
+
+	for _, opt := range opts {
+		opt.applyPool(ps)
+	}
+	return ps
+}
+
+// OnStart implements the Service interface.
+func (ps *PoolService) OnStart() error {
+	ctx := ps.Context()
+
+	// The workers share a single queue, unless each of them has a shard
+	shards := []*shard{{jobs: make(chan poolJob)}}
+	if ps.shardKey != nil {
+		shards = make([]*shard, ps.size)
+		for i := range shards {
+			shards[i] = &shard{jobs: make(chan poolJob, ps.shardBuf)}
+		}
+	}
+	ps.Lock()
+	ps.shards = shards
+	ps.Unlock()
+
+	var results chan poolResult
+	if ps.ordered {
+		results = make(chan poolResult, ps.size)
+	}
+
+	var workers sync.WaitGroup
+	workers.Add(ps.size)
+	ps.wg.Add(ps.size + 1)
+	ps.RunLabeled(ctx, "dispatcher", func(ctx context.Context) { ps.dispatch(ctx, shards) })
+	for i := 0; i < ps.size; i++ {
+		s := shards[i%len(shards)]
+		ps.RunLabeled(ctx, "worker", func(ctx context.Context) {
+			defer workers.Done()
+			ps.worker(ctx, s, results)
+		})
+	}
+
+	if results != nil {
+		ps.wg.Add(1)
+		ps.RunLabeled(ctx, "reorder", func(ctx context.Context) { ps.reorder(ctx, results) })
+		go func() {
+			workers.Wait()
+			close(results)
+		}()
+	}
+	ps.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (ps *PoolService) OnStop() error {
+	finished := make(chan struct{})
+	go func() {
+		ps.wg.Wait()
+		close(finished)
+	}()
+
+	t := time.NewTimer(ps.drain)
+	defer t.Stop()
+
+	select {
+	case <-finished:
+	case <-t.C:
+	}
+	return nil
+}
+
+// PoolStats returns a snapshot of the activity of the workers.
+func (ps *PoolService) PoolStats() PoolStats {
+	return PoolStats{
+		Workers:   ps.size,
+		Busy:      int(atomic.LoadInt32(&ps.busy)),
+		Processed: atomic.LoadUint64(&ps.processed),
+	}
+}
+
+// dispatch hands the requests to the workers, and closes the queues once the service is stopped,
+// so the workers finish the requests that were already received by every shard.
+func (ps *PoolService) dispatch(ctx context.Context, shards []*shard) {
+	defer ps.wg.Done()
+	defer func() {
+		for _, s := range shards {
+			close(s.jobs)
+		}
+	}()
+
+	var seq uint64
+	for {
+		start := time.Now()
+		if err := ps.CheckRateLimitErr(); err != nil {
+			return
+		}
+		waited := time.Since(start)
+
+		req, ok := ps.nextRequest(ctx, nil, nil)
+		if !ok {
+			return
+		}
+
+		ps.IncReceived()
+		shards[ps.shardOf(req, len(shards))].jobs <- poolJob{seq: seq, req: req, waited: waited}
+		seq++
+	}
+}
+
+func (ps *PoolService) handle(_ context.Context, req interface{}) (interface{}, error) {
+	return ps.fn(req)
+}
+
+func (ps *PoolService) worker(ctx context.Context, s *shard, results chan<- poolResult) {
+	defer ps.wg.Done()
+
+	for job := range s.jobs {
+		atomic.AddInt32(&ps.busy, 1)
+		mctx, span := ps.startSpan(job.req, job.waited)
+		// The requests received before the stop are finished, so the handlers outlive the run
+		result, ok, err := ps.invoke(context.Background(), mctx, ps.handle, job.req)
+		atomic.AddInt32(&ps.busy, -1)
+		atomic.AddUint64(&ps.processed, 1)
+		s.processed.Add(1)
+
+		if results != nil {
+			results <- poolResult{seq: job.seq, result: result, ok: ok}
+		} else if ok {
+			ps.emit(ctx, result)
+		}
+		// The request was marked busy when it was dequeued
+		ps.MarkIdle()
+		span.End(err)
+		ps.Beat()
+	}
+}
+
+// reorder sends the results on the Output channel using the sequence numbers assigned by the dispatcher.
+func (ps *PoolService) reorder(ctx context.Context, results <-chan poolResult) {
+	defer ps.wg.Done()
+
+	var next uint64
+	pending := make(map[uint64]poolResult)
+	for r := range results {
+		pending[r.seq] = r
+
+		for {
+			res, found := pending[next]
+			if !found {
+				break
+			}
+
+			delete(pending, next)
+			next++
+			if res.ok {
+				ps.emit(ctx, res.result)
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolService(t *testing.T) {
+	release := make(chan struct{})
+	srv := NewPoolService("Pool", 4, func(req interface{}) (interface{}, error) {
+		<-release
+		return req, nil
+	}, WithInputBuffer(10), WithOutputBuffer(10))
+	var _ Service = srv
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 0; i < 8; i++ {
+		srv.Input() <- i
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if stats := srv.PoolStats(); stats.Workers != 4 || stats.Busy != 4 {
+		t.Errorf("Expected all four workers to be busy, received %+v", stats)
+	}
+
+	close(release)
+	seen := make(map[interface{}]bool)
+	for i := 0; i < 8; i++ {
+		seen[<-srv.Output()] = true
+	}
+	if len(seen) != 8 {
+		t.Errorf("Expected eight distinct results, received %d", len(seen))
+	}
+	if stats := srv.PoolStats(); stats.Processed != 8 || stats.Busy != 0 {
+		t.Errorf("Expected eight processed requests and no busy workers, received %+v", stats)
+	}
+}
+
+func TestPoolServiceOrdered(t *testing.T) {
+	srv := NewPoolService("Ordered", 8, func(req interface{}) (interface{}, error) {
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		if req.(int)%10 == 0 {
+			// Requests without a result must not stall the ordering
+			return nil, nil
+		}
+		return req, nil
+	}, WithOrderedOutput(), WithOutputBuffer(100))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	go func() {
+		for i := 1; i <= 100; i++ {
+			srv.Input() <- i
+		}
+	}()
+
+	prev := 0
+	for i := 0; i < 90; i++ {
+		result := (<-srv.Output()).(int)
+		if result <= prev {
+			t.Fatalf("Received %d after %d", result, prev)
+		}
+		prev = result
+	}
+}
+
+func TestPoolServiceSharedRateLimit(t *testing.T) {
+	srv := NewPoolService("Limited", 4, func(req interface{}) (interface{}, error) {
+		return req, nil
+	})
+	srv.SetRateLimit(10)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		srv.Input() <- i
+		<-srv.Output()
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("The workers did not share the rate limit, four requests took %v", elapsed)
+	}
+}
+
+func TestPoolServiceDrain(t *testing.T) {
+	var finished int32
+	srv := NewPoolService("Drain", 2, func(req interface{}) (interface{}, error) {
+		time.Sleep(100 * time.Millisecond)
+		atomic.AddInt32(&finished, 1)
+		return nil, nil
+	}, WithDrainTimeout(time.Second))
+
+	_ = srv.Start()
+	srv.Input() <- 1
+	srv.Input() <- 2
+	_ = srv.Stop()
+
+	if f := atomic.LoadInt32(&finished); f != 2 {
+		t.Errorf("Stop returned before the in-flight requests finished, %d of 2 finished", f)
+	}
+
+	slow := NewPoolService("Slow", 1, func(req interface{}) (interface{}, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	}, WithDrainTimeout(50*time.Millisecond))
+
+	_ = slow.Start()
+	slow.Input() <- 1
+	start := time.Now()
+	_ = slow.Stop()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Stop did not return after the drain timeout, it took %v", elapsed)
+	}
+}
+
+type keyedReq struct {
+	key string
+	seq int
+}
+
+func keyOf(req interface{}) string {
+	return req.(keyedReq).key
+}
+
+func TestPoolServiceShardOrdering(t *testing.T) {
+	const keys, num = 8, 20
+
+	var mu sync.Mutex
+	last := make(map[string]int)
+	srv := NewPoolService("Sharded", 1, func(req interface{}) (interface{}, error) {
+		r := req.(keyedReq)
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if prev, found := last[r.key]; found && r.seq != prev+1 {
+			t.Errorf("Request %d of key %s was processed after request %d", r.seq, r.key, prev)
+		}
+		last[r.key] = r.seq
+		return nil, nil
+	}, WithSharding(keyOf, 4), WithShardBuffer(4))
+
+	_ = srv.Start()
+	for i := 0; i < num; i++ {
+		for k := 0; k < keys; k++ {
+			srv.Input() <- keyedReq{key: strconv.Itoa(k), seq: i}
+		}
+	}
+	_ = srv.Stop()
+
+	if s := srv.PoolStats(); s.Workers != 4 || s.Processed != keys*num {
+		t.Errorf("Expected 4 workers to process %d requests, received %+v", keys*num, s)
+	}
+	for k := 0; k < keys; k++ {
+		if seq := last[strconv.Itoa(k)]; seq != num-1 {
+			t.Errorf("The last request processed for key %d was %d", k, seq)
+		}
+	}
+}
+
+func TestPoolServiceShardDistribution(t *testing.T) {
+	const shards, num = 4, 2000
+
+	srv := NewPoolService("Distribution", 1, func(req interface{}) (interface{}, error) {
+		return nil, nil
+	}, WithSharding(keyOf, shards))
+
+	_ = srv.Start()
+	for i := 0; i < num; i++ {
+		srv.Input() <- keyedReq{key: fmt.Sprint(rand.Int63())}
+	}
+	_ = srv.Stop()
+
+	stats := srv.ShardStats()
+	if len(stats) != shards {
+		t.Fatalf("Expected stats for %d shards and received %d", shards, len(stats))
+	}
+	for i, s := range stats {
+		// Each shard is expected to receive a quarter of the requests
+		if s.Processed < num/shards*3/4 || s.Processed > num/shards*5/4 {
+			t.Errorf("Shard %d processed %d of %d requests", i, s.Processed, num)
+		}
+		if s.Queued != 0 {
+			t.Errorf("Shard %d still had %d requests queued after the stop", i, s.Queued)
+		}
+	}
+	if stats := NewPoolService("Plain", 2, nil).ShardStats(); stats != nil {
+		t.Errorf("Expected no shard stats without sharding and received %v", stats)
+	}
+}
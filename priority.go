@@ -0,0 +1,217 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultPriorityAging is the waiting time that raises the priority of a queued message by one.
+const DefaultPriorityAging = time.Second
+
+type priorityItem struct {
+	msg interface{}
+	// The enqueue time lowered by the priority, so the smallest key is delivered first
+	key   int64
+	seq   uint64
+	index int
+}
+
+type priorityItems []*priorityItem
+
+func (pi priorityItems) Len() int { return len(pi) }
+
+func (pi priorityItems) Less(i, j int) bool {
+	if pi[i].key == pi[j].key {
+		return pi[i].seq < pi[j].seq
+	}
+	return pi[i].key < pi[j].key
+}
+
+func (pi priorityItems) Swap(i, j int) {
+	pi[i], pi[j] = pi[j], pi[i]
+	pi[i].index = i
+	pi[j].index = j
+}
+
+func (pi *priorityItems) Push(x interface{}) {
+	item := x.(*priorityItem)
+	item.index = len(*pi)
+	*pi = append(*pi, item)
+}
+
+func (pi *priorityItems) Pop() interface{} {
+	old := *pi
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*pi = old[:n-1]
+	return item
+}
+
+type priorityQueue struct {
+	sync.Mutex
+	items priorityItems
+	seq   uint64
+	aging time.Duration
+	// Wakes the goroutine feeding the Input channel when a message is queued
+	queued chan struct{}
+	// Requests the goroutine feeding the Input channel to take the queued messages
+	takes chan chan []interface{}
+}
+
+// SetPriorityAging sets the waiting time that raises the priority of a message queued by
+// SendPriority by one, so messages with a low priority are not starved by a steady flow of
+// messages with a higher priority. DefaultPriorityAging is used when the duration is not positive.
+func (bas *BaseService) SetPriorityAging(d time.Duration) {
+	pq := &bas.prio
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.aging = d
+}
+
+// SendPriority queues the message for the Input channel, ahead of the messages queued with a lower
+// priority. Messages sent directly on the Input channel or by Send are not ordered by the queue, and
+// the queue is most effective when the Input channel is unbuffered. SendPriority does not block
+// on the Input channel, and returns the same errors as Send. The messages remaining in the queue
+// when the service stops are routed to the dead letters.
+func (bas *BaseService) SendPriority(ctx context.Context, msg interface{}, prio int) error {
+	done := bas.Done()
+	select {
+	case <-done:
+		return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	default:
+	}
+	if err := bas.errDraining(); err != nil {
+		return err
+	}
+	if err := bas.waitResumed(ctx, done); err != nil {
+		return err
+	}
+
+	bas.enqueued(msg)
+	bas.trackQueued(msg)
+	bas.pushPriority(prio, msg)
+	return nil
+}
+
+// pushPriority queues the messages in order with the priority, and wakes the goroutine feeding
+// the Input channel.
+func (bas *BaseService) pushPriority(prio int, msgs ...interface{}) {
+	pq := &bas.prio
+	pq.Lock()
+	aging := pq.aging
+	if aging <= 0 {
+		aging = DefaultPriorityAging
+	}
+	key := bas.clock.Now().UnixNano() - int64(prio)*int64(aging)
+	for _, msg := range msgs {
+		pq.seq++
+		heap.Push(&pq.items, &priorityItem{msg: msg, key: key, seq: pq.seq})
+	}
+	pq.Unlock()
+
+	select {
+	case pq.queued <- struct{}{}:
+	default:
+	}
+}
+
+// PriorityLen returns the number of messages queued by SendPriority that have not been delivered
+// to the Input channel.
+func (bas *BaseService) PriorityLen() int {
+	pq := &bas.prio
+	pq.Lock()
+	defer pq.Unlock()
+
+	return len(pq.items)
+}
+
+func (bas *BaseService) nextPriority() (*priorityItem, bool) {
+	pq := &bas.prio
+	pq.Lock()
+	defer pq.Unlock()
+
+	if len(pq.items) == 0 {
+		return nil, false
+	}
+	return pq.items[0], true
+}
+
+func (bas *BaseService) removePriority(item *priorityItem) {
+	pq := &bas.prio
+	pq.Lock()
+	defer pq.Unlock()
+
+	heap.Remove(&pq.items, item.index)
+}
+
+// feedPriority delivers the queued messages to the Input channel during the run of the context.
+func (bas *BaseService) feedPriority(run context.Context) {
+	for {
+		var input chan interface{}
+		var msg interface{}
+
+		item, ok := bas.nextPriority()
+		if ok {
+			input = bas.input
+			msg = item.msg
+		}
+
+		select {
+		case <-run.Done():
+			bas.discardPriority()
+			return
+		case <-bas.prio.queued:
+		case reply := <-bas.prio.takes:
+			reply <- bas.takeQueued()
+		case input <- msg:
+			bas.removePriority(item)
+		}
+	}
+}
+
+// takeQueued removes the messages waiting on the Input channel and in the queue, and returns them
+// in the order they would have been received. The caller must ensure that no request loop and no
+// goroutine feeding the Input channel is running concurrently.
+func (bas *BaseService) takeQueued() []interface{} {
+	var msgs []interface{}
+
+	for {
+		select {
+		case msg := <-bas.input:
+			msgs = append(msgs, msg)
+			continue
+		default:
+		}
+		break
+	}
+
+	pq := &bas.prio
+	pq.Lock()
+	defer pq.Unlock()
+
+	for len(pq.items) > 0 {
+		msgs = append(msgs, heap.Pop(&pq.items).(*priorityItem).msg)
+	}
+	return msgs
+}
+
+func (bas *BaseService) discardPriority() {
+	pq := &bas.prio
+	pq.Lock()
+	items := pq.items
+	pq.items = nil
+	pq.Unlock()
+
+	for _, item := range items {
+		bas.ReportDeadLetter(item.msg, DeadLetterCanceled, ErrServiceStopped)
+	}
+}
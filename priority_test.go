@@ -0,0 +1,91 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func receiveOrder(t *testing.T, srv Service, n int) []interface{} {
+	var order []interface{}
+
+	for i := 0; i < n; i++ {
+		select {
+		case result := <-srv.Output():
+			order = append(order, result)
+		case <-time.After(time.Second):
+			t.Fatalf("Only %d of %d results were received", i, n)
+		}
+	}
+	return order
+}
+
+func TestSendPriority(t *testing.T) {
+	srv := newEchoService("Priority")
+
+	// The messages are queued before the service starts, so the order depends only on the priority
+	for _, str := range []string{"bulk1", "bulk2", "bulk3"} {
+		if err := srv.SendPriority(context.Background(), str, 0); err != nil {
+			t.Fatalf("SendPriority failed: %v", err)
+		}
+	}
+	_ = srv.SendPriority(context.Background(), "interactive", 5)
+	if n := srv.PriorityLen(); n != 4 {
+		t.Errorf("Expected 4 queued messages and counted %d", n)
+	}
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	order := receiveOrder(t, srv, 4)
+	for i, expected := range []string{"interactive", "bulk1", "bulk2", "bulk3"} {
+		if order[i] != expected {
+			t.Errorf("Expected %s at position %d and received %v", expected, i, order[i])
+		}
+	}
+}
+
+func TestSendPriorityAging(t *testing.T) {
+	clock := newFakeClock()
+	srv := newEchoService("Aging", WithClock(clock))
+	srv.SetPriorityAging(10 * time.Second)
+
+	_ = srv.SendPriority(context.Background(), "old", 0)
+	clock.Advance(50 * time.Second)
+	// The old message has gained more than two levels while waiting
+	_ = srv.SendPriority(context.Background(), "high", 2)
+	_ = srv.SendPriority(context.Background(), "urgent", 100)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	order := receiveOrder(t, srv, 3)
+	for i, expected := range []string{"urgent", "old", "high"} {
+		if order[i] != expected {
+			t.Errorf("Expected %s at position %d and received %v", expected, i, order[i])
+		}
+	}
+}
+
+func TestSendPriorityDrain(t *testing.T) {
+	srv := newEchoService("Drain", WithOutputBuffer(10))
+
+	for i := 0; i < 5; i++ {
+		_ = srv.SendPriority(context.Background(), i, i)
+	}
+	_ = srv.Start()
+
+	if err := srv.StopDrain(context.Background()); err != nil {
+		t.Errorf("StopDrain failed: %v", err)
+	}
+	if n := srv.Stats().Received; n != 5 {
+		t.Errorf("Expected the 5 queued messages to be processed and counted %d", n)
+	}
+	if err := srv.SendPriority(context.Background(), "late", 0); err == nil {
+		t.Errorf("SendPriority did not fail after the service was stopped")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package prom exports the state and statistics of services as Prometheus metrics.
+package prom
+
+import (
+	"github.com/caffix/service"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector providing metrics for a set of services. Each metric has
+// a name label with the name of the service.
+type Collector struct {
+	services  func() []service.Service
+	up        *prometheus.Desc
+	backlog   *prometheus.Desc
+	processed *prometheus.Desc
+	errors    *prometheus.Desc
+	wait      *prometheus.Desc
+	queue     *prometheus.Desc
+	handler   *prometheus.Desc
+}
+
+// NewCollector returns a Collector for the provided services.
+func NewCollector(services ...service.Service) *Collector {
+	list := append([]service.Service(nil), services...)
+
+	return newCollector(func() []service.Service { return list })
+}
+
+// NewRegistryCollector returns a Collector for the services in the registry at the time of each collection.
+func NewRegistryCollector(r *service.Registry) *Collector {
+	return newCollector(r.List)
+}
+
+func newCollector(services func() []service.Service) *Collector {
+	labels := []string{"name"}
+
+	return &Collector{
+		services: services,
+		up: prometheus.NewDesc("service_up",
+			"Whether the service is running.", labels, nil),
+		backlog: prometheus.NewDesc("service_input_backlog",
+			"The number of requests waiting in the input buffer.", labels, nil),
+		processed: prometheus.NewDesc("service_processed_total",
+			"The number of requests received by the service.", labels, nil),
+		errors: prometheus.NewDesc("service_errors_total",
+			"The number of errors reported by the service.", labels, nil),
+		wait: prometheus.NewDesc("service_ratelimit_wait_seconds",
+			"The total time spent waiting on the rate limit.", labels, nil),
+		queue: prometheus.NewDesc("service_queue_latency_seconds",
+			"The time the messages spent on the queue.", labels, nil),
+		handler: prometheus.NewDesc("service_handler_latency_seconds",
+			"The time the handler took for each request.", labels, nil),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.backlog
+	ch <- c.processed
+	ch <- c.errors
+	ch <- c.wait
+	ch <- c.queue
+	ch <- c.handler
+}
+
+// Collect implements the prometheus.Collector interface. The metrics are only provided when the
+// service implements the corresponding accessor of service.BaseService.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, srv := range c.services() {
+		name := srv.String()
+
+		if s, ok := srv.(interface{ State() service.State }); ok {
+			var up float64
+			if s.State() == service.StateRunning {
+				up = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up, name)
+		}
+		if b, ok := srv.(interface{ InputLen() int }); ok {
+			ch <- prometheus.MustNewConstMetric(c.backlog, prometheus.GaugeValue, float64(b.InputLen()), name)
+		}
+		if s, ok := srv.(interface{ Stats() service.Stats }); ok {
+			stats := s.Stats()
+
+			ch <- prometheus.MustNewConstMetric(c.processed, prometheus.CounterValue, float64(stats.Received), name)
+			ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(stats.Errors), name)
+			ch <- prometheus.MustNewConstMetric(c.wait, prometheus.CounterValue, stats.RateLimitWait.Seconds(), name)
+			ch <- &latencyMetric{desc: c.queue, name: name, h: stats.QueueLatency}
+			ch <- &latencyMetric{desc: c.handler, name: name, h: stats.HandlerLatency}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package prom
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/caffix/service"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	running := service.NewSimpleService("running", func(req interface{}) (interface{}, error) {
+		return req, nil
+	})
+	stopped := service.NewSimpleService("stopped", func(req interface{}) (interface{}, error) {
+		return req, nil
+	}, service.WithInputBuffer(5))
+
+	_ = running.Start()
+	defer func() { _ = running.Stop() }()
+	running.Input() <- "request"
+	<-running.Output()
+	running.ReportError(errors.New("failed"))
+
+	stopped.Input() <- "queued"
+	stopped.Input() <- "queued"
+
+	expected := `
+# HELP service_errors_total The number of errors reported by the service.
+# TYPE service_errors_total counter
+service_errors_total{name="running"} 1
+service_errors_total{name="stopped"} 0
+# HELP service_input_backlog The number of requests waiting in the input buffer.
+# TYPE service_input_backlog gauge
+service_input_backlog{name="running"} 0
+service_input_backlog{name="stopped"} 2
+# HELP service_processed_total The number of requests received by the service.
+# TYPE service_processed_total counter
+service_processed_total{name="running"} 1
+service_processed_total{name="stopped"} 0
+# HELP service_up Whether the service is running.
+# TYPE service_up gauge
+service_up{name="running"} 1
+service_up{name="stopped"} 0
+`
+	c := NewCollector(running, stopped)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "service_up",
+		"service_input_backlog", "service_processed_total", "service_errors_total"); err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+	if n := testutil.CollectAndCount(c, "service_ratelimit_wait_seconds"); n != 2 {
+		t.Errorf("Expected the rate limit wait for 2 services and received %d", n)
+	}
+}
+
+func TestRegistryCollector(t *testing.T) {
+	r := service.NewRegistry()
+	c := NewRegistryCollector(r)
+
+	if n := testutil.CollectAndCount(c); n != 0 {
+		t.Errorf("Expected no metrics for the empty registry and received %d", n)
+	}
+
+	_ = r.Register(service.NewSimpleService("registered", func(req interface{}) (interface{}, error) {
+		return req, nil
+	}))
+	if n := testutil.CollectAndCount(c, "service_up"); n != 1 {
+		t.Errorf("Expected the registered service to be collected, received %d metrics", n)
+	}
+}
+
+func TestCollectorLatency(t *testing.T) {
+	srv := service.NewSimpleService("latency", func(req interface{}) (interface{}, error) {
+		return req, nil
+	})
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 0; i < 3; i++ {
+		srv.Input() <- i
+		<-srv.Output()
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(NewCollector(srv)); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, f := range families {
+		if f.GetName() != "service_handler_latency_seconds" {
+			continue
+		}
+		found = true
+
+		h := f.GetMetric()[0].GetHistogram()
+		if h.GetSampleCount() != 3 || h.GetSchema() != 2 {
+			t.Errorf("Expected 3 latencies in a native histogram, received %d with schema %d", h.GetSampleCount(), h.GetSchema())
+		}
+
+		var total int64
+		var count int64
+		for _, delta := range h.GetPositiveDelta() {
+			count += delta
+			total += count
+		}
+		if total != 3 {
+			t.Errorf("Expected the native buckets to hold 3 latencies, received %d", total)
+		}
+		if n := len(h.GetBucket()); n != 27 {
+			t.Errorf("Expected 27 classic buckets, received %d", n)
+		}
+	}
+	if !found {
+		t.Error("Expected the handler latency to be collected")
+	}
+}
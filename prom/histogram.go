@@ -0,0 +1,89 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package prom
+
+import (
+	"math"
+	"time"
+
+	"github.com/caffix/service"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The schema of the native histograms, whose buckets grow by a factor of 2^(1/4) like the
+// buckets of service.LatencyHistogram
+const nativeSchema = 2
+
+// latencyMetric is a histogram of the latencies recorded by a service, provided both as a native
+// histogram and as a classic histogram with a bucket for each power of two seconds.
+type latencyMetric struct {
+	desc *prometheus.Desc
+	name string
+	h    service.LatencyHistogram
+}
+
+// Desc implements the prometheus.Metric interface.
+func (m *latencyMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+// Write implements the prometheus.Metric interface.
+func (m *latencyMetric) Write(out *dto.Metric) error {
+	label := "name"
+	out.Label = []*dto.LabelPair{{Name: &label, Value: &m.name}}
+
+	count := m.h.Count
+	sum := m.h.Sum.Seconds()
+	schema := int32(nativeSchema)
+	var zero float64
+	var zeroCount uint64
+	hist := &dto.Histogram{
+		SampleCount:   &count,
+		SampleSum:     &sum,
+		Schema:        &schema,
+		ZeroThreshold: &zero,
+		ZeroCount:     &zeroCount,
+	}
+
+	bounds := service.LatencyBounds()
+	var cumulative uint64
+	first, last := -1, -1
+	for i, n := range m.h.Counts {
+		cumulative += n
+		if i < len(bounds) && i%4 == 0 {
+			c, upper := cumulative, bounds[i].Seconds()
+			hist.Bucket = append(hist.Bucket, &dto.Bucket{CumulativeCount: &c, UpperBound: &upper})
+		}
+		if n > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	// The populated buckets are provided as a single span, and the longer latencies are counted
+	// in the bucket following the last bound
+	if first >= 0 {
+		offset := int32(nativeIndex(bounds[0])) + int32(first)
+		length := uint32(last - first + 1)
+		hist.PositiveSpan = []*dto.BucketSpan{{Offset: &offset, Length: &length}}
+
+		var prev int64
+		for _, n := range m.h.Counts[first : last+1] {
+			hist.PositiveDelta = append(hist.PositiveDelta, int64(n)-prev)
+			prev = int64(n)
+		}
+	}
+
+	out.Histogram = hist
+	return nil
+}
+
+// nativeIndex returns the index of the native bucket with the upper bound.
+func nativeIndex(bound time.Duration) int {
+	return int(math.Round(math.Log2(bound.Seconds()) * (1 << nativeSchema)))
+}
@@ -0,0 +1,123 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"log/slog"
+	"math"
+	"time"
+)
+
+// rateRamp holds the warm-up ramp set by SetRateLimitRamp.
+type rateRamp struct {
+	target      float64
+	over        time.Duration
+	floor       float64
+	exponential bool
+	start       time.Time
+	// Set while the effective rate limit is increasing toward the target
+	active bool
+}
+
+// RampOption configures the warm-up ramp set by SetRateLimitRamp.
+type RampOption func(*rateRamp)
+
+// WithRampFloor sets the number of calls per second permitted when the ramp begins. The default
+// floor is one call per second, or the target when it is lower.
+func WithRampFloor(floor float64) RampOption {
+	return func(r *rateRamp) {
+		r.floor = floor
+	}
+}
+
+// WithExponentialRamp increases the effective rate limit by the same factor over equal periods,
+// instead of by the same number of calls per second, so the ramp stays slow for longer.
+func WithExponentialRamp() RampOption {
+	return func(r *rateRamp) {
+		r.exponential = true
+	}
+}
+
+// SetRateLimitRamp sets the rate limit to target calls per second, reached by increasing the
+// effective rate limit from a floor over the duration, so an upstream is not hit at the full rate
+// from a cold start. The ramp begins each time the service is started, including restarts, and
+// right away when the service is running. EffectiveRateLimit reports the rate along the ramp, and
+// the Stats of the service record the time the ramp was completed. A later call to SetRateLimit
+// removes the ramp.
+func (bas *BaseService) SetRateLimitRamp(target int, over time.Duration, opts ...RampOption) {
+	bas.SetRateLimit(target)
+	if target <= 0 || over <= 0 {
+		return
+	}
+
+	r := rateRamp{
+		target: float64(target),
+		over:   over,
+		floor:  math.Min(1, float64(target)),
+	}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	r.floor = math.Max(math.Min(r.floor, r.target), math.SmallestNonzeroFloat64)
+
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	bas.ramp = r
+	if bas.running() {
+		bas.beginRamp()
+	}
+}
+
+// restartRamp begins the ramp again when the service is started.
+func (bas *BaseService) restartRamp() {
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	if bas.ramp.over > 0 {
+		bas.beginRamp()
+	}
+}
+
+// beginRamp starts the ramp at the floor. The rlock must be held.
+func (bas *BaseService) beginRamp() {
+	bas.ramp.start = bas.clock.Now()
+	bas.ramp.active = true
+	bas.stats.rampDone.Store(0)
+	bas.log(slog.LevelInfo, "rate limit ramp started", nil,
+		slog.Float64("target", bas.ramp.target), slog.Duration("over", bas.ramp.over))
+	bas.checkRamp()
+}
+
+// checkRamp applies the effective rate limit along the ramp. The rlock must be held.
+func (bas *BaseService) checkRamp() {
+	r := &bas.ramp
+	if !r.active {
+		return
+	}
+
+	now := bas.clock.Now()
+	frac := float64(now.Sub(r.start)) / float64(r.over)
+	rate := r.target
+	switch {
+	case frac >= 1:
+		r.active = false
+		bas.stats.rampDone.Store(now.UnixNano())
+		bas.log(slog.LevelInfo, "rate limit ramp completed", nil, slog.Float64("rate", rate))
+	case r.exponential:
+		rate = r.floor * math.Pow(r.target/r.floor, frac)
+	default:
+		rate = r.floor + (r.target-r.floor)*frac
+	}
+
+	bas.setCeiling(r.target)
+	bas.rctl.effective = rate
+	bas.rctl.successes = 0
+	if p, ok := bas.rlimit.(*pacer); ok {
+		p.setRate(rate)
+		return
+	}
+	bas.rlimit = bas.newLimiter(rate, bas.rctl.slack)
+}
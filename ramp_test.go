@@ -0,0 +1,74 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func expectRate(t *testing.T, srv Service, want float64) {
+	t.Helper()
+
+	es := srv.(interface{ EffectiveRateLimit() float64 })
+	if rate := es.EffectiveRateLimit(); math.Abs(rate-want) > 0.01 {
+		t.Errorf("Expected the effective rate limit of %v, received %v", want, rate)
+	}
+}
+
+func TestRateLimitRamp(t *testing.T) {
+	clock := newFakeClock()
+	srv := newEchoService("Ramp", WithClock(clock))
+	srv.SetRateLimitRamp(100, 10*time.Second)
+	// The ramp begins when the service is started
+	expectRate(t, srv, 100)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	expectRate(t, srv, 1)
+	clock.Advance(2500 * time.Millisecond)
+	expectRate(t, srv, 25.75)
+	clock.Advance(2500 * time.Millisecond)
+	expectRate(t, srv, 50.5)
+	if done := srv.Stats().RampCompleted; !done.IsZero() {
+		t.Errorf("Expected the ramp to be in progress, received the completion time %v", done)
+	}
+
+	clock.Advance(5 * time.Second)
+	expectRate(t, srv, 100)
+	if done := srv.Stats().RampCompleted; !done.Equal(clock.Now()) {
+		t.Errorf("Expected the ramp to be completed at %v, received %v", clock.Now(), done)
+	}
+
+	// The ramp begins again after a restart
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("Failed to restart the service: %v", err)
+	}
+	expectRate(t, srv, 1)
+	if done := srv.Stats().RampCompleted; !done.IsZero() {
+		t.Errorf("Expected the restart to begin the ramp again, received the completion time %v", done)
+	}
+}
+
+func TestRateLimitRampExponential(t *testing.T) {
+	clock := newFakeClock()
+	srv := newEchoService("Ramp", WithClock(clock))
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.SetRateLimitRamp(100, 10*time.Second, WithExponentialRamp(), WithRampFloor(4))
+	expectRate(t, srv, 4)
+	clock.Advance(5 * time.Second)
+	expectRate(t, srv, 20)
+	clock.Advance(10 * time.Second)
+	expectRate(t, srv, 100)
+
+	// An explicit rate limit removes the ramp
+	srv.SetRateLimitRamp(100, 10*time.Second)
+	srv.SetRateLimit(50)
+	expectRate(t, srv, 50)
+}
@@ -0,0 +1,245 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// Limiter paces the calls made by a service. The Wait method blocks until the next call is permitted,
+// or returns an error when the context is done first. The *rate.Limiter type from the
+// golang.org/x/time/rate package satisfies this interface.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// TryLimiter is a Limiter that can report whether a call is permitted without blocking.
+// The *rate.Limiter type from the golang.org/x/time/rate package satisfies this interface.
+type TryLimiter interface {
+	Limiter
+	Allow() bool
+}
+
+// MaxRateLimit is the largest number of calls per second permitted by the rate limit, which paces
+// the calls one nanosecond apart. Larger rates are clamped to it.
+const MaxRateLimit = 1_000_000_000
+
+type rateLimitConfig struct {
+	slack int
+	per   time.Duration
+}
+
+// RateLimitOption configures the rate limit set by SetRateLimitWithOptions.
+type RateLimitOption func(*rateLimitConfig)
+
+// WithSlack permits up to slack unused calls to accumulate while the service is idle,
+// so they can be spent in a burst. The rate limit has no slack by default.
+func WithSlack(slack int) RateLimitOption {
+	return func(cfg *rateLimitConfig) {
+		cfg.slack = slack
+	}
+}
+
+// WithPer sets the period that the number of permitted calls applies to. The default period is one second.
+func WithPer(per time.Duration) RateLimitOption {
+	return func(cfg *rateLimitConfig) {
+		cfg.per = per
+	}
+}
+
+// SetRateLimit implements the Service interface.
+func (bas *BaseService) SetRateLimit(persec int) {
+	bas.SetRateLimitWithOptions(persec)
+}
+
+// SetRateLimitWithOptions sets the number of calls permitted each second, or during the period
+// provided by the WithPer option. A value of zero removes the rate limit. The invalid values
+// rejected by SetRateLimitErr are logged, and the rate limit is not changed.
+func (bas *BaseService) SetRateLimitWithOptions(persec int, opts ...RateLimitOption) {
+	if err := bas.SetRateLimitErr(persec, opts...); err != nil {
+		bas.log(slog.LevelWarn, "rate limit was not changed", err, slog.Int("rate", persec))
+	}
+}
+
+// SetRateLimitErr is like SetRateLimitWithOptions, but returns ErrInvalidRateLimit for a negative
+// number of calls, period or slack, without changing the rate limit. Rates above MaxRateLimit
+// calls per second are clamped to it, and a warning is logged.
+func (bas *BaseService) SetRateLimitErr(persec int, opts ...RateLimitOption) error {
+	cfg := rateLimitConfig{per: time.Second}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if persec < 0 || cfg.per < 0 || cfg.slack < 0 {
+		return fmt.Errorf("%s: %w", bas.name, ErrInvalidRateLimit)
+	}
+
+	var rate float64
+	if persec > 0 && cfg.per > 0 {
+		rate = float64(persec) / cfg.per.Seconds()
+	}
+	if rate > MaxRateLimit {
+		bas.log(slog.LevelWarn, "rate limit clamped", nil, slog.Float64("rate", rate), slog.Int("max", MaxRateLimit))
+		rate = MaxRateLimit
+	}
+
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	bas.overrideSchedule()
+	bas.ramp = rateRamp{}
+	bas.setCeiling(rate)
+	bas.rctl.effective = rate
+	bas.rctl.slack = cfg.slack
+	bas.rctl.successes = 0
+	bas.rlimit = bas.newLimiter(rate, cfg.slack)
+	bas.log(slog.LevelInfo, "rate limit changed", nil, slog.Float64("rate", rate))
+	return nil
+}
+
+// RateLimit returns the number of calls permitted each second by the rate limit set for the
+// service, rounded to a whole call, or zero when there is no rate limit or a Limiter was provided
+// by SetRateLimiter. EffectiveRateLimit reports the rate permitted at the moment, which includes
+// the adjustments made at runtime.
+func (bas *BaseService) RateLimit() int {
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	bas.checkSchedule()
+	return rateLimitInt(bas.rctl.ceiling)
+}
+
+// OnRateLimitChange registers a function that is called each time the rate limit reported by
+// RateLimit changes, including the changes made by the schedule set by SetRateLimitSchedule. The
+// functions are called synchronously in the order they were registered, without holding a lock.
+func (bas *BaseService) OnRateLimitChange(fn func(srv Service, old, new int)) {
+	bas.rlock.Lock()
+	defer bas.rlock.Unlock()
+
+	bas.rctl.fns = append(bas.rctl.fns, fn)
+}
+
+// setCeiling sets the configured rate limit, and records the change for the functions registered
+// by OnRateLimitChange. The rlock must be held.
+func (bas *BaseService) setCeiling(rate float64) {
+	old, new := rateLimitInt(bas.rctl.ceiling), rateLimitInt(rate)
+
+	bas.rctl.ceiling = rate
+	if old != new {
+		bas.rctl.changes = append(bas.rctl.changes, [2]int{old, new})
+	}
+}
+
+// unlockRate releases the rlock, and then calls the functions registered by OnRateLimitChange for
+// the changes recorded while it was held.
+func (bas *BaseService) unlockRate() {
+	changes, fns := bas.rctl.changes, bas.rctl.fns
+	bas.rctl.changes = nil
+	bas.publishLimiter()
+	bas.rlock.Unlock()
+
+	for _, c := range changes {
+		for _, fn := range fns {
+			fn(bas.service, c[0], c[1])
+		}
+	}
+}
+
+func rateLimitInt(rate float64) int {
+	if rate <= 0 {
+		return 0
+	}
+	return max(int(math.Round(rate)), 1)
+}
+
+// SetRateLimiter replaces the rate limiter used by the service. A nil Limiter removes the rate limit.
+func (bas *BaseService) SetRateLimiter(l Limiter) {
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	bas.overrideSchedule()
+	bas.ramp = rateRamp{}
+	bas.setCeiling(0)
+	bas.rctl.effective = 0
+	bas.rlimit = l
+	bas.log(slog.LevelInfo, "rate limiter replaced", nil)
+}
+
+// newLimiter returns the default limiter permitting rate calls each second, or nil when rate is zero.
+func (bas *BaseService) newLimiter(rate float64, slack int) Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return newPacer(rate, slack, bas.clock)
+}
+
+// SetRateLimitDuration permits one call during each interval, which supports rates slower than
+// one call per second. A zero or negative interval removes the rate limit.
+func (bas *BaseService) SetRateLimitDuration(interval time.Duration) {
+	if interval <= 0 {
+		bas.SetRateLimit(0)
+		return
+	}
+	bas.SetRateLimitWithOptions(1, WithPer(interval))
+}
+
+// CheckRateLimit implements the Service interface.
+func (bas *BaseService) CheckRateLimit() {
+	_ = bas.CheckRateLimitErr()
+}
+
+// CheckRateLimitErr blocks until the minimum wait duration since the last call, but returns
+// ErrServiceStopped without waiting the full duration when the service is stopped.
+func (bas *BaseService) CheckRateLimitErr() error {
+	rlimit := bas.limiter()
+
+	return bas.take(rlimit)
+}
+
+// TryCheckRateLimit returns true when a call is permitted by the rate limit without waiting, and false
+// otherwise. It never blocks, and always returns false when the service has been stopped or when the
+// Limiter provided by SetRateLimiter does not implement the TryLimiter interface.
+func (bas *BaseService) TryCheckRateLimit() bool {
+	if bas.Context().Err() != nil {
+		return false
+	}
+
+	rlimit := bas.limiter()
+
+	if rlimit == nil {
+		return true
+	}
+	if tl, ok := rlimit.(TryLimiter); ok {
+		return tl.Allow()
+	}
+	return false
+}
+
+func (bas *BaseService) take(rlimit Limiter) error {
+	return bas.takeN(rlimit, 1)
+}
+
+// takeN waits until the limiter permits n units, using WaitN when the limiter supports it.
+func (bas *BaseService) takeN(rlimit Limiter, n int) error {
+	ctx := bas.Context()
+	if ctx.Err() == nil && rlimit != nil && n > 0 {
+		start := bas.clock.Now()
+		err := waitN(ctx, rlimit, n)
+
+		bas.countWait(bas.since(start))
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return fmt.Errorf("%s: %w", bas.name, err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	}
+	return nil
+}
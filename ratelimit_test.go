@@ -0,0 +1,432 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// advanceCheck calls CheckRateLimit, which must wait for the duration on the clock, and
+// advances the clock to release it. The service must not be running a handler checking the
+// rate limit concurrently.
+func advanceCheck(t *testing.T, srv *testService, clock *fakeClock, d time.Duration) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		srv.CheckRateLimit()
+		close(done)
+	}()
+
+	clock.waitTimers(t, 1)
+	clock.Advance(d - time.Nanosecond)
+	select {
+	case <-done:
+		t.Fatalf("The rate limit permitted the call before %v elapsed", d)
+	default:
+	}
+
+	clock.Advance(time.Nanosecond)
+	<-done
+}
+
+func TestRateLimit(t *testing.T) {
+	clock := newFakeClock()
+	srv := newTestService(WithClock(clock))
+	srv.SetRateLimit(2)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "1"
+	<-srv.Output()
+	for _, str := range []string{"2", "3", "4"} {
+		// The handler waits on the rate limiter before receiving the request
+		clock.waitTimers(t, 1)
+		clock.Advance(500*time.Millisecond - time.Nanosecond)
+		select {
+		case srv.Input() <- str:
+			t.Fatalf("The rate limit was not enforced between requests")
+		default:
+		}
+
+		clock.Advance(time.Nanosecond)
+		srv.Input() <- str
+		<-srv.Output()
+	}
+}
+
+func TestCheckRateLimitStop(t *testing.T) {
+	srv := newTestService()
+	srv.SetRateLimit(1)
+	_ = srv.Start()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- srv.CheckRateLimitErr()
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	_ = srv.Stop()
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("The goroutines waiting on the rate limiter did not return after the service was stopped")
+	}
+
+	close(errs)
+	var stopped int
+	for err := range errs {
+		if errors.Is(err, ErrServiceStopped) {
+			stopped++
+		}
+	}
+	if stopped == 0 {
+		t.Errorf("Expected the waiting goroutines to receive ErrServiceStopped")
+	}
+}
+
+type testService struct {
+	BaseService
+}
+
+func TestRateLimitSlack(t *testing.T) {
+	clock := newFakeClock()
+	srv := newTestService(WithClock(clock))
+	srv.SetRateLimitWithOptions(10, WithSlack(5))
+
+	srv.CheckRateLimit()
+	// Allow the unused calls to accumulate
+	clock.Advance(time.Second)
+
+	var permitted int
+	for i := 0; i < 10; i++ {
+		if srv.TryCheckRateLimit() {
+			permitted++
+		}
+	}
+	// The call permitted now is available in addition to the slack
+	if permitted != 6 {
+		t.Errorf("Expected a burst of six calls after the idle period, but %d were permitted", permitted)
+	}
+	advanceCheck(t, srv, clock, 100*time.Millisecond)
+}
+
+func TestRateLimitPer(t *testing.T) {
+	clock := newFakeClock()
+	srv := newTestService(WithClock(clock))
+	srv.SetRateLimitWithOptions(2, WithPer(200*time.Millisecond))
+
+	srv.CheckRateLimit()
+	advanceCheck(t, srv, clock, 100*time.Millisecond)
+	advanceCheck(t, srv, clock, 100*time.Millisecond)
+}
+
+func TestRateLimitDuration(t *testing.T) {
+	clock := newFakeClock()
+	srv := newTestService(WithClock(clock))
+	srv.SetRateLimitDuration(2 * time.Second)
+
+	srv.CheckRateLimit()
+	advanceCheck(t, srv, clock, 2*time.Second)
+
+	srv.SetRateLimitDuration(0)
+	for i := 0; i < 3; i++ {
+		if !srv.TryCheckRateLimit() {
+			t.Errorf("The rate limit was not removed by a zero interval")
+		}
+	}
+}
+
+func TestSetRateLimiter(t *testing.T) {
+	lim := &fakeLimiter{tokens: make(chan struct{})}
+	srv := newTestService()
+	srv.SetRateLimiter(lim)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	go func() { srv.Input() <- "request" }()
+	select {
+	case <-srv.Output():
+		t.Fatalf("The request was handled before the limiter released a token")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	lim.tokens <- struct{}{}
+	if result := <-srv.Output(); result != "request" {
+		t.Errorf("Expected request to be returned and received %v", result)
+	}
+
+	srv.SetRateLimiter(nil)
+	// Release the handler blocked on the replaced limiter
+	lim.tokens <- struct{}{}
+	for _, str := range []string{"a", "b", "c"} {
+		srv.Input() <- str
+		if result := <-srv.Output(); result != str {
+			t.Errorf("Expected %s to be returned and received %v", str, result)
+		}
+	}
+}
+
+func TestRateLimiterError(t *testing.T) {
+	srv := newTestService()
+	srv.SetRateLimiter(&failingLimiter{})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if err := srv.CheckRateLimitErr(); !errors.Is(err, errLimiterFailed) {
+		t.Errorf("Expected the limiter error to be returned, received %v", err)
+	}
+}
+
+// fakeLimiter permits one call for each token sent on the channel.
+type fakeLimiter struct {
+	tokens chan struct{}
+}
+
+func (l *fakeLimiter) Wait(ctx context.Context) error {
+	select {
+	case <-l.tokens:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var errLimiterFailed = errors.New("limiter failed")
+
+type failingLimiter struct{}
+
+func (l *failingLimiter) Wait(ctx context.Context) error {
+	return errLimiterFailed
+}
+
+func TestTryCheckRateLimit(t *testing.T) {
+	clock := newFakeClock()
+	srv := newTestService(WithClock(clock))
+	if !srv.TryCheckRateLimit() {
+		t.Errorf("TryCheckRateLimit returned false without a rate limit")
+	}
+
+	srv.SetRateLimit(5)
+	var permitted int
+	for i := 0; i < 100; i++ {
+		if srv.TryCheckRateLimit() {
+			permitted++
+		}
+	}
+	if permitted != 1 {
+		t.Errorf("Expected one call to be permitted, but %d were permitted", permitted)
+	}
+
+	clock.Advance(200 * time.Millisecond)
+	if !srv.TryCheckRateLimit() {
+		t.Errorf("TryCheckRateLimit returned false after the interval elapsed")
+	}
+
+	srv.SetRateLimiter(&fakeLimiter{})
+	if srv.TryCheckRateLimit() {
+		t.Errorf("TryCheckRateLimit returned true for a Limiter that does not implement TryLimiter")
+	}
+}
+
+func TestTryCheckRateLimitConcurrent(t *testing.T) {
+	clock := newFakeClock()
+	srv := newTestService(WithClock(clock))
+	srv.SetRateLimit(5)
+	srv.CheckRateLimit()
+
+	// The waiting caller reserves the next call permitted by the rate limit
+	finished := make(chan struct{})
+	go func() {
+		srv.CheckRateLimit()
+		close(finished)
+	}()
+	clock.waitTimers(t, 1)
+	clock.Advance(100 * time.Millisecond)
+
+	if srv.TryCheckRateLimit() {
+		t.Errorf("TryCheckRateLimit took the call reserved by the waiting caller")
+	}
+	clock.Advance(100 * time.Millisecond)
+	<-finished
+	if srv.TryCheckRateLimit() {
+		t.Errorf("TryCheckRateLimit returned true before the next interval elapsed")
+	}
+
+	_ = srv.Start()
+	_ = srv.Stop()
+	clock.Advance(time.Second)
+	if srv.TryCheckRateLimit() {
+		t.Errorf("TryCheckRateLimit returned true after the service was stopped")
+	}
+}
+
+func TestRateLimitGetter(t *testing.T) {
+	srv := newTestService()
+	if n := srv.RateLimit(); n != 0 {
+		t.Errorf("Expected no rate limit, received %d", n)
+	}
+
+	type change struct{ old, new int }
+	var changes []change
+	srv.OnRateLimitChange(func(s Service, old, new int) {
+		if s != Service(srv) {
+			t.Errorf("Expected the service to be provided to the callback")
+		}
+		changes = append(changes, change{old, new})
+	})
+
+	srv.SetRateLimit(10)
+	srv.SetRateLimit(10)
+	srv.SetRateLimitWithOptions(2, WithPer(100*time.Millisecond))
+	if n := srv.RateLimit(); n != 20 {
+		t.Errorf("Expected the rate limit of 20, received %d", n)
+	}
+	srv.SetRateLimiter(&fakeLimiter{})
+	if n := srv.RateLimit(); n != 0 {
+		t.Errorf("Expected no rate limit with a Limiter, received %d", n)
+	}
+
+	want := []change{{0, 10}, {10, 20}, {20, 0}}
+	if len(changes) != len(want) {
+		t.Fatalf("Expected the changes %v, received %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("Expected the changes %v, received %v", want, changes)
+		}
+	}
+}
+
+func TestRateLimitGetterRace(t *testing.T) {
+	srv := newTestService()
+
+	var mu sync.Mutex
+	var last int
+	srv.OnRateLimitChange(func(_ Service, _, new int) {
+		mu.Lock()
+		last = new
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 8; i++ {
+		wg.Add(2)
+		go func(rate int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				srv.SetRateLimit(rate)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if n := srv.RateLimit(); n < 0 || n > 8 {
+					t.Errorf("Expected a rate limit set by the writers, received %d", n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if last == 0 {
+		t.Errorf("Expected the changes to be provided to the callback")
+	}
+}
+
+func TestSetRateLimitErr(t *testing.T) {
+	tests := []struct {
+		name    string
+		persec  int
+		opts    []RateLimitOption
+		wantErr bool
+		want    int
+	}{
+		{name: "negative", persec: -5, wantErr: true, want: 7},
+		{name: "negative period", persec: 5, opts: []RateLimitOption{WithPer(-time.Second)}, wantErr: true, want: 7},
+		{name: "negative slack", persec: 5, opts: []RateLimitOption{WithSlack(-1)}, wantErr: true, want: 7},
+		{name: "zero", persec: 0, want: 0},
+		{name: "one", persec: 1, want: 1},
+		{name: "maximum", persec: MaxRateLimit, want: MaxRateLimit},
+		{name: "above the maximum", persec: MaxRateLimit + 1, want: MaxRateLimit},
+		{name: "above the maximum per period", persec: MaxRateLimit, opts: []RateLimitOption{WithPer(time.Millisecond)}, want: MaxRateLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestService()
+			srv.SetRateLimit(7)
+
+			err := srv.SetRateLimitErr(tt.persec, tt.opts...)
+			if tt.wantErr != errors.Is(err, ErrInvalidRateLimit) {
+				t.Errorf("Expected the error %v, received %v", tt.wantErr, err)
+			}
+			if n := srv.RateLimit(); n != tt.want {
+				t.Errorf("Expected the rate limit of %d, received %d", tt.want, n)
+			}
+		})
+	}
+}
+
+func TestSetRateLimitInvalid(t *testing.T) {
+	h := new(recordHandler)
+	srv := newTestService()
+	srv.SetLogger(slog.New(h))
+
+	srv.SetRateLimit(3)
+	srv.SetRateLimit(-1)
+	if n := srv.RateLimit(); n != 3 {
+		t.Errorf("Expected the negative value to be ignored, received the rate limit %d", n)
+	}
+	if _, ok := h.find("rate limit was not changed"); !ok {
+		t.Errorf("Expected the negative value to be logged")
+	}
+
+	srv.SetRateLimit(2 * MaxRateLimit)
+	if _, ok := h.find("rate limit clamped"); !ok {
+		t.Errorf("Expected the clamped value to be logged")
+	}
+	if !srv.TryCheckRateLimit() {
+		t.Errorf("Expected the clamped rate limit to permit a call")
+	}
+}
+
+type nopLimiter struct{}
+
+func (nopLimiter) Wait(context.Context) error { return nil }
+
+func BenchmarkCheckRateLimitParallel(b *testing.B) {
+	srv := newTestService()
+	srv.SetRateLimiter(nopLimiter{})
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = srv.CheckRateLimitErr()
+		}
+	})
+}
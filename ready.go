@@ -0,0 +1,81 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// readiness is closed once the loops started by OnStart are running.
+type readiness struct {
+	sync.Mutex
+	ch     chan struct{}
+	closed bool
+	// The error returned by OnStart when the service failed to start
+	err error
+}
+
+// Ready marks the service as ready, once the goroutines started by OnStart are running, which
+// releases the callers of WaitStarted. The Run, RunContext and RunBatch methods call Ready once
+// their workers are started, as do the services of this package, so the services using them do
+// not need to. Ready has no effect when the service is not running.
+func (bas *BaseService) Ready() {
+	if !bas.running() {
+		return
+	}
+
+	r := &bas.ready
+	r.Lock()
+	defer r.Unlock()
+
+	if !r.closed {
+		close(r.ch)
+		r.closed = true
+		bas.log(slog.LevelDebug, "service ready", nil)
+	}
+}
+
+// WaitStarted blocks until the service is marked ready by Ready, and returns nil. The error
+// returned by OnStart is returned when the service fails to start, ErrServiceStopped when the
+// service is stopped first, and the context error when the context is done first.
+func (bas *BaseService) WaitStarted(ctx context.Context) error {
+	r := &bas.ready
+	r.Lock()
+	ch := r.ch
+	r.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-bas.Done():
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+}
+
+// resetReady prepares the readiness of the next run, and records the error of the run that failed
+// to start.
+func (bas *BaseService) resetReady(err error) {
+	r := &bas.ready
+	r.Lock()
+	defer r.Unlock()
+
+	if r.closed {
+		r.ch = make(chan struct{})
+		r.closed = false
+	}
+	r.err = err
+}
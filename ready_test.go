@@ -0,0 +1,126 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWaitStarted(t *testing.T) {
+	srv := newEchoService("Ready")
+
+	// The callers waiting before the start are released once the workers are running
+	errs := make(chan error, 1)
+	go func() { errs <- srv.WaitStarted(context.Background()) }()
+
+	_ = srv.Start()
+	if err := <-errs; err != nil {
+		t.Fatalf("Expected the service to be ready, received %v", err)
+	}
+	srv.Input() <- "ready"
+	if result := <-srv.Output(); result != "ready" {
+		t.Errorf("Expected the request to be processed, received %v", result)
+	}
+
+	_ = srv.Stop()
+	if err := srv.WaitStarted(context.Background()); !errors.Is(err, ErrServiceStopped) {
+		t.Errorf("Expected ErrServiceStopped after the stop, received %v", err)
+	}
+
+	// The readiness is marked again for each run
+	_ = srv.Restart()
+	defer func() { _ = srv.Stop() }()
+	if err := srv.WaitStarted(context.Background()); err != nil {
+		t.Errorf("Expected the restarted service to be ready, received %v", err)
+	}
+}
+
+func TestWaitStartedFailure(t *testing.T) {
+	srv := new(flakyStartService)
+	srv.Init(srv, "Flaky")
+
+	_ = srv.Start()
+	if err := srv.WaitStarted(context.Background()); !errors.Is(err, errStartFailed) {
+		t.Errorf("Expected the OnStart error, received %v", err)
+	}
+
+	// The service does not call Ready, so the context ends the wait
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := srv.WaitStarted(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context error, received %v", err)
+	}
+}
+
+func TestWaitStartedPool(t *testing.T) {
+	ps := NewPoolService("Pool", 4, func(req interface{}) (interface{}, error) {
+		return req, nil
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- ps.WaitStarted(context.Background()) }()
+
+	_ = ps.Start()
+	defer func() { _ = ps.Stop() }()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("Expected the pool to be ready, received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The pool was not marked ready once its workers were started")
+	}
+}
+
+func TestWaitStartedBatch(t *testing.T) {
+	srv := newBatchService(2, time.Hour)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.WaitStarted(ctx); err != nil {
+		t.Fatalf("Expected RunBatch to mark the service ready, received %v", err)
+	}
+	srv.Input() <- "a"
+	srv.Input() <- "b"
+	if batch := srv.nextBatch(t); len(batch) != 2 {
+		t.Errorf("Expected a batch of 2 requests and received %v", batch)
+	}
+}
+
+func TestWaitStartedServices(t *testing.T) {
+	// The reader stays open, so the ReaderService does not stop itself
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	for _, srv := range []Service{
+		NewScheduler("Scheduler", time.Hour, func() interface{} { return nil }),
+		NewDebounce("Debounce", time.Second, firstLetter),
+		NewChaos(newEchoService("Echo")),
+		NewFanIn("FanIn", newEchoService("Source")),
+		NewPipeline("Pipeline", newEchoService("First"), newEchoService("Second")),
+		NewReaderService("Reader", pr, TextCodec()),
+		NewWriterService("Writer", io.Discard, TextCodec()),
+		NewRecorder(newEchoService("Recorded"), io.Discard, JSONCodec[string]()),
+		NewSupervisor("Supervisor"),
+	} {
+		_ = srv.Start()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := srv.(startWaiter).WaitStarted(ctx); err != nil {
+			t.Errorf("Expected %s to be marked ready, received %v", srv, err)
+		}
+		cancel()
+		_ = srv.Stop()
+	}
+}
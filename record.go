@@ -0,0 +1,293 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Direction identifies whether a recorded message was received or sent by a service.
+type Direction string
+
+// The directions of the recorded messages.
+const (
+	DirectionInput  Direction = "in"
+	DirectionOutput Direction = "out"
+)
+
+// Record is a message recorded by a Recorder. The recording is a stream of records encoded as
+// JSON, one per line, so it can be read while it is written and replayed up to a truncation.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Direction Direction `json:"dir"`
+	// The payload encoded by the codec of the Recorder
+	Payload []byte `json:"payload"`
+}
+
+// Recorder is a service that forwards the messages on its Input channel to the inner service,
+// and sends the results of the inner service on its Output channel, while writing each message
+// to the recording. The replies to Request are provided by the inner service, and the inner
+// service is started and stopped with the Recorder.
+type Recorder struct {
+	BaseService
+	inner Service
+	codec Codec
+	wlock sync.Mutex
+	enc   *json.Encoder
+	wg    sync.WaitGroup
+}
+
+// NewRecorder returns a Recorder writing the traffic of the inner service to w, with the payloads
+// encoded by the codec.
+func NewRecorder(inner Service, w io.Writer, codec Codec) *Recorder {
+	r := &Recorder{
+		inner: inner,
+		codec: codec,
+		enc:   json.NewEncoder(w),
+	}
+
+	r.Init(r, "Recorder("+inner.String()+")")
+	return r
+}
+
+// Inner returns the service whose traffic is recorded.
+func (r *Recorder) Inner() Service {
+	return r.inner
+}
+
+// OnStart implements the Service interface.
+func (r *Recorder) OnStart() error {
+	if err := r.inner.Start(); err != nil && !errors.Is(err, ErrAlreadyStarted) {
+		return err
+	}
+
+	ctx := r.Context()
+	r.wg.Add(2)
+	r.RunLabeled(ctx, "forward", r.forward)
+	r.RunLabeled(ctx, "results", r.results)
+	r.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (r *Recorder) OnStop() error {
+	r.wg.Wait()
+
+	if err := r.inner.Stop(); err != nil && !errors.Is(err, ErrAlreadyStopped) {
+		return err
+	}
+	return nil
+}
+
+func (r *Recorder) forward(ctx context.Context) {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-r.Input():
+			r.MarkBusy()
+			r.IncReceived()
+			r.record(DirectionInput, req)
+			if err := sendTo(ctx, r.inner, req); err != nil {
+				r.ReportDeadLetter(req, DeadLetterCanceled, err)
+			}
+			r.MarkIdle()
+		}
+	}
+}
+
+func (r *Recorder) results(ctx context.Context) {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.inner.Done():
+			return
+		case msg := <-r.inner.Output():
+			r.record(DirectionOutput, msg)
+			r.emit(ctx, msg)
+		}
+	}
+}
+
+// record writes the payload of the message to the recording. The messages that cannot be
+// encoded or written are not recorded, and the error is reported.
+func (r *Recorder) record(dir Direction, msg interface{}) {
+	data, err := r.codec.Marshal(Unwrap(msg))
+	if err != nil {
+		r.ReportError(fmt.Errorf("%s: %w", r, err))
+		return
+	}
+
+	r.wlock.Lock()
+	defer r.wlock.Unlock()
+
+	rec := Record{
+		Time:      r.clock.Now(),
+		Direction: dir,
+		Payload:   data,
+	}
+	if err := r.enc.Encode(&rec); err != nil {
+		r.ReportError(fmt.Errorf("%s: %w", r, err))
+	}
+}
+
+// ReplayerOption configures a Replayer during construction.
+type ReplayerOption func(*Replayer)
+
+// WithReplayCodec sets the codec decoding the recorded payloads. Without a codec, the payloads
+// are sent as the []byte values written by the codec of the Recorder.
+func WithReplayCodec(c Codec) ReplayerOption {
+	return func(r *Replayer) {
+		r.codec = c
+	}
+}
+
+// WithReplayInputs makes the Replayer send the recorded inputs instead of the recorded outputs,
+// so the traffic can be driven again into another service, such as a new build of the service.
+func WithReplayInputs() ReplayerOption {
+	return func(r *Replayer) {
+		r.dir = DirectionInput
+	}
+}
+
+// WithReplaySpeed scales the pacing of the replay. A speed of one keeps the original intervals
+// between the messages, a speed of ten replays them ten times faster, and a speed that is not
+// positive sends the messages without waiting. The original pacing is used by default.
+func WithReplaySpeed(speed float64) ReplayerOption {
+	return func(r *Replayer) {
+		r.speed = speed
+	}
+}
+
+// Replayer is a service that sends the messages of a recording written by a Recorder on its
+// Output channel, paced like they were recorded. A truncated or corrupted recording is replayed
+// up to the last complete record, and the truncation is reported as ErrInvalidRecording.
+type Replayer struct {
+	BaseService
+	src      *bufio.Reader
+	codec    Codec
+	dir      Direction
+	speed    float64
+	finished chan struct{}
+}
+
+// NewReplayer returns a Replayer reading the recording from src.
+func NewReplayer(name string, src io.Reader, opts ...ReplayerOption) *Replayer {
+	r := &Replayer{
+		src:      bufio.NewReader(src),
+		dir:      DirectionOutput,
+		speed:    1,
+		finished: make(chan struct{}),
+	}
+	r.Init(r, name)
+
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Finished returns a channel that is closed once the recording has been replayed.
+func (r *Replayer) Finished() <-chan struct{} {
+	return r.finished
+}
+
+// OnStart implements the Service interface.
+func (r *Replayer) OnStart() error {
+	r.RunLabeled(r.Context(), "replay", r.replay)
+	r.Ready()
+	return nil
+}
+
+func (r *Replayer) replay(ctx context.Context) {
+	defer close(r.finished)
+
+	var last time.Time
+	for {
+		rec, err := r.next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				r.ReportError(fmt.Errorf("%s: %w: %v", r, ErrInvalidRecording, err))
+			}
+			return
+		}
+		if rec.Direction != r.dir {
+			continue
+		}
+
+		if !last.IsZero() && r.speed > 0 {
+			wait := time.Duration(float64(rec.Time.Sub(last)) / r.speed)
+			if !r.sleep(ctx, wait) {
+				return
+			}
+		}
+		last = rec.Time
+
+		msg, err := r.decode(rec.Payload)
+		if err != nil {
+			r.ReportError(fmt.Errorf("%s: %w", r, err))
+			continue
+		}
+		r.emit(ctx, msg)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// next reads the next complete record, and returns io.EOF at the end of the recording.
+func (r *Replayer) next() (*Record, error) {
+	line, err := r.src.ReadBytes('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			// The last record was not written completely
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	var rec Record
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (r *Replayer) decode(data []byte) (interface{}, error) {
+	if r.codec == nil {
+		return data, nil
+	}
+	return r.codec.Unmarshal(data)
+}
+
+// sleep waits for the duration on the clock of the service, and returns false when the context
+// is done first.
+func (bas *BaseService) sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	t := bas.clock.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C():
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// record returns a recording of the requests sent to a service returning them in upper case.
+func record(t *testing.T, reqs ...string) []byte {
+	var buf bytes.Buffer
+	inner := NewSimpleService("Upper", func(req interface{}) (interface{}, error) {
+		return strings.ToUpper(req.(string)), nil
+	})
+	r := NewRecorder(inner, &buf, JSONCodec[string]())
+
+	_ = r.Start()
+	for _, req := range reqs {
+		r.Input() <- req
+		if result := <-r.Output(); result != strings.ToUpper(req) {
+			t.Errorf("Expected the result of the inner service and received %v", result)
+		}
+	}
+	_ = r.Stop()
+
+	if s := inner.State(); s != StateStopped {
+		t.Errorf("Expected the inner service to be stopped with the recorder, the state is %v", s)
+	}
+	return buf.Bytes()
+}
+
+func replayAll(t *testing.T, r *Replayer) []interface{} {
+	_ = r.Start()
+	defer func() { _ = r.Stop() }()
+
+	var msgs []interface{}
+	for {
+		select {
+		case msg := <-r.Output():
+			msgs = append(msgs, msg)
+		case <-r.Finished():
+			// The records replayed before the end remain buffered on the Output channel
+			for len(r.Output()) > 0 {
+				msgs = append(msgs, <-r.Output())
+			}
+			return msgs
+		case <-time.After(time.Second):
+			t.Fatalf("The replay did not finish")
+		}
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	data := record(t, "a", "b", "c")
+	if lines := bytes.Count(data, []byte("\n")); lines != 6 {
+		t.Fatalf("Expected six records and received %d:\n%s", lines, data)
+	}
+
+	outputs := replayAll(t, NewReplayer("Outputs", bytes.NewReader(data),
+		WithReplayCodec(JSONCodec[string]()), WithReplaySpeed(0)))
+	if len(outputs) != 3 || outputs[0] != "A" || outputs[2] != "C" {
+		t.Errorf("Expected the recorded outputs and received %v", outputs)
+	}
+
+	inputs := replayAll(t, NewReplayer("Inputs", bytes.NewReader(data),
+		WithReplayCodec(JSONCodec[string]()), WithReplayInputs(), WithReplaySpeed(0)))
+	if len(inputs) != 3 || inputs[0] != "a" || inputs[2] != "c" {
+		t.Errorf("Expected the recorded inputs and received %v", inputs)
+	}
+
+	raw := replayAll(t, NewReplayer("Raw", bytes.NewReader(data), WithReplaySpeed(0)))
+	if len(raw) != 3 || string(raw[0].([]byte)) != `"A"` {
+		t.Errorf("Expected the encoded payloads without a codec and received %v", raw)
+	}
+}
+
+func TestReplayTruncated(t *testing.T) {
+	data := record(t, "a", "b")
+	r := NewReplayer("Truncated", bytes.NewReader(data[:len(data)-10]),
+		WithReplayCodec(JSONCodec[string]()), WithReplaySpeed(0))
+
+	if outputs := replayAll(t, r); len(outputs) != 1 || outputs[0] != "A" {
+		t.Errorf("Expected the complete records to be replayed and received %v", outputs)
+	}
+	if err := <-r.Errors(); !errors.Is(err, ErrInvalidRecording) {
+		t.Errorf("Expected the truncation to be reported and received %v", err)
+	}
+}
+
+func TestReplayPacing(t *testing.T) {
+	start := time.Now()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i, payload := range []string{`"a"`, `"b"`} {
+		_ = enc.Encode(&Record{
+			Time:      start.Add(time.Duration(i) * time.Second),
+			Direction: DirectionOutput,
+			Payload:   []byte(payload),
+		})
+	}
+
+	clock := newFakeClock()
+	r := NewReplayer("Paced", &buf, WithReplayCodec(JSONCodec[string]()), WithReplaySpeed(4))
+	r.clock = clock
+
+	_ = r.Start()
+	defer func() { _ = r.Stop() }()
+
+	if msg := <-r.Output(); msg != "a" {
+		t.Errorf("Expected the first record and received %v", msg)
+	}
+	// The second record is replayed after the recorded interval divided by the speed
+	clock.waitTimers(t, 1)
+	clock.Advance(250*time.Millisecond - time.Nanosecond)
+	select {
+	case msg := <-r.Output():
+		t.Fatalf("The record %v was replayed before the interval elapsed", msg)
+	default:
+	}
+
+	clock.Advance(time.Nanosecond)
+	if msg := <-r.Output(); msg != "b" {
+		t.Errorf("Expected the second record and received %v", msg)
+	}
+}
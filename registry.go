@@ -0,0 +1,238 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type registration struct {
+	srv  Service
+	tags map[string]struct{}
+	deps []string
+}
+
+// RegisterOption configures a service registration.
+type RegisterOption func(*registration)
+
+// WithTags associates the tags with the registered service, so subsets of the services can be selected.
+func WithTags(tags ...string) RegisterOption {
+	return func(r *registration) {
+		for _, tag := range tags {
+			r.tags[tag] = struct{}{}
+		}
+	}
+}
+
+// WithDependencies declares that the service depends on the registered services with the provided
+// names, as returned by their String method, so StopAll and StopTagged stop the service before them.
+func WithDependencies(names ...string) RegisterOption {
+	return func(r *registration) {
+		r.deps = append(r.deps, names...)
+	}
+}
+
+// Registry is a concurrency-safe collection of services that can be found by name.
+type Registry struct {
+	sync.Mutex
+	entries    []*registration
+	byName     map[string]*registration
+	middleware []Middleware
+	// Called with each service when it is registered
+	hooks []func(Service)
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*registration)}
+}
+
+// Register adds the service to the registry using the name returned by its String method.
+// An error wrapping ErrDuplicateName is returned when the name is already registered.
+func (r *Registry) Register(srv Service, opts ...RegisterOption) error {
+	reg := &registration{
+		srv:  srv,
+		tags: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(reg)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	name := srv.String()
+	if _, found := r.byName[name]; found {
+		return fmt.Errorf("%s: %w", name, ErrDuplicateName)
+	}
+
+	r.entries = append(r.entries, reg)
+	r.byName[name] = reg
+	if len(r.middleware) > 0 {
+		inheritMiddleware(srv, r, r.middleware)
+	}
+	for _, hook := range r.hooks {
+		hook(srv)
+	}
+	return nil
+}
+
+// Deregister removes the named service from the registry and reports whether it was registered.
+func (r *Registry) Deregister(name string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	reg, found := r.byName[name]
+	if !found {
+		return false
+	}
+
+	delete(r.byName, name)
+	inheritMiddleware(reg.srv, r, nil)
+	for i, e := range r.entries {
+		if e == reg {
+			r.entries = append(r.entries[:i], r.entries[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Use adds middleware applied around the handlers of the registered services that support them,
+// such as those embedding BaseService, including the services registered later. The middleware
+// are removed from a service when it is deregistered.
+func (r *Registry) Use(mw ...Middleware) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.middleware = append(r.middleware[:len(r.middleware):len(r.middleware)], mw...)
+	for _, reg := range r.entries {
+		inheritMiddleware(reg.srv, r, r.middleware)
+	}
+}
+
+// addRegisterHook calls the hook with the registered services, and with each service registered later.
+func (r *Registry) addRegisterHook(hook func(Service)) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.hooks = append(r.hooks, hook)
+	for _, reg := range r.entries {
+		hook(reg.srv)
+	}
+}
+
+// Lookup returns the service registered with the provided name.
+func (r *Registry) Lookup(name string) (Service, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if reg, found := r.byName[name]; found {
+		return reg.srv, true
+	}
+	return nil, false
+}
+
+// List returns the registered services in the order they were registered.
+func (r *Registry) List() []Service {
+	r.Lock()
+	defer r.Unlock()
+
+	services := make([]Service, 0, len(r.entries))
+	for _, reg := range r.entries {
+		services = append(services, reg.srv)
+	}
+	return services
+}
+
+// Tagged returns the services registered with the tag, in the order they were registered.
+func (r *Registry) Tagged(tag string) []Service {
+	r.Lock()
+	defer r.Unlock()
+
+	var services []Service
+	for _, reg := range r.entries {
+		if _, found := reg.tags[tag]; found {
+			services = append(services, reg.srv)
+		}
+	}
+	return services
+}
+
+// Tags returns the sorted tags of the named service.
+func (r *Registry) Tags(name string) []string {
+	r.Lock()
+	defer r.Unlock()
+
+	reg, found := r.byName[name]
+	if !found {
+		return nil
+	}
+
+	tags := make([]string, 0, len(reg.tags))
+	for tag := range reg.tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// StopAll stops the registered services in the reverse order they were registered, and returns the
+// joined errors. The services are stopped before the services they depend on, as declared using
+// WithDependencies, unless the dependencies form a cycle. Services that were never started or were
+// already stopped are skipped.
+func (r *Registry) StopAll() error {
+	return stopReverse(r.stopOrder(func(*registration) bool { return true }))
+}
+
+// StopTagged stops the services registered with the tag in the reverse order they were registered,
+// honoring their dependencies on the other tagged services as StopAll does.
+func (r *Registry) StopTagged(tag string) error {
+	return stopReverse(r.stopOrder(func(reg *registration) bool {
+		_, found := reg.tags[tag]
+		return found
+	}))
+}
+
+// stopOrder returns the selected services in the order their dependencies are satisfied, or in the
+// order they were registered when the dependencies form a cycle. The dependencies on the services
+// that are not selected are ignored.
+func (r *Registry) stopOrder(selected func(*registration) bool) []Service {
+	r.Lock()
+	defer r.Unlock()
+
+	var services []Service
+	deps := make(map[Service][]string)
+	for _, reg := range r.entries {
+		if !selected(reg) {
+			continue
+		}
+
+		services = append(services, reg.srv)
+		if len(reg.deps) > 0 {
+			deps[reg.srv] = reg.deps
+		}
+	}
+
+	if order, err := dependencyOrder(services, deps, false); err == nil {
+		return order
+	}
+	return services
+}
+
+func stopReverse(services []Service) error {
+	var errs []error
+
+	for i := len(services) - 1; i >= 0; i-- {
+		if err := services[i].Stop(); err != nil &&
+			!errors.Is(err, ErrAlreadyStopped) && !errors.Is(err, ErrNotStarted) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,148 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	a, b := newTestService(), NewSimpleService("B", func(req interface{}) (interface{}, error) { return req, nil })
+
+	if err := r.Register(a); err != nil {
+		t.Fatalf("Failed to register the service: %v", err)
+	}
+	if err := r.Register(b, WithTags("dns", "passive")); err != nil {
+		t.Fatalf("Failed to register the service: %v", err)
+	}
+	if err := r.Register(newTestService()); !errors.Is(err, ErrDuplicateName) {
+		t.Errorf("Expected ErrDuplicateName when registering the name twice, received %v", err)
+	}
+
+	if srv, found := r.Lookup("B"); !found || srv != Service(b) {
+		t.Errorf("Failed to look up the registered service")
+	}
+	if _, found := r.Lookup("missing"); found {
+		t.Errorf("Found a service that was never registered")
+	}
+	if list := r.List(); len(list) != 2 || list[0] != Service(a) || list[1] != Service(b) {
+		t.Errorf("The services were not listed in registration order: %v", list)
+	}
+	if tags := r.Tags("B"); len(tags) != 2 || tags[0] != "dns" || tags[1] != "passive" {
+		t.Errorf("Expected the tags dns and passive, received %v", tags)
+	}
+	if tagged := r.Tagged("passive"); len(tagged) != 1 || tagged[0] != Service(b) {
+		t.Errorf("Expected only B to be tagged passive, received %v", tagged)
+	}
+
+	if !r.Deregister("Test") {
+		t.Errorf("Failed to deregister the service")
+	}
+	if r.Deregister("Test") {
+		t.Errorf("Deregistered a service that was already removed")
+	}
+	if err := r.Register(newTestService()); err != nil {
+		t.Errorf("Failed to register the name after it was deregistered: %v", err)
+	}
+}
+
+func TestRegistryStop(t *testing.T) {
+	var order []string
+	rec := &recorder{events: &order}
+	r := NewRegistry()
+
+	for _, name := range []string{"A", "B", "C", "D"} {
+		tag := "passive"
+		if name == "B" || name == "D" {
+			tag = "active"
+		}
+
+		srv := newRecordedService(name, rec)
+		_ = srv.Start()
+		_ = r.Register(srv, WithTags(tag))
+	}
+
+	if err := r.StopTagged("active"); err != nil {
+		t.Errorf("Failed to stop the active services: %v", err)
+	}
+	if err := r.StopAll(); err != nil {
+		t.Errorf("Failed to stop the services: %v", err)
+	}
+
+	expected := []string{"start A", "start B", "start C", "start D", "stop D", "stop B", "stop C", "stop A"}
+	if len(order) != len(expected) {
+		t.Fatalf("Expected the events %v, received %v", expected, order)
+	}
+	for i, e := range expected {
+		if order[i] != e {
+			t.Errorf("Expected the events %v, received %v", expected, order)
+			break
+		}
+	}
+}
+
+func TestRegistryStopDependencies(t *testing.T) {
+	var order []string
+	rec := &recorder{events: &order}
+	r := NewRegistry()
+
+	// The API is registered before the database it depends on
+	for _, reg := range []struct {
+		name string
+		deps []string
+	}{
+		{"api", []string{"db"}},
+		{"db", nil},
+		{"worker", []string{"api", "missing"}},
+	} {
+		srv := newRecordedService(reg.name, rec)
+		_ = srv.Start()
+		_ = r.Register(srv, WithDependencies(reg.deps...))
+	}
+
+	if err := r.StopAll(); err != nil {
+		t.Errorf("Failed to stop the services: %v", err)
+	}
+
+	expected := []string{"stop worker", "stop api", "stop db"}
+	if len(order) != 6 {
+		t.Fatalf("Expected the events %v after the starts, received %v", expected, order)
+	}
+	for i, e := range expected {
+		if order[3+i] != e {
+			t.Errorf("Expected the events %v after the starts, received %v", expected, order[3:])
+			break
+		}
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	r := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			srv := NewSimpleService(strconv.Itoa(i), func(req interface{}) (interface{}, error) { return req, nil })
+			_ = r.Register(srv, WithTags("all"))
+			_, _ = r.Lookup(strconv.Itoa(i))
+			_ = r.List()
+			if i%2 == 0 {
+				r.Deregister(strconv.Itoa(i))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if l := len(r.Tagged("all")); l != 25 {
+		t.Errorf("Expected 25 registered services, received %d", l)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import "sync"
+
+// replayBuffer is a ring of the most recent results sent on the Output channel.
+type replayBuffer struct {
+	sync.Mutex
+	items []interface{}
+	size  int
+	// The position of the oldest result once the ring is full
+	next int
+}
+
+// SetReplayBuffer sets the number of recent results kept by the service, so subscriptions created
+// with WithReplay receive them first. The results kept are discarded when the service stops, or
+// when the size is changed. A size that is not positive disables the buffer.
+func (bas *BaseService) SetReplayBuffer(n int) {
+	r := &bas.replay
+	r.Lock()
+	defer r.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	r.size = n
+	r.reset()
+}
+
+// WithReplay makes the subscription receive the results kept by the buffer set with
+// SetReplayBuffer, oldest first, before any new result. When the results kept do not fit in the
+// subscription channel, only the most recent are received.
+func WithReplay() SubscribeOption {
+	return func(s *subscriber) {
+		s.replay = true
+	}
+}
+
+// emitted counts the result sent on the Output channel, and keeps it for the replays.
+func (bas *BaseService) emitted(result interface{}) {
+	bas.IncEmitted()
+
+	r := &bas.replay
+	r.Lock()
+	defer r.Unlock()
+
+	if r.size == 0 {
+		return
+	}
+	if len(r.items) < r.size {
+		r.items = append(r.items, result)
+		return
+	}
+	r.items[r.next] = result
+	r.next = (r.next + 1) % r.size
+}
+
+// history returns the results kept by the buffer, oldest first.
+func (r *replayBuffer) history() []interface{} {
+	r.Lock()
+	defer r.Unlock()
+
+	items := make([]interface{}, 0, len(r.items))
+	items = append(items, r.items[r.next:]...)
+	return append(items, r.items[:r.next]...)
+}
+
+func (r *replayBuffer) clear() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.reset()
+}
+
+func (r *replayBuffer) reset() {
+	r.items = nil
+	r.next = 0
+}
@@ -0,0 +1,85 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newReplayService(t *testing.T, emitted int) *SimpleService {
+	srv := newEchoService("Replay")
+	srv.SetReplayBuffer(10)
+
+	_ = srv.Start()
+	t.Cleanup(func() { _ = srv.Stop() })
+
+	for i := 0; i < emitted; i++ {
+		_ = srv.Send(context.Background(), i)
+		<-srv.Output()
+	}
+	return srv
+}
+
+func TestReplayBuffer(t *testing.T) {
+	srv := newReplayService(t, 100)
+
+	ch, cancel := srv.Subscribe(WithReplay())
+	defer cancel()
+	_ = srv.Send(context.Background(), 100)
+
+	for i := 90; i <= 100; i++ {
+		select {
+		case msg := <-ch:
+			if msg != i {
+				t.Fatalf("Expected result %d and received %v", i, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("The result %d was not received", i)
+		}
+	}
+}
+
+func TestReplaySubscriberBuffer(t *testing.T) {
+	srv := newReplayService(t, 100)
+
+	ch, cancel := srv.Subscribe(WithReplay(), WithSubscriberBuffer(4))
+	defer cancel()
+
+	if n := len(ch); n != 4 {
+		t.Fatalf("Expected 4 results to be replayed and received %d", n)
+	}
+	for i := 96; i < 100; i++ {
+		if msg := <-ch; msg != i {
+			t.Errorf("Expected the most recent result %d and received %v", i, msg)
+		}
+	}
+}
+
+func TestReplayWithoutOption(t *testing.T) {
+	srv := newReplayService(t, 5)
+
+	ch, cancel := srv.Subscribe()
+	defer cancel()
+
+	if n := len(ch); n != 0 {
+		t.Errorf("Expected no results to be replayed and received %d", n)
+	}
+}
+
+func TestReplayClearedOnStop(t *testing.T) {
+	srv := newReplayService(t, 5)
+
+	_ = srv.Stop()
+	_ = srv.Restart()
+
+	ch, cancel := srv.Subscribe(WithReplay())
+	defer cancel()
+
+	if n := len(ch); n != 0 {
+		t.Errorf("Expected the results kept to be discarded by the stop, %d were replayed", n)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import "sync"
+
+// DefaultErrorBuffer is the capacity of the channel returned by Errors.
+const DefaultErrorBuffer = 16
+
+type errorReports struct {
+	sync.Mutex
+	ch      chan error
+	closed  bool
+	dropped uint64
+}
+
+// Errors returns a channel that receives the errors reported by the service during the current run.
+// The channel is closed when the service is stopped, and a new channel is used after a restart.
+func (bas *BaseService) Errors() <-chan error {
+	r := &bas.reports
+	r.Lock()
+	defer r.Unlock()
+
+	return r.ch
+}
+
+// ReportError sends the error on the Errors channel without blocking. The error is dropped and
+// counted by DroppedErrors when the channel buffer is full or the service has been stopped.
+// Errors returned by handlers executed by the Run method are reported automatically.
+func (bas *BaseService) ReportError(err error) {
+	if err == nil {
+		return
+	}
+	bas.stats.errors.Add(1)
+
+	r := &bas.reports
+	r.Lock()
+	defer r.Unlock()
+
+	if r.closed {
+		r.dropped++
+		return
+	}
+
+	select {
+	case r.ch <- err:
+	default:
+		r.dropped++
+	}
+}
+
+// DroppedErrors returns the number of errors that ReportError could not deliver.
+func (bas *BaseService) DroppedErrors() uint64 {
+	r := &bas.reports
+	r.Lock()
+	defer r.Unlock()
+
+	return r.dropped
+}
+
+// openReports provides a new Errors channel when the previous run closed it.
+func (bas *BaseService) openReports() {
+	r := &bas.reports
+	r.Lock()
+	defer r.Unlock()
+
+	if r.ch == nil || r.closed {
+		r.ch = make(chan error, DefaultErrorBuffer)
+		r.closed = false
+	}
+}
+
+func (bas *BaseService) closeReports() {
+	r := &bas.reports
+	r.Lock()
+	defer r.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		close(r.ch)
+	}
+}
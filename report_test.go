@@ -0,0 +1,98 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReportError(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	errReport := errors.New("reported")
+	srv.ReportError(errReport)
+	srv.ReportError(nil)
+
+	select {
+	case err := <-srv.Errors():
+		if err != errReport {
+			t.Errorf("Expected the reported error and received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The reported error was not received")
+	}
+	select {
+	case err := <-srv.Errors():
+		t.Errorf("Received an unexpected error: %v", err)
+	default:
+	}
+}
+
+func TestReportErrorDropped(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	for i := 0; i < DefaultErrorBuffer+5; i++ {
+		srv.ReportError(errors.New("unread"))
+	}
+	if n := srv.DroppedErrors(); n != 5 {
+		t.Errorf("Expected 5 dropped errors and counted %d", n)
+	}
+
+	_ = srv.Stop()
+	srv.ReportError(errors.New("late"))
+	if n := srv.DroppedErrors(); n != 6 {
+		t.Errorf("Expected the error reported after the stop to be dropped, counted %d", n)
+	}
+}
+
+func TestErrorsClosedOnStop(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	errs := srv.Errors()
+	_ = srv.Stop()
+
+	select {
+	case _, ok := <-errs:
+		if !ok {
+			break
+		}
+		t.Errorf("Received an unexpected error before the channel was closed")
+	case <-time.After(time.Second):
+		t.Fatalf("The Errors channel was not closed when the service stopped")
+	}
+
+	_ = srv.Restart()
+	defer func() { _ = srv.Stop() }()
+	if srv.Errors() == errs {
+		t.Errorf("The Errors channel was not replaced by the restart")
+	}
+}
+
+func TestRunReportsErrors(t *testing.T) {
+	errHandler := errors.New("handler failed")
+	srv := NewSimpleService("Reporting", func(req interface{}) (interface{}, error) {
+		return nil, errHandler
+	})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "request"
+	select {
+	case err := <-srv.Errors():
+		if !errors.Is(err, errHandler) {
+			t.Errorf("Expected the handler error and received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The handler error was not reported on the Errors channel")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var msgCounter uint64
+
+func nextMessageID() string {
+	return strconv.FormatUint(atomic.AddUint64(&msgCounter, 1), 10)
+}
+
+// Message is the envelope used to correlate a request with the response produced by the service,
+// and to carry the metadata of the request. Services can send raw values instead, which are
+// wrapped when the Run method dequeues them.
+type Message struct {
+	ID      string
+	Payload interface{}
+	// The time the message was sent to the service, set by Send when it is zero
+	EnqueuedAt time.Time
+	// The time after which the message is no longer worth processing, or zero
+	Deadline time.Time
+	// The number of times the handler was executed for the message
+	Attempts int
+	Meta     map[string]string
+	ctx      context.Context
+	reply    chan response
+	// The message was created by Requeue for a raw value, whose results are not wrapped
+	raw bool
+	// The message was requeued, so it is not checked against the deduplication window
+	requeued bool
+}
+
+type response struct {
+	payload interface{}
+	err     error
+}
+
+// NewMessage returns a Message with a unique ID that carries the provided payload.
+func NewMessage(payload interface{}) *Message {
+	return &Message{
+		ID:      nextMessageID(),
+		Payload: payload,
+	}
+}
+
+// Wrap returns the value when it is already a *Message, and otherwise returns a new Message carrying
+// the value as the payload.
+func Wrap(v interface{}) *Message {
+	if msg, ok := v.(*Message); ok {
+		return msg
+	}
+	return NewMessage(v)
+}
+
+// Unwrap returns the payload when the value is a *Message, and otherwise returns the value.
+func Unwrap(v interface{}) interface{} {
+	if msg, ok := v.(*Message); ok {
+		return msg.Payload
+	}
+	return v
+}
+
+// enqueued sets the time the value was sent when it is a *Message that does not have one.
+func (bas *BaseService) enqueued(v interface{}) {
+	if msg, ok := v.(*Message); ok && msg.EnqueuedAt.IsZero() {
+		msg.EnqueuedAt = bas.clock.Now()
+	}
+}
+
+// NewMessageContext returns a Message like NewMessage that also carries the context. The
+// context provides the parent of the spans created for the message by a Tracer, and is passed
+// on with the results, so the spans are linked across a pipeline of services.
+func NewMessageContext(ctx context.Context, payload interface{}) *Message {
+	msg := NewMessage(payload)
+
+	msg.ctx = ctx
+	return msg
+}
+
+// Context returns the context carried by the message, or context.Background when there is none.
+func (m *Message) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// Reply delivers the result of processing the message to the caller waiting on the response.
+// It returns false when nobody is waiting on the response, and the result should be sent on
+// the Output channel instead.
+func (m *Message) Reply(result interface{}, err error) bool {
+	if m.reply == nil {
+		return false
+	}
+
+	select {
+	case m.reply <- response{payload: result, err: err}:
+		return true
+	default:
+	}
+	return false
+}
+
+// Request sends the payload to the service wrapped in a *Message and waits for the handler to call
+// Reply on the message. The wait ends early when the context is done or the service is stopped.
+func (bas *BaseService) Request(ctx context.Context, in interface{}) (interface{}, error) {
+	msg := NewMessageContext(ctx, in)
+	msg.reply = make(chan response, 1)
+
+	done := bas.Done()
+	if err := bas.Send(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-msg.reply:
+		return resp.payload, resp.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-done:
+		return nil, fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	}
+}
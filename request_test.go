@@ -0,0 +1,167 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMessageReply(t *testing.T) {
+	if msg := NewMessage("data"); msg.Reply("result", nil) {
+		t.Errorf("Reply returned true for a message that nobody is waiting on")
+	}
+
+	if a, b := NewMessage(nil), NewMessage(nil); a.ID == b.ID {
+		t.Errorf("Two messages were created with the same ID: %s", a.ID)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	msg := Wrap("data")
+	if msg.Payload != "data" || msg.ID == "" {
+		t.Errorf("The raw value was not wrapped in a new message: %+v", msg)
+	}
+	if Wrap(msg) != msg {
+		t.Errorf("Wrap did not return the message it was provided")
+	}
+	if v := Unwrap(msg); v != "data" {
+		t.Errorf("Expected the payload to be unwrapped and received %v", v)
+	}
+	if v := Unwrap("raw"); v != "raw" {
+		t.Errorf("Expected the raw value to be returned and received %v", v)
+	}
+}
+
+func TestMessageMetadata(t *testing.T) {
+	srv := newEchoService("Metadata")
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	msg := NewMessage("data")
+	msg.Meta = map[string]string{"source": "test"}
+	if err := srv.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if msg.EnqueuedAt.IsZero() {
+		t.Errorf("Send did not set the time the message was enqueued")
+	}
+
+	result, ok := (<-srv.Output()).(*Message)
+	if !ok {
+		t.Fatalf("The result of the message is not a *Message")
+	}
+	if result.ID != msg.ID || result.Meta["source"] != "test" {
+		t.Errorf("The result does not carry the ID and metadata of the message: %+v", result)
+	}
+	if msg.Attempts != 1 {
+		t.Errorf("Expected 1 attempt and counted %d", msg.Attempts)
+	}
+	if s := srv.Stats(); s.QueueWaits != 1 || s.QueueWait <= 0 {
+		t.Errorf("The queue wait of the message was not measured: %d, %v", s.QueueWaits, s.QueueWait)
+	}
+}
+
+func TestRequestCorrelation(t *testing.T) {
+	srv := newTestRequestService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			result, err := srv.Request(context.Background(), i)
+			if err != nil {
+				t.Errorf("Request %d failed: %v", i, err)
+			} else if result != strconv.Itoa(i) {
+				t.Errorf("Request %d received the response %v", i, result)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestRequestError(t *testing.T) {
+	srv := newTestRequestService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if _, err := srv.Request(context.Background(), -1); err == nil {
+		t.Errorf("The error returned by the handler was not provided to the caller")
+	}
+}
+
+func TestRequestCanceled(t *testing.T) {
+	// The service is never started, so nothing will read the request
+	srv := newTestRequestService()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := srv.Request(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context deadline to be exceeded, received %v", err)
+	}
+}
+
+func TestRequestStopped(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	_ = srv.Stop()
+	if _, err := srv.Request(context.Background(), 1); !errors.Is(err, ErrServiceStopped) {
+		t.Errorf("Expected ErrServiceStopped when sending a request to a stopped service, received %v", err)
+	}
+}
+
+type testRequestService struct {
+	BaseService
+}
+
+func newTestRequestService() *testRequestService {
+	srv := new(testRequestService)
+
+	srv.Init(srv, "Request")
+	return srv
+}
+
+func (srv *testRequestService) OnStart() error {
+	go srv.handleRequests(srv.Done())
+	return nil
+}
+
+func (srv *testRequestService) handleRequests(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case req := <-srv.Input():
+			if msg, ok := req.(*Message); ok {
+				// Process the requests concurrently so the responses are not in order
+				go srv.process(msg)
+			}
+		}
+	}
+}
+
+func (srv *testRequestService) process(msg *Message) {
+	time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
+
+	if i := msg.Payload.(int); i < 0 {
+		msg.Reply(nil, errors.New("negative value"))
+		return
+	}
+	msg.Reply(strconv.Itoa(msg.Payload.(int)), nil)
+}
@@ -0,0 +1,198 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// NackError is returned by a handler to requeue the request after the delay, instead of failing
+// it. The request is not retried by WithRetry, and is not reported as an error.
+type NackError struct {
+	Delay time.Duration
+}
+
+// Nack returns a *NackError requeuing the request after the delay.
+func Nack(delay time.Duration) error {
+	return &NackError{Delay: delay}
+}
+
+// Error implements the error interface.
+func (e *NackError) Error() string {
+	return fmt.Sprintf("request requeued after %v", e.Delay)
+}
+
+func isNack(err error) bool {
+	var nack *NackError
+	return errors.As(err, &nack)
+}
+
+type requeueItem struct {
+	due time.Time
+	msg *Message
+}
+
+// requeueList holds the requeued messages ordered by the time they are due.
+type requeueList struct {
+	items   []requeueItem
+	changed chan struct{}
+	limit   int
+}
+
+// SetRequeueLimit sets the number of attempts, including the retries, after which a requeued
+// message is routed to the dead letters instead. The limit is DefaultMaxAttempts by default, and
+// a limit that is not positive permits any number of attempts.
+func (bas *BaseService) SetRequeueLimit(n int) {
+	bas.Lock()
+	defer bas.Unlock()
+
+	bas.requeues.limit = n
+}
+
+// Requeue sends the message to the Input channel again after the delay, so a request that failed
+// can be processed later. A value that is not a *Message is wrapped in one to count its attempts,
+// and is still provided to the handler and sent on the Output channel without the envelope. Once
+// the message has reached the requeue limit, it is routed to the dead letters and an error
+// wrapping ErrRequeueLimit is returned. The messages waiting for their delay are routed to the
+// dead letters when the service stops. Handlers executed by the Run method can return Nack
+// instead of calling Requeue.
+func (bas *BaseService) Requeue(msg interface{}, delay time.Duration) error {
+	env, ok := msg.(*Message)
+	if !ok {
+		env = NewMessage(msg)
+		env.raw = true
+	}
+	return bas.requeue(env, delay)
+}
+
+func (bas *BaseService) requeue(env *Message, delay time.Duration) error {
+	bas.Lock()
+	limit := bas.requeues.limit
+	bas.Unlock()
+
+	if limit > 0 && env.Attempts >= limit {
+		err := fmt.Errorf("%s: %w", bas.name, ErrRequeueLimit)
+		bas.deadLetter(env.original(), env, DeadLetterRequeueLimit, err)
+		env.Reply(nil, err)
+		return err
+	}
+	if !bas.running() {
+		err := fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+		bas.deadLetter(env.original(), env, DeadLetterCanceled, err)
+		return err
+	}
+
+	env.requeued = true
+	bas.trackQueued(env)
+	item := requeueItem{due: bas.clock.Now().Add(delay), msg: env}
+
+	bas.Lock()
+	rq := &bas.requeues
+	i := sort.Search(len(rq.items), func(i int) bool { return rq.items[i].due.After(item.due) })
+	rq.items = append(rq.items, requeueItem{})
+	copy(rq.items[i+1:], rq.items[i:])
+	rq.items[i] = item
+	bas.Unlock()
+
+	select {
+	case rq.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// feedRequeues sends the requeued messages to the Input channel once they are due, until the run
+// of the context ends.
+func (bas *BaseService) feedRequeues(run context.Context) {
+	var timer Timer
+	defer func() { stopTimer(timer) }()
+
+	rq := &bas.requeues
+	for {
+		var input chan interface{}
+		var next *Message
+		var expired <-chan time.Time
+
+		bas.discardCanceled()
+		bas.Lock()
+		if len(rq.items) > 0 {
+			if wait := rq.items[0].due.Sub(bas.clock.Now()); wait > 0 {
+				timer = bas.resetTimer(timer, wait)
+				expired = timer.C()
+			} else {
+				input, next = bas.input, rq.items[0].msg
+			}
+		}
+		bas.Unlock()
+
+		select {
+		case <-run.Done():
+			bas.discardRequeues()
+			return
+		case <-rq.changed:
+		case <-expired:
+		case input <- next:
+			bas.removeRequeue(next)
+		}
+	}
+}
+
+func (bas *BaseService) removeRequeue(msg *Message) {
+	bas.Lock()
+	defer bas.Unlock()
+
+	rq := &bas.requeues
+	for i, item := range rq.items {
+		if item.msg == msg {
+			rq.items = append(rq.items[:i], rq.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// discardCanceled removes the requeued messages canceled by Cancel.
+func (bas *BaseService) discardCanceled() {
+	var canceled []*Message
+
+	bas.Lock()
+	rq := &bas.requeues
+	items := rq.items[:0]
+	for _, item := range rq.items {
+		if bas.canceled(item.msg) {
+			canceled = append(canceled, item.msg)
+			continue
+		}
+		items = append(items, item)
+	}
+	rq.items = items
+	bas.Unlock()
+
+	for _, msg := range canceled {
+		bas.dequeued(msg)
+	}
+}
+
+func (bas *BaseService) discardRequeues() {
+	bas.Lock()
+	items := bas.requeues.items
+	bas.requeues.items = nil
+	bas.Unlock()
+
+	for _, item := range items {
+		bas.deadLetter(item.msg.original(), item.msg, DeadLetterCanceled, ErrServiceStopped)
+	}
+}
+
+// original returns the value that was requeued, which is the payload when it was not a *Message.
+func (m *Message) original() interface{} {
+	if m.raw {
+		return m.Payload
+	}
+	return m
+}
@@ -0,0 +1,112 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNackRequeue(t *testing.T) {
+	clock := newFakeClock()
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	srv := NewSimpleService("Nack", func(req interface{}) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts = append(attempts, clock.Now())
+		if len(attempts) < 3 {
+			return nil, Nack(time.Second)
+		}
+		return req, nil
+	}, WithClock(clock))
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	msg := NewMessage("job")
+	srv.Input() <- msg
+	for i := 0; i < 2; i++ {
+		clock.waitTimers(t, 1)
+		clock.Advance(time.Second)
+	}
+
+	result := (<-srv.Output()).(*Message)
+	if result.Payload != "job" || msg.Attempts != 3 {
+		t.Errorf("Expected the job to succeed on the third attempt, received %v after %d attempts", result.Payload, msg.Attempts)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i < len(attempts); i++ {
+		if d := attempts[i].Sub(attempts[i-1]); d != time.Second {
+			t.Errorf("Expected the attempts to be spaced by 1s, received %v", d)
+		}
+	}
+	select {
+	case err := <-srv.Errors():
+		t.Errorf("Expected the nacks not to be reported, received %v", err)
+	default:
+	}
+}
+
+func TestRequeueRawValue(t *testing.T) {
+	clock := newFakeClock()
+	srv := NewSimpleService("Raw", func(req interface{}) (interface{}, error) {
+		if _, ok := req.(string); !ok {
+			return nil, errors.New("the handler received the envelope")
+		}
+		return req, nil
+	}, WithClock(clock))
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if err := srv.Requeue("raw", 0); err != nil {
+		t.Fatal(err)
+	}
+	if result := <-srv.Output(); result != "raw" {
+		t.Errorf("Expected the result without the envelope, received %v", result)
+	}
+}
+
+func TestRequeueLimit(t *testing.T) {
+	srv := NewSimpleService("Limited", func(req interface{}) (interface{}, error) {
+		return nil, Nack(0)
+	})
+	srv.SetRequeueLimit(2)
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "job"
+	dl := <-srv.DeadLetters()
+	if dl.Reason != DeadLetterRequeueLimit || dl.Payload != "job" || dl.Attempts != 2 || !errors.Is(dl.Err, ErrRequeueLimit) {
+		t.Errorf("Expected the job to be dead-lettered after 2 attempts, received %+v", dl)
+	}
+	if err := <-srv.Errors(); !errors.Is(err, ErrRequeueLimit) {
+		t.Errorf("Expected the requeue limit to be reported, received %v", err)
+	}
+}
+
+func TestRequeueDiscardedOnStop(t *testing.T) {
+	clock := newFakeClock()
+	srv := newEchoService("Pending", WithClock(clock))
+	_ = srv.Start()
+
+	if err := srv.Requeue("later", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	_ = srv.Stop()
+
+	dl := <-srv.DeadLetters()
+	if dl.Reason != DeadLetterCanceled || dl.Payload != "later" {
+		t.Errorf("Expected the pending requeue to be canceled, received %+v", dl)
+	}
+	if err := srv.Requeue("stopped", 0); !errors.Is(err, ErrServiceStopped) {
+		t.Errorf("Expected ErrServiceStopped once stopped, received %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// The default settings used by WithRetry.
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+	DefaultBackoffJitter  = 0.2
+)
+
+type retryConfig struct {
+	attempts  int
+	initial   time.Duration
+	max       time.Duration
+	jitter    float64
+	retryable func(err error) bool
+}
+
+// RetryOption configures how the handler executed by the Run method is retried.
+type RetryOption func(*retryConfig)
+
+// WithMaxAttempts sets the number of times the handler is executed for a request, including the first attempt.
+func WithMaxAttempts(n int) RetryOption {
+	return func(c *retryConfig) {
+		c.attempts = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry, which is doubled for each of the following
+// retries up to the maximum delay.
+func WithBackoff(initial, maxDelay time.Duration) RetryOption {
+	return func(c *retryConfig) {
+		c.initial = initial
+		c.max = maxDelay
+	}
+}
+
+// WithJitter sets the fraction of each delay that is randomly added or subtracted.
+func WithJitter(fraction float64) RetryOption {
+	return func(c *retryConfig) {
+		c.jitter = fraction
+	}
+}
+
+// WithRetryClassifier sets the function deciding whether a request that failed with the error
+// is retried. By default, errors implementing Temporary() bool are retried when it returns true,
+// panics are not retried, and the other errors are retried.
+func WithRetryClassifier(fn func(err error) bool) RetryOption {
+	return func(c *retryConfig) {
+		c.retryable = fn
+	}
+}
+
+// WithRetry makes the Run method retry the requests that the handler fails to process, waiting
+// with an exponential backoff and checking the rate limit before each retry. The error is only
+// provided to the error handler and the Errors channel once the attempts are exhausted.
+func WithRetry(opts ...RetryOption) Option {
+	cfg := &retryConfig{
+		attempts:  DefaultMaxAttempts,
+		initial:   DefaultInitialBackoff,
+		max:       DefaultMaxBackoff,
+		jitter:    DefaultBackoffJitter,
+		retryable: isRetryable,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(bas *BaseService) {
+		bas.retry = cfg
+	}
+}
+
+func isRetryable(err error) bool {
+	var perr *PanicError
+	if errors.As(err, &perr) {
+		return false
+	}
+
+	var temp interface{ Temporary() bool }
+	if errors.As(err, &temp) {
+		return temp.Temporary()
+	}
+	return true
+}
+
+// call executes the handler, and retries it according to the retry configuration of the service.
+func (bas *BaseService) call(ctx context.Context, env *Message, handler Handler) (interface{}, error) {
+	env.Attempts++
+	result, err := bas.guard(ctx, handler, env.Payload)
+
+	cfg := bas.retry
+	if cfg == nil {
+		return result, err
+	}
+
+	delay := cfg.initial
+	for attempt := 1; err != nil && attempt < cfg.attempts && !errors.Is(err, ErrCircuitOpen) && !isNack(err) && cfg.retryable(err); attempt++ {
+		if !bas.sleep(ctx, cfg.backoff(delay)) {
+			return result, err
+		}
+
+		if rerr := bas.CheckRateLimitErr(); rerr != nil {
+			return result, err
+		}
+		env.Attempts++
+		result, err = bas.guard(ctx, handler, env.Payload)
+
+		if delay *= 2; delay > cfg.max {
+			delay = cfg.max
+		}
+	}
+	return result, err
+}
+
+// backoff returns the delay with the jitter applied.
+func (c *retryConfig) backoff(delay time.Duration) time.Duration {
+	return withJitter(delay, c.jitter)
+}
+
+// withJitter randomly adds or subtracts the fraction of the delay.
+func withJitter(delay time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return delay
+	}
+	return delay + time.Duration((rand.Float64()*2-1)*fraction*float64(delay))
+}
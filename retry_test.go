@@ -0,0 +1,156 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type temporaryError struct {
+	temporary bool
+}
+
+func (e *temporaryError) Error() string   { return "upstream failure" }
+func (e *temporaryError) Temporary() bool { return e.temporary }
+
+// flakyUpstream fails the first calls and records the time of each attempt.
+type flakyUpstream struct {
+	sync.Mutex
+	failures int
+	err      error
+	attempts []time.Time
+}
+
+func (u *flakyUpstream) handle(req interface{}) (interface{}, error) {
+	u.Lock()
+	defer u.Unlock()
+
+	u.attempts = append(u.attempts, time.Now())
+	if len(u.attempts) <= u.failures {
+		return nil, u.err
+	}
+	return req, nil
+}
+
+func (u *flakyUpstream) count() int {
+	u.Lock()
+	defer u.Unlock()
+
+	return len(u.attempts)
+}
+
+func TestRetry(t *testing.T) {
+	up := &flakyUpstream{failures: 2, err: &temporaryError{temporary: true}}
+	srv := NewSimpleService("Retry", up.handle,
+		WithRetry(WithMaxAttempts(3), WithBackoff(20*time.Millisecond, time.Second)))
+
+	var reported []error
+	srv.SetErrorHandler(func(req interface{}, err error) { reported = append(reported, err) })
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "request"
+	select {
+	case result := <-srv.Output():
+		if result != "request" {
+			t.Errorf("Expected request to be returned and received %v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The request did not succeed after the retries")
+	}
+
+	up.Lock()
+	defer up.Unlock()
+
+	if len(up.attempts) != 3 {
+		t.Fatalf("Expected exactly 3 attempts and counted %d", len(up.attempts))
+	}
+	first, second := up.attempts[1].Sub(up.attempts[0]), up.attempts[2].Sub(up.attempts[1])
+	if first < 15*time.Millisecond || second <= first {
+		t.Errorf("The gaps between the attempts did not increase: %v and %v", first, second)
+	}
+	if len(reported) != 0 {
+		t.Errorf("The errors of the retried attempts were reported: %v", reported)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	up := &flakyUpstream{failures: 10, err: errors.New("down")}
+	srv := NewSimpleService("Exhausted", up.handle,
+		WithRetry(WithMaxAttempts(3), WithBackoff(time.Millisecond, time.Millisecond), WithJitter(0)))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "request"
+	select {
+	case err := <-srv.Errors():
+		if !errors.Is(err, up.err) {
+			t.Errorf("Expected the upstream error and received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The error was not reported after the attempts were exhausted")
+	}
+	if n := up.count(); n != 3 {
+		t.Errorf("Expected 3 attempts and counted %d", n)
+	}
+	if dl := <-srv.DeadLetters(); dl.Attempts != 3 {
+		t.Errorf("Expected the dead letter to record 3 attempts and received %d", dl.Attempts)
+	}
+}
+
+func TestRetryPermanent(t *testing.T) {
+	up := &flakyUpstream{failures: 10, err: &temporaryError{temporary: false}}
+	srv := NewSimpleService("Permanent", up.handle, WithRetry(WithBackoff(time.Millisecond, time.Millisecond)))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "request"
+	<-srv.Errors()
+	if n := up.count(); n != 1 {
+		t.Errorf("The permanent error was retried, counted %d attempts", n)
+	}
+}
+
+func TestRetryClassifier(t *testing.T) {
+	errSkip := errors.New("skip")
+	up := &flakyUpstream{failures: 10, err: errSkip}
+	srv := NewSimpleService("Classifier", up.handle, WithRetry(
+		WithBackoff(time.Millisecond, time.Millisecond),
+		WithRetryClassifier(func(err error) bool { return !errors.Is(err, errSkip) }),
+	))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "request"
+	<-srv.Errors()
+	if n := up.count(); n != 1 {
+		t.Errorf("The classifier did not prevent the retry, counted %d attempts", n)
+	}
+}
+
+func TestRetryRateLimit(t *testing.T) {
+	up := &flakyUpstream{failures: 2, err: errors.New("down")}
+	srv := NewSimpleService("Limited", up.handle,
+		WithRetry(WithBackoff(time.Millisecond, time.Millisecond), WithJitter(0)))
+	srv.SetRateLimit(20)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	start := time.Now()
+	srv.Input() <- "request"
+	<-srv.Output()
+	// Three calls at 20 per second need at least 100ms, even though the backoff is shorter
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("The retries did not wait on the rate limit, the attempts took %v", elapsed)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// The services that provide their own semantics for delivering a message, such as those
+// embedding BaseService
+type sender interface {
+	Send(ctx context.Context, msg interface{}) error
+}
+
+// Router is a service that dispatches each request on its Input channel to the downstream service
+// registered for the key of the request. The rate limit of the Router is checked before each
+// dispatch, and the requests that cannot be dispatched are reported as errors of the Router.
+type Router struct {
+	BaseService
+	mu     sync.Mutex
+	key    func(msg interface{}) string
+	routes map[string]Service
+	def    Service
+}
+
+// NewRouter returns a Router that obtains the key of each request from the provided function.
+func NewRouter(name string, key func(msg interface{}) string, opts ...Option) *Router {
+	r := &Router{
+		key:    key,
+		routes: make(map[string]Service),
+	}
+
+	r.Init(r, name, opts...)
+	return r
+}
+
+// AddRoute dispatches the requests with the key to the service, replacing any previous route.
+// Routes can be added and removed while the Router is running.
+func (r *Router) AddRoute(key string, srv Service) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.routes[key] = srv
+}
+
+// RemoveRoute removes the route for the key, so those requests are dispatched to the default route.
+func (r *Router) RemoveRoute(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.routes, key)
+}
+
+// SetDefault sets the service receiving the requests with a key that has no route. Without a
+// default route, those requests fail with an error wrapping ErrNoRoute.
+func (r *Router) SetDefault(srv Service) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.def = srv
+}
+
+// Route returns the service that receives the requests with the key, or false when there is none.
+func (r *Router) Route(key string) (Service, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if srv, found := r.routes[key]; found {
+		return srv, true
+	}
+	return r.def, r.def != nil
+}
+
+// OnStart implements the Service interface.
+func (r *Router) OnStart() error {
+	return r.RunContext(r.dispatch)
+}
+
+// dispatch delivers the request using the Send method of the downstream service when it has one,
+// so the overflow policy of the downstream service is respected.
+func (r *Router) dispatch(ctx context.Context, req interface{}) (interface{}, error) {
+	key := r.key(req)
+
+	srv, ok := r.Route(key)
+	if !ok {
+		return nil, fmt.Errorf("%s: %q: %w", r.name, key, ErrNoRoute)
+	}
+	return nil, sendTo(ctx, srv, req)
+}
+
+// sendTo delivers the message using the Send method of the service when it has one.
+func sendTo(ctx context.Context, srv Service, msg interface{}) error {
+	if s, ok := srv.(sender); ok {
+		return s.Send(ctx, msg)
+	}
+
+	select {
+	case srv.Input() <- msg:
+		return nil
+	case <-srv.Done():
+		return fmt.Errorf("%s: %w", srv, ErrServiceStopped)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func typeKey(msg interface{}) string {
+	return fmt.Sprintf("%T", msg)
+}
+
+func collect(t *testing.T, srv Service, n int) []interface{} {
+	var results []interface{}
+
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-srv.Output():
+			results = append(results, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("%s received %d of %d results", srv, i, n)
+		}
+	}
+	select {
+	case msg := <-srv.Output():
+		t.Errorf("%s received the unexpected result %v", srv, msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+	return results
+}
+
+func TestRouter(t *testing.T) {
+	ints, strs, other := newEchoService("ints"), newEchoService("strings"), newEchoService("other")
+	for _, srv := range []*SimpleService{ints, strs, other} {
+		_ = srv.Start()
+		defer func(srv *SimpleService) { _ = srv.Stop() }(srv)
+	}
+
+	r := NewRouter("Router", typeKey)
+	r.AddRoute("int", ints)
+	r.AddRoute("string", strs)
+	r.SetDefault(other)
+	_ = r.Start()
+	defer func() { _ = r.Stop() }()
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			r.Input() <- i
+			r.Input() <- fmt.Sprint(i)
+			r.Input() <- float64(i)
+		}
+	}()
+
+	for _, c := range []struct {
+		srv      Service
+		expected string
+	}{
+		{ints, "int"},
+		{strs, "string"},
+		{other, "float64"},
+	} {
+		for _, msg := range collect(t, c.srv, 5) {
+			if key := typeKey(msg); key != c.expected {
+				t.Errorf("%s received a message of type %s", c.srv, key)
+			}
+		}
+	}
+}
+
+func TestRouterRemoveRoute(t *testing.T) {
+	ints, other := newEchoService("ints"), newEchoService("other")
+	for _, srv := range []*SimpleService{ints, other} {
+		_ = srv.Start()
+		defer func(srv *SimpleService) { _ = srv.Stop() }(srv)
+	}
+
+	r := NewRouter("Router", typeKey)
+	r.AddRoute("int", ints)
+	r.SetDefault(other)
+	_ = r.Start()
+	defer func() { _ = r.Stop() }()
+
+	r.Input() <- 1
+	collect(t, ints, 1)
+
+	r.RemoveRoute("int")
+	r.Input() <- 2
+	if results := collect(t, other, 1); results[0] != 2 {
+		t.Errorf("Expected 2 to be redirected to the default route and received %v", results[0])
+	}
+}
+
+func TestRouterNoRoute(t *testing.T) {
+	r := NewRouter("Router", typeKey)
+	_ = r.Start()
+	defer func() { _ = r.Stop() }()
+
+	r.Input() <- "lost"
+	select {
+	case err := <-r.Errors():
+		if !errors.Is(err, ErrNoRoute) {
+			t.Errorf("Expected ErrNoRoute and received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The request without a route was not reported")
+	}
+}
+
+func TestRouterOverflowPolicy(t *testing.T) {
+	// The downstream is never started, so its buffer fills up
+	slow := newEchoService("slow", WithInputBuffer(1), WithOverflowPolicy(PolicyDropNew))
+
+	r := NewRouter("Router", typeKey)
+	r.SetDefault(slow)
+	_ = r.Start()
+	defer func() { _ = r.Stop() }()
+
+	for i := 0; i < 3; i++ {
+		if err := r.Send(context.Background(), i); err != nil {
+			t.Fatalf("The router blocked on the downstream: %v", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for slow.Stats().Dropped != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := slow.Stats().Dropped; n != 2 {
+		t.Errorf("Expected the downstream to drop 2 messages and counted %d", n)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// PanicError is reported when a handler executed by the Run method panics.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panic: %v", e.Value)
+}
+
+// SetErrorHandler sets the function called with the request and the error each time a handler
+// executed by the Run method returns an error or panics.
+func (bas *BaseService) SetErrorHandler(fn func(req interface{}, err error)) {
+	bas.Lock()
+	defer bas.Unlock()
+
+	bas.errHandler = fn
+}
+
+// Handler processes a request received by the service. The context is canceled when the service
+// is stopped, when the caller of Request stops waiting, or when the request timeout expires.
+type Handler func(ctx context.Context, req interface{}) (interface{}, error)
+
+// Run starts the goroutines, one by default or the number set by WithWorkers, that receive the
+// requests on the Input channel, check the rate limit, and execute the handler for each request
+// until the service is stopped. Results other than nil are sent on the Output channel. Errors and
+// recovered panics are provided to the error handler and reported on the Errors channel. Requests
+// sent by the Request method receive the result as the reply. Run is typically called from OnStart:
+//
+//	func (srv *MyService) OnStart() error {
+//		return srv.Run(srv.handle)
+//	}
+func (bas *BaseService) Run(handler func(req interface{}) (interface{}, error)) error {
+	return bas.RunContext(func(_ context.Context, req interface{}) (interface{}, error) {
+		return handler(req)
+	})
+}
+
+// RunContext is like Run, but executes a handler that receives the context of the request.
+func (bas *BaseService) RunContext(handler Handler) error {
+	ctx := bas.Context()
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	}
+
+	workers := bas.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	drain := bas.addLoops(workers)
+	for i := 0; i < workers; i++ {
+		bas.RunLabeled(ctx, "worker", func(ctx context.Context) { bas.requestLoop(ctx, drain, handler) })
+	}
+	bas.Ready()
+	return nil
+}
+
+func (bas *BaseService) requestLoop(ctx context.Context, drain <-chan struct{}, handler Handler) {
+	defer bas.loopExited()
+
+	beats, stop := bas.beatTicker()
+	defer stop()
+
+	bas.Beat()
+	for {
+		start := time.Now()
+		if err := bas.CheckRateLimitErr(); err != nil {
+			return
+		}
+		waited := time.Since(start)
+
+		req, ok := bas.nextRequest(ctx, drain, beats)
+		if !ok {
+			if ctx.Err() == nil {
+				bas.drainInput(ctx, handler)
+			}
+			return
+		}
+
+		start = time.Now()
+		if err := bas.chargeCost(req); err != nil {
+			bas.ReportDeadLetter(req, DeadLetterCanceled, err)
+			bas.MarkIdle()
+			return
+		}
+		waited += time.Since(start)
+
+		bas.process(ctx, handler, req, waited)
+		bas.Beat()
+	}
+}
+
+// nextRequest waits for a request on the Input channel while beating at the heartbeat interval,
+// and does not receive requests while the service is paused. Expired and duplicate requests are
+// skipped, so the rate limit checked before the call is not charged for them. It returns false when the service
+// is stopped or StopDrain has begun. The request returned is counted as in flight until MarkIdle
+// is called.
+func (bas *BaseService) nextRequest(ctx context.Context, drain <-chan struct{}, beats <-chan time.Time) (interface{}, bool) {
+	for {
+		paused, resumed := bas.pauseChans()
+
+		input := bas.input
+		if resumed != nil {
+			input = nil
+			paused = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-drain:
+			return nil, false
+		case <-beats:
+			bas.Beat()
+		case <-paused:
+		case <-resumed:
+		case req := <-input:
+			bas.MarkBusy()
+			bas.checkBacklog()
+			if !bas.skip(req) {
+				return req, true
+			}
+			bas.MarkIdle()
+		}
+	}
+}
+
+// skip reports whether the request should not be processed, because it expired or is a duplicate.
+func (bas *BaseService) skip(req interface{}) bool {
+	if bas.dequeued(req) {
+		return true
+	}
+	if msg, ok := req.(*Message); ok && msg.requeued {
+		return bas.expire(req)
+	}
+	return bas.expire(req) || bas.duplicate(req)
+}
+
+func (bas *BaseService) process(ctx context.Context, handler Handler, req interface{}, waited time.Duration) {
+	bas.IncReceived()
+	// The request was marked busy when it was dequeued
+	defer bas.MarkIdle()
+
+	mctx, span := bas.startSpan(req, waited)
+	audit := bas.startAudit(req)
+	result, ok, err := bas.invoke(ctx, mctx, handler, req)
+	audit.finish(result, err)
+	if ok {
+		bas.emit(ctx, result)
+	}
+	span.End(err)
+}
+
+// invoke executes the handler for the request during the run of the context, and returns the result
+// to be sent on the Output channel, or false when nothing should be sent. Raw requests are wrapped
+// in a Message to track the attempts, and the result of a *Message carries the message context,
+// deadline and metadata.
+func (bas *BaseService) invoke(run, mctx context.Context, handler Handler, req interface{}) (interface{}, bool, error) {
+	msg, isMsg := req.(*Message)
+	if isMsg && !msg.EnqueuedAt.IsZero() {
+		bas.countQueueWait(bas.since(msg.EnqueuedAt))
+	}
+	env := Wrap(req)
+	if env.raw {
+		// The value requeued without an envelope is provided without it
+		req = env.Payload
+	}
+
+	hctx, cancel := context.WithCancel(mctx)
+	defer cancel()
+	defer bas.trackInFlight(env, cancel)()
+	defer context.AfterFunc(run, cancel)()
+
+	start := bas.clock.Now()
+	finished := bas.watchSlow(req, start)
+	result, err := bas.call(hctx, env, bas.intercept(handler))
+	finished()
+	bas.stats.handleHist.record(bas.since(start))
+
+	var nack *NackError
+	if errors.As(err, &nack) {
+		env.raw = env.raw || !isMsg
+		if rerr := bas.requeue(env, nack.Delay); rerr != nil {
+			bas.ReportError(rerr)
+		}
+		return nil, false, nil
+	}
+	if err != nil {
+		bas.handleError(req, env, err)
+	}
+	if isMsg && msg.Reply(result, err) {
+		return nil, false, err
+	}
+	if err != nil || result == nil {
+		return nil, false, err
+	}
+	if isMsg && !msg.raw {
+		result = &Message{ID: msg.ID, Payload: result, Deadline: msg.Deadline, Meta: msg.Meta, ctx: mctx}
+	}
+	return result, true, nil
+}
+
+func (bas *BaseService) emit(ctx context.Context, result interface{}) {
+	select {
+	case bas.output <- result:
+		bas.emitted(result)
+	case <-ctx.Done():
+		bas.ReportDeadLetter(result, DeadLetterCanceled, ctx.Err())
+	}
+}
+
+func safeCall(ctx context.Context, handler Handler, req interface{}) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// handleError reports the error returned for the request, and routes the request to the dead
+// letters with the metadata of its envelope.
+func (bas *BaseService) handleError(req interface{}, env *Message, err error) {
+	bas.Lock()
+	fn := bas.errHandler
+	bas.Unlock()
+
+	bas.deadLetter(req, env, deadLetterReason(err), err)
+
+	var perr *PanicError
+	if errors.As(err, &perr) {
+		bas.log(slog.LevelError, "handler panic recovered", err, slog.String("stack", string(perr.Stack)))
+	}
+
+	if fn != nil {
+		fn(req, err)
+	}
+	bas.ReportError(err)
+}
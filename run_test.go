@@ -0,0 +1,164 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	srv := newTestRunService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for _, str := range []string{"str1", "str2", "str3"} {
+		srv.Input() <- str
+		if result := <-srv.Output(); result != str {
+			t.Errorf("Expected %s to be returned and received %v", str, result)
+		}
+	}
+
+	if err := srv.Run(srv.handle); err != nil {
+		t.Errorf("Failed to run a second request loop: %v", err)
+	}
+}
+
+func TestRunPanic(t *testing.T) {
+	srv := newTestRunService()
+	errs := make(chan error, 1)
+	srv.SetErrorHandler(func(req interface{}, err error) {
+		errs <- err
+	})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "panic"
+	select {
+	case err := <-errs:
+		var pe *PanicError
+		if !errors.As(err, &pe) {
+			t.Errorf("Expected a *PanicError and received %v", err)
+		} else if pe.Value != "handler failure" || len(pe.Stack) == 0 {
+			t.Errorf("The PanicError did not describe the panic: %v", pe)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The panic was not provided to the error handler")
+	}
+
+	// The service must continue to handle requests
+	srv.Input() <- "after"
+	if result := <-srv.Output(); result != "after" {
+		t.Errorf("Expected after to be returned and received %v", result)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	srv := newTestRunService()
+	reqs := make(chan interface{}, 1)
+	srv.SetErrorHandler(func(req interface{}, err error) {
+		reqs <- req
+	})
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "error"
+	select {
+	case req := <-reqs:
+		if req != "error" {
+			t.Errorf("The error handler received the wrong request: %v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The error was not provided to the error handler")
+	}
+	if l := srv.OutputLen(); l != 0 {
+		t.Errorf("The failed request produced %d results", l)
+	}
+}
+
+func TestRunRequest(t *testing.T) {
+	srv := newTestRunService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if result, err := srv.Request(context.Background(), "hello"); err != nil || result != "hello" {
+		t.Errorf("Expected hello to be returned and received %v, %v", result, err)
+	}
+	if _, err := srv.Request(context.Background(), "panic"); err == nil {
+		t.Errorf("The panic was not returned to the caller")
+	}
+
+	msg := NewMessage("wrapped")
+	srv.Input() <- msg
+	if result, ok := (<-srv.Output()).(*Message); !ok || result.ID != msg.ID || result.Payload != "wrapped" {
+		t.Errorf("The result was not returned in a message with the same ID: %v", result)
+	}
+}
+
+func TestRunStopped(t *testing.T) {
+	srv := newTestRunService()
+
+	_ = srv.Start()
+	_ = srv.Stop()
+	if err := srv.Run(srv.handle); !errors.Is(err, ErrServiceStopped) {
+		t.Errorf("Expected ErrServiceStopped when running a stopped service, received %v", err)
+	}
+}
+
+type testRunService struct {
+	BaseService
+}
+
+func newTestRunService() *testRunService {
+	srv := new(testRunService)
+
+	srv.Init(srv, "Run")
+	return srv
+}
+
+func (srv *testRunService) OnStart() error {
+	return srv.Run(srv.handle)
+}
+
+func (srv *testRunService) handle(req interface{}) (interface{}, error) {
+	switch req {
+	case "panic":
+		panic("handler failure")
+	case "error":
+		return nil, errors.New("handler error")
+	}
+	return req, nil
+}
+
+func TestRunContextCanceledOnStop(t *testing.T) {
+	srv := new(BaseService)
+	srv.Init(srv, "Context")
+	_ = srv.Start()
+
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	_ = srv.RunContext(func(ctx context.Context, req interface{}) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	})
+
+	srv.Input() <- "request"
+	<-started
+	go func() { _ = srv.Stop() }()
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatalf("The handler context was not canceled when the service stopped")
+	}
+}
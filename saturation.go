@@ -0,0 +1,96 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// The number of slots the window of SetRateLimitAlert is divided into
+const waitSlots = 10
+
+type waitAlertConfig struct {
+	ratio  float64
+	window time.Duration
+	fn     func(srv Service, ratio float64)
+}
+
+// waitWindow sums the time spent waiting on the rate limit over a sliding window, using a slot
+// for each tenth of the window, so the waits are recorded with atomic operations only.
+type waitWindow struct {
+	cfg     atomic.Pointer[waitAlertConfig]
+	alerted atomic.Bool
+	slots   [waitSlots]struct {
+		epoch  atomic.Int64
+		waited atomic.Int64
+	}
+}
+
+// SetRateLimitAlert calls the function when the time spent waiting on the rate limit during the
+// window exceeds the ratio of the window, such as 0.8 when the service is rate limited more than
+// 80% of the time, and logs a warning. The function receives the ratio measured, and is called
+// again only after the ratio has fallen below the threshold. The waits are summed over the
+// goroutines checking the rate limit, so the ratio can exceed one with several workers. The
+// function is called by the goroutine that checked the rate limit, and should return quickly. A
+// window that is not positive disables the alert.
+func (bas *BaseService) SetRateLimitAlert(ratio float64, window time.Duration, fn func(srv Service, ratio float64)) {
+	w := &bas.waitAlert
+
+	for i := range w.slots {
+		w.slots[i].epoch.Store(0)
+		w.slots[i].waited.Store(0)
+	}
+	w.alerted.Store(false)
+
+	if window <= 0 {
+		w.cfg.Store(nil)
+		return
+	}
+	w.cfg.Store(&waitAlertConfig{ratio: ratio, window: window, fn: fn})
+}
+
+// record adds the wait to the window, and fires the alert when the ratio crosses the threshold.
+func (w *waitWindow) record(bas *BaseService, d time.Duration) {
+	cfg := w.cfg.Load()
+	if cfg == nil {
+		return
+	}
+
+	width := int64(cfg.window / waitSlots)
+	if width <= 0 {
+		width = 1
+	}
+	epoch := bas.clock.Now().UnixNano() / width
+
+	slot := &w.slots[epoch%waitSlots]
+	if cur := slot.epoch.Load(); cur != epoch && slot.epoch.CompareAndSwap(cur, epoch) {
+		slot.waited.Store(0)
+	}
+	slot.waited.Add(int64(d))
+
+	var total int64
+	for i := range w.slots {
+		if s := &w.slots[i]; epoch-s.epoch.Load() < waitSlots {
+			total += s.waited.Load()
+		}
+	}
+
+	ratio := float64(total) / float64(cfg.window)
+	if ratio <= cfg.ratio {
+		w.alerted.Store(false)
+		return
+	}
+	if !w.alerted.CompareAndSwap(false, true) {
+		return
+	}
+
+	bas.log(slog.LevelWarn, "the service is rate limited", nil,
+		slog.Float64("ratio", ratio), slog.Duration("window", cfg.window))
+	if cfg.fn != nil {
+		cfg.fn(bas.service, ratio)
+	}
+}
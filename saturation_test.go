@@ -0,0 +1,67 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitAlert(t *testing.T) {
+	clock := newFakeClock()
+	srv := newEchoService("Saturated", WithClock(clock))
+
+	var alerts []float64
+	srv.SetRateLimitAlert(0.5, 10*time.Second, func(s Service, ratio float64) {
+		if s != Service(srv) {
+			t.Errorf("Expected the alert to provide the service")
+		}
+		alerts = append(alerts, ratio)
+	})
+
+	srv.countWait(3 * time.Second)
+	if len(alerts) != 0 {
+		t.Fatalf("Expected no alert below the threshold, received %v", alerts)
+	}
+	srv.countWait(3 * time.Second)
+	srv.countWait(time.Second)
+	if len(alerts) != 1 || alerts[0] != 0.6 {
+		t.Fatalf("Expected a single alert with the ratio 0.6, received %v", alerts)
+	}
+
+	// The waits leave the window, so the alert is fired again once the threshold is crossed
+	clock.Advance(11 * time.Second)
+	srv.countWait(time.Second)
+	srv.countWait(5 * time.Second)
+	if len(alerts) != 2 || alerts[1] != 0.6 {
+		t.Errorf("Expected a second alert with the ratio 0.6, received %v", alerts)
+	}
+
+	if max := srv.Stats().RateLimitMaxWait; max != 5*time.Second {
+		t.Errorf("Expected the longest wait to be 5s, received %v", max)
+	}
+
+	srv.SetRateLimitAlert(0, 0, nil)
+	srv.countWait(20 * time.Second)
+	if len(alerts) != 2 {
+		t.Errorf("Expected no alert once disabled, received %v", alerts)
+	}
+}
+
+func TestRateLimitMaxWait(t *testing.T) {
+	srv := newEchoService("Waiting")
+	srv.SetRateLimit(20)
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 0; i < 3; i++ {
+		srv.CheckRateLimit()
+	}
+
+	s := srv.Stats()
+	if s.RateLimitMaxWait <= 0 || s.RateLimitMaxWait > s.RateLimitWait {
+		t.Errorf("Expected the longest wait within the total of %v, received %v", s.RateLimitWait, s.RateLimitMaxWait)
+	}
+}
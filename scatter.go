@@ -0,0 +1,116 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// GatherError is the error of a single target returned by ScatterGather.
+type GatherError struct {
+	// The position of the target in the targets provided
+	Index  int
+	Target Service
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *GatherError) Error() string {
+	return fmt.Sprintf("target %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the error of the target.
+func (e *GatherError) Unwrap() error {
+	return e.Err
+}
+
+type gatherConfig struct {
+	firstSuccess bool
+}
+
+// GatherOption configures a call to ScatterGather.
+type GatherOption func(*gatherConfig)
+
+// FirstSuccess makes ScatterGather return as soon as one target responds without an error, and
+// cancel the requests to the other targets, as needed for redundant services.
+func FirstSuccess() GatherOption {
+	return func(c *gatherConfig) {
+		c.firstSuccess = true
+	}
+}
+
+type gathered struct {
+	index  int
+	result interface{}
+	err    error
+}
+
+// ScatterGather sends the message to each target, and collects the response of each target in a
+// slice aligned with the targets. A *Message is unwrapped, and each target receives the payload in
+// a Message of its own that is correlated with the response, as done by Request. When targets fail,
+// are stopped, or do not respond before the context is done, the results collected are returned
+// with the errors of the targets joined, each as a *GatherError.
+func ScatterGather(ctx context.Context, msg interface{}, targets []Service, opts ...GatherOption) ([]interface{}, error) {
+	var cfg gatherConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The channel is buffered, so the requests still running after the return do not block
+	responses := make(chan gathered, len(targets))
+	for i, target := range targets {
+		go func(i int, target Service) {
+			result, err := request(ctx, target, Unwrap(msg))
+			responses <- gathered{index: i, result: result, err: err}
+		}(i, target)
+	}
+
+	results := make([]interface{}, len(targets))
+	failures := make([]error, len(targets))
+	for range targets {
+		r := <-responses
+		if r.err != nil {
+			failures[r.index] = &GatherError{Index: r.index, Target: targets[r.index], Err: r.err}
+			continue
+		}
+
+		results[r.index] = r.result
+		if cfg.firstSuccess {
+			return results, nil
+		}
+	}
+	// The errors are joined in the order of the targets
+	return results, errors.Join(failures...)
+}
+
+// request sends the payload to the service in a *Message and waits for the reply, like Request,
+// for any implementation of the Service interface.
+func request(ctx context.Context, srv Service, in interface{}) (interface{}, error) {
+	msg := NewMessageContext(ctx, in)
+	msg.reply = make(chan response, 1)
+
+	if err := sendTo(ctx, srv, msg); err != nil {
+		return nil, err
+	}
+	return awaitReply(ctx, srv, msg)
+}
+
+// awaitReply waits for the reply to the message sent to the service, which must have been
+// created with a reply channel.
+func awaitReply(ctx context.Context, srv Service, msg *Message) (interface{}, error) {
+	select {
+	case resp := <-msg.reply:
+		return resp.payload, resp.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-srv.Done():
+		return nil, fmt.Errorf("%s: %w", srv, ErrServiceStopped)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func startTarget(t *testing.T, name string, fn func(req interface{}) (interface{}, error)) *SimpleService {
+	srv := NewSimpleService(name, fn)
+
+	_ = srv.Start()
+	t.Cleanup(func() { _ = srv.Stop() })
+	return srv
+}
+
+func TestScatterGather(t *testing.T) {
+	failed := errors.New("failed")
+	targets := []Service{
+		newEchoService("Echo"),
+		startTarget(t, "Map", func(req interface{}) (interface{}, error) { return timesTen(req), nil }),
+		startTarget(t, "Fail", func(req interface{}) (interface{}, error) { return nil, failed }),
+	}
+	_ = targets[0].Start()
+	defer func() { _ = targets[0].Stop() }()
+
+	results, err := ScatterGather(context.Background(), NewMessage(2), targets)
+	if results[0] != 2 || results[1] != 20 || results[2] != nil {
+		t.Errorf("Expected the results of each target and received %v", results)
+	}
+
+	var gerr *GatherError
+	if !errors.As(err, &gerr) || gerr.Index != 2 || !errors.Is(err, failed) {
+		t.Errorf("Expected the error of the failed target and received %v", err)
+	}
+}
+
+func TestScatterGatherTimeout(t *testing.T) {
+	targets := []Service{
+		startTarget(t, "Fast", func(req interface{}) (interface{}, error) { return req, nil }),
+		startTarget(t, "Slow", func(req interface{}) (interface{}, error) {
+			time.Sleep(time.Second)
+			return req, nil
+		}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	results, err := ScatterGather(ctx, "req", targets)
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Expected ScatterGather to return at the deadline, it took %v", d)
+	}
+	if results[0] != "req" || results[1] != nil {
+		t.Errorf("Expected the partial results and received %v", results)
+	}
+
+	var gerr *GatherError
+	if !errors.As(err, &gerr) || gerr.Index != 1 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the slow target to time out and received %v", err)
+	}
+}
+
+func TestScatterGatherStoppedTarget(t *testing.T) {
+	started := make(chan struct{})
+	gate := make(chan struct{})
+	defer close(gate)
+
+	stopped := startTarget(t, "Stopped", func(req interface{}) (interface{}, error) {
+		close(started)
+		<-gate
+		return req, nil
+	})
+	targets := []Service{newEchoService("Echo"), stopped}
+	_ = targets[0].Start()
+	defer func() { _ = targets[0].Stop() }()
+
+	go func() {
+		<-started
+		_ = stopped.Stop()
+	}()
+
+	results, err := ScatterGather(context.Background(), "req", targets)
+	if results[0] != "req" {
+		t.Errorf("Expected the result of the running target and received %v", results[0])
+	}
+	if !errors.Is(err, ErrServiceStopped) {
+		t.Errorf("Expected the target stopped during the request to be reported and received %v", err)
+	}
+}
+
+func TestScatterGatherFirstSuccess(t *testing.T) {
+	targets := []Service{
+		startTarget(t, "Fail", func(req interface{}) (interface{}, error) { return nil, errors.New("failed") }),
+		startTarget(t, "Slow", func(req interface{}) (interface{}, error) {
+			time.Sleep(time.Second)
+			return "slow", nil
+		}),
+		startTarget(t, "Fast", func(req interface{}) (interface{}, error) {
+			time.Sleep(10 * time.Millisecond)
+			return "fast", nil
+		}),
+	}
+
+	start := time.Now()
+	results, err := ScatterGather(context.Background(), "req", targets, FirstSuccess())
+	if err != nil {
+		t.Errorf("Expected no error with a successful target and received %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Expected ScatterGather to return after the first success, it took %v", d)
+	}
+	if results[2] != "fast" || results[1] != nil {
+		t.Errorf("Expected only the first success to be returned and received %v", results)
+	}
+}
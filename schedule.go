@@ -0,0 +1,181 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"log/slog"
+	"time"
+)
+
+// RateWindow is a period of the week during which a rate limit applies, such as business hours.
+type RateWindow struct {
+	// The time of day that the window starts, as the offset from midnight in the location of the clock
+	Start time.Duration
+	// The length of the window, which can extend into the following days
+	Duration time.Duration
+	// The days that the window starts on, or every day when empty
+	Days []time.Weekday
+	// The number of calls permitted each second during the window
+	Rate int
+}
+
+// rateSchedule holds the windows set by SetRateLimitSchedule.
+type rateSchedule struct {
+	windows []RateWindow
+	// An explicit rate limit suspends the schedule until ClearRateLimitOverride is called
+	override bool
+	// The window applied, or -1 outside of the windows
+	active int
+	// The time that the schedule is evaluated next, or zero to evaluate it on the next check
+	next time.Time
+}
+
+// SetRateLimitSchedule sets the rate limit of the service for the windows of the schedule. The
+// rate limit changes at the boundaries of the windows, as measured by the clock of the service,
+// and the first window of the schedule applies when several overlap. Outside of the windows, the
+// service has no rate limit. The calls reserved before a change keep their place, so the change
+// does not drop or duplicate calls. An explicit rate limit, set by SetRateLimit or SetRateLimiter,
+// overrides the schedule until ClearRateLimitOverride is called. An empty schedule removes it and
+// keeps the current rate limit.
+func (bas *BaseService) SetRateLimitSchedule(sched []RateWindow) {
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	bas.sched = rateSchedule{
+		windows: append([]RateWindow(nil), sched...),
+		active:  -2,
+	}
+	bas.checkSchedule()
+}
+
+// ClearRateLimitOverride resumes the schedule set by SetRateLimitSchedule after an explicit rate
+// limit was set.
+func (bas *BaseService) ClearRateLimitOverride() {
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	bas.sched.override = false
+	bas.sched.active = -2
+	bas.sched.next = time.Time{}
+	bas.checkSchedule()
+}
+
+// overrideSchedule suspends the schedule for an explicit rate limit. The rlock must be held.
+func (bas *BaseService) overrideSchedule() {
+	if len(bas.sched.windows) > 0 && !bas.sched.override {
+		bas.sched.override = true
+		bas.log(slog.LevelInfo, "rate limit schedule overridden", nil)
+	}
+}
+
+// rateView is the Limiter of the service, published to be loaded without locking.
+type rateView struct {
+	limiter Limiter
+	// Set while the schedule or the ramp can change the Limiter, so it must be checked under the rlock
+	dynamic bool
+}
+
+// publishLimiter publishes the Limiter for the checks of the rate limit. The rlock must be held.
+func (bas *BaseService) publishLimiter() {
+	bas.rview.Store(&rateView{
+		limiter: bas.rlimit,
+		dynamic: bas.ramp.active || (len(bas.sched.windows) > 0 && !bas.sched.override),
+	})
+}
+
+// limiter returns the Limiter of the service, once the schedule has been applied. The rlock is
+// only taken while the schedule or the ramp are in effect.
+func (bas *BaseService) limiter() Limiter {
+	if v := bas.rview.Load(); v != nil && !v.dynamic {
+		return v.limiter
+	}
+
+	bas.rlock.Lock()
+	defer bas.unlockRate()
+
+	bas.checkSchedule()
+	bas.checkRamp()
+	return bas.rlimit
+}
+
+// checkSchedule applies the rate of the window containing the current time, once a boundary of
+// the windows has been crossed. The rlock must be held.
+func (bas *BaseService) checkSchedule() {
+	s := &bas.sched
+	if len(s.windows) == 0 || s.override {
+		return
+	}
+
+	now := bas.clock.Now()
+	if !s.next.IsZero() && now.Before(s.next) {
+		return
+	}
+
+	var idx int
+	idx, s.next = s.evaluate(now)
+	if idx == s.active {
+		return
+	}
+	s.active = idx
+
+	var rate float64
+	if idx >= 0 {
+		rate = float64(s.windows[idx].Rate)
+	}
+	bas.setCeiling(rate)
+	bas.rctl.effective = rate
+	bas.rctl.successes = 0
+	if p, ok := bas.rlimit.(*pacer); ok && rate > 0 {
+		// Keep the reservations of the default limiter
+		p.setRate(rate)
+	} else {
+		bas.rlimit = bas.newLimiter(rate, bas.rctl.slack)
+	}
+	bas.log(slog.LevelInfo, "rate limit schedule changed", nil, slog.Int("window", idx), slog.Float64("rate", rate))
+}
+
+// The number of days before the current day searched for windows that are still open
+const scheduleLookback = 7
+
+// evaluate returns the index of the first window containing t, or -1, and the next time that a
+// window starts or ends.
+func (s *rateSchedule) evaluate(t time.Time) (int, time.Time) {
+	active := -1
+	var next time.Time
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	for i, w := range s.windows {
+		for d := -scheduleLookback; d <= scheduleLookback; d++ {
+			day := midnight.AddDate(0, 0, d)
+			if !w.onDay(day.Weekday()) {
+				continue
+			}
+
+			start := day.Add(w.Start)
+			end := start.Add(w.Duration)
+			if active < 0 && !t.Before(start) && t.Before(end) {
+				active = i
+			}
+			for _, b := range []time.Time{start, end} {
+				if b.After(t) && (next.IsZero() || b.Before(next)) {
+					next = b
+				}
+			}
+		}
+	}
+	return active, next
+}
+
+func (w RateWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
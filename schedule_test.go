@@ -0,0 +1,78 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+var weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+func TestRateLimitSchedule(t *testing.T) {
+	clock := newFakeClock()
+	// Monday, shortly before the end of business hours
+	clock.now = time.Date(2024, time.January, 1, 16, 59, 59, int(900*time.Millisecond), time.UTC)
+
+	h := new(recordHandler)
+	srv := newTestService(WithClock(clock))
+	srv.SetLogger(slog.New(h))
+	srv.SetRateLimitSchedule([]RateWindow{
+		{Start: 9 * time.Hour, Duration: 8 * time.Hour, Days: weekdays, Rate: 10},
+		{Start: 17 * time.Hour, Duration: 16 * time.Hour, Rate: 100},
+	})
+	if rate := srv.EffectiveRateLimit(); rate != 10 {
+		t.Fatalf("Expected the business hours rate of 10, received %v", rate)
+	}
+
+	srv.CheckRateLimit()
+	advanceCheck(t, srv, clock, 100*time.Millisecond)
+	// The call reserved before the boundary keeps its place, and the calls after it use the new rate
+	advanceCheck(t, srv, clock, 100*time.Millisecond)
+	advanceCheck(t, srv, clock, 10*time.Millisecond)
+	if rate := srv.EffectiveRateLimit(); rate != 100 {
+		t.Errorf("Expected the overnight rate of 100, received %v", rate)
+	}
+	var changes int
+	h.Lock()
+	for _, r := range h.records {
+		if r.Message == "rate limit schedule changed" {
+			changes++
+		}
+	}
+	h.Unlock()
+	if changes != 2 {
+		t.Errorf("Expected the two windows applied to be logged, received %d changes", changes)
+	}
+
+	// Saturday during the day is outside of the windows
+	clock.Advance(5*24*time.Hour - 5*time.Hour)
+	if rate := srv.EffectiveRateLimit(); rate != 0 {
+		t.Errorf("Expected no rate limit outside of the windows, received %v", rate)
+	}
+}
+
+func TestRateLimitScheduleOverride(t *testing.T) {
+	clock := newFakeClock()
+	clock.now = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	srv := newTestService(WithClock(clock))
+	srv.SetRateLimitSchedule([]RateWindow{
+		{Start: 9 * time.Hour, Duration: 8 * time.Hour, Days: weekdays, Rate: 10},
+		{Start: 17 * time.Hour, Duration: 16 * time.Hour, Rate: 100},
+	})
+
+	srv.SetRateLimit(1)
+	clock.Advance(6 * time.Hour)
+	if rate := srv.EffectiveRateLimit(); rate != 1 {
+		t.Errorf("Expected the explicit rate limit to override the schedule, received %v", rate)
+	}
+
+	srv.ClearRateLimitOverride()
+	if rate := srv.EffectiveRateLimit(); rate != 100 {
+		t.Errorf("Expected the schedule to resume, received %v", rate)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SchedulerOption configures a Scheduler during construction. Each Option is also a
+// SchedulerOption, so the intervals can be timed by the clock set with WithClock.
+type SchedulerOption interface {
+	applyScheduler(*Scheduler)
+}
+
+func (o Option) applyScheduler(s *Scheduler) {
+	o(&s.BaseService)
+}
+
+type schedulerOption func(*Scheduler)
+
+func (o schedulerOption) applyScheduler(s *Scheduler) {
+	o(s)
+}
+
+// WithImmediate makes the Scheduler produce a message as soon as it starts, instead of waiting
+// for the first interval.
+func WithImmediate() SchedulerOption {
+	return schedulerOption(func(s *Scheduler) {
+		s.immediate = true
+	})
+}
+
+// WithTickJitter randomizes each interval by up to the fraction of the interval in either
+// direction, so a fleet of schedulers does not tick simultaneously.
+func WithTickJitter(fraction float64) SchedulerOption {
+	return schedulerOption(func(s *Scheduler) {
+		s.jitter = fraction
+	})
+}
+
+// Scheduler is a service that sends the message produced by gen on its Output channel at each
+// interval. The ticks are skipped while the Scheduler is paused, and each message waits for the
+// rate limit of the Scheduler.
+type Scheduler struct {
+	BaseService
+	interval  time.Duration
+	gen       func() interface{}
+	immediate bool
+	jitter    float64
+	wg        sync.WaitGroup
+}
+
+// NewScheduler returns a Scheduler producing a message using gen at each interval.
+func NewScheduler(name string, interval time.Duration, gen func() interface{}, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		interval: interval,
+		gen:      gen,
+	}
+	s.Init(s, name)
+
+	for _, opt := range opts {
+		opt.applyScheduler(s)
+	}
+	return s
+}
+
+// OnStart implements the Service interface.
+func (s *Scheduler) OnStart() error {
+	s.wg.Add(1)
+	s.RunLabeled(s.Context(), "scheduler", s.schedule)
+	s.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (s *Scheduler) OnStop() error {
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Scheduler) schedule(ctx context.Context) {
+	defer s.wg.Done()
+
+	var timer Timer
+	defer func() { stopTimer(timer) }()
+
+	if s.immediate {
+		s.tick(ctx)
+	}
+	for {
+		timer = s.resetTimer(timer, s.nextInterval())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C():
+			s.tick(ctx)
+		}
+	}
+}
+
+func (s *Scheduler) nextInterval() time.Duration {
+	if s.jitter <= 0 {
+		return s.interval
+	}
+
+	spread := float64(s.interval) * s.jitter
+	return s.interval + time.Duration(spread*(2*rand.Float64()-1))
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	s.Beat()
+	if _, resumed := s.pauseChans(); resumed != nil {
+		return
+	}
+	if err := s.CheckRateLimitErr(); err != nil {
+		return
+	}
+
+	if msg := s.gen(); msg != nil {
+		s.emit(ctx, msg)
+	}
+}
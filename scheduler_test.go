@@ -0,0 +1,128 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCounter() (func() interface{}, *int64) {
+	var n int64
+	return func() interface{} {
+		return atomic.AddInt64(&n, 1)
+	}, &n
+}
+
+func TestScheduler(t *testing.T) {
+	clock := newFakeClock()
+	gen, count := newCounter()
+	s := NewScheduler("Scheduler", time.Hour, gen, WithClock(clock))
+
+	_ = s.Start()
+	for i := 1; i <= 3; i++ {
+		if d := clock.nextTimer(t); d != time.Hour {
+			t.Errorf("Expected the scheduler to wait for the interval and waited %v", d)
+		}
+		clock.Advance(time.Hour)
+		if msg := <-s.Output(); msg != int64(i) {
+			t.Errorf("Expected message %d at tick %d and received %v", i, i, msg)
+		}
+	}
+
+	_ = s.Stop()
+	if n := atomic.LoadInt64(count); n != 3 {
+		t.Errorf("Expected 3 messages to be produced and counted %d", n)
+	}
+	clock.Lock()
+	if n := len(clock.timers); n != 0 {
+		t.Errorf("The scheduler is still waiting on the clock after the stop")
+	}
+	clock.Unlock()
+}
+
+func TestSchedulerImmediate(t *testing.T) {
+	gen, _ := newCounter()
+	s := NewScheduler("Immediate", time.Hour, gen, WithImmediate(), WithClock(newFakeClock()))
+
+	_ = s.Start()
+	defer func() { _ = s.Stop() }()
+
+	select {
+	case msg := <-s.Output():
+		if msg != int64(1) {
+			t.Errorf("Expected the first message and received %v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The scheduler did not produce a message on start")
+	}
+}
+
+func TestSchedulerPaused(t *testing.T) {
+	clock := newFakeClock()
+	gen, count := newCounter()
+	s := NewScheduler("Paused", time.Hour, gen, WithClock(clock))
+
+	_ = s.Start()
+	defer func() { _ = s.Stop() }()
+
+	_ = s.Pause()
+	for i := 0; i < 2; i++ {
+		// The scheduler waits again once the tick was handled
+		clock.waitTimers(t, 1)
+		clock.Advance(time.Hour)
+	}
+	clock.waitTimers(t, 1)
+	_ = s.Resume()
+	clock.Advance(time.Hour)
+
+	if msg := <-s.Output(); msg != int64(1) {
+		t.Errorf("Expected the ticks while paused to be skipped and received %v", msg)
+	}
+	if n := atomic.LoadInt64(count); n != 1 {
+		t.Errorf("Expected 1 message to be produced and counted %d", n)
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	clock := newFakeClock()
+	gen, _ := newCounter()
+	s := NewScheduler("Jitter", time.Second, gen, WithTickJitter(0.1), WithClock(clock))
+
+	_ = s.Start()
+	defer func() { _ = s.Stop() }()
+
+	varied := false
+	for i := 0; i < 10; i++ {
+		d := clock.nextTimer(t)
+		if d < 900*time.Millisecond || d > 1100*time.Millisecond {
+			t.Errorf("The interval %v is outside of the jitter", d)
+		}
+		if d != time.Second {
+			varied = true
+		}
+		clock.Advance(d)
+		<-s.Output()
+	}
+	if !varied {
+		t.Errorf("The jitter did not change the intervals")
+	}
+}
+
+func TestSchedulerRealTimer(t *testing.T) {
+	gen, count := newCounter()
+	s := NewScheduler("Timer", 10*time.Millisecond, gen)
+
+	_ = s.Start()
+	for i := 0; i < 3; i++ {
+		<-s.Output()
+	}
+	_ = s.Stop()
+
+	if n := atomic.LoadInt64(count); n < 3 {
+		t.Errorf("Expected at least 3 messages and counted %d", n)
+	}
+}
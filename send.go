@@ -0,0 +1,86 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+// Send delivers the message to the Input channel of the service, including services that provide
+// their own Input channel. It returns the context error when the context is done first, or an error
+// wrapping ErrServiceStopped when the service is stopped or is being stopped by StopDrain. While the
+// service is paused, Send blocks until it is resumed, or returns an error wrapping ErrPaused when the
+// service was created using WithPauseErrors. Send does not block when the service was created using
+// WithOverflowPolicy with a policy that drops messages.
+func (bas *BaseService) Send(ctx context.Context, msg interface{}) error {
+	done := bas.Done()
+	select {
+	case <-done:
+		return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	default:
+	}
+	if err := bas.errDraining(); err != nil {
+		return err
+	}
+
+	bas.enqueued(msg)
+	if bas.overflow != PolicyBlock {
+		bas.trackQueued(msg)
+		bas.sendOverflow(msg)
+		bas.checkBacklog()
+		return nil
+	}
+	if err := bas.waitResumed(ctx, done); err != nil {
+		return err
+	}
+
+	bas.trackQueued(msg)
+	select {
+	case bas.service.Input() <- msg:
+		bas.checkBacklog()
+		return nil
+	case <-ctx.Done():
+		bas.untrackQueued(msg)
+		return ctx.Err()
+	case <-done:
+		bas.untrackQueued(msg)
+		return fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	}
+}
+
+// TrySend delivers the message to the Input channel only when it can be done without blocking,
+// and reports whether the message was delivered.
+func (bas *BaseService) TrySend(msg interface{}) bool {
+	if _, resumed := bas.pauseChans(); resumed != nil || bas.Context().Err() != nil || bas.draining() {
+		return false
+	}
+
+	bas.enqueued(msg)
+	bas.trackQueued(msg)
+	select {
+	case bas.service.Input() <- msg:
+		bas.checkBacklog()
+		return true
+	default:
+	}
+	bas.untrackQueued(msg)
+	return false
+}
+
+// Receive returns the next result from the Output channel of the service, including services that
+// provide their own Output channel. It returns the context error when the context is done first,
+// or an error wrapping ErrServiceStopped once the service is stopped, so consumers of the results
+// terminate with the service.
+func (bas *BaseService) Receive(ctx context.Context) (interface{}, error) {
+	select {
+	case msg := <-bas.service.Output():
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-bas.Done():
+		return nil, fmt.Errorf("%s: %w", bas.name, ErrServiceStopped)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	if err := srv.Send(context.Background(), "message"); err != nil {
+		t.Fatalf("Failed to send the message: %v", err)
+	}
+	if result := <-srv.Output(); result != "message" {
+		t.Errorf("Expected message to be returned and received %v", result)
+	}
+}
+
+func TestSendAfterStop(t *testing.T) {
+	srv := newTestService()
+
+	_ = srv.Start()
+	_ = srv.Stop()
+
+	start := time.Now()
+	if err := srv.Send(context.Background(), "late"); !errors.Is(err, ErrServiceStopped) {
+		t.Errorf("Expected ErrServiceStopped when sending to a stopped service, received %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Send did not return promptly after the service stopped, it took %v", elapsed)
+	}
+	if srv.TrySend("late") {
+		t.Errorf("TrySend delivered a message to a stopped service")
+	}
+}
+
+func TestSendStoppedWhileBlocked(t *testing.T) {
+	// The service never reads the Input channel
+	srv := new(failingService)
+	srv.Init(srv, "Blocked")
+	_ = srv.Start()
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.Send(context.Background(), "blocked") }()
+
+	time.Sleep(20 * time.Millisecond)
+	_ = srv.Stop()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrServiceStopped) {
+			t.Errorf("Expected ErrServiceStopped for the blocked send, received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The blocked send did not return after the service stopped")
+	}
+}
+
+func TestSendCanceledContext(t *testing.T) {
+	srv := newTestService()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := srv.Send(ctx, "canceled"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled when sending with a canceled context, received %v", err)
+	}
+}
+
+func TestTrySend(t *testing.T) {
+	srv := NewSimpleService("Buffered", func(req interface{}) (interface{}, error) {
+		return req, nil
+	}, WithInputBuffer(1))
+
+	if !srv.TrySend(1) {
+		t.Errorf("TrySend failed to deliver a message to the empty buffer")
+	}
+	if srv.TrySend(2) {
+		t.Errorf("TrySend delivered a message to the full buffer")
+	}
+}
+
+func TestReceive(t *testing.T) {
+	srv := newEchoService("Receive")
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "result"
+	if msg, err := srv.Receive(context.Background()); err != nil || msg != "result" {
+		t.Errorf("Expected the result to be received and received %v, %v", msg, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := srv.Receive(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context error and received %v", err)
+	}
+}
+
+func TestReceiveTerminatesOnStop(t *testing.T) {
+	srv := newEchoService("Consumer")
+
+	_ = srv.Start()
+	for i := 0; i < 3; i++ {
+		srv.Input() <- i
+	}
+
+	done := make(chan error)
+	go func() {
+		for {
+			if _, err := srv.Receive(context.Background()); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	_ = srv.Stop()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrServiceStopped) {
+			t.Errorf("Expected ErrServiceStopped and received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The consumer did not terminate when the service stopped")
+	}
+}
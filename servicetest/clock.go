@@ -0,0 +1,156 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package servicetest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/caffix/service"
+)
+
+// FakeClock is a service.Clock whose time only passes when Advance is called, so the rate limits,
+// idle timeouts, batching timers and TTLs of a service created using service.WithClock can be
+// tested without sleeping.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+	// Closed and replaced each time a timer is added
+	changed chan struct{}
+}
+
+// NewFakeClock returns a FakeClock set to the provided time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:     now,
+		changed: make(chan struct{}),
+	}
+}
+
+// Now implements the service.Clock interface.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer implements the service.Clock interface.
+func (c *FakeClock) NewTimer(d time.Duration) service.Timer {
+	t := &fakeTimer{
+		clock: c,
+		ch:    make(chan time.Time, 1),
+	}
+
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the time of the clock forward, and fires the timers expiring by the new time in
+// the order of their expiration.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].when.Before(c.timers[j].when)
+	})
+
+	var pending []*fakeTimer
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.fire(c.now)
+	}
+	c.timers = pending
+}
+
+// Timers returns the number of timers waiting to fire.
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+// BlockUntil waits until at least n timers are waiting to fire, so a test can advance the clock
+// once the goroutines under test are waiting on it.
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.mu.Lock()
+		waiting := len(c.timers)
+		changed := c.changed
+		c.mu.Unlock()
+
+		if waiting >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+// remove stops the timer when it is waiting to fire, and reports whether it was.
+// The clock must be locked by the caller.
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	ch    chan time.Time
+	when  time.Time
+}
+
+// C implements the service.Timer interface.
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+// Stop implements the service.Timer interface.
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.remove(t)
+}
+
+// Reset implements the service.Timer interface.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	active := c.remove(t)
+	t.when = c.now.Add(d)
+	if d <= 0 {
+		t.fire(c.now)
+		return active
+	}
+
+	c.timers = append(c.timers, t)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return active
+}
+
+// fire sends the time on the channel of the timer, unless a previous time was not received.
+func (t *fakeTimer) fire(now time.Time) {
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
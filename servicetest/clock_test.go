@@ -0,0 +1,80 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package servicetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/caffix/service"
+)
+
+func TestFakeClockTimers(t *testing.T) {
+	start := time.Now()
+	c := NewFakeClock(start)
+
+	late := c.NewTimer(2 * time.Second)
+	early := c.NewTimer(time.Second)
+	stopped := c.NewTimer(time.Second)
+	if !stopped.Stop() || c.Timers() != 2 {
+		t.Fatalf("Expected the stopped timer to be removed, %d timers remain", c.Timers())
+	}
+
+	c.Advance(time.Second)
+	select {
+	case now := <-early.C():
+		if !now.Equal(start.Add(time.Second)) {
+			t.Errorf("Expected the timer to fire at the advanced time and received %v", now)
+		}
+	default:
+		t.Errorf("The timer did not fire when the clock reached its expiration")
+	}
+	select {
+	case <-late.C():
+		t.Errorf("The timer fired before its expiration")
+	default:
+	}
+
+	if !late.Reset(time.Minute) || c.Timers() != 1 {
+		t.Errorf("Expected the reset timer to be active")
+	}
+	c.Advance(time.Minute)
+	if len(late.C()) != 1 || c.Timers() != 0 {
+		t.Errorf("Expected the reset timer to fire after the new duration")
+	}
+}
+
+func TestFakeClockRateLimit(t *testing.T) {
+	c := NewFakeClock(time.Now())
+	m := NewMock("mock", service.WithClock(c))
+	m.SetRateLimit(2)
+
+	_ = m.Start()
+	defer func() { _ = m.Stop() }()
+
+	ctx := context.Background()
+	if _, err := m.Request(ctx, "first"); err != nil {
+		t.Fatalf("The first request failed: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = m.Request(ctx, "second")
+		close(done)
+	}()
+
+	// The second request waits half a second on the rate limiter
+	c.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatalf("The rate limit was not enforced between requests")
+	default:
+	}
+
+	c.Advance(500 * time.Millisecond)
+	<-done
+	m.ExpectReceived(t, "second")
+}
@@ -0,0 +1,221 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package servicetest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caffix/service"
+)
+
+// DefaultTimeout is the time that Run waits for the outputs of a Case without a Timeout.
+const DefaultTimeout = 5 * time.Second
+
+// leakTimeout is the time that Run waits for the goroutines started by a case to exit.
+const leakTimeout = time.Second
+
+// Case describes the outputs expected from a service for a sequence of inputs.
+type Case struct {
+	Name   string
+	Inputs []interface{}
+	// The outputs expected, compared with the payloads of the *service.Message outputs
+	Want []interface{}
+	// Reports whether the outputs match Want, and defaults to Ordered
+	Compare func(got, want []interface{}) bool
+	// The time permitted for sending the inputs and receiving the outputs
+	Timeout time.Duration
+}
+
+// Ordered reports whether the outputs are equal to the expected values in the same order,
+// as determined by reflect.DeepEqual.
+func Ordered(got, want []interface{}) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unordered reports whether the outputs are equal to the expected values in any order,
+// for services that handle requests concurrently.
+func Unordered(got, want []interface{}) bool {
+	if len(got) != len(want) {
+		return false
+	}
+
+	matched := make([]bool, len(want))
+	for _, g := range got {
+		found := false
+		for i, w := range want {
+			if !matched[i] && reflect.DeepEqual(g, w) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Run starts the service, sends the inputs of the case on its Input channel, and collects as
+// many outputs as the case wants before the timeout. The service is stopped, and the test fails
+// when the outputs do not match, or when goroutines started during the case are still running
+// shortly after the stop. Since the goroutines of the whole process are checked, Run must not be
+// used by parallel tests.
+func Run(t testing.TB, srv service.Service, c Case) {
+	t.Helper()
+
+	before := goroutines()
+	if err := srv.Start(); err != nil {
+		t.Fatalf("%s: failed to start: %v", srv, err)
+	}
+
+	got := collect(srv, c)
+	if err := srv.Stop(); err != nil {
+		t.Errorf("%s: failed to stop: %v", srv, err)
+	}
+
+	compare := c.Compare
+	if compare == nil {
+		compare = Ordered
+	}
+	if !compare(got, c.Want) {
+		t.Errorf("%s: outputs mismatch (-want +got):\n%s", srv, diff(c.Want, got))
+	}
+	if leaked := leaks(before); len(leaked) > 0 {
+		t.Errorf("%s: %d goroutines leaked:\n\n%s", srv, len(leaked), strings.Join(leaked, "\n\n"))
+	}
+}
+
+// RunCases runs each case as a subtest using a new service returned by the factory, so the cases
+// of a table-driven test do not share the state of a service.
+func RunCases(t *testing.T, factory func() service.Service, cases ...Case) {
+	t.Helper()
+
+	for i, c := range cases {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("case %d", i)
+		}
+
+		t.Run(name, func(t *testing.T) {
+			Run(t, factory(), c)
+		})
+	}
+}
+
+// collect sends the inputs to the service while receiving the outputs, and returns the payloads
+// of the outputs received before the timeout.
+func collect(srv service.Service, c Case) []interface{} {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	// Closed when the outputs are collected, so the inputs not received do not keep the sender waiting
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for _, in := range c.Inputs {
+			select {
+			case srv.Input() <- in:
+			case <-done:
+				return
+			case <-srv.Done():
+				return
+			}
+		}
+	}()
+
+	var got []interface{}
+	for len(got) < len(c.Want) {
+		select {
+		case out := <-srv.Output():
+			got = append(got, service.Unwrap(out))
+		case <-deadline.C:
+			return got
+		}
+	}
+	return got
+}
+
+// diff formats the expected and received outputs side by side, one line per position.
+func diff(want, got []interface{}) string {
+	var b strings.Builder
+
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			fmt.Fprintf(&b, "- [%d]: %#v\n", i, want[i])
+		case i >= len(want):
+			fmt.Fprintf(&b, "+ [%d]: %#v\n", i, got[i])
+		case reflect.DeepEqual(want[i], got[i]):
+			fmt.Fprintf(&b, "  [%d]: %#v\n", i, got[i])
+		default:
+			fmt.Fprintf(&b, "- [%d]: %#v\n", i, want[i])
+			fmt.Fprintf(&b, "+ [%d]: %#v\n", i, got[i])
+		}
+	}
+	return b.String()
+}
+
+// goroutines returns the stacks of the running goroutines, keyed by the goroutine header.
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		s := string(stack)
+		// The header contains the goroutine ID followed by its state
+		id, _, _ := strings.Cut(s, " [")
+		stacks[id] = s
+	}
+	return stacks
+}
+
+// leaks returns the stacks of the goroutines started since the snapshot that are still running
+// after the goroutines are given time to exit.
+func leaks(before map[string]string) []string {
+	deadline := time.Now().Add(leakTimeout)
+
+	for wait := time.Millisecond; ; wait *= 2 {
+		var leaked []string
+		for id, stack := range goroutines() {
+			if _, found := before[id]; !found {
+				leaked = append(leaked, stack)
+			}
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			sort.Strings(leaked)
+			return leaked
+		}
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package servicetest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caffix/service"
+)
+
+func double(req interface{}) (interface{}, error) {
+	return 2 * req.(int), nil
+}
+
+func TestRunCases(t *testing.T) {
+	RunCases(t, func() service.Service {
+		return service.NewSimpleService("double", double, service.WithWorkers(4))
+	}, Case{
+		Name:    "unordered",
+		Inputs:  []interface{}{1, 2, 3, 4},
+		Want:    []interface{}{8, 6, 4, 2},
+		Compare: Unordered,
+	}, Case{
+		Inputs: []interface{}{5},
+		Want:   []interface{}{10},
+	})
+}
+
+func TestRunMismatch(t *testing.T) {
+	r := &failRecorder{TB: t}
+	srv := service.NewSimpleService("double", double)
+
+	Run(r, srv, Case{
+		Inputs:  []interface{}{1, 2},
+		Want:    []interface{}{2, 5, 6},
+		Timeout: 50 * time.Millisecond,
+	})
+	if len(r.failures) != 1 {
+		t.Fatalf("Expected the mismatch to be reported once and received %v", r.failures)
+	}
+	for _, line := range []string{"  [0]: 2", "- [1]: 5", "+ [1]: 4", "- [2]: 6"} {
+		if !strings.Contains(r.failures[0], line) {
+			t.Errorf("Expected the diff to contain %q and received:\n%s", line, r.failures[0])
+		}
+	}
+}
+
+// leakyService starts a goroutine that keeps running after the service is stopped.
+type leakyService struct {
+	service.BaseService
+	release chan struct{}
+}
+
+func (l *leakyService) OnStart() error {
+	go func() { <-l.release }()
+	return nil
+}
+
+func TestRunLeak(t *testing.T) {
+	r := &failRecorder{TB: t}
+	srv := &leakyService{release: make(chan struct{})}
+	srv.Init(srv, "leaky")
+	defer close(srv.release)
+
+	Run(r, srv, Case{})
+	if len(r.failures) != 1 || !strings.Contains(r.failures[0], "1 goroutines leaked") {
+		t.Errorf("Expected the leaked goroutine to be reported and received %v", r.failures)
+	}
+}
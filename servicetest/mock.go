@@ -0,0 +1,289 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package servicetest provides a scripted Service for testing the code that uses services.
+package servicetest
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caffix/service"
+)
+
+// DefaultWait is the time that the assertion helpers of a Mock wait for an expected event.
+const DefaultWait = time.Second
+
+// EventKind identifies what was recorded by a Mock.
+type EventKind int
+
+// The kinds of the events recorded by a Mock.
+const (
+	EventStart EventKind = iota
+	EventOnStart
+	EventStop
+	EventOnStop
+	// A request was received by the handler
+	EventReceived
+	// A result was returned by the handler
+	EventResult
+)
+
+var eventNames = [...]string{
+	EventStart:    "start",
+	EventOnStart:  "on start",
+	EventStop:     "stop",
+	EventOnStop:   "on stop",
+	EventReceived: "received",
+	EventResult:   "result",
+}
+
+// String implements the Stringer interface.
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventNames) {
+		return "unknown"
+	}
+	return eventNames[k]
+}
+
+// Event is a lifecycle call or a message recorded by a Mock.
+type Event struct {
+	Kind EventKind
+	// The payload of the request or the result, and nil for lifecycle calls
+	Msg  interface{}
+	Err  error
+	Time time.Time
+}
+
+type scripted struct {
+	input  interface{}
+	result interface{}
+	err    error
+}
+
+// Mock is a Service that handles each request using the responses scripted with On and OnError,
+// or the handler set by SetHandler, and echoes the other requests. Every lifecycle call, request
+// and result is recorded with the time it happened. Mock embeds service.BaseService, so it
+// supports the features of the package such as Request, rate limits and StopDrain.
+type Mock struct {
+	service.BaseService
+	mu      sync.Mutex
+	script  []scripted
+	handler func(req interface{}) (interface{}, error)
+	events  []Event
+	// Closed and replaced each time an event is recorded
+	changed chan struct{}
+}
+
+// NewMock returns a Mock with the provided name and options.
+func NewMock(name string, opts ...service.Option) *Mock {
+	m := &Mock{changed: make(chan struct{})}
+
+	m.Init(m, name, opts...)
+	return m
+}
+
+// On scripts the result returned for the requests equal to the input, as determined by
+// reflect.DeepEqual. The payload of a *service.Message is compared.
+func (m *Mock) On(input, result interface{}) *Mock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.script = append(m.script, scripted{input: input, result: result})
+	return m
+}
+
+// OnError scripts the error returned for the requests equal to the input.
+func (m *Mock) OnError(input interface{}, err error) *Mock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.script = append(m.script, scripted{input: input, err: err})
+	return m
+}
+
+// SetHandler sets the function handling the requests that do not match a scripted input.
+func (m *Mock) SetHandler(fn func(req interface{}) (interface{}, error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handler = fn
+}
+
+// Start implements the Service interface.
+func (m *Mock) Start() error {
+	m.record(EventStart, nil, nil)
+	return m.BaseService.Start()
+}
+
+// Stop implements the Service interface.
+func (m *Mock) Stop() error {
+	m.record(EventStop, nil, nil)
+	return m.BaseService.Stop()
+}
+
+// OnStart implements the Service interface.
+func (m *Mock) OnStart() error {
+	m.record(EventOnStart, nil, nil)
+	return m.Run(m.handle)
+}
+
+// OnStop implements the Service interface.
+func (m *Mock) OnStop() error {
+	m.record(EventOnStop, nil, nil)
+	return nil
+}
+
+func (m *Mock) handle(req interface{}) (interface{}, error) {
+	m.record(EventReceived, req, nil)
+
+	result, err := m.respond(req)
+	m.record(EventResult, result, err)
+	return result, err
+}
+
+func (m *Mock) respond(req interface{}) (interface{}, error) {
+	m.mu.Lock()
+	fn := m.handler
+	for _, s := range m.script {
+		if reflect.DeepEqual(s.input, req) {
+			m.mu.Unlock()
+			return s.result, s.err
+		}
+	}
+	m.mu.Unlock()
+
+	if fn != nil {
+		return fn(req)
+	}
+	return req, nil
+}
+
+func (m *Mock) record(kind EventKind, msg interface{}, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, Event{
+		Kind: kind,
+		Msg:  msg,
+		Err:  err,
+		Time: time.Now(),
+	})
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// Events returns the events recorded, in the order they happened.
+func (m *Mock) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Event(nil), m.events...)
+}
+
+// Received returns the requests received by the handler, in the order they were received.
+func (m *Mock) Received() []interface{} {
+	var msgs []interface{}
+
+	for _, e := range m.Events() {
+		if e.Kind == EventReceived {
+			msgs = append(msgs, e.Msg)
+		}
+	}
+	return msgs
+}
+
+// waitFor waits until the condition is satisfied by the events recorded, and reports whether
+// it was satisfied before the timeout.
+func (m *Mock) waitFor(timeout time.Duration, cond func(events []Event) bool) bool {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	for {
+		m.mu.Lock()
+		satisfied := cond(m.events)
+		changed := m.changed
+		m.mu.Unlock()
+
+		if satisfied {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-t.C:
+			return false
+		}
+	}
+}
+
+func hasKind(kind EventKind) func(events []Event) bool {
+	return func(events []Event) bool {
+		for _, e := range events {
+			if e.Kind == kind {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ExpectStarted fails the test when Start has not been called within DefaultWait.
+func (m *Mock) ExpectStarted(t testing.TB) {
+	t.Helper()
+
+	if !m.waitFor(DefaultWait, hasKind(EventStart)) {
+		t.Errorf("%s: expected the service to be started", m)
+	}
+}
+
+// ExpectStopped fails the test when Stop has not been called within DefaultWait.
+func (m *Mock) ExpectStopped(t testing.TB) {
+	t.Helper()
+
+	if !m.waitFor(DefaultWait, hasKind(EventStop)) {
+		t.Errorf("%s: expected the service to be stopped", m)
+	}
+}
+
+// ExpectReceived fails the test when no request equal to the message, as determined by
+// reflect.DeepEqual, has been received within DefaultWait.
+func (m *Mock) ExpectReceived(t testing.TB, msg interface{}) {
+	t.Helper()
+
+	received := m.waitFor(DefaultWait, func(events []Event) bool {
+		for _, e := range events {
+			if e.Kind == EventReceived && reflect.DeepEqual(e.Msg, msg) {
+				return true
+			}
+		}
+		return false
+	})
+	if !received {
+		t.Errorf("%s: expected the request %v to be received, received %v", m, msg, m.Received())
+	}
+}
+
+// WaitForOutputs reads n results from the Output channel and returns them. The test fails when
+// the results are not available before the timeout, and the results read are returned.
+func (m *Mock) WaitForOutputs(t testing.TB, n int, timeout time.Duration) []interface{} {
+	t.Helper()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var results []interface{}
+	for len(results) < n {
+		select {
+		case msg := <-m.Output():
+			results = append(results, msg)
+		case <-timer.C:
+			t.Errorf("%s: expected %d results and received %d", m, n, len(results))
+			return results
+		}
+	}
+	return results
+}
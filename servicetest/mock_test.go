@@ -0,0 +1,100 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package servicetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/caffix/service"
+)
+
+// failRecorder captures the failures reported by the assertion helpers.
+type failRecorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *failRecorder) Helper() {}
+
+func (r *failRecorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestMockScript(t *testing.T) {
+	failed := errors.New("failed")
+	m := NewMock("mock").On("ping", "pong").OnError("bad", failed)
+	m.SetHandler(func(req interface{}) (interface{}, error) {
+		return fmt.Sprintf("handled %v", req), nil
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start the mock: %v", err)
+	}
+	defer func() { _ = m.Stop() }()
+	m.ExpectStarted(t)
+
+	ctx := context.Background()
+	if result, err := m.Request(ctx, "ping"); err != nil || result != "pong" {
+		t.Errorf("Expected the scripted result and received %v, %v", result, err)
+	}
+	if _, err := m.Request(ctx, "bad"); !errors.Is(err, failed) {
+		t.Errorf("Expected the scripted error and received %v", err)
+	}
+	if result, err := m.Request(ctx, "other"); err != nil || result != "handled other" {
+		t.Errorf("Expected the handler result and received %v, %v", result, err)
+	}
+	m.ExpectReceived(t, "bad")
+
+	if received := m.Received(); len(received) != 3 || received[0] != "ping" || received[2] != "other" {
+		t.Errorf("Expected the requests in order and received %v", received)
+	}
+}
+
+func TestMockOutputs(t *testing.T) {
+	m := NewMock("mock")
+	_ = m.Start()
+	defer func() { _ = m.Stop() }()
+
+	for i := 0; i < 3; i++ {
+		m.Input() <- i
+	}
+	m.ExpectReceived(t, 2)
+
+	results := m.WaitForOutputs(t, 3, time.Second)
+	if len(results) != 3 || results[0] != 0 || results[2] != 2 {
+		t.Errorf("Expected the echoed requests and received %v", results)
+	}
+
+	r := &failRecorder{TB: t}
+	if results := m.WaitForOutputs(r, 1, 10*time.Millisecond); len(results) != 0 || len(r.failures) != 1 {
+		t.Errorf("Expected a failure without results and received %v, %v", results, r.failures)
+	}
+}
+
+func TestMockLifecycle(t *testing.T) {
+	m := NewMock("mock", service.WithInputBuffer(1))
+	before := time.Now()
+
+	_ = m.Start()
+	_ = m.Stop()
+	m.ExpectStopped(t)
+
+	var kinds []EventKind
+	for _, e := range m.Events() {
+		kinds = append(kinds, e.Kind)
+		if e.Time.Before(before) {
+			t.Errorf("Expected the %v event to be timestamped", e.Kind)
+		}
+	}
+
+	want := []EventKind{EventStart, EventOnStart, EventStop, EventOnStop}
+	if fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Errorf("Expected the lifecycle calls %v and received %v", want, kinds)
+	}
+}
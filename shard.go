@@ -0,0 +1,78 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// DefaultShardBuffer is the default capacity of the queue of each shard.
+const DefaultShardBuffer = 16
+
+// ShardStats is a snapshot of the activity of a shard of a PoolService.
+type ShardStats struct {
+	Queued    int
+	Processed uint64
+}
+
+type shard struct {
+	jobs      chan poolJob
+	processed atomic.Uint64
+}
+
+// WithSharding makes the PoolService send the requests with the same key to the same worker, so
+// they are processed in the order they were received, while requests with different keys are
+// processed in parallel. Each of the shards has a single worker and its own queue, so the number
+// of workers provided to NewPoolService is replaced by the number of shards.
+func WithSharding(key func(req interface{}) string, shards int) PoolOption {
+	return poolOption(func(ps *PoolService) {
+		if shards < 1 {
+			shards = 1
+		}
+
+		ps.shardKey = key
+		ps.size = shards
+	})
+}
+
+// WithShardBuffer sets the capacity of the queue of each shard. When the queue of a shard is
+// full, the requests for the shard wait, and the requests for the other shards wait behind them.
+func WithShardBuffer(size int) PoolOption {
+	return poolOption(func(ps *PoolService) {
+		ps.shardBuf = size
+	})
+}
+
+// shardOf returns the index of the shard processing the request.
+func (ps *PoolService) shardOf(req interface{}, shards int) int {
+	if ps.shardKey == nil || shards < 2 {
+		return 0
+	}
+
+	f := fnv.New32a()
+	_, _ = f.Write([]byte(ps.shardKey(Unwrap(req))))
+	return int(f.Sum32() % uint32(shards))
+}
+
+// ShardStats returns a snapshot of the activity of each shard, or nil when WithSharding was not used.
+func (ps *PoolService) ShardStats() []ShardStats {
+	ps.Lock()
+	shards := ps.shards
+	ps.Unlock()
+
+	if ps.shardKey == nil {
+		return nil
+	}
+
+	stats := make([]ShardStats, len(shards))
+	for i, s := range shards {
+		stats[i] = ShardStats{
+			Queued:    len(s.jobs),
+			Processed: s.processed.Load(),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,129 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// SharedLimiter is a rate limit shared by several services, such as the services querying an API
+// with the same key. Each service waits on its own member Limiter, and the members take turns
+// drawing from the shared rate, so a service with many waiting calls cannot starve the others.
+// The calls of each member are permitted in the order they started waiting.
+type SharedLimiter struct {
+	sync.Mutex
+	name    string
+	pacer   *pacer
+	members []*sharedMember
+	turn    int
+	running bool
+}
+
+type sharedMember struct {
+	shared  *SharedLimiter
+	waiters []*sharedWaiter
+}
+
+type sharedWaiter struct {
+	n     int
+	ready chan struct{}
+}
+
+// NewSharedLimiter returns a SharedLimiter permitting persec calls each second across its members.
+func NewSharedLimiter(persec int) *SharedLimiter {
+	return newSharedLimiter("SharedLimiter", persec, realClock{})
+}
+
+func newSharedLimiter(name string, persec int, clock Clock) *SharedLimiter {
+	return &SharedLimiter{
+		name:  name,
+		pacer: newPacer(float64(max(persec, 1)), 0, clock),
+	}
+}
+
+// Member returns a new member of the shared rate limit, which can be provided to a service using
+// SetRateLimiter. The returned Limiter implements the WeightedLimiter interface.
+func (s *SharedLimiter) Member() Limiter {
+	s.Lock()
+	defer s.Unlock()
+
+	m := &sharedMember{shared: s}
+	s.members = append(s.members, m)
+	return m
+}
+
+// Wait implements the Limiter interface.
+func (m *sharedMember) Wait(ctx context.Context) error {
+	return m.WaitN(ctx, 1)
+}
+
+// WaitN implements the WeightedLimiter interface.
+func (m *sharedMember) WaitN(ctx context.Context, n int) error {
+	s := m.shared
+	w := &sharedWaiter{n: n, ready: make(chan struct{})}
+
+	s.Lock()
+	m.waiters = append(m.waiters, w)
+	if !s.running {
+		s.running = true
+		goLabeled(context.Background(), s.name, "dispatcher", s.dispatch)
+	}
+	s.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	// The call may have been permitted while the context was done
+	select {
+	case <-w.ready:
+		return nil
+	default:
+	}
+	for i, other := range m.waiters {
+		if other == w {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			break
+		}
+	}
+	return ctx.Err()
+}
+
+// dispatch permits the waiting calls at the shared rate, taking the members in turn, and returns
+// once no calls are waiting.
+func (s *SharedLimiter) dispatch(ctx context.Context) {
+	for {
+		s.Lock()
+		w := s.nextWaiter()
+		if w == nil {
+			s.running = false
+			s.Unlock()
+			return
+		}
+		s.Unlock()
+
+		_ = s.pacer.WaitN(ctx, w.n)
+		close(w.ready)
+	}
+}
+
+// nextWaiter removes and returns the first waiter of the next member with calls waiting.
+func (s *SharedLimiter) nextWaiter() *sharedWaiter {
+	for i := 0; i < len(s.members); i++ {
+		idx := (s.turn + i) % len(s.members)
+		if m := s.members[idx]; len(m.waiters) > 0 {
+			w := m.waiters[0]
+			m.waiters = m.waiters[1:]
+			s.turn = idx + 1
+			return w
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupSharedRateLimit(t *testing.T) {
+	g := NewGroup()
+	for _, name := range []string{"A", "B", "C", "D"} {
+		g.Add(newEchoService(name))
+	}
+	g.SetSharedRateLimit(2)
+	if err := g.StartAll(); err != nil {
+		t.Fatalf("Failed to start the group: %v", err)
+	}
+	defer func() { _ = g.StopAll() }()
+
+	var total atomic.Int64
+	stop := make(chan struct{})
+	for _, srv := range g.Members() {
+		go func(srv Service) {
+			for {
+				select {
+				case <-stop:
+					return
+				case srv.Input() <- "req":
+				case <-srv.Output():
+					total.Add(1)
+				}
+			}
+		}(srv)
+	}
+
+	// The calls are permitted at 0s, 0.5s and 1s across the group
+	time.Sleep(1250 * time.Millisecond)
+	close(stop)
+	if n := total.Load(); n < 2 || n > 4 {
+		t.Errorf("Expected about 3 requests to be processed by the group, received %d", n)
+	}
+}
+
+// waiting returns the number of calls waiting on the members of the shared limiter.
+func (s *SharedLimiter) waiting() int {
+	s.Lock()
+	defer s.Unlock()
+
+	var n int
+	for _, m := range s.members {
+		n += len(m.waiters)
+	}
+	return n
+}
+
+func TestSharedLimiterFairness(t *testing.T) {
+	clock := newFakeClock()
+	s := newSharedLimiter("Shared", 1, clock)
+	chatty, quiet := s.Member(), s.Member()
+
+	// The first call is permitted right away, and the second is reserved the next turn
+	grants := make(chan string, 10)
+	for i := 0; i < 5; i++ {
+		go func() {
+			if chatty.Wait(context.Background()) == nil {
+				grants <- "chatty"
+			}
+		}()
+	}
+	for len(grants)+s.waiting() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	go func() {
+		if quiet.Wait(context.Background()) == nil {
+			grants <- "quiet"
+		}
+	}()
+	for s.waiting() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The quiet member takes the turn after the reserved call, instead of waiting for the others
+	if g := <-grants; g != "chatty" {
+		t.Fatalf("Expected the first call of the chatty member, received %s", g)
+	}
+	for _, want := range []string{"chatty", "quiet"} {
+		clock.waitTimers(t, 1)
+		clock.Advance(time.Second)
+		if g := <-grants; g != want {
+			t.Errorf("Expected the call of the %s member, received %s", want, g)
+		}
+	}
+}
+
+func TestSharedLimiterCancel(t *testing.T) {
+	clock := newFakeClock()
+	s := newSharedLimiter("Shared", 1, clock)
+	m := s.Member()
+
+	if err := m.Wait(context.Background()); err != nil {
+		t.Fatalf("Expected the first call to be permitted, received %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- m.Wait(ctx) }()
+	clock.waitTimers(t, 1)
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, received %v", err)
+	}
+}
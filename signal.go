@@ -0,0 +1,191 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout is the time permitted for a group to finish its queued requests during a
+// shutdown requested by a signal.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// SignalService shuts down a group of services when the process receives a shutdown signal. The
+// first signal stops the services of the group using StopDrain, so the queued requests are
+// finished within the drain timeout, and the SignalService stops itself once the group has
+// stopped. A second signal received during the drain aborts the shutdown by calling the abort
+// function, which exits the process by default. Other signals can be mapped to callbacks using
+// Handle, such as SIGHUP to reload a configuration. The progress of the shutdown is logged
+// through the logger of the service, or of the group when the service has none, and an error
+// stopping the group is reported on the Errors channel.
+type SignalService struct {
+	BaseService
+	group    *Group
+	sigs     []os.Signal
+	timeout  atomic.Int64
+	hmu      sync.Mutex
+	handlers map[os.Signal]func(os.Signal)
+	abort    func()
+	notify   chan os.Signal
+	wg       sync.WaitGroup
+}
+
+// NewSignalService returns a SignalService shutting down the group when one of the signals is
+// received, or SIGINT and SIGTERM when no signal is provided.
+func NewSignalService(group *Group, sigs ...os.Signal) *SignalService {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	ss := &SignalService{
+		group:    group,
+		sigs:     sigs,
+		handlers: make(map[os.Signal]func(os.Signal)),
+		abort:    func() { os.Exit(1) },
+	}
+	ss.timeout.Store(int64(DefaultShutdownTimeout))
+
+	ss.Init(ss, "SignalService")
+	group.Lock()
+	inheritLogger(ss, group.logger)
+	group.Unlock()
+	return ss
+}
+
+// SetDrainTimeout sets the time permitted for the group to finish its queued requests once the
+// first shutdown signal is received. The remaining services are stopped when it expires.
+func (ss *SignalService) SetDrainTimeout(d time.Duration) {
+	ss.timeout.Store(int64(d))
+}
+
+// SetAbort sets the function called when a second shutdown signal is received during the drain.
+// When the function returns, the remaining services are stopped without finishing their requests.
+func (ss *SignalService) SetAbort(fn func()) {
+	ss.hmu.Lock()
+	defer ss.hmu.Unlock()
+
+	ss.abort = fn
+}
+
+// Handle calls the function each time the signal is received, instead of shutting down the
+// group. A nil function removes the callback, and the signal is ignored from then on, unless it
+// is one of the shutdown signals.
+func (ss *SignalService) Handle(sig os.Signal, fn func(os.Signal)) {
+	ss.hmu.Lock()
+	defer ss.hmu.Unlock()
+
+	if fn == nil {
+		delete(ss.handlers, sig)
+		return
+	}
+
+	ss.handlers[sig] = fn
+	if ss.notify != nil {
+		signal.Notify(ss.notify, sig)
+	}
+}
+
+// OnStart implements the Service interface.
+func (ss *SignalService) OnStart() error {
+	ch := make(chan os.Signal, 2)
+
+	ss.hmu.Lock()
+	ss.notify = ch
+	signal.Notify(ch, ss.sigs...)
+	for sig := range ss.handlers {
+		signal.Notify(ch, sig)
+	}
+	ss.hmu.Unlock()
+
+	ss.wg.Add(1)
+	ss.RunLabeled(ss.Context(), "signal", func(ctx context.Context) { ss.watch(ctx, ch) })
+	ss.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (ss *SignalService) OnStop() error {
+	ss.hmu.Lock()
+	signal.Stop(ss.notify)
+	ss.notify = nil
+	ss.hmu.Unlock()
+
+	ss.wg.Wait()
+	return nil
+}
+
+func (ss *SignalService) watch(ctx context.Context, ch chan os.Signal) {
+	defer ss.wg.Done()
+
+	var stopped chan struct{}
+	var cancel context.CancelFunc
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopped:
+			go func() { _ = ss.Stop() }()
+			return
+		case sig := <-ch:
+			attr := slog.String("signal", sig.String())
+
+			ss.hmu.Lock()
+			fn, abort := ss.handlers[sig], ss.abort
+			ss.hmu.Unlock()
+
+			switch {
+			case fn != nil:
+				ss.log(slog.LevelInfo, "signal received", nil, attr)
+				fn(sig)
+			case !ss.shutdownSignal(sig):
+				// The callback of the signal was removed
+			case cancel == nil:
+				timeout := time.Duration(ss.timeout.Load())
+				ss.log(slog.LevelInfo, "shutting down the group", nil, attr, slog.Duration("timeout", timeout))
+
+				var dctx context.Context
+				dctx, cancel = context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+
+				stopped = make(chan struct{})
+				ss.RunLabeled(dctx, "shutdown", func(ctx context.Context) { ss.shutdown(ctx, stopped) })
+			default:
+				ss.log(slog.LevelWarn, "aborting the shutdown of the group", nil, attr)
+				abort()
+				cancel()
+			}
+		}
+	}
+}
+
+func (ss *SignalService) shutdownSignal(sig os.Signal) bool {
+	for _, s := range ss.sigs {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+func (ss *SignalService) shutdown(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+
+	start := time.Now()
+	if err := ss.group.StopDrain(ctx); err != nil {
+		err = fmt.Errorf("%s: %w", ss, err)
+		ss.log(slog.LevelError, "the group stopped with errors", err)
+		ss.ReportError(err)
+		return
+	}
+	ss.log(slog.LevelInfo, "the group stopped", nil, slog.Duration("elapsed", time.Since(start)))
+}
@@ -0,0 +1,148 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func raise(t *testing.T, sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(sig); err != nil {
+		t.Skipf("Signals cannot be sent to the test process: %v", err)
+	}
+}
+
+func waitStopped(t *testing.T, srv Service) {
+	select {
+	case <-srv.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s was not stopped", srv)
+	}
+}
+
+// syncBuffer is a log destination that can be written by several goroutines.
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.String()
+}
+
+func TestSignalService(t *testing.T) {
+	var logs syncBuffer
+	srv := newEchoService("Echo")
+	group := NewGroup(srv)
+	group.SetLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+	_ = group.StartAll()
+
+	ss := NewSignalService(group, syscall.SIGTERM)
+	reloads := make(chan os.Signal, 1)
+	ss.Handle(syscall.SIGHUP, func(sig os.Signal) { reloads <- sig })
+	_ = ss.Start()
+
+	raise(t, syscall.SIGHUP)
+	select {
+	case sig := <-reloads:
+		if sig != syscall.SIGHUP {
+			t.Errorf("Expected SIGHUP, received %v", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The callback of SIGHUP was not called")
+	}
+	if s := srv.State(); s != StateRunning {
+		t.Errorf("Expected the group to keep running after SIGHUP, the state is %v", s)
+	}
+
+	raise(t, syscall.SIGTERM)
+	waitStopped(t, srv)
+	waitStopped(t, ss)
+	if out := logs.String(); !strings.Contains(out, "shutting down the group") || !strings.Contains(out, "signal=terminated") {
+		t.Errorf("Expected the shutdown to be logged, received %q", out)
+	}
+}
+
+func TestSignalServiceAbort(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	srv := NewSimpleService("Busy", func(req interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return req, nil
+	})
+	group := NewGroup(srv)
+	_ = group.StartAll()
+	srv.Input() <- "a"
+	<-started
+
+	ss := NewSignalService(group, syscall.SIGTERM)
+	aborted := make(chan struct{})
+	ss.SetAbort(func() { close(aborted) })
+	_ = ss.Start()
+
+	// The drain waits for the busy service until the second signal
+	raise(t, syscall.SIGTERM)
+	time.Sleep(50 * time.Millisecond)
+	raise(t, syscall.SIGTERM)
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The second signal did not abort the shutdown")
+	}
+	waitStopped(t, ss)
+	if err := <-ss.Errors(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the aborted drain to be reported, received %v", err)
+	}
+}
+
+func TestGroupStopDrain(t *testing.T) {
+	srv := NewSimpleService("Upper", func(req interface{}) (interface{}, error) {
+		return strings.ToUpper(req.(string)), nil
+	})
+	group := NewGroup(srv)
+	_ = group.StartAll()
+
+	srv.Input() <- "a"
+	srv.Input() <- "b"
+	if err := group.StopDrain(context.Background()); err != nil {
+		t.Errorf("Expected the group to stop, received %v", err)
+	}
+	if n := srv.Stats().Emitted; n != 2 {
+		t.Errorf("Expected the queued requests to be finished, %d were emitted", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewGroup(srv).StopDrain(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context error, received %v", err)
+	}
+}
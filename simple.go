@@ -0,0 +1,25 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+// SimpleService executes a function for each request received, without the need to define a
+// type that embeds BaseService.
+type SimpleService struct {
+	BaseService
+	fn func(req interface{}) (interface{}, error)
+}
+
+// NewSimpleService returns a service that executes fn for each request using the Run method.
+func NewSimpleService(name string, fn func(req interface{}) (interface{}, error), opts ...Option) *SimpleService {
+	srv := &SimpleService{fn: fn}
+
+	srv.Init(srv, name, opts...)
+	return srv
+}
+
+// OnStart implements the Service interface.
+func (ss *SimpleService) OnStart() error {
+	return ss.Run(ss.fn)
+}
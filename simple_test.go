@@ -0,0 +1,83 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSimpleService(t *testing.T) {
+	srv := NewSimpleService("Simple", func(req interface{}) (interface{}, error) {
+		return req.(int) * 2, nil
+	})
+	var _ Service = srv
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 1; i <= 3; i++ {
+		srv.Input() <- i
+		if result := <-srv.Output(); result != i*2 {
+			t.Errorf("Expected %d to be returned and received %v", i*2, result)
+		}
+	}
+}
+
+func TestSimpleServiceWorkers(t *testing.T) {
+	var mu sync.Mutex
+	var inflight, highest int
+	srv := NewSimpleService("Workers", func(req interface{}) (interface{}, error) {
+		mu.Lock()
+		inflight++
+		if inflight > highest {
+			highest = inflight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+		return req, nil
+	}, WithWorkers(4), WithInputBuffer(8), WithOutputBuffer(8))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for i := 0; i < 8; i++ {
+		srv.Input() <- i
+	}
+	for i := 0; i < 8; i++ {
+		<-srv.Output()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if highest != 4 {
+		t.Errorf("Expected four requests to be handled concurrently, but %d were", highest)
+	}
+}
+
+func TestSimpleServiceRateLimit(t *testing.T) {
+	srv := NewSimpleService("Limited", func(req interface{}) (interface{}, error) {
+		return req, nil
+	})
+	srv.SetRateLimit(10)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		srv.Input() <- i
+		<-srv.Output()
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("The rate limit was not enforced, four requests took %v", elapsed)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import "time"
+
+// SlowOption configures the detection set by SetSlowThreshold.
+type SlowOption func(*slowConfig)
+
+type slowConfig struct {
+	threshold time.Duration
+	fn        func(msg interface{}, elapsed time.Duration)
+	running   bool
+}
+
+// SlowWhileRunning calls the function as soon as the threshold has elapsed, while the handler is
+// still running, so requests that hang are detected. The function is called once the handler
+// returns by default.
+func SlowWhileRunning() SlowOption {
+	return func(cfg *slowConfig) {
+		cfg.running = true
+	}
+}
+
+// SetSlowThreshold calls the function for each request whose handler, executed by the Run method,
+// takes longer than the threshold, with the request and the time elapsed. The requests are counted
+// in the SlowRequests field of the Stats. The time includes the retries and the middleware, and is
+// measured with the clock of the service. A threshold of zero disables the detection.
+func (bas *BaseService) SetSlowThreshold(d time.Duration, fn func(msg interface{}, elapsed time.Duration), opts ...SlowOption) {
+	if d <= 0 {
+		bas.slow.Store(nil)
+		return
+	}
+
+	cfg := &slowConfig{threshold: d, fn: fn}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	bas.slow.Store(cfg)
+}
+
+// watchSlow measures the handler time of the request from the start, and returns the function to
+// call once the handler has returned.
+func (bas *BaseService) watchSlow(req interface{}, start time.Time) func() {
+	cfg := bas.slow.Load()
+	if cfg == nil {
+		return func() {}
+	}
+
+	if !cfg.running {
+		return func() {
+			if elapsed := bas.since(start); elapsed > cfg.threshold {
+				bas.slowRequest(cfg, req, elapsed)
+			}
+		}
+	}
+
+	t := bas.clock.NewTimer(cfg.threshold)
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-t.C():
+			bas.slowRequest(cfg, req, bas.since(start))
+		case <-finished:
+		}
+	}()
+
+	return func() {
+		t.Stop()
+		close(finished)
+	}
+}
+
+func (bas *BaseService) slowRequest(cfg *slowConfig, req interface{}, elapsed time.Duration) {
+	bas.stats.slow.Add(1)
+	if cfg.fn != nil {
+		cfg.fn(req, elapsed)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+type slowCall struct {
+	msg     interface{}
+	elapsed time.Duration
+}
+
+func TestSlowThreshold(t *testing.T) {
+	clock := newFakeClock()
+	srv := NewSimpleService("Slow", func(req interface{}) (interface{}, error) {
+		if req == "slow" {
+			clock.Advance(3 * time.Second)
+		}
+		return req, nil
+	}, WithClock(clock))
+
+	calls := make(chan slowCall, 2)
+	srv.SetSlowThreshold(time.Second, func(msg interface{}, elapsed time.Duration) {
+		calls <- slowCall{msg: msg, elapsed: elapsed}
+	})
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for _, req := range []string{"fast", "slow"} {
+		srv.Input() <- req
+		<-srv.Output()
+	}
+
+	select {
+	case c := <-calls:
+		if c.msg != "slow" || c.elapsed != 3*time.Second {
+			t.Errorf("Expected the slow request after 3s, received %v after %v", c.msg, c.elapsed)
+		}
+	default:
+		t.Fatal("The slow request was not detected")
+	}
+	if len(calls) != 0 {
+		t.Errorf("Expected only the slow request to be detected")
+	}
+	if n := srv.Stats().SlowRequests; n != 1 {
+		t.Errorf("Expected 1 slow request, received %d", n)
+	}
+}
+
+func TestSlowWhileRunning(t *testing.T) {
+	clock := newFakeClock()
+	release := make(chan struct{})
+	srv := NewSimpleService("Hanging", func(req interface{}) (interface{}, error) {
+		<-release
+		return req, nil
+	}, WithClock(clock))
+
+	calls := make(chan slowCall, 2)
+	srv.SetSlowThreshold(time.Second, func(msg interface{}, elapsed time.Duration) {
+		calls <- slowCall{msg: msg, elapsed: elapsed}
+	}, SlowWhileRunning())
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "hang"
+	clock.waitTimers(t, 1)
+	clock.Advance(time.Second)
+
+	select {
+	case c := <-calls:
+		if c.msg != "hang" || c.elapsed != time.Second {
+			t.Errorf("Expected the hanging request after 1s, received %v after %v", c.msg, c.elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The hanging request was not detected while running")
+	}
+
+	close(release)
+	<-srv.Output()
+	if len(calls) != 0 {
+		t.Errorf("Expected the request to be detected once")
+	}
+	if n := srv.Stats().SlowRequests; n != 1 {
+		t.Errorf("Expected 1 slow request, received %d", n)
+	}
+
+	// Disabling the detection leaves the requests alone
+	srv.SetSlowThreshold(0, nil)
+	srv.Input() <- "fast"
+	<-srv.Output()
+	if n := srv.Stats().SlowRequests; n != 1 {
+		t.Errorf("Expected 1 slow request, received %d", n)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import "fmt"
+
+// State is a stage in the lifecycle of a service.
+type State int
+
+// The states of a service. A new service is started through StateStarting into StateRunning,
+// or into StateFailed when OnStart returns an error. The run of a failed service is rolled back,
+// so its Done channel is closed, and Start can be called again. Stopping a running service moves
+// it through StateStopping into StateStopped, while a failed service moves into StateStopped
+// directly, and Restart moves it back into StateStarting. A running service moves into
+// StatePaused while Pause is in effect, and back into StateRunning by Resume.
+const (
+	StateNew State = iota
+	StateStarting
+	StateRunning
+	StateStopping
+	StateStopped
+	StateFailed
+	StatePaused
+)
+
+var stateNames = [...]string{
+	StateNew:      "new",
+	StateStarting: "starting",
+	StateRunning:  "running",
+	StateStopping: "stopping",
+	StateStopped:  "stopped",
+	StateFailed:   "failed",
+	StatePaused:   "paused",
+}
+
+// String implements the Stringer interface.
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *State) UnmarshalText(text []byte) error {
+	for i, name := range stateNames {
+		if name == string(text) {
+			*s = State(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown state %q", text)
+}
+
+// State returns the current state of the service. The state is read without locking the service,
+// so it can be checked for each request.
+func (bas *BaseService) State() State {
+	return State(bas.state.Load())
+}
+
+// OnStateChange registers a function that is called each time the service moves into another state.
+// The functions are called synchronously in the order they were registered, and the service is not
+// locked during the calls, so they can safely query the service.
+func (bas *BaseService) OnStateChange(fn func(srv Service, old, new State)) {
+	bas.Lock()
+	defer bas.Unlock()
+
+	bas.stateFns = append(bas.stateFns, fn)
+}
+
+func (bas *BaseService) setState(s State) {
+	bas.Lock()
+	old := State(bas.state.Swap(int32(s)))
+	fns := bas.stateFns
+	bas.Unlock()
+
+	if old == s {
+		return
+	}
+	for _, fn := range fns {
+		fn(bas.service, old, s)
+	}
+}
+
+// running returns true when the service has been started and has not been stopped since.
+func (bas *BaseService) running() bool {
+	switch bas.State() {
+	case StateStarting, StateRunning, StatePaused:
+		return true
+	}
+	return false
+}
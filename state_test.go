@@ -0,0 +1,371 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+type blockingService struct {
+	BaseService
+	entered chan State
+	release chan struct{}
+}
+
+func newBlockingService() *blockingService {
+	srv := &blockingService{
+		entered: make(chan State),
+		release: make(chan struct{}),
+	}
+
+	srv.Init(srv, "Blocking")
+	return srv
+}
+
+func (srv *blockingService) OnStart() error {
+	srv.entered <- srv.State()
+	<-srv.release
+	return nil
+}
+
+func (srv *blockingService) OnStop() error {
+	srv.entered <- srv.State()
+	<-srv.release
+	return nil
+}
+
+func TestStateTransitions(t *testing.T) {
+	srv := newBlockingService()
+
+	if s := srv.State(); s != StateNew {
+		t.Errorf("Expected a new service to be in the %v state, not %v", StateNew, s)
+	}
+
+	for _, step := range []struct {
+		name   string
+		call   func() error
+		during State
+		after  State
+	}{
+		{"Start", srv.Start, StateStarting, StateRunning},
+		{"Stop", srv.Stop, StateStopping, StateStopped},
+	} {
+		errs := make(chan error, 1)
+		go func() { errs <- step.call() }()
+
+		if s := <-srv.entered; s != step.during {
+			t.Errorf("Expected the %v state during %s, not %v", step.during, step.name, s)
+		}
+		if s := srv.State(); s != step.during {
+			t.Errorf("Expected State to return %v during %s, not %v", step.during, step.name, s)
+		}
+		srv.release <- struct{}{}
+
+		if err := <-errs; err != nil {
+			t.Fatalf("%s returned an error: %v", step.name, err)
+		}
+		if s := srv.State(); s != step.after {
+			t.Errorf("Expected the %v state after %s, not %v", step.after, step.name, s)
+		}
+	}
+
+	// Restart moves the stopped service through starting back into running
+	errs := make(chan error, 1)
+	go func() { errs <- srv.Restart() }()
+	if s := <-srv.entered; s != StateStarting {
+		t.Errorf("Expected the %v state during Restart, not %v", StateStarting, s)
+	}
+	srv.release <- struct{}{}
+	if err := <-errs; err != nil {
+		t.Fatalf("Restart returned an error: %v", err)
+	}
+	if s := srv.State(); s != StateRunning {
+		t.Errorf("Expected the %v state after Restart, not %v", StateRunning, s)
+	}
+
+	go func() { errs <- srv.Stop() }()
+	<-srv.entered
+	srv.release <- struct{}{}
+	<-errs
+}
+
+func TestStateFailed(t *testing.T) {
+	srv := new(failingService)
+	srv.Init(srv, "Failing")
+
+	if err := srv.Start(); !errors.Is(err, errStartFailed) {
+		t.Fatalf("Expected the OnStart error to be returned, received %v", err)
+	}
+	if s := srv.State(); s != StateFailed {
+		t.Errorf("Expected the %v state after OnStart failed, not %v", StateFailed, s)
+	}
+	select {
+	case <-srv.Done():
+	default:
+		t.Errorf("Expected the Done channel to be closed after OnStart failed")
+	}
+	if err := srv.Stop(); err != nil {
+		t.Errorf("Failed to stop the failed service: %v", err)
+	}
+	if s := srv.State(); s != StateStopped {
+		t.Errorf("Expected the %v state after stopping the failed service, not %v", StateStopped, s)
+	}
+}
+
+// flakyStartService fails to start the first time.
+type flakyStartService struct {
+	BaseService
+	attempts int
+}
+
+func (srv *flakyStartService) OnStart() error {
+	srv.attempts++
+	if srv.attempts == 1 {
+		return errStartFailed
+	}
+	return nil
+}
+
+func TestStartRetry(t *testing.T) {
+	srv := new(flakyStartService)
+	srv.Init(srv, "Flaky")
+
+	if err := srv.Start(); !errors.Is(err, errStartFailed) {
+		t.Fatalf("Expected the OnStart error to be returned, received %v", err)
+	}
+	if srv.running() {
+		t.Errorf("Expected the failed service not to be running")
+	}
+
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Expected the service to be started again, received %v", err)
+	}
+	if s := srv.State(); s != StateRunning {
+		t.Errorf("Expected the %v state after the retry, not %v", StateRunning, s)
+	}
+	select {
+	case <-srv.Done():
+		t.Errorf("Expected the Done channel of the new run to be open")
+	default:
+	}
+
+	if err := srv.Stop(); err != nil {
+		t.Errorf("Failed to stop the service: %v", err)
+	}
+	if n := srv.attempts; n != 2 {
+		t.Errorf("Expected OnStart to be called twice, received %d", n)
+	}
+}
+
+func TestStateIllegalTransitions(t *testing.T) {
+	srv := newTestService()
+
+	if err := srv.Stop(); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Expected ErrNotStarted when stopping a new service, received %v", err)
+	}
+	if err := srv.Restart(); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Expected ErrNotStarted when restarting a new service, received %v", err)
+	}
+	if s := srv.State(); s != StateNew {
+		t.Errorf("The illegal transitions changed the state to %v", s)
+	}
+
+	_ = srv.Start()
+	if err := srv.Start(); !errors.Is(err, ErrAlreadyStarted) {
+		t.Errorf("Expected ErrAlreadyStarted when starting a running service, received %v", err)
+	}
+
+	_ = srv.Stop()
+	if err := srv.Stop(); !errors.Is(err, ErrAlreadyStopped) {
+		t.Errorf("Expected ErrAlreadyStopped when stopping a stopped service, received %v", err)
+	}
+	if err := srv.Start(); !errors.Is(err, ErrAlreadyStopped) {
+		t.Errorf("Expected ErrAlreadyStopped when starting a stopped service, received %v", err)
+	}
+	if s := srv.State(); s != StateStopped {
+		t.Errorf("The illegal transitions changed the state to %v", s)
+	}
+}
+
+func TestStateString(t *testing.T) {
+	for state, name := range map[State]string{
+		StateNew:      "new",
+		StateStarting: "starting",
+		StateRunning:  "running",
+		StateStopping: "stopping",
+		StateStopped:  "stopped",
+		StateFailed:   "failed",
+		StatePaused:   "paused",
+		State(42):     "unknown",
+	} {
+		if s := state.String(); s != name {
+			t.Errorf("Expected %s and received %s", name, s)
+		}
+	}
+}
+
+type transition struct {
+	old, new State
+}
+
+func TestOnStateChange(t *testing.T) {
+	srv := newTestService()
+
+	var first, second []transition
+	srv.OnStateChange(func(s Service, old, new State) {
+		if s != Service(srv) {
+			t.Errorf("The callback received %v instead of the service", s)
+		}
+		// Querying the service must not deadlock
+		if st := srv.State(); st != new {
+			t.Errorf("Expected State to return %v during the callback, not %v", new, st)
+		}
+		first = append(first, transition{old, new})
+	})
+	srv.OnStateChange(func(s Service, old, new State) {
+		if len(first) != len(second)+1 {
+			t.Errorf("The callbacks were not called in the order they were registered")
+		}
+		second = append(second, transition{old, new})
+	})
+
+	_ = srv.Start()
+	_ = srv.Stop()
+
+	expected := []transition{
+		{StateNew, StateStarting},
+		{StateStarting, StateRunning},
+		{StateRunning, StateStopping},
+		{StateStopping, StateStopped},
+	}
+	for _, got := range [][]transition{first, second} {
+		if len(got) != len(expected) {
+			t.Fatalf("Expected the transitions %v and received %v", expected, got)
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Errorf("Expected the transitions %v and received %v", expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestOnStateChangeFailure(t *testing.T) {
+	srv := new(failingService)
+	srv.Init(srv, "Failing")
+
+	var events []transition
+	srv.OnStateChange(func(s Service, old, new State) {
+		events = append(events, transition{old, new})
+	})
+
+	_ = srv.Start()
+	_ = srv.Restart()
+	_ = srv.Stop()
+
+	expected := []transition{
+		{StateNew, StateStarting},
+		{StateStarting, StateFailed},
+		{StateFailed, StateStarting},
+		{StateStarting, StateFailed},
+		{StateFailed, StateStopped},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected the transitions %v and received %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Expected the transitions %v and received %v", expected, events)
+			break
+		}
+	}
+}
+
+func TestStateText(t *testing.T) {
+	for s := StateNew; s <= StatePaused; s++ {
+		text, _ := s.MarshalText()
+
+		var got State
+		if err := got.UnmarshalText(text); err != nil || got != s {
+			t.Errorf("Expected %v to be decoded from %q, received %v, %v", s, text, got, err)
+		}
+	}
+
+	var s State
+	if err := s.UnmarshalText([]byte("sleeping")); err == nil {
+		t.Error("Expected an unknown state name to be rejected")
+	}
+}
+
+func BenchmarkStateRead(b *testing.B) {
+	srv := newTestService()
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if !srv.running() {
+				b.Fatal("Expected the service to be running")
+			}
+		}
+	})
+}
+
+// slowStartService opens its connection in OnStart until the service is stopped, and closes it
+// in OnStop.
+type slowStartService struct {
+	BaseService
+	entered chan struct{}
+	conn    *bytes.Buffer
+	closed  bool
+}
+
+func (srv *slowStartService) OnStart() error {
+	close(srv.entered)
+
+	select {
+	case <-srv.Context().Done():
+	case <-time.After(5 * time.Second):
+	}
+	srv.conn = new(bytes.Buffer)
+	return nil
+}
+
+func (srv *slowStartService) OnStop() error {
+	srv.conn.Reset()
+	srv.closed = true
+	return nil
+}
+
+func TestStopDuringStart(t *testing.T) {
+	srv := &slowStartService{entered: make(chan struct{})}
+	srv.Init(srv, "SlowStart")
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.Start() }()
+	<-srv.entered
+
+	start := time.Now()
+	if err := srv.Stop(); err != nil {
+		t.Errorf("Failed to stop the service: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the stop to cancel the start in progress, waited %v", elapsed)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("Expected the start to complete, received %v", err)
+	}
+	if !srv.closed {
+		t.Errorf("Expected OnStop to be called after OnStart returned")
+	}
+	if s := srv.State(); s != StateStopped {
+		t.Errorf("Expected the %v state, not %v", StateStopped, s)
+	}
+}
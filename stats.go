@@ -0,0 +1,142 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the activity of a service.
+type Stats struct {
+	// The number of requests received on the Input channel
+	Received uint64 `json:"received"`
+	// The number of results sent on the Output channel
+	Emitted uint64 `json:"emitted"`
+	// The number of requests discarded by the policy set by WithOverflowPolicy
+	Dropped uint64 `json:"dropped"`
+	// The number of requests skipped by the window set by SetDedupWindow
+	Duplicates uint64 `json:"duplicates"`
+	// The number of errors provided to ReportError
+	Errors uint64 `json:"errors"`
+	// The number of results of the shadow differing from the primary, counted by a Mirror
+	Mismatches uint64 `json:"mismatches"`
+	// The number of times the rate limit was checked, and the total duration spent waiting
+	RateLimitWaits uint64        `json:"ratelimit_waits"`
+	RateLimitWait  time.Duration `json:"ratelimit_wait"`
+	// The longest time a single check of the rate limit waited
+	RateLimitMaxWait time.Duration `json:"ratelimit_max_wait"`
+	// The number of messages dequeued with the time they were sent, and the total duration they
+	// spent on the queue
+	QueueWaits uint64        `json:"queue_waits"`
+	QueueWait  time.Duration `json:"queue_wait"`
+	// The distributions of the time the messages spent on the queue, and of the time the handler
+	// executed by the Run method took for each request
+	QueueLatency   LatencyHistogram `json:"queue_latency"`
+	HandlerLatency LatencyHistogram `json:"handler_latency"`
+	// The number of requests detected by the threshold set by SetSlowThreshold
+	SlowRequests uint64 `json:"slow_requests"`
+	// The time of the last request received or result sent
+	LastActivity time.Time `json:"last_activity"`
+	// The duration since the service was started, or zero when it is not running
+	Uptime time.Duration `json:"uptime"`
+	// The state of the circuit breaker set by WithCircuitBreaker
+	Breaker BreakerState `json:"breaker"`
+	// The time the ramp set by SetRateLimitRamp reached its target, or zero while it is ramping
+	RampCompleted time.Time `json:"ramp_completed"`
+}
+
+type statCounters struct {
+	received   atomic.Uint64
+	emitted    atomic.Uint64
+	dropped    atomic.Uint64
+	duplicates atomic.Uint64
+	errors     atomic.Uint64
+	mismatches atomic.Uint64
+	waits      atomic.Uint64
+	waited     atomic.Int64
+	maxWait    atomic.Int64
+	queued     atomic.Uint64
+	queueWait  atomic.Int64
+	slow       atomic.Uint64
+	queueHist  latencyHistogram
+	handleHist latencyHistogram
+	activity   atomic.Int64
+	startedAt  atomic.Int64
+	rampDone   atomic.Int64
+}
+
+// Stats returns a snapshot of the counters maintained for the service. The requests and results
+// handled by the Run method are counted automatically, while other services can use IncReceived
+// and IncEmitted.
+func (bas *BaseService) Stats() Stats {
+	c := &bas.stats
+	s := Stats{
+		Received:         c.received.Load(),
+		Emitted:          c.emitted.Load(),
+		Dropped:          c.dropped.Load(),
+		Duplicates:       c.duplicates.Load(),
+		Errors:           c.errors.Load(),
+		Mismatches:       c.mismatches.Load(),
+		RateLimitWaits:   c.waits.Load(),
+		RateLimitWait:    time.Duration(c.waited.Load()),
+		RateLimitMaxWait: time.Duration(c.maxWait.Load()),
+		QueueWaits:       c.queued.Load(),
+		QueueWait:        time.Duration(c.queueWait.Load()),
+		QueueLatency:     c.queueHist.snapshot(),
+		HandlerLatency:   c.handleHist.snapshot(),
+		SlowRequests:     c.slow.Load(),
+		Breaker:          bas.BreakerState(),
+	}
+
+	if last := c.activity.Load(); last != 0 {
+		s.LastActivity = time.Unix(0, last)
+	}
+	if start := c.startedAt.Load(); start != 0 {
+		s.Uptime = bas.since(time.Unix(0, start))
+	}
+	if done := c.rampDone.Load(); done != 0 {
+		s.RampCompleted = time.Unix(0, done)
+	}
+	return s
+}
+
+// IncReceived counts a request received by the service.
+func (bas *BaseService) IncReceived() {
+	now := bas.clock.Now().UnixNano()
+
+	bas.stats.received.Add(1)
+	bas.stats.activity.Store(now)
+	bas.idle.lastInput.Store(now)
+}
+
+// IncEmitted counts a result sent by the service.
+func (bas *BaseService) IncEmitted() {
+	bas.stats.emitted.Add(1)
+	bas.stats.activity.Store(bas.clock.Now().UnixNano())
+}
+
+func (bas *BaseService) countWait(d time.Duration) {
+	bas.stats.waits.Add(1)
+	bas.stats.waited.Add(int64(d))
+	storeMax(&bas.stats.maxWait, int64(d))
+	bas.waitAlert.record(bas, d)
+}
+
+// storeMax stores the value when it is larger than the current value.
+func storeMax(a *atomic.Int64, v int64) {
+	for {
+		cur := a.Load()
+		if v <= cur || a.CompareAndSwap(cur, v) {
+			return
+		}
+	}
+}
+
+func (bas *BaseService) countQueueWait(d time.Duration) {
+	bas.stats.queued.Add(1)
+	bas.stats.queueWait.Add(int64(d))
+	bas.stats.queueHist.record(d)
+}
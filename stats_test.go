@@ -0,0 +1,99 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	srv := NewSimpleService("Stats", func(req interface{}) (interface{}, error) {
+		if req == "fail" {
+			return nil, errors.New("failed")
+		}
+		return req, nil
+	})
+	srv.SetRateLimit(1000)
+
+	if s := srv.Stats(); s.Uptime != 0 || !s.LastActivity.IsZero() {
+		t.Errorf("Expected no uptime or activity before the start, received %+v", s)
+	}
+
+	before := time.Now()
+	_ = srv.Start()
+	for _, req := range []string{"one", "two", "fail"} {
+		srv.Input() <- req
+	}
+	for i := 0; i < 2; i++ {
+		<-srv.Output()
+	}
+	<-srv.Errors()
+
+	s := srv.Stats()
+	if s.Received != 3 {
+		t.Errorf("Expected 3 requests received and counted %d", s.Received)
+	}
+	if s.Emitted != 2 {
+		t.Errorf("Expected 2 results emitted and counted %d", s.Emitted)
+	}
+	if s.Errors != 1 {
+		t.Errorf("Expected 1 error and counted %d", s.Errors)
+	}
+	if s.RateLimitWaits < 3 {
+		t.Errorf("Expected at least 3 rate limit waits and counted %d", s.RateLimitWaits)
+	}
+	if s.LastActivity.Before(before) {
+		t.Errorf("The last activity time %v is before the service was started", s.LastActivity)
+	}
+	if s.Uptime <= 0 {
+		t.Errorf("Expected a positive uptime for the running service, received %v", s.Uptime)
+	}
+
+	_ = srv.Stop()
+	if s := srv.Stats(); s.Uptime != 0 {
+		t.Errorf("Expected no uptime after the service stopped, received %v", s.Uptime)
+	}
+}
+
+func TestStatsCounters(t *testing.T) {
+	srv := newTestService()
+
+	srv.IncReceived()
+	srv.IncReceived()
+	srv.IncEmitted()
+	srv.ReportError(errors.New("counted"))
+
+	s := srv.Stats()
+	if s.Received != 2 || s.Emitted != 1 || s.Errors != 1 {
+		t.Errorf("The counters do not match the calls: %+v", s)
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	srv := newTestService()
+	srv.IncReceived()
+
+	data, err := json.Marshal(srv.Stats())
+	if err != nil {
+		t.Fatalf("Failed to marshal the stats: %v", err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Failed to unmarshal the stats: %v", err)
+	}
+	for _, name := range []string{"received", "emitted", "dropped", "errors", "ratelimit_waits",
+		"ratelimit_wait", "queue_waits", "queue_wait", "last_activity", "uptime"} {
+		if _, found := fields[name]; !found {
+			t.Errorf("The %s field is missing from %s", name, data)
+		}
+	}
+	if fields["received"] != float64(1) {
+		t.Errorf("Expected received to be 1 in %s", data)
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReaderService parses the records of a stream, one per line, and sends each record on its Output
+// channel. Once the end of the stream is reached and the records have been received from the
+// Output channel, the service stops itself, which closes its Done channel. When the stream fails
+// with another error, the service stops itself with the error, which is then returned by Err. The
+// lines that cannot be decoded or that are longer than the maximum record size are reported on
+// the Errors channel and skipped. The stream is read by a single goroutine, so a read in progress when the service is
+// stopped completes in the background. The record is sent by the next run when the service was
+// restarted meanwhile, and routed to the dead letters otherwise.
+type ReaderService struct {
+	BaseService
+	src     *bufio.Reader
+	codec   LineCodec
+	maxSize atomic.Int64
+	// The lines read from the stream, received by the run of the service
+	lines    chan readLine
+	scanning bool
+}
+
+type readLine struct {
+	data []byte
+	err  error
+}
+
+// NewReaderService returns a ReaderService parsing the records of r with the codec, or as JSON
+// values when the codec is nil.
+func NewReaderService(name string, r io.Reader, codec LineCodec, opts ...Option) *ReaderService {
+	if codec == nil {
+		codec = JSONCodec[interface{}]()
+	}
+
+	rs := &ReaderService{
+		src:   bufio.NewReader(r),
+		codec: codec,
+		lines: make(chan readLine),
+	}
+	rs.maxSize.Store(DefaultMaxLineSize)
+
+	rs.Init(rs, name, opts...)
+	return rs
+}
+
+// SetMaxRecordSize sets the length limit of the lines, not counting the newline.
+func (rs *ReaderService) SetMaxRecordSize(n int) {
+	rs.maxSize.Store(int64(n))
+}
+
+// OnStart implements the Service interface.
+func (rs *ReaderService) OnStart() error {
+	// The goroutine of a previous run is still scanning while its read is blocked
+	rs.Lock()
+	if !rs.scanning {
+		rs.scanning = true
+		rs.RunLabeled(context.Background(), "scanner", func(context.Context) { rs.scan() })
+	}
+	rs.Unlock()
+
+	rs.RunLabeled(rs.Context(), "reader", rs.read)
+	rs.Ready()
+	return nil
+}
+
+func (rs *ReaderService) read(ctx context.Context) {
+	for {
+		var l readLine
+
+		select {
+		case <-ctx.Done():
+			return
+		case l = <-rs.lines:
+		}
+
+		if result, ok := rs.decode(l.data); ok {
+			rs.emit(ctx, result)
+		}
+		switch {
+		case errors.Is(l.err, io.EOF):
+			rs.finish(ctx, nil)
+			return
+		case l.err != nil:
+			err := fmt.Errorf("%s: %w", rs, l.err)
+
+			rs.ReportError(err)
+			if !errors.Is(l.err, errRecordTooLarge) {
+				rs.finish(ctx, err)
+				return
+			}
+		}
+	}
+}
+
+// scan reads the lines of the stream and hands them to the runs of the service, until the service
+// has stopped.
+func (rs *ReaderService) scan() {
+	for {
+		line, err := rs.next()
+		if !rs.handOff(readLine{data: line, err: err}) {
+			return
+		}
+	}
+}
+
+// handOff sends the line to the run of the service, including a run started while the line was
+// read, and returns false when the service has stopped. The record is then routed to the dead letters.
+func (rs *ReaderService) handOff(l readLine) bool {
+	for {
+		ctx := rs.Context()
+		select {
+		case rs.lines <- l:
+			return true
+		case <-ctx.Done():
+		}
+
+		// The context is replaced when the service is restarted
+		rs.Lock()
+		stopped := rs.Context() == ctx
+		if stopped {
+			rs.scanning = false
+		}
+		rs.Unlock()
+
+		if stopped {
+			if result, ok := rs.decode(l.data); ok {
+				rs.ReportDeadLetter(result, DeadLetterCanceled, ctx.Err())
+			}
+			return false
+		}
+	}
+}
+
+// decode returns the record of the line, and reports the lines that cannot be decoded.
+func (rs *ReaderService) decode(line []byte) (interface{}, bool) {
+	if len(line) == 0 {
+		return nil, false
+	}
+
+	result, err := rs.codec.Unmarshal(line)
+	if err != nil {
+		rs.ReportError(fmt.Errorf("%s: %w", rs, err))
+		return nil, false
+	}
+	rs.IncReceived()
+	return result, true
+}
+
+var errRecordTooLarge = errors.New("record exceeds the maximum size")
+
+// next returns the next line without the line terminator. The last line of the stream does not
+// need a newline. A line longer than the maximum size is discarded, and errRecordTooLarge is returned.
+func (rs *ReaderService) next() ([]byte, error) {
+	limit := int(rs.maxSize.Load())
+
+	var line []byte
+	var large bool
+	for {
+		frag, err := rs.src.ReadSlice('\n')
+		if !large {
+			line = append(line, frag...)
+			if len(bytes.TrimRight(line, "\r\n")) > limit {
+				large = true
+				line = nil
+			}
+		}
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case large:
+			// The end of the stream is returned by the next call
+			return nil, errRecordTooLarge
+		}
+		return bytes.TrimRight(line, "\r\n"), err
+	}
+}
+
+// finish stops the service once the records have been received from the Output channel, and
+// records the error that ended the stream as the cause of the stop.
+func (rs *ReaderService) finish(ctx context.Context, cause error) {
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+
+	for len(rs.Output()) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+	if ctx.Err() == nil {
+		_ = rs.StopWithError(cause)
+	}
+}
+
+// WriterService encodes the payloads received on its Input channel and writes them to a stream,
+// one per line. The writes are buffered while more payloads are queued on the Input channel, and
+// flushed once the queue is empty. The payloads that cannot be encoded or written are reported on
+// the Errors channel and routed to the dead letters. StopDrain writes the queued payloads before
+// the service is stopped, while Stop discards them.
+type WriterService struct {
+	BaseService
+	dst   *bufio.Writer
+	codec LineCodec
+	wg    sync.WaitGroup
+}
+
+// NewWriterService returns a WriterService writing the payloads to w encoded by the codec, or as
+// JSON values when the codec is nil.
+func NewWriterService(name string, w io.Writer, codec LineCodec, opts ...Option) *WriterService {
+	if codec == nil {
+		codec = JSONCodec[interface{}]()
+	}
+
+	ws := &WriterService{
+		dst:   bufio.NewWriter(w),
+		codec: codec,
+	}
+
+	ws.Init(ws, name, opts...)
+	return ws
+}
+
+// OnStart implements the Service interface.
+func (ws *WriterService) OnStart() error {
+	ws.wg.Add(1)
+	ws.RunLabeled(ws.Context(), "writer", ws.write)
+	ws.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (ws *WriterService) OnStop() error {
+	ws.wg.Wait()
+
+	if err := ws.dst.Flush(); err != nil {
+		return fmt.Errorf("%s: %w", ws, err)
+	}
+	return nil
+}
+
+func (ws *WriterService) write(ctx context.Context) {
+	defer ws.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-ws.Input():
+			ws.MarkBusy()
+			ws.IncReceived()
+
+			if err := ws.writeLine(Unwrap(req)); err != nil {
+				err = fmt.Errorf("%s: %w", ws, err)
+				ws.ReportError(err)
+				ws.ReportDeadLetter(req, DeadLetterHandlerError, err)
+			}
+			if len(ws.Input()) == 0 {
+				if err := ws.dst.Flush(); err != nil {
+					ws.ReportError(fmt.Errorf("%s: %w", ws, err))
+				}
+			}
+			ws.MarkIdle()
+		}
+	}
+}
+
+func (ws *WriterService) writeLine(payload interface{}) error {
+	data, err := ws.codec.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if bytes.IndexByte(data, '\n') >= 0 {
+		return errors.New("encoded payload contains a newline")
+	}
+
+	if _, err := ws.dst.Write(data); err != nil {
+		return err
+	}
+	return ws.dst.WriteByte('\n')
+}
@@ -0,0 +1,148 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// readAll returns the records sent by the service before it stopped itself.
+func readAll(t *testing.T, rs *ReaderService) []interface{} {
+	var records []interface{}
+
+	for {
+		select {
+		case rec := <-rs.Output():
+			records = append(records, rec)
+		case <-rs.Done():
+			return records
+		case <-time.After(5 * time.Second):
+			t.Fatal("The service did not stop at the end of the stream")
+		}
+	}
+}
+
+func TestReaderService(t *testing.T) {
+	rs := NewReaderService("Reader", strings.NewReader("{\"a\":1}\n\n[bad\r\n{\"b\":2}"), nil)
+	_ = rs.Start()
+
+	records := readAll(t, rs)
+	if len(records) != 2 {
+		t.Fatalf("Expected two records, received %v", records)
+	}
+	if m, ok := records[1].(map[string]interface{}); !ok || m["b"] != float64(2) {
+		t.Errorf("Expected the last line without a newline to be parsed, received %v", records[1])
+	}
+	if err := <-rs.Errors(); err == nil || !strings.Contains(err.Error(), "Reader") {
+		t.Errorf("Expected the line that cannot be decoded to be reported, received %v", err)
+	}
+	if err := rs.Err(); err != nil {
+		t.Errorf("Expected a clean stop at the end of the stream, received %v", err)
+	}
+}
+
+func TestReaderServiceReadError(t *testing.T) {
+	errBroken := errors.New("broken stream")
+	rs := NewReaderService("Reader", io.MultiReader(strings.NewReader("first\n"), iotest.ErrReader(errBroken)), TextCodec())
+	_ = rs.Start()
+
+	if records := readAll(t, rs); len(records) != 1 || records[0] != "first" {
+		t.Errorf("Expected the record before the error, received %v", records)
+	}
+	if err := rs.Err(); !errors.Is(err, errBroken) {
+		t.Errorf("Expected the read error to be the cause of the stop, received %v", err)
+	}
+}
+
+func TestReaderServiceMaxRecordSize(t *testing.T) {
+	// The long line does not fit in the buffer of the reader
+	long := strings.Repeat("x", 10000)
+	rs := NewReaderService("Reader", strings.NewReader("short\n"+long+"\n"+long[:5000]+"\nlast"), TextCodec())
+	rs.SetMaxRecordSize(5000)
+	_ = rs.Start()
+
+	records := readAll(t, rs)
+	if len(records) != 3 || records[0] != "short" || len(records[1].(string)) != 5000 || records[2] != "last" {
+		t.Errorf("Expected the oversized record to be skipped, received %d records", len(records))
+	}
+	if err := <-rs.Errors(); !strings.Contains(err.Error(), errRecordTooLarge.Error()) {
+		t.Errorf("Expected the oversized record to be reported, received %v", err)
+	}
+}
+
+func TestReaderServiceRestart(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	rs := NewReaderService("Reader", r, TextCodec())
+	_ = rs.Start()
+	// The read of the first run is blocked when the service stops
+	time.Sleep(10 * time.Millisecond)
+	_ = rs.Stop()
+	if err := rs.Restart(); err != nil {
+		t.Fatalf("Failed to restart the service: %v", err)
+	}
+	defer func() { _ = rs.Stop() }()
+
+	for _, line := range []string{"first", "second"} {
+		go func(line string) { _, _ = io.WriteString(w, line+"\n") }(line)
+
+		select {
+		case rec := <-rs.Output():
+			if rec != line {
+				t.Errorf("Expected the record %q, received %v", line, rec)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("The record %q was not sent by the restarted service", line)
+		}
+	}
+}
+
+func TestWriterService(t *testing.T) {
+	var buf bytes.Buffer
+	ws := NewWriterService("Writer", &buf, TextCodec(), WithInputBuffer(4))
+	_ = ws.Start()
+
+	ws.Input() <- "a"
+	ws.Input() <- 42
+	ws.Input() <- NewMessage("b")
+	if err := ws.StopDrain(context.Background()); err != nil {
+		t.Fatalf("The service failed to stop: %v", err)
+	}
+
+	if got := buf.String(); got != "a\nb\n" {
+		t.Errorf("Expected a line for each payload, received %q", got)
+	}
+	if err := <-ws.Errors(); err == nil || !strings.Contains(err.Error(), "unsupported payload type int") {
+		t.Errorf("Expected the payload that cannot be encoded to be reported, received %v", err)
+	}
+	if dl := <-ws.DeadLetters(); dl.Payload != 42 {
+		t.Errorf("Expected the payload that cannot be encoded in the dead letters, received %v", dl.Payload)
+	}
+}
+
+func TestReaderWriterPipe(t *testing.T) {
+	var buf bytes.Buffer
+	rs := NewReaderService("Reader", strings.NewReader("{\"n\":1}\n{\"n\":2}\n"), nil)
+	ws := NewWriterService("Writer", &buf, nil)
+	_ = ws.Start()
+	_ = rs.Start()
+
+	for _, rec := range readAll(t, rs) {
+		ws.Input() <- rec
+	}
+	_ = ws.StopDrain(context.Background())
+
+	if got := buf.String(); got != "{\"n\":1}\n{\"n\":2}\n" {
+		t.Errorf("Expected the records to be written unchanged, received %q", got)
+	}
+}
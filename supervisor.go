@@ -0,0 +1,324 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// The default restart settings of the children of a Supervisor.
+const (
+	DefaultRestartBackoff    = 100 * time.Millisecond
+	DefaultRestartMultiplier = 2.0
+	DefaultMaxRestartBackoff = 30 * time.Second
+	DefaultRestartJitter     = 0.2
+	DefaultRestartIntensity  = 5
+	DefaultRestartWindow     = time.Minute
+)
+
+// ChildOption configures how a child of a Supervisor is restarted.
+type ChildOption func(*supervisedChild)
+
+// WithRestartPolicy sets whether the child is started again when it stops. The child is always
+// started again by default.
+func WithRestartPolicy(p RestartPolicy) ChildOption {
+	return func(c *supervisedChild) {
+		c.policy = p
+	}
+}
+
+// WithRestartBackoff sets the delay before the first restart of the child, and the maximum delay
+// reached as the delay is multiplied for each of the following restarts.
+func WithRestartBackoff(initial, maxDelay time.Duration) ChildOption {
+	return func(c *supervisedChild) {
+		c.initial = initial
+		c.max = maxDelay
+	}
+}
+
+// WithRestartMultiplier sets the factor applied to the delay for each restart of the child.
+func WithRestartMultiplier(m float64) ChildOption {
+	return func(c *supervisedChild) {
+		c.multiplier = m
+	}
+}
+
+// WithRestartJitter sets the fraction of each restart delay that is randomly added or subtracted.
+func WithRestartJitter(fraction float64) ChildOption {
+	return func(c *supervisedChild) {
+		c.jitter = fraction
+	}
+}
+
+// WithRestartIntensity permits at most n restarts of the child within the window. When the child
+// stops once more, it is marked as failed and is not started again.
+func WithRestartIntensity(n int, window time.Duration) ChildOption {
+	return func(c *supervisedChild) {
+		c.intensity = n
+		c.window = window
+	}
+}
+
+type supervisedChild struct {
+	srv        Service
+	policy     RestartPolicy
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64
+	intensity  int
+	window     time.Duration
+	// The status of the child, guarded by the lock of the supervisor
+	restarts    int
+	lastErr     error
+	lastFailure time.Time
+	failed      bool
+	// The times of the restarts within the window
+	recent []time.Time
+}
+
+// ChildStatus is a snapshot of the restarts of a child of a Supervisor in its current run.
+type ChildStatus struct {
+	Name        string
+	Restarts    int
+	LastError   error
+	LastFailure time.Time
+	// The child exceeded its restart intensity and is not started again
+	Failed bool
+}
+
+// Supervisor is a service starting its children, and starting them again as set by their
+// RestartPolicy when they stop while the supervisor is running. The restarts are delayed with an
+// exponential backoff, and a child restarted more times than its restart intensity permits is
+// marked as failed, reported as ErrRestartIntensity and provided to the OnEscalate callbacks.
+// The children are stopped in the reverse order they were added when the supervisor is stopped.
+type Supervisor struct {
+	BaseService
+	children  []*supervisedChild
+	escalated []func(srv Service, child Service, err error)
+	wg        sync.WaitGroup
+}
+
+// NewSupervisor returns a Supervisor without children.
+func NewSupervisor(name string, opts ...Option) *Supervisor {
+	s := new(Supervisor)
+
+	s.Init(s, name, opts...)
+	return s
+}
+
+// Add makes the service a child of the supervisor. The children must be added before the
+// supervisor is started, and are provided the logger of the supervisor when they do not have one.
+func (s *Supervisor) Add(child Service, opts ...ChildOption) {
+	c := &supervisedChild{
+		srv:        child,
+		policy:     RestartAlways,
+		initial:    DefaultRestartBackoff,
+		max:        DefaultMaxRestartBackoff,
+		multiplier: DefaultRestartMultiplier,
+		jitter:     DefaultRestartJitter,
+		intensity:  DefaultRestartIntensity,
+		window:     DefaultRestartWindow,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.children = append(s.children, c)
+	inheritLogger(child, s.logger)
+}
+
+// SetLogger sets the logger of the supervisor, which is provided to the children that do not have
+// a logger, including the children added later.
+func (s *Supervisor) SetLogger(l *slog.Logger) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.logger = l
+	for _, c := range s.children {
+		inheritLogger(c.srv, l)
+	}
+}
+
+// OnEscalate registers a function called with the child and the error when a child exceeds its
+// restart intensity. The function is called by the goroutine supervising the child, which is
+// waited for by Stop, so it must not stop the supervisor without starting a new goroutine.
+func (s *Supervisor) OnEscalate(fn func(srv Service, child Service, err error)) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.escalated = append(s.escalated, fn)
+}
+
+// Status returns the restarts of the children, in the order they were added.
+func (s *Supervisor) Status() []ChildStatus {
+	s.Lock()
+	defer s.Unlock()
+
+	status := make([]ChildStatus, 0, len(s.children))
+	for _, c := range s.children {
+		status = append(status, ChildStatus{
+			Name:        c.srv.String(),
+			Restarts:    c.restarts,
+			LastError:   c.lastErr,
+			LastFailure: c.lastFailure,
+			Failed:      c.failed,
+		})
+	}
+	return status
+}
+
+// OnStart implements the Service interface.
+func (s *Supervisor) OnStart() error {
+	s.Lock()
+	children := append([]*supervisedChild(nil), s.children...)
+	for _, c := range children {
+		c.restarts, c.lastErr, c.lastFailure, c.failed, c.recent = 0, nil, time.Time{}, false, nil
+	}
+	s.Unlock()
+
+	var started []Service
+	for _, c := range children {
+		if err := startChild(c.srv); err != nil {
+			_ = stopReverse(started)
+			return fmt.Errorf("%s: %s: %w", s, c.srv, err)
+		}
+		started = append(started, c.srv)
+	}
+
+	ctx := s.Context()
+	for _, c := range children {
+		s.wg.Add(1)
+		c := c
+		s.RunLabeled(ctx, "supervisor", func(ctx context.Context) { s.supervise(ctx, c) })
+	}
+	s.Ready()
+	return nil
+}
+
+// OnStop implements the Service interface.
+func (s *Supervisor) OnStop() error {
+	s.wg.Wait()
+
+	s.Lock()
+	var children []Service
+	for _, c := range s.children {
+		children = append(children, c.srv)
+	}
+	s.Unlock()
+
+	return stopReverse(children)
+}
+
+// startChild starts the child, using Restart for the services that were started before.
+func startChild(child Service) error {
+	if r, ok := child.(restarter); ok {
+		if st, ok := child.(interface{ State() State }); ok && st.State() != StateNew {
+			return r.Restart()
+		}
+	}
+	return child.Start()
+}
+
+// supervise starts the child again each time it stops, until the supervisor is stopped or the
+// child exceeds its restart intensity.
+func (s *Supervisor) supervise(ctx context.Context, c *supervisedChild) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.srv.Done():
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		var err error
+		if er, ok := c.srv.(errReporter); ok {
+			err = er.Err()
+		}
+		if !c.policy.restart(err) {
+			return
+		}
+
+		delay, ok := s.failure(c, err)
+		if !ok {
+			s.escalate(c, err)
+			return
+		}
+		if !s.sleep(ctx, delay) {
+			return
+		}
+
+		if err := startChild(c.srv); err != nil {
+			// The Done channel of the child is closed when it failed to start
+			s.ReportError(fmt.Errorf("%s: %s: %w", s, c.srv, err))
+		}
+	}
+}
+
+// failure records that the child stopped with the error, which is nil for a clean stop, and
+// returns the delay before it is restarted, or false when the restart would exceed the restart
+// intensity of the child.
+func (s *Supervisor) failure(c *supervisedChild, err error) (time.Duration, bool) {
+	now := s.clock.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err != nil {
+		c.lastErr = err
+		c.lastFailure = now
+	}
+
+	var recent []time.Time
+	for _, t := range c.recent {
+		if now.Sub(t) < c.window {
+			recent = append(recent, t)
+		}
+	}
+	c.recent = recent
+	if len(c.recent) >= c.intensity {
+		c.failed = true
+		return 0, false
+	}
+
+	delay := c.initial
+	for i := 0; i < len(c.recent) && delay < c.max; i++ {
+		delay = time.Duration(float64(delay) * c.multiplier)
+	}
+	delay = min(delay, c.max)
+
+	c.recent = append(c.recent, now)
+	c.restarts++
+	return withJitter(delay, c.jitter), true
+}
+
+// escalate reports the child that exceeded its restart intensity, and calls the OnEscalate callbacks.
+func (s *Supervisor) escalate(c *supervisedChild, cause error) {
+	err := fmt.Errorf("%s: %s: %w", s, c.srv, ErrRestartIntensity)
+	if cause != nil {
+		err = fmt.Errorf("%w: %v", err, cause)
+	}
+	s.log(slog.LevelError, "child restart intensity exceeded", cause, slog.String("child", c.srv.String()))
+	s.ReportError(err)
+
+	s.Lock()
+	fns := append(s.escalated[:0:0], s.escalated...)
+	s.Unlock()
+
+	for _, fn := range fns {
+		fn(s, c.srv, err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSupervisorBackoff(t *testing.T) {
+	clock := newFakeClock()
+	s := NewSupervisor("Supervisor", WithClock(clock))
+
+	child := &failLaterService{}
+	child.Init(child, "Child")
+	s.Add(child, WithRestartBackoff(100*time.Millisecond, 300*time.Millisecond),
+		WithRestartJitter(0), WithRestartIntensity(4, time.Hour))
+
+	escalated := make(chan error, 1)
+	s.OnEscalate(func(srv Service, c Service, err error) {
+		if c != child {
+			t.Errorf("Expected the escalation of the child, received %v", c)
+		}
+		escalated <- err
+	})
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start the supervisor: %v", err)
+	}
+	defer func() { _ = s.Stop() }()
+
+	for i, expected := range []time.Duration{100, 200, 300, 300} {
+		expected *= time.Millisecond
+
+		if d := clock.nextTimer(t); d != expected {
+			t.Errorf("Expected restart %d to wait %v, received %v", i+1, expected, d)
+		}
+		clock.Advance(expected)
+	}
+
+	select {
+	case err := <-escalated:
+		if !errors.Is(err, ErrRestartIntensity) {
+			t.Errorf("Expected ErrRestartIntensity, received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The child exceeding its restart intensity was not escalated")
+	}
+
+	status := s.Status()
+	if len(status) != 1 {
+		t.Fatalf("Expected the status of one child, received %v", status)
+	}
+	if st := status[0]; st.Name != "Child" || st.Restarts != 4 || !st.Failed || !errors.Is(st.LastError, errMemberFailed) {
+		t.Errorf("Expected the failed child after 4 restarts, received %+v", st)
+	}
+	// The Done channel of the child is closed before its stop completes
+	deadline := time.Now().Add(time.Second)
+	for child.State() != StateStopped && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if child.State() != StateStopped {
+		t.Errorf("Expected the failed child to be left stopped, received %v", child.State())
+	}
+}
+
+func TestSupervisorIntensityWindow(t *testing.T) {
+	clock := newFakeClock()
+	s := NewSupervisor("Supervisor", WithClock(clock))
+
+	child := &failLaterService{}
+	child.Init(child, "Child")
+	s.Add(child, WithRestartBackoff(time.Second, time.Second),
+		WithRestartJitter(0), WithRestartIntensity(1, time.Minute))
+	s.OnEscalate(func(srv Service, c Service, err error) {
+		t.Errorf("Expected the restarts outside of the window to be permitted, received %v", err)
+	})
+
+	_ = s.Start()
+	defer func() { _ = s.Stop() }()
+
+	// Each restart leaves the previous one outside of the window
+	for i := 0; i < 3; i++ {
+		_ = clock.nextTimer(t)
+		clock.Advance(time.Minute)
+	}
+	_ = clock.nextTimer(t)
+
+	if st := s.Status()[0]; st.Restarts != 4 || st.Failed {
+		t.Errorf("Expected the child to be restarted 4 times, received %+v", st)
+	}
+}
+
+func TestSupervisorPolicy(t *testing.T) {
+	s := NewSupervisor("Supervisor")
+
+	never := newTestService()
+	s.Add(never, WithRestartPolicy(RestartNever))
+	onFailure := newTestService()
+	s.Add(onFailure, WithRestartPolicy(RestartOnFailure), WithRestartBackoff(time.Millisecond, time.Millisecond))
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start the supervisor: %v", err)
+	}
+
+	_ = never.Stop()
+	_ = onFailure.StopWithError(errMemberFailed)
+
+	deadline := time.Now().Add(time.Second)
+	for onFailure.State() != StateRunning && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if st := onFailure.State(); st != StateRunning {
+		t.Errorf("Expected the failed child to be restarted, received %v", st)
+	}
+	if st := never.State(); st != StateStopped {
+		t.Errorf("Expected the child to be left stopped, received %v", st)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Errorf("Failed to stop the supervisor: %v", err)
+	}
+	if st := onFailure.State(); st != StateStopped {
+		t.Errorf("Expected the supervisor to stop its children, received %v", st)
+	}
+}
+
+func TestSupervisorLogger(t *testing.T) {
+	own := slog.New(new(recordHandler))
+	shared := slog.New(new(recordHandler))
+
+	first, second, third := newTestService(), newTestService(), newTestService()
+	second.SetLogger(own)
+
+	s := NewSupervisor("Supervisor")
+	s.Add(first)
+	s.Add(second)
+	s.SetLogger(shared)
+	s.Add(third)
+
+	if s.Logger() != shared {
+		t.Errorf("The logger was not set on the supervisor")
+	}
+	if first.Logger() != shared || third.Logger() != shared {
+		t.Errorf("The supervisor logger was not provided to the children without a logger")
+	}
+	if second.Logger() != own {
+		t.Errorf("The supervisor logger replaced the logger of the child")
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"io"
+	"log/slog"
+)
+
+// The largest number of bytes read or written by the throttled streams before waiting on the
+// byte rate limit, which keeps large writes from being sent in a single burst.
+const throttleChunkSize = 32 * 1024
+
+// SetByteRateLimit sets the number of bytes permitted each second through the streams returned by
+// ThrottledReader and ThrottledWriter. A value of zero removes the byte rate limit. The byte rate
+// limit is separate from the request rate limit, so both can be active at the same time.
+func (bas *BaseService) SetByteRateLimit(bytesPerSec int) {
+	bas.rlock.Lock()
+	defer bas.rlock.Unlock()
+
+	bas.blimit = bas.newLimiter(float64(bytesPerSec), 0)
+	bas.log(slog.LevelInfo, "byte rate limit changed", nil, slog.Int("rate", bytesPerSec))
+}
+
+func (bas *BaseService) byteLimiter() Limiter {
+	bas.rlock.Lock()
+	defer bas.rlock.Unlock()
+
+	return bas.blimit
+}
+
+// ThrottledReader returns an io.Reader pacing the reads of r against the byte rate limit of the
+// service. Each read waits until the rate limit permits the bytes it returned, so the wait is paid
+// by the next read, and the reads fail with ErrServiceStopped once the service is stopped.
+func (bas *BaseService) ThrottledReader(r io.Reader) io.Reader {
+	return &throttledReader{bas: bas, r: r}
+}
+
+type throttledReader struct {
+	bas *BaseService
+	r   io.Reader
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		if terr := tr.bas.takeN(tr.bas.byteLimiter(), n); terr != nil {
+			return n, terr
+		}
+	}
+	return n, err
+}
+
+// ThrottledWriter returns an io.Writer pacing the writes to w against the byte rate limit of the
+// service. Large writes are split, so the bytes are sent at a steady pace, and the writes fail
+// with ErrServiceStopped once the service is stopped.
+func (bas *BaseService) ThrottledWriter(w io.Writer) io.Writer {
+	return &throttledWriter{bas: bas, w: w}
+}
+
+type throttledWriter struct {
+	bas *BaseService
+	w   io.Writer
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), throttleChunkSize)]
+		if err := tw.bas.takeN(tw.bas.byteLimiter(), len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := tw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,60 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestThrottledWriter(t *testing.T) {
+	srv := newTestService()
+	srv.SetByteRateLimit(4 << 20)
+	srv.SetRateLimit(1000)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	var buf bytes.Buffer
+	data := make([]byte, 1<<20)
+	start := time.Now()
+	if n, err := io.Copy(srv.ThrottledWriter(&buf), bytes.NewReader(data)); err != nil || n != int64(len(data)) {
+		t.Fatalf("Expected %d bytes to be copied, received %d: %v", len(data), n, err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 400*time.Millisecond {
+		t.Errorf("Expected the copy to take about 250ms, received %v", elapsed)
+	}
+	if buf.Len() != len(data) {
+		t.Errorf("Expected %d bytes to be written, received %d", len(data), buf.Len())
+	}
+	// The byte rate limit does not replace the request rate limit
+	if rate := srv.EffectiveRateLimit(); rate != 1000 {
+		t.Errorf("Expected the request rate limit to be 1000, received %v", rate)
+	}
+}
+
+func TestThrottledReader(t *testing.T) {
+	srv := newTestService()
+	srv.SetByteRateLimit(1 << 20)
+
+	_ = srv.Start()
+	data := make([]byte, 256<<10)
+	start := time.Now()
+	if n, err := io.Copy(io.Discard, srv.ThrottledReader(bytes.NewReader(data))); err != nil || n != int64(len(data)) {
+		t.Fatalf("Expected %d bytes to be copied, received %d: %v", len(data), n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected the copy to take about 250ms, received %v", elapsed)
+	}
+
+	_ = srv.Stop()
+	if _, err := srv.ThrottledReader(bytes.NewReader(data)).Read(make([]byte, 10)); !errors.Is(err, ErrServiceStopped) {
+		t.Errorf("Expected ErrServiceStopped, received %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WithRequestTimeout limits how long the handler executed by the Run method can take for a request.
+// The context provided to the handler expires after the timeout, and the request fails with an
+// error wrapping ErrRequestTimeout, so the service continues with the next request. Since a
+// goroutine cannot be stopped, a handler that ignores its context keeps running in the background
+// after it is abandoned, and its result is discarded.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(bas *BaseService) {
+		bas.reqTimeout = d
+	}
+}
+
+type outcome struct {
+	result interface{}
+	err    error
+}
+
+// execute runs the handler, and abandons it once the request timeout has expired.
+func (bas *BaseService) execute(ctx context.Context, handler Handler, req interface{}) (interface{}, error) {
+	if bas.reqTimeout <= 0 {
+		return safeCall(ctx, handler, req)
+	}
+
+	// The deadline is provided to the handler, and the timer of the clock abandons it
+	tctx, cancel := context.WithDeadline(ctx, bas.clock.Now().Add(bas.reqTimeout))
+	defer cancel()
+	t := bas.clock.NewTimer(bas.reqTimeout)
+	defer t.Stop()
+
+	// The channel is buffered, so an abandoned handler does not block when it finishes
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := safeCall(tctx, handler, req)
+		done <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-tctx.Done():
+	case <-t.C():
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s: %w", bas.name, ErrRequestTimeout)
+}
@@ -0,0 +1,72 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	forever := make(chan struct{})
+	defer close(forever)
+
+	srv := NewSimpleService("Timeout", func(req interface{}) (interface{}, error) {
+		if req == "stuck" {
+			// Ignores the request context and never returns on its own
+			<-forever
+		}
+		return req, nil
+	}, WithRequestTimeout(50*time.Millisecond))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "stuck"
+	srv.Input() <- "next"
+
+	select {
+	case err := <-srv.Errors():
+		if !errors.Is(err, ErrRequestTimeout) {
+			t.Errorf("Expected ErrRequestTimeout and received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The stuck request did not time out")
+	}
+	select {
+	case result := <-srv.Output():
+		if result != "next" {
+			t.Errorf("Expected next to be returned and received %v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The stuck request stalled the following request")
+	}
+}
+
+func TestRequestTimeoutContext(t *testing.T) {
+	srv := new(BaseService)
+	srv.Init(srv, "Context", WithRequestTimeout(20*time.Millisecond))
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	deadlines := make(chan bool, 1)
+	_ = srv.RunContext(func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	srv.Input() <- "request"
+	if !<-deadlines {
+		t.Errorf("The handler context does not have the deadline of the request timeout")
+	}
+	if err := <-srv.Errors(); !errors.Is(err, ErrRequestTimeout) {
+		t.Errorf("Expected ErrRequestTimeout and received %v", err)
+	}
+}
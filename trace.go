@@ -0,0 +1,56 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer creates a span for each request handled by the Run method and the PoolService.
+// The otel package provides a Tracer built on OpenTelemetry.
+type Tracer interface {
+	// Start is called when the request is dequeued. The context is the one carried by the
+	// request when it is a *Message, and the returned context is carried by the result.
+	Start(ctx context.Context, srv Service, req interface{}) (context.Context, Span)
+}
+
+// Span tracks the handling of a single request.
+type Span interface {
+	// RateLimitWait records the time spent waiting on the rate limit before the request was dequeued.
+	RateLimitWait(d time.Duration)
+	// End is called after the result has been emitted, with the error returned by the handler.
+	End(err error)
+}
+
+// WithTracer sets the Tracer that creates a span for each request handled by the service.
+func WithTracer(t Tracer) Option {
+	return func(bas *BaseService) {
+		bas.tracer = t
+	}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) RateLimitWait(d time.Duration) {}
+
+func (nopSpan) End(err error) {}
+
+// startSpan returns the context to be carried by the result of the request and the span tracking it.
+func (bas *BaseService) startSpan(req interface{}, waited time.Duration) (context.Context, Span) {
+	ctx := context.Background()
+	if msg, ok := req.(*Message); ok {
+		ctx = msg.Context()
+	}
+	if bas.tracer == nil {
+		return ctx, nopSpan{}
+	}
+
+	ctx, span := bas.tracer.Start(ctx, bas.service, req)
+	if waited > 0 {
+		span.RateLimitWait(waited)
+	}
+	return ctx, span
+}
@@ -0,0 +1,147 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	service string
+	parent  *recordedSpan
+	waited  time.Duration
+	err     error
+	ended   bool
+}
+
+type fakeTracer struct {
+	sync.Mutex
+	spans []*recordedSpan
+	ended chan *recordedSpan
+}
+
+func newFakeTracer() *fakeTracer {
+	return &fakeTracer{ended: make(chan *recordedSpan, 10)}
+}
+
+func (ft *fakeTracer) Start(ctx context.Context, srv Service, req interface{}) (context.Context, Span) {
+	ft.Lock()
+	defer ft.Unlock()
+
+	span := &recordedSpan{service: srv.String()}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent
+	}
+	ft.spans = append(ft.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), &fakeSpan{ft: ft, span: span}
+}
+
+type fakeSpan struct {
+	ft   *fakeTracer
+	span *recordedSpan
+}
+
+func (fs *fakeSpan) RateLimitWait(d time.Duration) {
+	fs.ft.Lock()
+	defer fs.ft.Unlock()
+
+	fs.span.waited = d
+}
+
+func (fs *fakeSpan) End(err error) {
+	fs.ft.Lock()
+	fs.span.err = err
+	fs.span.ended = true
+	fs.ft.Unlock()
+
+	fs.ft.ended <- fs.span
+}
+
+func TestTracer(t *testing.T) {
+	errFailed := errors.New("failed")
+	tracer := newFakeTracer()
+	srv := NewSimpleService("Traced", func(req interface{}) (interface{}, error) {
+		if req == "fail" {
+			return nil, errFailed
+		}
+		return req, nil
+	}, WithTracer(tracer))
+	srv.SetRateLimit(10)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "first"
+	<-srv.Output()
+	first := <-tracer.ended
+	srv.Input() <- "fail"
+	second := <-tracer.ended
+
+	tracer.Lock()
+	defer tracer.Unlock()
+
+	if first.service != "Traced" || first.err != nil {
+		t.Errorf("Unexpected span for the successful request: %+v", first)
+	}
+	if !errors.Is(second.err, errFailed) {
+		t.Errorf("Expected the handler error to end the span, received %v", second.err)
+	}
+	if second.waited <= 0 {
+		t.Errorf("The rate limit wait was not recorded on the span")
+	}
+}
+
+func TestTracerPipeline(t *testing.T) {
+	tracer := newFakeTracer()
+	echo := func(req interface{}) (interface{}, error) { return req, nil }
+	p := NewPipeline("Pipeline",
+		NewSimpleService("First", echo, WithTracer(tracer)),
+		NewSimpleService("Second", echo, WithTracer(tracer)),
+	)
+
+	_ = p.Start()
+	defer func() { _ = p.Stop() }()
+
+	p.Input() <- NewMessageContext(context.Background(), "linked")
+	result := <-p.Output()
+	if msg, ok := result.(*Message); !ok || msg.Payload != "linked" {
+		t.Fatalf("Expected the message to pass through the pipeline, received %v", result)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-tracer.ended:
+		case <-time.After(time.Second):
+			t.Fatalf("The spans were not ended")
+		}
+	}
+
+	tracer.Lock()
+	defer tracer.Unlock()
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("Expected 2 spans and received %d", len(tracer.spans))
+	}
+	if first, second := tracer.spans[0], tracer.spans[1]; second.parent != first {
+		t.Errorf("The span of the second stage is not linked to the span of the first stage")
+	}
+}
+
+func TestMessageContext(t *testing.T) {
+	if ctx := NewMessage("payload").Context(); ctx != context.Background() {
+		t.Errorf("Expected the background context for a message without a context")
+	}
+
+	ctx := context.WithValue(context.Background(), spanKey{}, "value")
+	if msg := NewMessageContext(ctx, "payload"); msg.Context() != ctx {
+		t.Errorf("The message does not carry the provided context")
+	}
+}
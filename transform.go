@@ -0,0 +1,26 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+// NewFilter returns a service that sends the requests satisfying the predicate on its Output
+// channel, and discards the others. The predicate receives the payload of a *Message, and the
+// message envelope is kept for the requests passed through.
+func NewFilter(name string, pred func(msg interface{}) bool, opts ...Option) *SimpleService {
+	return NewSimpleService(name, func(req interface{}) (interface{}, error) {
+		if !pred(req) {
+			return nil, nil
+		}
+		return req, nil
+	}, opts...)
+}
+
+// NewMap returns a service that sends the value returned by fn for each request on its Output
+// channel. The function receives the payload of a *Message, and the message envelope is kept for
+// the value returned. Requests for which fn returns nil are discarded.
+func NewMap(name string, fn func(msg interface{}) interface{}, opts ...Option) *SimpleService {
+	return NewSimpleService(name, func(req interface{}) (interface{}, error) {
+		return fn(req), nil
+	}, opts...)
+}
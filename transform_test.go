@@ -0,0 +1,61 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func isEven(msg interface{}) bool {
+	return msg.(int)%2 == 0
+}
+
+func timesTen(msg interface{}) interface{} {
+	return msg.(int) * 10
+}
+
+func TestFilter(t *testing.T) {
+	f := NewFilter("Filter", isEven, WithInputBuffer(10))
+
+	for i := 0; i < 10; i++ {
+		_ = f.Send(context.Background(), i)
+	}
+	_ = f.Start()
+	defer func() { _ = f.Stop() }()
+
+	for i := 0; i < 10; i += 2 {
+		select {
+		case msg := <-f.Output():
+			if msg != i {
+				t.Errorf("Expected %d to pass the filter and received %v", i, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("The request %d did not pass the filter", i)
+		}
+	}
+
+	if s := f.Stats(); s.Received != 10 || s.Emitted != 5 {
+		t.Errorf("Expected 10 requests received and 5 emitted, counted %d and %d", s.Received, s.Emitted)
+	}
+}
+
+func TestMap(t *testing.T) {
+	m := NewMap("Map", timesTen)
+
+	_ = m.Start()
+	defer func() { _ = m.Stop() }()
+
+	if result, err := m.Request(context.Background(), 2); err != nil || result != 20 {
+		t.Errorf("Expected the request to be transformed to 20, received %v: %v", result, err)
+	}
+
+	msg := NewMessage(3)
+	_ = m.Send(context.Background(), msg)
+	if result, ok := (<-m.Output()).(*Message); !ok || result.ID != msg.ID || result.Payload != 30 {
+		t.Errorf("Expected the message envelope to be kept and received %v", result)
+	}
+}
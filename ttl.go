@@ -0,0 +1,46 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetMessageTTL sets how long a *Message remains worth processing after it was sent, when the
+// message does not have a Deadline. Messages dequeued after their deadline are skipped instead of
+// being handled, and are routed to the dead letters with DeadLetterExpired. Raw values are never
+// expired, since the time they were sent is not known. A zero TTL disables the default deadline.
+func (bas *BaseService) SetMessageTTL(d time.Duration) {
+	bas.ttl.Store(int64(d))
+}
+
+// deadline returns the time after which the message expires, or false when it does not expire.
+func (bas *BaseService) deadline(msg *Message) (time.Time, bool) {
+	if !msg.Deadline.IsZero() {
+		return msg.Deadline, true
+	}
+	if ttl := time.Duration(bas.ttl.Load()); ttl > 0 && !msg.EnqueuedAt.IsZero() {
+		return msg.EnqueuedAt.Add(ttl), true
+	}
+	return time.Time{}, false
+}
+
+// expire reports whether the request is a *Message dequeued after its deadline. The expired
+// message is routed to the dead letters, and the caller waiting in Request receives the error.
+func (bas *BaseService) expire(req interface{}) bool {
+	msg, ok := req.(*Message)
+	if !ok {
+		return false
+	}
+	if d, ok := bas.deadline(msg); !ok || bas.clock.Now().Before(d) {
+		return false
+	}
+
+	err := fmt.Errorf("%s: %w", bas.name, ErrMessageExpired)
+	bas.deadLetter(msg, msg, DeadLetterExpired, err)
+	msg.Reply(nil, err)
+	return true
+}
@@ -0,0 +1,96 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMessageTTL(t *testing.T) {
+	clock := newFakeClock()
+	srv := NewSimpleService("TTL", func(req interface{}) (interface{}, error) {
+		// The queued messages expire while the first request is handled
+		if req == "first" {
+			clock.Advance(time.Hour)
+		}
+		return req, nil
+	}, WithInputBuffer(10), WithClock(clock))
+	srv.SetMessageTTL(time.Minute)
+	// Only two requests can be handled, so the expired messages must not be charged
+	tokens := make(chan struct{}, 2)
+	tokens <- struct{}{}
+	tokens <- struct{}{}
+	srv.SetRateLimiter(&fakeLimiter{tokens: tokens})
+
+	_ = srv.Send(context.Background(), "first")
+	for i := 0; i < 3; i++ {
+		_ = srv.Send(context.Background(), NewMessage(i))
+	}
+	_ = srv.Send(context.Background(), "last")
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for _, expected := range []string{"first", "last"} {
+		select {
+		case result := <-srv.Output():
+			if result != expected {
+				t.Errorf("Expected %s to be processed and received %v", expected, result)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("The request %s was not processed", expected)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		dl := <-srv.DeadLetters()
+		if dl.Reason != DeadLetterExpired || !errors.Is(dl.Err, ErrMessageExpired) {
+			t.Errorf("Expected the message to expire and received %v: %v", dl.Reason, dl.Err)
+		}
+		if msg, ok := dl.Payload.(*Message); !ok || msg.Payload != i {
+			t.Errorf("Expected message %d to expire and received %v", i, dl.Payload)
+		}
+	}
+	if n := srv.Stats().Received; n != 2 {
+		t.Errorf("Expected the expired messages not to be received, counted %d", n)
+	}
+}
+
+func TestMessageDeadline(t *testing.T) {
+	srv := newEchoService("Deadline")
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	msg := NewMessageContext(context.Background(), "stale")
+	msg.Deadline = time.Now().Add(-time.Second)
+	_ = srv.Send(context.Background(), msg)
+
+	select {
+	case dl := <-srv.DeadLetters():
+		if dl.Payload != msg || dl.Reason != DeadLetterExpired {
+			t.Errorf("Expected the stale message to expire and received %v: %v", dl.Payload, dl.Reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The stale message was not routed to the dead letters")
+	}
+}
+
+func TestRequestExpired(t *testing.T) {
+	srv := newEchoService("Expired", WithInputBuffer(1))
+	srv.SetMessageTTL(time.Nanosecond)
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := srv.Request(ctx, "request"); !errors.Is(err, ErrMessageExpired) {
+		t.Errorf("Expected the request to fail with ErrMessageExpired and received %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// TypeError is reported when a value received by a typed service does not have the expected type.
+type TypeError struct {
+	Value    interface{}
+	Expected reflect.Type
+}
+
+// Error implements the error interface.
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("received a value of type %T, but %v was expected", e.Value, e.Expected)
+}
+
+// As returns the value converted to type T or a *TypeError when the conversion is not possible.
+func As[T any](v interface{}) (T, error) {
+	t, ok := v.(T)
+	if !ok {
+		return t, &TypeError{
+			Value:    v,
+			Expected: reflect.TypeOf((*T)(nil)).Elem(),
+		}
+	}
+	return t, nil
+}
+
+// Box returns a channel that receives the values from the typed channel as empty interfaces.
+// The returned channel is closed after the provided channel is closed or the context is done.
+func Box[T any](ctx context.Context, ch <-chan T) <-chan interface{} {
+	out := make(chan interface{})
+
+	go func() {
+		defer close(out)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// TypedService provides typed input and output channels on top of the BaseService, while still
+// implementing the Service interface. Values sent on the Input channel are delivered to the In
+// channel, and values sent on the Out channel are delivered to the Output channel.
+type TypedService[I any, O any] struct {
+	BaseService
+	in   chan I
+	out  chan O
+	errs chan error
+}
+
+// NewTypedService returns an initialized TypedService object. It is intended for services that
+// embed a *TypedService. Services embedding TypedService by value should call Init instead.
+func NewTypedService[I any, O any](srv Service, name string, opts ...Option) *TypedService[I, O] {
+	ts := new(TypedService[I, O])
+
+	ts.Init(srv, name, opts...)
+	return ts
+}
+
+// Init initializes the TypedService in place for the provided service embedding it.
+// It must be called before the service is used.
+func (ts *TypedService[I, O]) Init(srv Service, name string, opts ...Option) {
+	ts.BaseService.Init(srv, name, opts...)
+	ts.in = make(chan I)
+	ts.out = make(chan O)
+	ts.errs = make(chan error, 10)
+
+	in, out, errs := ts.in, ts.out, ts.errs
+	input, output := ts.input, ts.output
+	ts.addStartHook(func(ctx context.Context) {
+		ts.RunLabeled(ctx, "unbox", func(ctx context.Context) { unboxInput(ctx, input, in, errs) })
+		ts.RunLabeled(ctx, "box", func(ctx context.Context) { boxOutput(ctx, out, output) })
+	})
+}
+
+// In returns the channel that the typed service receives requests on.
+func (ts *TypedService[I, O]) In() chan I {
+	return ts.in
+}
+
+// Out returns the channel that the typed service sends results on.
+func (ts *TypedService[I, O]) Out() chan O {
+	return ts.out
+}
+
+// TypeErrors returns a channel that receives a *TypeError for each value sent on the Input
+// channel that does not have the input type. The errors are dropped when the channel is full.
+func (ts *TypedService[I, O]) TypeErrors() <-chan error {
+	return ts.errs
+}
+
+func unboxInput[I any](ctx context.Context, from chan interface{}, to chan I, errs chan error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v := <-from:
+			req, err := As[I](v)
+			if err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+				continue
+			}
+
+			select {
+			case to <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func boxOutput[O any](ctx context.Context, from chan O, to chan interface{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v := <-from:
+			select {
+			case to <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAs(t *testing.T) {
+	if v, err := As[string]("str"); err != nil || v != "str" {
+		t.Errorf("Failed to convert a string value: %v", err)
+	}
+
+	var te *TypeError
+	if _, err := As[string](10); !errors.As(err, &te) {
+		t.Errorf("Expected a *TypeError when converting an int to a string, received %v", err)
+	} else if te.Value != 10 || te.Expected.String() != "string" {
+		t.Errorf("The TypeError did not describe the failed conversion: %v", te)
+	}
+}
+
+func TestBox(t *testing.T) {
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+
+	var sum int
+	for v := range Box(context.Background(), ch) {
+		sum += v.(int)
+	}
+	if sum != 6 {
+		t.Errorf("Expected the boxed values to sum to 6, received %d", sum)
+	}
+}
+
+func TestTypedService(t *testing.T) {
+	srv := newTestTypedService()
+	var _ Service = srv
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	for _, str := range []string{"a", "bb", "ccc"} {
+		srv.Input() <- str
+		if result := <-srv.Output(); result != len(str) {
+			t.Errorf("Expected %d to be returned and received %v", len(str), result)
+		}
+	}
+}
+
+func TestTypedServiceWrongType(t *testing.T) {
+	srv := newTestTypedService()
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- 3.14
+	select {
+	case err := <-srv.TypeErrors():
+		var te *TypeError
+		if !errors.As(err, &te) {
+			t.Errorf("Expected a *TypeError and received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The wrong input type was not reported")
+	}
+
+	// The service must continue to handle requests
+	srv.Input() <- "four"
+	if result := <-srv.Output(); result != 4 {
+		t.Errorf("Expected 4 to be returned and received %v", result)
+	}
+}
+
+func TestTypedServiceRestart(t *testing.T) {
+	srv := newTestTypedService()
+
+	_ = srv.Start()
+	_ = srv.Restart()
+	defer func() { _ = srv.Stop() }()
+
+	srv.Input() <- "abc"
+	if result := <-srv.Output(); result != 3 {
+		t.Errorf("Expected 3 to be returned and received %v", result)
+	}
+}
+
+type testTypedService struct {
+	TypedService[string, int]
+}
+
+func newTestTypedService() *testTypedService {
+	srv := new(testTypedService)
+
+	srv.Init(srv, "Typed")
+	return srv
+}
+
+func (srv *testTypedService) OnStart() error {
+	go srv.handleRequests(srv.Done())
+	return nil
+}
+
+func (srv *testTypedService) handleRequests(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case req := <-srv.In():
+			srv.Out() <- len(req)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// waterMarks tracks whether the backlog of the Input channel is above the high-water mark.
+type waterMarks struct {
+	sync.Mutex
+	// The high-water mark is read without the lock, so the backlog is not checked when it is unset
+	high      atomic.Int64
+	low       int
+	lowSet    bool
+	highFn    func(backlog int)
+	lowFn     func(backlog int)
+	watchers  []func(congested bool)
+	congested bool
+}
+
+// SetHighWaterMark calls the function when the backlog of the Input channel reaches n, so the
+// producers can slow down before the sends start blocking. The function is not called again until
+// the backlog has fallen to the low-water mark, which is half the high-water mark unless it is set
+// with SetLowWaterMark. The backlog is checked as the messages are sent with Send or TrySend and
+// received by the Run method. A mark that is not positive disables the check.
+func (bas *BaseService) SetHighWaterMark(n int, fn func(backlog int)) {
+	w := &bas.marks
+	w.Lock()
+	defer w.Unlock()
+
+	w.highFn = fn
+	w.congested = false
+	w.high.Store(int64(max(n, 0)))
+}
+
+// SetLowWaterMark calls the function when the backlog of the Input channel falls to n after it
+// reached the high-water mark, so the producers can resume.
+func (bas *BaseService) SetLowWaterMark(n int, fn func(backlog int)) {
+	w := &bas.marks
+	w.Lock()
+	defer w.Unlock()
+
+	w.low = max(n, 0)
+	w.lowSet = true
+	w.lowFn = fn
+}
+
+// Congested returns true when the backlog of the Input channel has reached the high-water mark,
+// and has not fallen to the low-water mark since.
+func (bas *BaseService) Congested() bool {
+	w := &bas.marks
+	w.Lock()
+	defer w.Unlock()
+
+	return w.congested
+}
+
+// watchCongestion registers a function called each time the service becomes congested or recovers.
+func (bas *BaseService) watchCongestion(fn func(congested bool)) {
+	w := &bas.marks
+	w.Lock()
+	defer w.Unlock()
+
+	w.watchers = append(w.watchers, fn)
+}
+
+// checkBacklog compares the backlog of the Input channel with the water marks.
+func (bas *BaseService) checkBacklog() {
+	w := &bas.marks
+	high := int(w.high.Load())
+	if high <= 0 {
+		return
+	}
+	backlog := bas.InputLen()
+
+	w.Lock()
+	low := high / 2
+	if w.lowSet {
+		low = w.low
+	}
+
+	var fn func(backlog int)
+	switch {
+	case !w.congested && backlog >= high:
+		w.congested = true
+		fn = w.highFn
+	case w.congested && backlog <= low:
+		w.congested = false
+		fn = w.lowFn
+	default:
+		w.Unlock()
+		return
+	}
+	congested, watchers := w.congested, w.watchers
+	w.Unlock()
+
+	if congested {
+		bas.log(slog.LevelWarn, "the input backlog reached the high-water mark", nil, slog.Int("backlog", backlog))
+	} else {
+		bas.log(slog.LevelInfo, "the input backlog fell to the low-water mark", nil, slog.Int("backlog", backlog))
+	}
+	if fn != nil {
+		fn(backlog)
+	}
+	for _, watch := range watchers {
+		watch(congested)
+	}
+}
+
+// The services that report their congestion, such as those embedding BaseService
+type congestionWatcher interface {
+	watchCongestion(fn func(congested bool))
+}
+
+// groupCongestion tracks the members of a group that are congested.
+type groupCongestion struct {
+	sync.Mutex
+	fn        func(congested bool)
+	congested map[Service]struct{}
+}
+
+// OnCongestion calls the function with true when a service of the group reaches its high-water
+// mark while no other member is congested, and with false once every member has recovered, so a
+// single signal reports that the pipeline is congested. The members must set their high-water
+// marks with SetHighWaterMark. The services added later are included.
+func (g *Group) OnCongestion(fn func(congested bool)) {
+	c := &groupCongestion{
+		fn:        fn,
+		congested: make(map[Service]struct{}),
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	g.congestion = append(g.congestion, c)
+	for _, srv := range g.members {
+		c.watch(srv)
+	}
+}
+
+func (c *groupCongestion) watch(srv Service) {
+	cw, ok := srv.(congestionWatcher)
+	if !ok {
+		return
+	}
+
+	cw.watchCongestion(func(congested bool) {
+		c.Lock()
+		before := len(c.congested) > 0
+		if congested {
+			c.congested[srv] = struct{}{}
+		} else {
+			delete(c.congested, srv)
+		}
+		after := len(c.congested) > 0
+		c.Unlock()
+
+		if before != after {
+			c.fn(after)
+		}
+	})
+}
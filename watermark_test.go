@@ -0,0 +1,89 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"sync"
+	"testing"
+)
+
+type markCalls struct {
+	sync.Mutex
+	high, low []int
+}
+
+func (m *markCalls) counts() (int, int) {
+	m.Lock()
+	defer m.Unlock()
+
+	return len(m.high), len(m.low)
+}
+
+func TestWaterMarks(t *testing.T) {
+	srv := newEchoService("Backlog", WithInputBuffer(10))
+
+	calls := new(markCalls)
+	srv.SetHighWaterMark(5, func(backlog int) {
+		calls.Lock()
+		defer calls.Unlock()
+		calls.high = append(calls.high, backlog)
+	})
+	srv.SetLowWaterMark(1, func(backlog int) {
+		calls.Lock()
+		defer calls.Unlock()
+		calls.low = append(calls.low, backlog)
+	})
+
+	for i := 0; i < 8; i++ {
+		if !srv.TrySend(i) {
+			t.Fatalf("Failed to send the message %d", i)
+		}
+	}
+	if high, low := calls.counts(); high != 1 || low != 0 || calls.high[0] != 5 || !srv.Congested() {
+		t.Fatalf("Expected one high-water callback at 5, received %v and %v", calls.high, calls.low)
+	}
+
+	_ = srv.Start()
+	defer func() { _ = srv.Stop() }()
+	for i := 0; i < 8; i++ {
+		<-srv.Output()
+	}
+
+	if high, low := calls.counts(); high != 1 || low != 1 || calls.low[0] > 1 || srv.Congested() {
+		t.Errorf("Expected one low-water callback, received %v and %v", calls.high, calls.low)
+	}
+}
+
+func TestGroupCongestion(t *testing.T) {
+	a := newEchoService("A", WithInputBuffer(4))
+	b := newEchoService("B", WithInputBuffer(4))
+	a.SetHighWaterMark(2, nil)
+	b.SetHighWaterMark(2, nil)
+
+	g := NewGroup(a)
+	var signals []bool
+	g.OnCongestion(func(congested bool) {
+		signals = append(signals, congested)
+	})
+	g.Add(b)
+
+	for _, srv := range []*SimpleService{a, b} {
+		srv.TrySend(1)
+		srv.TrySend(2)
+	}
+	if len(signals) != 1 || !signals[0] {
+		t.Fatalf("Expected a single congestion signal, received %v", signals)
+	}
+
+	_ = g.StartAll()
+	defer func() { _ = g.StopAll() }()
+	for _, srv := range []*SimpleService{a, b} {
+		<-srv.Output()
+		<-srv.Output()
+	}
+	if len(signals) != 2 || signals[1] {
+		t.Errorf("Expected a single recovery signal once both recovered, received %v", signals)
+	}
+}
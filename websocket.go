@@ -0,0 +1,495 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The default settings of the handler returned by NewWebSocketHandler.
+const (
+	// The size limit of the messages received from a WebSocket client
+	DefaultMaxFrameSize = 1 << 20
+	// The time permitted for each frame to be written to a WebSocket client
+	DefaultWebSocketWriteTimeout = 10 * time.Second
+)
+
+// The keys of the metadata set on the messages received from WebSocket clients.
+const (
+	// MetaWebSocketConn identifies the connection that the message was received on
+	MetaWebSocketConn = "websocket.conn"
+	// MetaWebSocketRemote is the network address of the client
+	MetaWebSocketRemote = "websocket.remote"
+)
+
+// The opcodes of the WebSocket frames
+const (
+	wsContinuation byte = 0x0
+	wsText         byte = 0x1
+	wsBinary       byte = 0x2
+	wsClose        byte = 0x8
+	wsPing         byte = 0x9
+	wsPong         byte = 0xa
+)
+
+// The status codes of the WebSocket close frames
+const (
+	wsCloseNormal      = 1000
+	wsCloseGoingAway   = 1001
+	wsCloseProtocol    = 1002
+	wsCloseInvalidData = 1007
+	wsCloseTooBig      = 1009
+)
+
+// The time permitted for a client to answer the close frame of the server
+const wsCloseTimeout = time.Second
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var wsConnCounter uint64
+
+var (
+	errWSProtocol = errors.New("websocket protocol error")
+	errWSTooBig   = errors.New("websocket message is too big")
+)
+
+// WebSocketOption configures the handler returned by NewWebSocketHandler.
+type WebSocketOption func(*wsHandler)
+
+// WithWebSocketBuffer sets the number of results buffered for each connection while the client
+// is receiving the previous results.
+func WithWebSocketBuffer(size int) WebSocketOption {
+	return func(h *wsHandler) {
+		h.buffer = size
+	}
+}
+
+// WithWebSocketDropPolicy sets the policy applied to the results that do not fit in the buffer of a
+// slow client. The default policy is PolicyDropNew, so a slow client cannot block the service or
+// the other clients.
+func WithWebSocketDropPolicy(policy OverflowPolicy) WebSocketOption {
+	return func(h *wsHandler) {
+		h.policy = policy
+	}
+}
+
+// WithMaxFrameSize sets the size limit of the messages received from the clients. The connections
+// sending larger messages are closed.
+func WithMaxFrameSize(size int) WebSocketOption {
+	return func(h *wsHandler) {
+		h.maxSize = size
+	}
+}
+
+// WithWebSocketWriteTimeout sets the time permitted for each frame to be written to a client. The
+// clients that do not read their frames in time are dropped, so a client that stopped reading
+// cannot block the handler. A timeout that is not positive removes the limit.
+func WithWebSocketWriteTimeout(d time.Duration) WebSocketOption {
+	return func(h *wsHandler) {
+		h.timeout = d
+	}
+}
+
+type wsHandler struct {
+	srv     Service
+	codec   Codec
+	buffer  int
+	policy  OverflowPolicy
+	maxSize int
+	timeout time.Duration
+	opcode  byte
+}
+
+// NewWebSocketHandler returns an http.Handler that upgrades the requests to WebSocket connections.
+// Each connection receives the results of the service encoded by the codec, and the messages of
+// the client are decoded by the codec and sent to the service in a *Message, with the identity of
+// the connection in the MetaWebSocketConn and MetaWebSocketRemote metadata. The results are sent
+// in text frames when the codec provides a JSON or text content type, and in binary frames
+// otherwise. The handler subscribes to the results of the service, so the service must provide
+// Subscribe like BaseService, and the results should only be read from subscriptions. The
+// connections are closed with the going away status when the service is stopped, and the clients
+// that do not read their frames within DefaultWebSocketWriteTimeout are dropped.
+func NewWebSocketHandler(srv Service, codec Codec, opts ...WebSocketOption) http.Handler {
+	h := &wsHandler{
+		srv:     srv,
+		codec:   codec,
+		buffer:  DefaultSubscriberBuffer,
+		policy:  PolicyDropNew,
+		maxSize: DefaultMaxFrameSize,
+		timeout: DefaultWebSocketWriteTimeout,
+		opcode:  wsBinary,
+	}
+	if ct, ok := codec.(contentTyper); ok {
+		if t := ct.ContentType(); strings.HasPrefix(t, "text/") || strings.HasPrefix(t, "application/json") {
+			h.opcode = wsText
+		}
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.srv.(subscribable)
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s: streaming is not supported", h.srv), http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing websocket key", http.StatusBadRequest)
+		return
+	}
+	if !serviceRunning(h.srv) {
+		http.Error(w, fmt.Sprintf("%s: %v", h.srv, ErrNotRunning), http.StatusServiceUnavailable)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket is not supported by the server", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	// The subscription is created before the first message of the client can be sent to the service
+	results, unsubscribe := sub.Subscribe(WithSubscriberBuffer(h.buffer), WithDropPolicy(h.policy))
+	defer unsubscribe()
+
+	c := &wsConn{
+		conn:    conn,
+		rw:      rw,
+		id:      strconv.FormatUint(atomic.AddUint64(&wsConnCounter, 1), 10),
+		remote:  r.RemoteAddr,
+		timeout: h.timeout,
+	}
+	h.serve(c, results)
+}
+
+// serve sends the results to the client until the client leaves or the service is stopped.
+func (h *wsHandler) serve(c *wsConn, results <-chan interface{}) {
+	// The messages of the client are abandoned once the connection is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	finished := make(chan struct{})
+	goLabeled(ctx, h.srv.String(), "websocket", func(ctx context.Context) {
+		defer close(finished)
+		h.read(ctx, c)
+	})
+
+	for {
+		select {
+		case <-finished:
+			return
+		case result, open := <-results:
+			if !open {
+				c.close(wsCloseGoingAway, "service stopped")
+				c.await(finished)
+				return
+			}
+
+			data, err := h.codec.Marshal(Unwrap(result))
+			if err != nil {
+				continue
+			}
+			if err := c.write(h.opcode, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// read sends the messages of the client to the service, and answers the control frames.
+func (h *wsHandler) read(ctx context.Context, c *wsConn) {
+	var message []byte
+
+	for {
+		f, err := readWSFrame(c.rw, h.maxSize-len(message))
+		switch {
+		case errors.Is(err, errWSTooBig):
+			c.close(wsCloseTooBig, "message is too big")
+			return
+		case err != nil:
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				c.close(wsCloseProtocol, "")
+			}
+			return
+		case !f.masked:
+			c.close(wsCloseProtocol, "frames must be masked")
+			return
+		}
+
+		switch f.opcode {
+		case wsClose:
+			// The close frame of the client is answered, unless it answers the close frame of the server
+			c.close(wsCloseNormal, "")
+			return
+		case wsPing:
+			if err := c.write(wsPong, f.payload); err != nil {
+				return
+			}
+			continue
+		case wsPong:
+			continue
+		case wsText, wsBinary:
+			if message != nil {
+				c.close(wsCloseProtocol, "expected a continuation frame")
+				return
+			}
+			message = f.payload
+		case wsContinuation:
+			if message == nil {
+				c.close(wsCloseProtocol, "unexpected continuation frame")
+				return
+			}
+			message = append(message, f.payload...)
+		default:
+			c.close(wsCloseProtocol, "unknown opcode")
+			return
+		}
+		if !f.fin {
+			continue
+		}
+
+		payload, err := h.codec.Unmarshal(message)
+		message = nil
+		if err != nil {
+			c.close(wsCloseInvalidData, "message cannot be decoded")
+			return
+		}
+
+		msg := NewMessageContext(ctx, payload)
+		msg.Meta = map[string]string{
+			MetaWebSocketConn:   c.id,
+			MetaWebSocketRemote: c.remote,
+		}
+		if err := sendTo(ctx, h.srv, msg); err != nil {
+			c.close(wsCloseGoingAway, "service stopped")
+			return
+		}
+	}
+}
+
+type wsConn struct {
+	sync.Mutex
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+	id      string
+	remote  string
+	timeout time.Duration
+	closed  bool
+}
+
+// write sends a frame to the client, unless the close frame has already been sent. The connection
+// cannot be written to anymore once a write failed, since the frame may have been partially sent.
+func (c *wsConn) write(opcode byte, payload []byte) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	c.setWriteDeadline()
+	err := writeWSFrame(c.rw.Writer, opcode, payload, nil)
+	if err == nil {
+		err = c.rw.Flush()
+	}
+	if err != nil {
+		c.closed = true
+	}
+	return err
+}
+
+// setWriteDeadline bounds the time permitted for the next write.
+func (c *wsConn) setWriteDeadline() {
+	if c.timeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+}
+
+// close sends the close frame with the status code, when it has not already been sent.
+func (c *wsConn) close(code int, reason string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	c.setWriteDeadline()
+	if err := writeWSFrame(c.rw.Writer, wsClose, payload, nil); err == nil {
+		_ = c.rw.Flush()
+	}
+}
+
+// await waits for the client to answer the close frame, and gives up after a short time.
+func (c *wsConn) await(finished <-chan struct{}) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsCloseTimeout))
+	<-finished
+}
+
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	masked  bool
+	payload []byte
+}
+
+// readWSFrame reads a frame and unmasks its payload. The frames with a payload larger than the
+// limit are not read.
+func readWSFrame(r io.Reader, limit int) (*wsFrame, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	f := &wsFrame{
+		fin:    hdr[0]&0x80 != 0,
+		opcode: hdr[0] & 0x0f,
+		masked: hdr[1]&0x80 != 0,
+	}
+	if hdr[0]&0x70 != 0 {
+		return nil, fmt.Errorf("%w: reserved bits are set", errWSProtocol)
+	}
+
+	size := uint64(hdr[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if f.opcode >= wsClose && (size > 125 || !f.fin) {
+		return nil, fmt.Errorf("%w: invalid control frame", errWSProtocol)
+	}
+	if f.opcode < wsClose && size > uint64(limit) {
+		return nil, errWSTooBig
+	}
+
+	var mask [4]byte
+	if f.masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	f.payload = make([]byte, size)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return nil, err
+	}
+	if f.masked {
+		for i := range f.payload {
+			f.payload[i] ^= mask[i%4]
+		}
+	}
+	return f, nil
+}
+
+// writeWSFrame writes a final frame with the payload, which is masked when the mask is provided.
+func writeWSFrame(w io.Writer, opcode byte, payload, mask []byte) error {
+	hdr := []byte{0x80 | opcode, 0}
+
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+
+	if mask != nil {
+		hdr[1] |= 0x80
+		hdr = append(hdr, mask...)
+
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ mask[i%4]
+		}
+		payload = masked
+	}
+
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// wsAccept returns the value of the Sec-WebSocket-Accept header for the key of the client.
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains reports whether the header has the token in its comma-separated values.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+// Copyright © by Jeff Foley 2020-2023. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// connEchoService sends the payload of each message with the connection it was received on.
+type connEchoService struct {
+	BaseService
+}
+
+func (s *connEchoService) OnStart() error {
+	go func() {
+		for {
+			select {
+			case <-s.Done():
+				return
+			case req := <-s.Input():
+				msg := req.(*Message)
+				s.Output() <- msg.Payload.(string) + "@" + msg.Meta[MetaWebSocketConn]
+			}
+		}
+	}()
+	return nil
+}
+
+type wsClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, server *httptest.Server) *wsClient {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("Failed to send the handshake: %v", err)
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatalf("Failed to read the handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected the connection to be upgraded, received %d", resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected the accept value of RFC 6455, received %q", accept)
+	}
+	return &wsClient{conn: conn, r: r}
+}
+
+func (c *wsClient) send(t *testing.T, opcode byte, payload string) {
+	if err := writeWSFrame(c.conn, opcode, []byte(payload), []byte{1, 2, 3, 4}); err != nil {
+		t.Fatalf("Failed to send the frame: %v", err)
+	}
+}
+
+// sendFragment sends a frame that is not final, with a payload shorter than 126 bytes.
+func (c *wsClient) sendFragment(t *testing.T, opcode byte, payload string) {
+	key := []byte{1, 2, 3, 4}
+	frame := append([]byte{opcode, 0x80 | byte(len(payload))}, key...)
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^key[i%4])
+	}
+
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatalf("Failed to send the frame: %v", err)
+	}
+}
+
+func (c *wsClient) receive(t *testing.T) *wsFrame {
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	f, err := readWSFrame(c.r, DefaultMaxFrameSize)
+	if err != nil {
+		t.Fatalf("Failed to receive a frame: %v", err)
+	}
+	if f.masked {
+		t.Errorf("Expected the frames of the server to be unmasked")
+	}
+	return f
+}
+
+func (c *wsClient) expectClose(t *testing.T, code int) {
+	f := c.receive(t)
+
+	if f.opcode != wsClose || len(f.payload) < 2 {
+		t.Fatalf("Expected a close frame, received opcode %d %q", f.opcode, f.payload)
+	}
+	if got := int(binary.BigEndian.Uint16(f.payload)); got != code {
+		t.Errorf("Expected the close status %d, received %d", code, got)
+	}
+}
+
+func newWebSocketServer(t *testing.T, opts ...WebSocketOption) (*connEchoService, *httptest.Server) {
+	srv := new(connEchoService)
+	srv.Init(srv, "ConnEcho")
+	_ = srv.Start()
+
+	server := httptest.NewServer(NewWebSocketHandler(srv, JSONCodec[string](), opts...))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { _ = srv.Stop() })
+	return srv, server
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	_, server := newWebSocketServer(t)
+	a := dialWebSocket(t, server)
+	b := dialWebSocket(t, server)
+
+	a.send(t, wsText, `"hello"`)
+	for _, c := range []*wsClient{a, b} {
+		f := c.receive(t)
+		if f.opcode != wsText || !strings.HasPrefix(string(f.payload), `"hello@`) {
+			t.Errorf("Expected the result in a text frame, received opcode %d %q", f.opcode, f.payload)
+		}
+	}
+
+	a.send(t, wsPing, "ping")
+	if f := a.receive(t); f.opcode != wsPong || string(f.payload) != "ping" {
+		t.Errorf("Expected the ping to be answered, received opcode %d %q", f.opcode, f.payload)
+	}
+
+	// A message sent in two frames is received as a single message
+	b.sendFragment(t, wsText, `"ab`)
+	b.send(t, wsContinuation, `c"`)
+	for _, c := range []*wsClient{a, b} {
+		if f := c.receive(t); !strings.HasPrefix(string(f.payload), `"abc@`) {
+			t.Errorf("Expected the fragmented message to be reassembled, received %q", f.payload)
+		}
+	}
+
+	a.send(t, wsClose, string(binary.BigEndian.AppendUint16(nil, wsCloseNormal)))
+	a.expectClose(t, wsCloseNormal)
+}
+
+func TestWebSocketHandlerStop(t *testing.T) {
+	srv, server := newWebSocketServer(t)
+	c := dialWebSocket(t, server)
+
+	// The connection is subscribed once the first result is received
+	c.send(t, wsText, `"a"`)
+	_ = c.receive(t)
+
+	_ = srv.Stop()
+	c.expectClose(t, wsCloseGoingAway)
+}
+
+func TestWebSocketHandlerProtocolErrors(t *testing.T) {
+	_, server := newWebSocketServer(t, WithMaxFrameSize(8))
+
+	c := dialWebSocket(t, server)
+	if err := writeWSFrame(c.conn, wsText, []byte(`"a"`), nil); err != nil {
+		t.Fatal(err)
+	}
+	c.expectClose(t, wsCloseProtocol)
+
+	c = dialWebSocket(t, server)
+	c.send(t, wsText, `"too long for the limit"`)
+	c.expectClose(t, wsCloseTooBig)
+
+	c = dialWebSocket(t, server)
+	c.send(t, wsText, `{`)
+	c.expectClose(t, wsCloseInvalidData)
+}
+
+func TestWebSocketHandlerRejects(t *testing.T) {
+	srv := new(connEchoService)
+	srv.Init(srv, "ConnEcho")
+	h := NewWebSocketHandler(srv, JSONCodec[string]())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a request without the upgrade, received %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the service is started, received %d", rec.Code)
+	}
+
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUpgradeRequired || rec.Header().Get("Sec-WebSocket-Version") != "13" {
+		t.Errorf("Expected 426 for an unsupported version, received %d", rec.Code)
+	}
+}
+
+// floodService sends large results until it is stopped.
+type floodService struct {
+	BaseService
+}
+
+func (s *floodService) OnStart() error {
+	result := strings.Repeat("a", 64<<10)
+
+	go func() {
+		for {
+			select {
+			case <-s.Done():
+				return
+			case s.Output() <- result:
+			}
+		}
+	}()
+	return nil
+}
+
+func TestWebSocketHandlerWriteTimeout(t *testing.T) {
+	srv := new(floodService)
+	srv.Init(srv, "Flood")
+	_ = srv.Start()
+	t.Cleanup(func() { _ = srv.Stop() })
+
+	returned := make(chan struct{})
+	h := NewWebSocketHandler(srv, JSONCodec[string](), WithWebSocketWriteTimeout(50*time.Millisecond))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		close(returned)
+	}))
+	t.Cleanup(server.Close)
+
+	// The client never reads the results
+	_ = dialWebSocket(t, server)
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("The handler is still blocked on the client that stopped reading")
+	}
+}